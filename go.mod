@@ -16,4 +16,5 @@ require (
 	k8s.io/client-go v0.20.4
 	k8s.io/kubectl v0.20.4
 	k8s.io/metrics v0.20.4
+	sigs.k8s.io/yaml v1.2.0
 )
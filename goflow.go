@@ -1,23 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"goflow/internal/cli"
 	"goflow/internal/config"
 	"goflow/internal/dag/metrics"
 	"goflow/internal/dag/orchestrator"
-	"goflow/internal/k8s/client"
-	"goflow/internal/k8s/pod/utils"
 	"goflow/internal/logs"
 	"goflow/internal/paths"
 	"goflow/internal/rest"
 	"goflow/internal/termination"
 	"goflow/internal/testutils"
 	"io/ioutil"
+	"os"
+	"strings"
 	"time"
 
 	core "k8s.io/api/core/v1"
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -25,45 +29,96 @@ var host string
 var port int
 
 func main() {
-	configPath := flag.String(
+	args := os.Args[1:]
+	switch {
+	case len(args) > 0 && args[0] == "server":
+		runServer(args[1:])
+	// Flags without a command start the server, as before there were commands
+	case len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help":
+		runServer(args)
+	default:
+		logs.InfoLogger.SetOutput(ioutil.Discard)
+		os.Exit(cli.Main(args, os.Stdout, os.Stderr))
+	}
+}
+
+// runServer runs the orchestrator and REST server until the program is terminated
+func runServer(args []string) {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	configPath := flags.String(
 		"path",
 		paths.GetGoDefaultHomePath(),
 		"The path to the configuration file",
 	)
-	host := flag.String("host", "localhost", "Host IP to serve REST api on")
-	port := flag.Int("port", 8080, "Port to serve REST API on")
-	verbosePtr := flag.Bool("V", false, "Verbose logging")
-	testMode := flag.Bool("T", false, "Uses test mode which leverage a mocked kubernetes client")
-	flag.Parse()
+	host := flags.String("host", "localhost", "Host IP to serve REST api on")
+	port := flags.Int("port", 8080, "Port to serve REST API on")
+	verbosePtr := flags.Bool("V", false, "Verbose logging")
+	testMode := flags.Bool("T", false, "Uses test mode which leverage a mocked kubernetes client")
+	localMode := flags.Bool(
+		"local",
+		false,
+		"Runs DAGs as local processes by default, with a mocked kubernetes client",
+	)
+	flags.Parse(args)
 
 	if !*verbosePtr {
 		logs.InfoLogger.SetOutput(ioutil.Discard)
 	}
 
 	var orch *orchestrator.Orchestrator
-	if *testMode {
+	if *testMode || *localMode {
 		kubeClient := fake.NewSimpleClientset()
 		kubeClient.Tracker().Add(&core.Namespace{
 			ObjectMeta: v1.ObjectMeta{
 				Name: "default",
 			},
 		})
-		testutils.RegisterContainerStatusesToPods(kubeClient)
-		config := config.CreateConfig(*configPath)
-		config.DAGsOn = true
+		goflowConfig := config.CreateConfig(*configPath)
+		if *testMode {
+			testutils.RegisterContainerStatusesToPods(kubeClient)
+			goflowConfig.DAGsOn = true
+		}
+		if *localMode {
+			goflowConfig.DefaultExecutor = config.ExecutorLocal
+		}
 		orch = orchestrator.NewOrchestratorFromClientsAndConfig(
 			kubeClient,
-			config,
+			dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+			goflowConfig,
 			metrics.NewDAGMetricsClient(kubeClient, true),
 		)
+		for name := range goflowConfig.Clusters {
+			clusterClient := fake.NewSimpleClientset()
+			if *testMode {
+				testutils.RegisterContainerStatusesToPods(clusterClient)
+			}
+			orch.AddCluster(
+				name,
+				clusterClient,
+				dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+				metrics.NewDAGMetricsClient(clusterClient, true),
+			)
+		}
 	} else {
-		defer utils.CleanUpEnvironment(client.CreateKubeClient())
 		orch = orchestrator.NewOrchestrator(*configPath)
 	}
+	ctx := termination.Context(context.Background())
 	orch.Start(1 * time.Second)
-	go termination.Handle(func() {
-		orch.Stop()
-	})
-	go rest.Serve(*host, *port, orch)
-	orch.Wait()
+	serveErrors := make(chan error, 1)
+	go func() { serveErrors <- rest.Serve(ctx, *host, *port, orch) }()
+	select {
+	case <-ctx.Done():
+		err := <-serveErrors
+		if err != nil {
+			logs.ErrorLogger.Printf("REST server did not shut down cleanly: %s", err.Error())
+		}
+	case err := <-serveErrors:
+		logs.ErrorLogger.Printf("REST server stopped: %s", err.Error())
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), orch.Config().ShutdownTimeout())
+	defer cancel()
+	err := orch.Shutdown(shutdownCtx)
+	if err != nil {
+		logs.ErrorLogger.Println(err.Error())
+	}
 }
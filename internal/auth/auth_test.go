@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"goflow/internal/config"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tempDir string
+var rsaKey *rsa.PrivateKey
+var ecKey *ecdsa.PrivateKey
+var jwtAuthenticator *JWTAuthenticator
+
+func encodeInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func writeJSON(fileName string, value interface{}) string {
+	filePath := filepath.Join(tempDir, fileName)
+	fileBytes, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(filePath, fileBytes, 0644)
+	if err != nil {
+		panic(err)
+	}
+	return filePath
+}
+
+func TestMain(m *testing.M) {
+	var err error
+	tempDir, err = ioutil.TempDir("", "goflow-auth")
+	if err != nil {
+		panic(err)
+	}
+	rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	jwksFile := writeJSON("jwks.json", map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa-key",
+				"n":   encodeInt(rsaKey.N),
+				"e":   encodeInt(big.NewInt(int64(rsaKey.E))),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec-key",
+				"crv": "P-256",
+				"x":   encodeInt(ecKey.X),
+				"y":   encodeInt(ecKey.Y),
+			},
+		},
+	})
+	jwtAuthenticator, err = NewJWTAuthenticator(config.OIDCConfig{
+		Issuer:   "https://issuer.example.com",
+		Audience: "goflow",
+		JWKSFile: jwksFile,
+	})
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(tempDir)
+	os.Exit(code)
+}
+
+func signJWT(algorithm string, kid string, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		valueBytes, err := json.Marshal(value)
+		if err != nil {
+			panic(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(valueBytes)
+	}
+	signed := encode(map[string]string{"alg": algorithm, "kid": kid, "typ": "JWT"}) +
+		"." + encode(claims)
+	digest := jwtHashes[algorithm].New()
+	digest.Write([]byte(signed))
+	var signature []byte
+	var err error
+	if strings.HasPrefix(algorithm, "RS") {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, jwtHashes[algorithm], digest.Sum(nil))
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest.Sum(nil))
+		if err != nil {
+			panic(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":    "alice",
+		"iss":    "https://issuer.example.com",
+		"aud":    []string{"other", "goflow"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"data-team"},
+	}
+}
+
+func requestWithHeader(value string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/dags", nil)
+	if value != "" {
+		request.Header.Set("Authorization", value)
+	}
+	return request
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "other"
+	tampered := signJWT("RS256", "rsa-key", validClaims())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	cases := []struct {
+		name      string
+		token     string
+		expectErr bool
+	}{
+		{"RSA", signJWT("RS256", "rsa-key", validClaims()), false},
+		{"EC", signJWT("ES256", "ec-key", validClaims()), false},
+		{"expired", signJWT("RS256", "rsa-key", expired), true},
+		{"wrong audience", signJWT("RS256", "rsa-key", wrongAudience), true},
+		{"unknown key", signJWT("RS256", "missing-key", validClaims()), true},
+		{"algorithm mismatch", signJWT("RS256", "ec-key", validClaims()), true},
+		{"tampered", tampered, true},
+	}
+	for _, testCase := range cases {
+		principal, err := jwtAuthenticator.Authenticate(requestWithHeader("Bearer " + testCase.token))
+		if testCase.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected JWT to be rejected", testCase.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected JWT to be accepted, found %s", testCase.name, err.Error())
+			continue
+		}
+		if principal.Name != "alice" || len(principal.Groups) != 1 || principal.Groups[0] != "data-team" {
+			t.Errorf("%s: unexpected principal %+v", testCase.name, principal)
+		}
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	authenticator, err := NewTokenAuthenticator([]config.TokenConfig{
+		{Name: "ci", SHA256: HashToken("secret-token"), Groups: []string{"ci"}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	principal, err := authenticator.Authenticate(requestWithHeader("Bearer secret-token"))
+	if err != nil || principal.Name != "ci" {
+		t.Errorf("Expected token to authenticate as ci, found %+v, %v", principal, err)
+	}
+	_, err = authenticator.Authenticate(requestWithHeader("Bearer wrong-token"))
+	if err != ErrInvalidCredentials {
+		t.Errorf("Expected wrong token to be rejected, found %v", err)
+	}
+	principal, err = authenticator.Authenticate(requestWithHeader(""))
+	if principal != nil || err != nil {
+		t.Errorf("Expected request without a token to be passed on")
+	}
+	_, err = NewTokenAuthenticator([]config.TokenConfig{{Name: "plain", SHA256: "secret-token"}})
+	if err == nil {
+		t.Errorf("Expected a token without a valid hash to be rejected")
+	}
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	userFile := writeJSON("users.json", []User{
+		{"bob", encodePasswordHash("hunter2", []byte("salt"), 10), []string{"ops"}},
+	})
+	authenticator, err := NewBasicAuthenticator(userFile)
+	if err != nil {
+		panic(err)
+	}
+	request := requestWithHeader("")
+	request.SetBasicAuth("bob", "hunter2")
+	principal, err := authenticator.Authenticate(request)
+	if err != nil || principal.Name != "bob" || principal.Groups[0] != "ops" {
+		t.Errorf("Expected bob to be authenticated, found %+v, %v", principal, err)
+	}
+	request.SetBasicAuth("bob", "wrong")
+	_, err = authenticator.Authenticate(request)
+	if err != ErrInvalidCredentials {
+		t.Errorf("Expected wrong password to be rejected, found %v", err)
+	}
+	request.SetBasicAuth("mallory", "hunter2")
+	_, err = authenticator.Authenticate(request)
+	if err != ErrInvalidCredentials {
+		t.Errorf("Expected unknown user to be rejected, found %v", err)
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	// RFC 7914 test vector for PBKDF2-HMAC-SHA256
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if encoded := hex.EncodeToString(key); encoded != expected {
+		t.Errorf("Expected key %s, found %s", expected, encoded)
+	}
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		panic(err)
+	}
+	if !checkPassword("correct horse", hash) || checkPassword("wrong horse", hash) {
+		t.Errorf("Password hash %s does not verify correctly", hash)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := NewPolicy([]config.RoleBinding{
+		{Role: "viewer", Users: []string{"*"}},
+		{Role: "operator", Groups: []string{"data-team"}, Namespaces: []string{"data"}},
+		{Role: "admin", Users: []string{"alice"}, DAGs: []string{"etl"}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	alice := &Principal{Name: "alice", Groups: []string{"data-team"}}
+	bob := &Principal{Name: "bob"}
+	etl := Resource{DAG: "etl", Namespace: "default"}
+	report := Resource{DAG: "report", Namespace: "data"}
+	cases := []struct {
+		principal *Principal
+		role      Role
+		resource  Resource
+		expected  bool
+	}{
+		{bob, Viewer, etl, true},
+		{bob, Operator, report, false},
+		{alice, Operator, report, true},
+		{alice, Admin, report, false},
+		{alice, Admin, etl, true},
+	}
+	for _, testCase := range cases {
+		allowed := policy.Allowed(testCase.principal, testCase.role, testCase.resource)
+		if allowed != testCase.expected {
+			t.Errorf(
+				"Expected %s as %s on %+v to be allowed: %t",
+				testCase.principal.Name,
+				testCase.role,
+				testCase.resource,
+				testCase.expected,
+			)
+		}
+	}
+	if policy.AllowedAnywhere(bob, Operator) || !policy.AllowedAnywhere(alice, Admin) {
+		t.Errorf("Unexpected result for roles held on any resource")
+	}
+	_, err = NewPolicy([]config.RoleBinding{{Role: "superuser"}})
+	if err == nil {
+		t.Errorf("Expected unknown role to be rejected")
+	}
+}
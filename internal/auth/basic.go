@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"goflow/internal/logs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// passwordIterations is the number of PBKDF2 iterations used by HashPassword
+const passwordIterations = 310000
+
+const passwordScheme = "pbkdf2-sha256"
+
+// User is an entry of the basic authentication user file
+// PasswordHash has the form pbkdf2-sha256$<iterations>$<base64 salt>$<base64 key>
+type User struct {
+	Username     string
+	PasswordHash string
+	Groups       []string
+}
+
+// pbkdf2 derives a key of the given length from a password using HMAC-SHA256
+func pbkdf2(password, salt []byte, iterations, keyLength int) []byte {
+	mac := hmac.New(sha256.New, password)
+	key := make([]byte, 0, keyLength)
+	blockIndex := make([]byte, 4)
+	for block := uint32(1); len(key) < keyLength; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.BigEndian.PutUint32(blockIndex, block)
+		mac.Write(blockIndex)
+		u := mac.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
+
+func encodePasswordHash(password string, salt []byte, iterations int) string {
+	key := pbkdf2([]byte(password), salt, iterations, sha256.Size)
+	return strings.Join([]string{
+		passwordScheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$")
+}
+
+// HashPassword returns the password hash to store in the user file for a password
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	return encodePasswordHash(password, salt, passwordIterations), nil
+}
+
+// checkPassword returns true if the password matches the stored password hash
+func checkPassword(password string, passwordHash string) bool {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	storedKey, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(storedKey) == 0 {
+		return false
+	}
+	key := pbkdf2([]byte(password), salt, iterations, len(storedKey))
+	return subtle.ConstantTimeCompare(key, storedKey) == 1
+}
+
+// BasicAuthenticator authenticates requests using HTTP basic authentication against a user file
+// The file is reloaded when it changes
+type BasicAuthenticator struct {
+	path    string
+	lock    *sync.Mutex
+	modTime time.Time
+	users   map[string]User
+}
+
+// NewBasicAuthenticator returns an authenticator for the users in the given JSON file
+func NewBasicAuthenticator(path string) (*BasicAuthenticator, error) {
+	authenticator := &BasicAuthenticator{path: path, lock: &sync.Mutex{}}
+	_, err := authenticator.currentUsers()
+	if err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+// currentUsers returns the users of the file, reloading it if it was modified
+func (authenticator *BasicAuthenticator) currentUsers() (map[string]User, error) {
+	authenticator.lock.Lock()
+	defer authenticator.lock.Unlock()
+	info, err := os.Stat(authenticator.path)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator.users != nil && info.ModTime().Equal(authenticator.modTime) {
+		return authenticator.users, nil
+	}
+	fileBytes, err := ioutil.ReadFile(authenticator.path)
+	if err != nil {
+		return nil, err
+	}
+	userList := make([]User, 0)
+	err = json.Unmarshal(fileBytes, &userList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user file %s: %s", authenticator.path, err.Error())
+	}
+	users := make(map[string]User, len(userList))
+	for _, user := range userList {
+		users[user.Username] = user
+	}
+	authenticator.users = users
+	authenticator.modTime = info.ModTime()
+	return users, nil
+}
+
+// Authenticate returns the principal of a user with valid basic credentials
+func (authenticator *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	users, err := authenticator.currentUsers()
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not load user file: %s", err.Error())
+		return nil, ErrInvalidCredentials
+	}
+	user, ok := users[username]
+	if !ok || !checkPassword(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{user.Username, user.Groups, "basic"}, nil
+}
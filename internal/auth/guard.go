@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"goflow/internal/config"
+	"goflow/internal/jsonpanic"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCredentials is returned when a request carries credentials that cannot be verified
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator verifies the credentials of a request
+// It returns a nil principal and no error if the request holds no credentials it handles
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// ErrorWriter writes the response to a request the guard rejected
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// writeError writes the error message as a JSON string
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.WriteHeader(status)
+	fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+}
+
+// Guard authenticates requests with a chain of authenticators and authorizes them with a policy
+type Guard struct {
+	authenticators []Authenticator
+	policy         *Policy
+	errorWriter    ErrorWriter
+}
+
+// NewGuard returns a guard trying each authenticator in order
+func NewGuard(policy *Policy, authenticators ...Authenticator) *Guard {
+	return &Guard{authenticators, policy, writeError}
+}
+
+// SetErrorWriter sets how the responses to rejected requests are written
+func (guard *Guard) SetErrorWriter(errorWriter ErrorWriter) {
+	guard.errorWriter = errorWriter
+}
+
+// New returns a guard for the configured authentication methods and role bindings
+func New(authConfig config.AuthConfig) (*Guard, error) {
+	policy, err := NewPolicy(authConfig.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	authenticators := make([]Authenticator, 0)
+	if len(authConfig.Tokens) > 0 {
+		tokenAuthenticator, err := NewTokenAuthenticator(authConfig.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokenAuthenticator)
+	}
+	if authConfig.UserFile != "" {
+		basicAuthenticator, err := NewBasicAuthenticator(authConfig.UserFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, basicAuthenticator)
+	}
+	if authConfig.OIDC != nil {
+		jwtAuthenticator, err := NewJWTAuthenticator(*authConfig.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+	return NewGuard(policy, authenticators...), nil
+}
+
+// Authenticate returns the principal of the first authenticator accepting the request
+func (guard *Guard) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range guard.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if principal != nil {
+			return principal, nil
+		}
+	}
+	if r.Header.Get("Authorization") != "" {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, errors.New("authentication required")
+}
+
+// Middleware rejects unauthenticated requests and stores the principal in the request context
+// Preflight OPTIONS requests are passed on without credentials
+func (guard *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, err := guard.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goflow", Basic realm="goflow"`)
+			guard.errorWriter(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAccess(r.Context(), principal, guard.policy)))
+	})
+}
+
+// bearerToken returns the bearer token of a request, or an empty string if there is none
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
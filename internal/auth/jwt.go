@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goflow/internal/config"
+	"goflow/internal/logs"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is the tolerance applied to the time based claims of a JWT
+const clockSkew = time.Minute
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// jsonWebKey is a single key of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	valueBytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(valueBytes), nil
+}
+
+// publicKey returns the RSA or ECDSA public key described by the JWK
+func (key jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		modulus, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if !exponent.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent for key %s", key.Kid)
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+		curve, ok := curves[key.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s for key %s", key.Crv, key.Kid)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point of key %s is not on curve %s", key.Kid, key.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s for key %s", key.Kty, key.Kid)
+	}
+}
+
+// JWTAuthenticator authenticates requests holding a JWT signed by a key of a JWKS file
+// The file is reloaded when it changes so keys can be rotated without a restart
+type JWTAuthenticator struct {
+	config  config.OIDCConfig
+	lock    *sync.Mutex
+	modTime time.Time
+	keys    map[string]crypto.PublicKey
+}
+
+// NewJWTAuthenticator returns an authenticator for JWTs issued by the configured provider
+func NewJWTAuthenticator(oidcConfig config.OIDCConfig) (*JWTAuthenticator, error) {
+	if oidcConfig.JWKSFile == "" {
+		return nil, errors.New("OIDC authentication requires a JWKS file")
+	}
+	if oidcConfig.UsernameClaim == "" {
+		oidcConfig.UsernameClaim = "sub"
+	}
+	if oidcConfig.GroupsClaim == "" {
+		oidcConfig.GroupsClaim = "groups"
+	}
+	authenticator := &JWTAuthenticator{config: oidcConfig, lock: &sync.Mutex{}}
+	_, err := authenticator.currentKeys()
+	if err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+// currentKeys returns the keys of the JWKS file, reloading it if it was modified
+func (authenticator *JWTAuthenticator) currentKeys() (map[string]crypto.PublicKey, error) {
+	authenticator.lock.Lock()
+	defer authenticator.lock.Unlock()
+	info, err := os.Stat(authenticator.config.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator.keys != nil && info.ModTime().Equal(authenticator.modTime) {
+		return authenticator.keys, nil
+	}
+	fileBytes, err := ioutil.ReadFile(authenticator.config.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	document := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	err = json.Unmarshal(fileBytes, &document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %s: %s", authenticator.config.JWKSFile, err.Error())
+	}
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, key := range document.Keys {
+		publicKey, err := key.publicKey()
+		if err != nil {
+			logs.WarningLogger.Printf("Skipping JWKS key: %s", err.Error())
+			continue
+		}
+		keys[key.Kid] = publicKey
+	}
+	authenticator.keys = keys
+	authenticator.modTime = info.ModTime()
+	return keys, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	segmentBytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(segmentBytes, target)
+}
+
+// verifySignature checks the signature of the signed part of a JWT
+func verifySignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) error {
+	hashType, ok := jwtHashes[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported JWT algorithm %s", algorithm)
+	}
+	hasher := hashType.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "RS") {
+			return errors.New("JWT algorithm does not match an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(publicKey, hashType, digest, signature)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "ES") {
+			return errors.New("JWT algorithm does not match an EC key")
+		}
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid EC signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return errors.New("invalid EC signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key type")
+	}
+}
+
+// audienceMatches returns true if the aud claim, a string or list of strings, holds the audience
+func audienceMatches(claim interface{}, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, entry := range value {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// validateClaims checks the expiry, issuer and audience of a JWT
+func (authenticator *JWTAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	expiry, ok := numericClaim(claims, "exp")
+	if !ok {
+		return errors.New("JWT has no expiry")
+	}
+	if now.After(expiry.Add(clockSkew)) {
+		return errors.New("JWT has expired")
+	}
+	if notBefore, ok := numericClaim(claims, "nbf"); ok && now.Add(clockSkew).Before(notBefore) {
+		return errors.New("JWT is not valid yet")
+	}
+	if authenticator.config.Issuer != "" && claims["iss"] != authenticator.config.Issuer {
+		return errors.New("JWT has an unexpected issuer")
+	}
+	if authenticator.config.Audience != "" && !audienceMatches(claims["aud"], authenticator.config.Audience) {
+		return errors.New("JWT has an unexpected audience")
+	}
+	return nil
+}
+
+// verify returns the claims of a JWT with a valid signature and claims
+func (authenticator *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	err := decodeSegment(segments[0], &header)
+	if err != nil {
+		return nil, errors.New("malformed JWT header")
+	}
+	keys, err := authenticator.currentKeys()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown JWT key %s", header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, errors.New("malformed JWT signature")
+	}
+	err = verifySignature(header.Alg, key, segments[0]+"."+segments[1], signature)
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	err = decodeSegment(segments[1], &claims)
+	if err != nil {
+		return nil, errors.New("malformed JWT claims")
+	}
+	return claims, authenticator.validateClaims(claims)
+}
+
+// Authenticate returns the principal named by the username claim of a valid JWT
+func (authenticator *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+	claims, err := authenticator.verify(token)
+	if err != nil {
+		logs.InfoLogger.Printf("Rejected JWT: %s", err.Error())
+		return nil, ErrInvalidCredentials
+	}
+	name, ok := claims[authenticator.config.UsernameClaim].(string)
+	if !ok || name == "" {
+		return nil, ErrInvalidCredentials
+	}
+	groups := make([]string, 0)
+	if groupClaims, ok := claims[authenticator.config.GroupsClaim].([]interface{}); ok {
+		for _, group := range groupClaims {
+			if groupName, ok := group.(string); ok {
+				groups = append(groups, groupName)
+			}
+		}
+	}
+	return &Principal{name, groups, "jwt"}, nil
+}
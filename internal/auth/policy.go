@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"fmt"
+	"goflow/internal/config"
+	"strings"
+)
+
+// Role is a level of access to DAGs, each role includes the permissions of the roles below it
+type Role int
+
+const (
+	// Viewer can read DAGs, runs, metrics and logs
+	Viewer Role = iota + 1
+	// Operator can also toggle DAGs on and off
+	Operator
+	// Admin can also create and modify DAG definitions
+	Admin
+)
+
+var roleNames = map[Role]string{
+	Viewer:   "viewer",
+	Operator: "operator",
+	Admin:    "admin",
+}
+
+func (role Role) String() string {
+	name, ok := roleNames[role]
+	if !ok {
+		return fmt.Sprintf("Role(%d)", int(role))
+	}
+	return name
+}
+
+// ParseRole returns the role with the given name
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(name, roleName) {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role \"%s\"", name)
+}
+
+// Resource identifies the DAG a request acts on
+// An empty resource is used for requests that do not act on a single DAG
+type Resource struct {
+	DAG       string
+	Namespace string
+}
+
+// binding is a parsed role binding
+type binding struct {
+	role       Role
+	users      map[string]bool
+	groups     map[string]bool
+	dags       map[string]bool
+	namespaces map[string]bool
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func (currentBinding binding) appliesTo(principal *Principal) bool {
+	if currentBinding.users[principal.Name] || currentBinding.users["*"] {
+		return true
+	}
+	for _, group := range principal.Groups {
+		if currentBinding.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+func (currentBinding binding) isGlobal() bool {
+	return len(currentBinding.dags) == 0 && len(currentBinding.namespaces) == 0
+}
+
+func (currentBinding binding) covers(resource Resource) bool {
+	if currentBinding.isGlobal() {
+		return true
+	}
+	return (resource.DAG != "" && currentBinding.dags[resource.DAG]) ||
+		(resource.Namespace != "" && currentBinding.namespaces[resource.Namespace])
+}
+
+// Policy decides which roles principals hold for each resource
+type Policy struct {
+	bindings []binding
+}
+
+// NewPolicy returns a policy from the configured role bindings
+func NewPolicy(roleBindings []config.RoleBinding) (*Policy, error) {
+	bindings := make([]binding, 0, len(roleBindings))
+	for _, roleBinding := range roleBindings {
+		role, err := ParseRole(roleBinding.Role)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding{
+			role,
+			toSet(roleBinding.Users),
+			toSet(roleBinding.Groups),
+			toSet(roleBinding.DAGs),
+			toSet(roleBinding.Namespaces),
+		})
+	}
+	return &Policy{bindings}, nil
+}
+
+// Allowed returns true if the principal holds at least the given role for the resource
+func (policy *Policy) Allowed(principal *Principal, role Role, resource Resource) bool {
+	for _, currentBinding := range policy.bindings {
+		if currentBinding.role >= role &&
+			currentBinding.appliesTo(principal) &&
+			currentBinding.covers(resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedAnywhere returns true if the principal holds at least the given role for any resource
+func (policy *Policy) AllowedAnywhere(principal *Principal, role Role) bool {
+	for _, currentBinding := range policy.bindings {
+		if currentBinding.role >= role && currentBinding.appliesTo(principal) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package auth
+
+import "context"
+
+// Principal is an authenticated user or API client
+type Principal struct {
+	Name   string
+	Groups []string
+	Method string
+}
+
+type contextKey int
+
+const accessKey contextKey = iota
+
+// access holds the principal of a request along with the policy used to authorize it
+type access struct {
+	principal *Principal
+	policy    *Policy
+}
+
+func withAccess(ctx context.Context, principal *Principal, policy *Policy) context.Context {
+	return context.WithValue(ctx, accessKey, access{principal, policy})
+}
+
+func accessFromContext(ctx context.Context) (access, bool) {
+	currentAccess, ok := ctx.Value(accessKey).(access)
+	return currentAccess, ok
+}
+
+// PrincipalFromContext returns the authenticated principal of a request, or nil if
+// authentication is disabled
+func PrincipalFromContext(ctx context.Context) *Principal {
+	currentAccess, ok := accessFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return currentAccess.principal
+}
+
+// Allowed returns true if the principal of a request holds at least the given role for the
+// resource. All requests are allowed when authentication is disabled
+func Allowed(ctx context.Context, role Role, resource Resource) bool {
+	currentAccess, ok := accessFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return currentAccess.policy.Allowed(currentAccess.principal, role, resource)
+}
+
+// AllowedAnywhere returns true if the principal of a request holds at least the given role
+// for any resource. All requests are allowed when authentication is disabled
+func AllowedAnywhere(ctx context.Context, role Role) bool {
+	currentAccess, ok := accessFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return currentAccess.policy.AllowedAnywhere(currentAccess.principal, role)
+}
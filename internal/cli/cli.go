@@ -0,0 +1,245 @@
+// Package cli implements the goflow command-line client, which operates a goflow server through
+// its REST API
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of the commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputJUnit = "junit"
+	outputYAML  = "yaml"
+)
+
+// defaultServer is the server the client talks to unless configured otherwise
+const defaultServer = "http://localhost:8080"
+
+// errUsage is returned when a command is called with invalid arguments, the usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// errFailed is returned when a command has already reported why it failed
+var errFailed = errors.New("command failed")
+
+// options are the flags shared by all commands
+type options struct {
+	server   string
+	token    string
+	user     string
+	password string
+	output   string
+}
+
+// environment holds the output streams and shared options of a command
+// formats are the output formats supported by the command
+type environment struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	options options
+	formats []string
+}
+
+// command is a subcommand of the client
+type command struct {
+	summary string
+	run     func(env *environment, args []string) error
+}
+
+// commandGroups maps the command groups to their subcommands
+var commandGroups = map[string]map[string]command{
+	"dags": {
+		"list":     {"List DAGs", listDAGs},
+		"show":     {"Show a DAG", showDAG},
+		"pause":    {"Turn a DAG off", func(env *environment, args []string) error { return setDAGOn(env, args, false) }},
+		"unpause":  {"Turn a DAG on", func(env *environment, args []string) error { return setDAGOn(env, args, true) }},
+		"trigger":  {"Start a manually triggered run of a DAG", triggerDAG},
+		"render":   {"Print the pod, Job or process a run of a DAG would create, without creating it", renderDAG},
+		"validate": {"Same as validate", validateDAGs},
+	},
+	"runs": {
+		"list":   {"List runs", listRuns},
+		"logs":   {"Print or follow the logs of a run", runLogs},
+		"cancel": {"Cancel an active run", cancelRun},
+	},
+}
+
+// topCommands are the commands that are not part of a group
+var topCommands = map[string]command{
+	"validate": {"Validate and lint DAG files offline, without a server", validateDAGs},
+}
+
+func sortedKeys(values map[string]command) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: goflow <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	fmt.Fprintf(w, "  %-16s %s\n", "server", "Run the goflow server")
+	for _, name := range sortedKeys(topCommands) {
+		fmt.Fprintf(w, "  %-16s %s\n", name, topCommands[name].summary)
+	}
+	for _, group := range []string{"dags", "runs"} {
+		for _, name := range sortedKeys(commandGroups[group]) {
+			fmt.Fprintf(w, "  %-16s %s\n", group+" "+name, commandGroups[group][name].summary)
+		}
+	}
+	fmt.Fprintln(w, "\nRun goflow <command> -h for the flags of a command")
+}
+
+// Main runs the client command given by the arguments and returns the exit code of the program
+func Main(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		printUsage(stdout)
+		return 0
+	}
+	env := &environment{stdout: stdout, stderr: stderr}
+	if topCommand, ok := topCommands[args[0]]; ok {
+		return exitCode(env, topCommand.run(env, args[1:]))
+	}
+	group, ok := commandGroups[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+	if len(args) < 2 {
+		printUsage(stderr)
+		return 2
+	}
+	subcommand, ok := group[args[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0]+" "+args[1])
+		printUsage(stderr)
+		return 2
+	}
+	return exitCode(env, subcommand.run(env, args[2:]))
+}
+
+// exitCode reports the error returned by a command and returns the matching exit code
+func exitCode(env *environment, err error) int {
+	switch err {
+	case nil, flag.ErrHelp:
+		return 0
+	case errUsage:
+		return 2
+	case errFailed:
+		return 1
+	}
+	fmt.Fprintf(env.stderr, "Error: %s\n", err)
+	return 1
+}
+
+func envOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// newFlagSet returns the flag set of a command with the shared options registered
+// usage describes the positional arguments of the command, formats its output formats if it
+// supports others than table and json
+func (env *environment) newFlagSet(name string, usage string, withServer bool, formats ...string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(env.stderr, "Usage: goflow %s [flags] %s\n\nFlags:\n", name, usage)
+		flags.PrintDefaults()
+	}
+	env.formats = formats
+	if len(env.formats) == 0 {
+		env.formats = []string{outputTable, outputJSON}
+	}
+	flags.StringVar(
+		&env.options.output,
+		"o",
+		env.formats[0],
+		"Output format, one of "+strings.Join(env.formats, ", "),
+	)
+	if !withServer {
+		return flags
+	}
+	flags.StringVar(
+		&env.options.server,
+		"server",
+		envOrDefault("GOFLOW_SERVER", defaultServer),
+		"Base URL of the goflow server, defaults to $GOFLOW_SERVER",
+	)
+	flags.StringVar(&env.options.token, "token", os.Getenv("GOFLOW_TOKEN"), "API token, defaults to $GOFLOW_TOKEN")
+	flags.StringVar(&env.options.user, "user", os.Getenv("GOFLOW_USER"), "Basic auth user, defaults to $GOFLOW_USER")
+	flags.StringVar(
+		&env.options.password,
+		"password",
+		os.Getenv("GOFLOW_PASSWORD"),
+		"Basic auth password, defaults to $GOFLOW_PASSWORD",
+	)
+	return flags
+}
+
+// parse parses the flags of a command wherever they appear among its arguments and returns its
+// positional arguments, of which there must be between min and max
+func (env *environment) parse(flags *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flags.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		flags.Usage()
+		return nil, errUsage
+	}
+	for _, format := range env.formats {
+		if env.options.output == format {
+			return positional, nil
+		}
+	}
+	fmt.Fprintf(env.stderr, "Output format must be one of %s\n", strings.Join(env.formats, ", "))
+	return nil, errUsage
+}
+
+func (env *environment) client() *Client {
+	return NewClient(env.options.server, env.options.token, env.options.user, env.options.password)
+}
+
+// print writes the value as indented JSON, or calls writeTable to write it as a table
+func (env *environment) print(value interface{}, writeTable func(table *tabwriter.Writer)) error {
+	if env.options.output == outputJSON {
+		encoder := json.NewEncoder(env.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	table := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	writeTable(table)
+	return table.Flush()
+}
+
+// row writes the cells as a row of the table
+func row(table io.Writer, cells ...string) {
+	fmt.Fprintln(table, strings.Join(cells, "\t"))
+}
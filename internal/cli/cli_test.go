@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"goflow/internal/dag/lint"
+	"goflow/internal/testutils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testAPI serves a single DAG and records the requests made to it
+type testAPI struct {
+	dag      DAG
+	requests []string
+}
+
+func (api *testAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+	w.Header().Set("Content-type", "application/json")
+	switch r.Method + " " + r.URL.Path {
+	case "GET /api/v1/dags":
+		fmt.Fprint(w, `{"items":[`+api.dagJSON()+`]}`)
+	case "GET /api/v1/dags/" + api.dag.Name:
+		fmt.Fprint(w, api.dagJSON())
+	case "PUT /api/v1/dags/" + api.dag.Name + "/toggle":
+		api.dag.IsOn = !api.dag.IsOn
+		fmt.Fprint(w, api.dagJSON())
+	case "GET /api/v1/dags/" + api.dag.Name + "/render":
+		fmt.Fprintf(w, `{"kind":"Pod","metadata":{"name":"%s-%s"}}`, api.dag.Name, r.URL.Query().Get("date"))
+	case "GET /api/v1/dags/" + api.dag.Name + "/runs/run-1/logs/stream":
+		fmt.Fprint(w, "id: 1\ndata: first\n\nid: 2\ndata: second\n\nevent: end\ndata: \n\n")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":"not_found","message":"there is no DAG with the given name"}}`)
+	}
+}
+
+func (api *testAPI) dagJSON() string {
+	dagBytes, err := json.Marshal(api.dag)
+	if err != nil {
+		panic(err)
+	}
+	return string(dagBytes)
+}
+
+func runCommand(server *httptest.Server, args ...string) (int, string, string) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	if server != nil {
+		args = append(args, "-server", server.URL)
+	}
+	code := Main(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestDAGCommands(t *testing.T) {
+	api := &testAPI{dag: DAG{Name: "test-dag", Namespace: "default", Schedule: "* * * * *", IsOn: true}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, _ := runCommand(server, "dags", "list", "-o", "json")
+	dags := make([]DAG, 0)
+	if code != 0 || json.Unmarshal([]byte(stdout), &dags) != nil || len(dags) != 1 || dags[0].Name != "test-dag" {
+		t.Errorf("Expected test-dag to be listed as JSON, exited with %d and printed %s", code, stdout)
+	}
+	code, stdout, _ = runCommand(server, "dags", "list")
+	if code != 0 || !strings.HasPrefix(stdout, "NAME") || !strings.Contains(stdout, "test-dag") {
+		t.Errorf("Expected test-dag to be listed in a table, exited with %d and printed %s", code, stdout)
+	}
+
+	api.requests = nil
+	runCommand(server, "dags", "pause", "test-dag")
+	runCommand(server, "dags", "pause", "test-dag")
+	if api.dag.IsOn || len(api.requests) != 3 {
+		t.Errorf("Expected a single toggle to pause the DAG, sent %v", api.requests)
+	}
+
+	code, _, stderr := runCommand(server, "dags", "show", "missing-dag")
+	if code != 1 || !strings.Contains(stderr, "there is no DAG with the given name") {
+		t.Errorf("Expected the API error to be reported, exited with %d and printed %s", code, stderr)
+	}
+	code, _, _ = runCommand(server, "dags", "show")
+	if code != 2 {
+		t.Errorf("Expected a missing argument to be a usage error, exited with %d", code)
+	}
+}
+
+func TestFollowRunLogs(t *testing.T) {
+	server := httptest.NewServer(&testAPI{dag: DAG{Name: "test-dag"}})
+	defer server.Close()
+
+	code, stdout, stderr := runCommand(server, "runs", "logs", "-f", "test-dag", "run-1")
+	if code != 0 || stdout != "first\nsecond\n" {
+		t.Errorf("Expected the streamed lines, exited with %d and printed %q %s", code, stdout, stderr)
+	}
+}
+
+func TestRenderDAG(t *testing.T) {
+	server := httptest.NewServer(&testAPI{dag: DAG{Name: "test-dag"}})
+	defer server.Close()
+
+	code, stdout, stderr := runCommand(server, "dags", "render", "test-dag", "-date", "2020-01-01")
+	if code != 0 || stdout != "kind: Pod\nmetadata:\n  name: test-dag-2020-01-01\n" {
+		t.Errorf("Expected the manifest as YAML, exited with %d and printed %q %s", code, stdout, stderr)
+	}
+	code, stdout, _ = runCommand(server, "dags", "render", "-o", "json", "test-dag")
+	manifest := struct{ Kind string }{}
+	if code != 0 || json.Unmarshal([]byte(stdout), &manifest) != nil || manifest.Kind != "Pod" {
+		t.Errorf("Expected the manifest as JSON, exited with %d and printed %s", code, stdout)
+	}
+	code, _, _ = runCommand(server, "dags", "render", "-o", "table", "test-dag")
+	if code != 2 {
+		t.Errorf("Expected the table format to be a usage error, exited with %d", code)
+	}
+}
+
+func TestValidateDAGs(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goflow-validate")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(folder)
+	validPath := path.Join(folder, "valid.json")
+	invalidPath := path.Join(folder, "invalid.json")
+	ioutil.WriteFile(validPath, []byte(`{"Name": "valid", "Schedule": "* * * * *", "StartDateTime": "2019-01-01"}`), 0600)
+	ioutil.WriteFile(invalidPath, []byte(`{"Name": "invalid", "Schedule": "never", "StartDateTime": "2019-01-01"}`), 0600)
+
+	code, stdout, _ := runCommand(nil, "validate", "-config", testutils.GetConfigPath(), validPath)
+	if code != 0 || !strings.Contains(stdout, "1 files, 0 errors, 0 warnings") {
+		t.Errorf("Expected the DAG to be valid, exited with %d and printed %s", code, stdout)
+	}
+	code, stdout, _ = runCommand(
+		nil, "dags", "validate", "-config", testutils.GetConfigPath(), "-o", "json", validPath, invalidPath,
+	)
+	report := lint.Report{}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("Could not parse the validation output %s: %s", stdout, err)
+	}
+	if code != 1 || len(report.Files) != 2 || report.Errors != 1 || report.Files[1].Findings[0].Rule != lint.RuleLoad {
+		t.Errorf("Expected the schedule of the invalid DAG to be reported, exited with %d and found %v", code, report)
+	}
+	code, stdout, _ = runCommand(
+		nil, "validate", "-config", testutils.GetConfigPath(), "-o", "junit", validPath, invalidPath,
+	)
+	suites := junitSuites{}
+	if err := xml.Unmarshal([]byte(stdout), &suites); err != nil {
+		t.Fatalf("Could not parse the JUnit output %s: %s", stdout, err)
+	}
+	if code != 1 || suites.Suites[0].Tests != 2 || suites.Suites[0].Failures != 1 || suites.Suites[0].Cases[1].Failure == nil {
+		t.Errorf("Expected the invalid DAG to fail its test case, exited with %d and printed %s", code, stdout)
+	}
+}
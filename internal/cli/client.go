@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPath is the path prefix of the versioned API on the server
+const apiPath = "/api/v1"
+
+// DAG is a DAG as returned by the API
+type DAG struct {
+	Name                string            `json:"name"`
+	Namespace           string            `json:"namespace"`
+	Schedule            string            `json:"schedule"`
+	DockerImage         string            `json:"dockerImage"`
+	Labels              map[string]string `json:"labels"`
+	IsOn                bool              `json:"isOn"`
+	DryRun              bool              `json:"dryRun"`
+	ActiveRuns          int               `json:"activeRuns"`
+	MostRecentExecution time.Time         `json:"mostRecentExecution"`
+	LastUpdated         time.Time         `json:"lastUpdated"`
+}
+
+// Run is a dag run as returned by the API
+type Run struct {
+	ID            string     `json:"id"`
+	DAG           string     `json:"dag"`
+	Namespace     string     `json:"namespace"`
+	Status        string     `json:"status"`
+	Trigger       string     `json:"trigger"`
+	ExecutionDate time.Time  `json:"executionDate"`
+	StartTime     time.Time  `json:"startTime"`
+	EndTime       *time.Time `json:"endTime,omitempty"`
+}
+
+// LogLine is a numbered line of the logs of a dag run
+type LogLine struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+type dagPage struct {
+	Items      []DAG  `json:"items"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// RunPage is a page of dag runs along with the number of matching runs per status
+type RunPage struct {
+	Items      []Run          `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	Counts     map[string]int `json:"counts"`
+}
+
+type logPage struct {
+	Items []LogLine `json:"items"`
+}
+
+// APIError is an error response of the API
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("%s (%d %s)", err.Message, err.Status, err.Code)
+}
+
+// Client sends requests to the REST API of a goflow server
+// A token takes precedence over a username and password
+type Client struct {
+	baseURL    string
+	token      string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the server at the given base URL
+func NewClient(baseURL string, token string, username string, password string) *Client {
+	return &Client{
+		strings.TrimSuffix(baseURL, "/"),
+		token,
+		username,
+		password,
+		&http.Client{},
+	}
+}
+
+// do sends a request to the API and returns the response, or the error if the API returned one
+func (client *Client) do(method string, path string, query url.Values) (*http.Response, error) {
+	requestURL := client.baseURL + apiPath + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	} else if client.username != "" {
+		request.SetBasicAuth(client.username, client.password)
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < http.StatusBadRequest {
+		return response, nil
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	envelope := struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if json.Unmarshal(body, &envelope) != nil || envelope.Error.Message == "" {
+		envelope.Error.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(response.StatusCode)), " ", "_")
+		envelope.Error.Message = strings.TrimSpace(string(body))
+	}
+	return nil, &APIError{response.StatusCode, envelope.Error.Code, envelope.Error.Message}
+}
+
+// doJSON sends a request to the API and decodes the JSON response into result
+func (client *Client) doJSON(method string, path string, query url.Values, result interface{}) error {
+	response, err := client.do(method, path, query)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func dagPath(name string) string {
+	return "/dags/" + url.PathEscape(name)
+}
+
+func runPath(dagName string, runID string) string {
+	return dagPath(dagName) + "/runs/" + url.PathEscape(runID)
+}
+
+// DAGs returns every DAG matching the query, following all pages
+func (client *Client) DAGs(query url.Values) ([]DAG, error) {
+	dags := make([]DAG, 0)
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	for {
+		page := dagPage{}
+		err := client.doJSON(http.MethodGet, "/dags", pageQuery, &page)
+		if err != nil {
+			return nil, err
+		}
+		dags = append(dags, page.Items...)
+		if page.NextCursor == "" {
+			return dags, nil
+		}
+		pageQuery.Set("cursor", page.NextCursor)
+	}
+}
+
+// DAG returns the DAG with the given name
+func (client *Client) DAG(name string) (DAG, error) {
+	dag := DAG{}
+	err := client.doJSON(http.MethodGet, dagPath(name), nil, &dag)
+	return dag, err
+}
+
+// ToggleDAG turns the DAG on if it is off and off if it is on, returning the toggled DAG
+func (client *Client) ToggleDAG(name string) (DAG, error) {
+	dag := DAG{}
+	err := client.doJSON(http.MethodPut, dagPath(name)+"/toggle", nil, &dag)
+	return dag, err
+}
+
+// TriggerDAG starts a manually triggered run of the DAG
+func (client *Client) TriggerDAG(name string) (Run, error) {
+	run := Run{}
+	err := client.doJSON(http.MethodPut, dagPath(name)+"/trigger", nil, &run)
+	return run, err
+}
+
+// RenderDAG returns the JSON manifest of the pod, Job or process a run of the DAG would create for
+// the execution date, the date of the next scheduled run if it is empty
+func (client *Client) RenderDAG(name string, date string) (json.RawMessage, error) {
+	query := url.Values{}
+	if date != "" {
+		query.Set("date", date)
+	}
+	manifest := json.RawMessage{}
+	err := client.doJSON(http.MethodGet, dagPath(name)+"/render", query, &manifest)
+	return manifest, err
+}
+
+// Runs returns a page of the runs matching the query, only including the runs of the DAG if one is
+// given
+func (client *Client) Runs(dagName string, query url.Values) (RunPage, error) {
+	path := "/runs"
+	if dagName != "" {
+		path = dagPath(dagName) + "/runs"
+	}
+	page := RunPage{}
+	err := client.doJSON(http.MethodGet, path, query, &page)
+	return page, err
+}
+
+// CancelRun cancels an active run
+func (client *Client) CancelRun(dagName string, runID string) (Run, error) {
+	run := Run{}
+	err := client.doJSON(http.MethodPut, runPath(dagName, runID)+"/cancel", nil, &run)
+	return run, err
+}
+
+// RunLogs returns the stored log lines of a run matching the query
+func (client *Client) RunLogs(dagName string, runID string, query url.Values) ([]LogLine, error) {
+	page := logPage{}
+	err := client.doJSON(http.MethodGet, runPath(dagName, runID)+"/logs", query, &page)
+	return page.Items, err
+}
+
+// FollowRunLogs calls onLine with the log lines of a run as they are written, returning once the
+// run has stopped writing logs
+func (client *Client) FollowRunLogs(
+	dagName string,
+	runID string,
+	query url.Values,
+	onLine func(line LogLine),
+) error {
+	response, err := client.do(http.MethodGet, runPath(dagName, runID)+"/logs/stream", query)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return readLogEvents(response.Body, onLine)
+}
+
+// readLogEvents reads the server-sent log events of a stream until its end event
+func readLogEvents(reader io.Reader, onLine func(line LogLine)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := LogLine{}
+	data := make([]string, 0, 1)
+	event := ""
+	for scanner.Scan() {
+		field := scanner.Text()
+		switch {
+		case field == "":
+			if event == "end" {
+				return nil
+			}
+			if len(data) > 0 {
+				line.Text = strings.Join(data, "\n")
+				onLine(line)
+			}
+			line = LogLine{}
+			data = data[:0]
+			event = ""
+		case strings.HasPrefix(field, "id: "):
+			line.Number, _ = strconv.Atoi(strings.TrimPrefix(field, "id: "))
+		case strings.HasPrefix(field, "event: "):
+			event = strings.TrimPrefix(field, "event: ")
+		case strings.HasPrefix(field, "data: "):
+			data = append(data, strings.TrimPrefix(field, "data: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// formatTime returns the time in the local time zone, or - for the zero time
+func formatTime(value time.Time) string {
+	if value.IsZero() {
+		return "-"
+	}
+	return value.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	if len(pairs) == 0 {
+		return "-"
+	}
+	return strings.Join(pairs, ",")
+}
+
+func onOff(isOn bool) string {
+	if isOn {
+		return "on"
+	}
+	return "off"
+}
+
+func listDAGs(env *environment, args []string) error {
+	flags := env.newFlagSet("dags list", "", true)
+	namespace := flags.String("namespace", "", "Only list the DAGs of this namespace")
+	labels := stringList{}
+	flags.Var(&labels, "label", "Only list DAGs with this key=value label, may be repeated")
+	if _, err := env.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	query := url.Values{"label": labels}
+	if *namespace != "" {
+		query.Set("namespace", *namespace)
+	}
+	dags, err := env.client().DAGs(query)
+	if err != nil {
+		return err
+	}
+	return env.print(dags, func(table *tabwriter.Writer) {
+		row(table, "NAME", "NAMESPACE", "SCHEDULE", "STATE", "ACTIVE RUNS", "LAST EXECUTION")
+		for _, dag := range dags {
+			row(
+				table,
+				dag.Name,
+				dag.Namespace,
+				dag.Schedule,
+				onOff(dag.IsOn),
+				strconv.Itoa(dag.ActiveRuns),
+				formatTime(dag.MostRecentExecution),
+			)
+		}
+	})
+}
+
+func printDAG(env *environment, dag DAG) error {
+	return env.print(dag, func(table *tabwriter.Writer) {
+		row(table, "Name:", dag.Name)
+		row(table, "Namespace:", dag.Namespace)
+		row(table, "Schedule:", dag.Schedule)
+		row(table, "Image:", dag.DockerImage)
+		row(table, "Labels:", formatLabels(dag.Labels))
+		row(table, "State:", onOff(dag.IsOn))
+		row(table, "Dry run:", onOff(dag.DryRun))
+		row(table, "Active runs:", strconv.Itoa(dag.ActiveRuns))
+		row(table, "Last execution:", formatTime(dag.MostRecentExecution))
+		row(table, "Last updated:", formatTime(dag.LastUpdated))
+	})
+}
+
+func showDAG(env *environment, args []string) error {
+	flags := env.newFlagSet("dags show", "NAME", true)
+	positional, err := env.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	dag, err := env.client().DAG(positional[0])
+	if err != nil {
+		return err
+	}
+	return printDAG(env, dag)
+}
+
+// setDAGOn toggles the DAG if it is not already in the requested state
+func setDAGOn(env *environment, args []string, isOn bool) error {
+	name := "dags pause"
+	if isOn {
+		name = "dags unpause"
+	}
+	flags := env.newFlagSet(name, "NAME", true)
+	positional, err := env.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client := env.client()
+	dag, err := client.DAG(positional[0])
+	if err != nil {
+		return err
+	}
+	if dag.IsOn != isOn {
+		dag, err = client.ToggleDAG(dag.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return printDAG(env, dag)
+}
+
+func printRun(env *environment, run Run) error {
+	return env.print(run, func(table *tabwriter.Writer) {
+		row(table, "DAG:", run.DAG)
+		row(table, "Run:", run.ID)
+		row(table, "Status:", run.Status)
+		row(table, "Trigger:", run.Trigger)
+		row(table, "Execution date:", formatTime(run.ExecutionDate))
+		row(table, "Started:", formatTime(run.StartTime))
+		if run.EndTime != nil {
+			row(table, "Ended:", formatTime(*run.EndTime))
+		}
+	})
+}
+
+// renderDAG prints the pod manifest of a run of the DAG, as YAML unless JSON is asked for
+func renderDAG(env *environment, args []string) error {
+	flags := env.newFlagSet("dags render", "NAME", true, outputYAML, outputJSON)
+	date := flags.String(
+		"date",
+		"",
+		"Execution date of the run, as YYYY-MM-DD or an RFC 3339 time, defaults to the next scheduled run",
+	)
+	positional, err := env.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	manifest, err := env.client().RenderDAG(positional[0], *date)
+	if err != nil {
+		return err
+	}
+	if env.options.output == outputJSON {
+		return env.print(manifest, nil)
+	}
+	manifestYAML, err := yaml.JSONToYAML(manifest)
+	if err != nil {
+		return err
+	}
+	_, err = env.stdout.Write(manifestYAML)
+	return err
+}
+
+func triggerDAG(env *environment, args []string) error {
+	flags := env.newFlagSet("dags trigger", "NAME", true)
+	positional, err := env.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	run, err := env.client().TriggerDAG(positional[0])
+	if err != nil {
+		return err
+	}
+	return printRun(env, run)
+}
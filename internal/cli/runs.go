@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func formatCounts(counts map[string]int) string {
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	pairs := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", status, counts[status]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func listRuns(env *environment, args []string) error {
+	flags := env.newFlagSet("runs list", "", true)
+	dagName := flags.String("dag", "", "Only list the runs of this DAG")
+	statuses := stringList{}
+	flags.Var(&statuses, "status", "Only list runs with this status, may be repeated")
+	trigger := flags.String("trigger", "", "Only list runs with this trigger, scheduled or manual")
+	since := flags.String("since", "", "Only list runs executing at or after this RFC 3339 time")
+	until := flags.String("until", "", "Only list runs executing before this RFC 3339 time")
+	limit := flags.Int("limit", 20, "Maximum number of runs to list")
+	cursor := flags.String("cursor", "", "Cursor of the page to list, as returned by a previous listing")
+	if _, err := env.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	query := url.Values{"status": statuses, "limit": {strconv.Itoa(*limit)}}
+	for name, value := range map[string]string{"trigger": *trigger, "since": *since, "until": *until, "cursor": *cursor} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	page, err := env.client().Runs(*dagName, query)
+	if err != nil {
+		return err
+	}
+	err = env.print(page, func(table *tabwriter.Writer) {
+		row(table, "DAG", "RUN", "STATUS", "TRIGGER", "EXECUTION DATE", "STARTED", "ENDED")
+		for _, run := range page.Items {
+			endTime := "-"
+			if run.EndTime != nil {
+				endTime = formatTime(*run.EndTime)
+			}
+			row(
+				table,
+				run.DAG,
+				run.ID,
+				run.Status,
+				run.Trigger,
+				formatTime(run.ExecutionDate),
+				formatTime(run.StartTime),
+				endTime,
+			)
+		}
+	})
+	if err != nil || env.options.output == outputJSON {
+		return err
+	}
+	if len(page.Counts) > 0 {
+		fmt.Fprintf(env.stdout, "\nMatching runs: %s\n", formatCounts(page.Counts))
+	}
+	if page.NextCursor != "" {
+		fmt.Fprintf(env.stdout, "More runs: --cursor %s\n", page.NextCursor)
+	}
+	return nil
+}
+
+func runLogs(env *environment, args []string) error {
+	flags := env.newFlagSet("runs logs", "DAG RUN", true)
+	follow := flags.Bool("f", false, "Keep printing lines while the run is writing logs")
+	attempt := flags.Int("attempt", 0, "Attempt of the run, defaults to the latest")
+	tail := flags.Int("tail", 0, "Only print this many of the latest lines")
+	positional, err := env.parse(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if *attempt > 0 {
+		query.Set("attempt", strconv.Itoa(*attempt))
+	}
+	if *tail > 0 {
+		query.Set("tail", strconv.Itoa(*tail))
+	}
+	// JSON lines are written one object per line so that they can be read while following
+	encoder := json.NewEncoder(env.stdout)
+	printLine := func(line LogLine) {
+		if env.options.output == outputJSON {
+			encoder.Encode(line)
+			return
+		}
+		fmt.Fprintln(env.stdout, line.Text)
+	}
+	client := env.client()
+	if *follow {
+		return client.FollowRunLogs(positional[0], positional[1], query, printLine)
+	}
+	lines, err := client.RunLogs(positional[0], positional[1], query)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		printLine(line)
+	}
+	return nil
+}
+
+func cancelRun(env *environment, args []string) error {
+	flags := env.newFlagSet("runs cancel", "DAG RUN", true)
+	positional, err := env.parse(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	run, err := env.client().CancelRun(positional[0], positional[1])
+	if err != nil {
+		return err
+	}
+	return printRun(env, run)
+}
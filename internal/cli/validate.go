@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"goflow/internal/config"
+	"goflow/internal/dag/lint"
+	"goflow/internal/paths"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// JUnit report of a lint run, with a test case per DAG file
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func formatFinding(finding lint.Finding) string {
+	return fmt.Sprintf("%s [%s]: %s", finding.Severity, finding.Rule, finding.Message)
+}
+
+// newJUnitReport returns the JUnit report of the lint report, warnings only fail a file when strict
+func newJUnitReport(report lint.Report, strict bool) junitSuites {
+	suite := junitSuite{Name: "goflow validate", Tests: len(report.Files)}
+	for _, fileReport := range report.Files {
+		testCase := junitCase{Name: fileReport.File, ClassName: fileReport.DAG}
+		failures := make([]string, 0)
+		warnings := make([]string, 0)
+		for _, finding := range fileReport.Findings {
+			if finding.Severity == lint.SeverityError || strict {
+				failures = append(failures, formatFinding(finding))
+			} else {
+				warnings = append(warnings, formatFinding(finding))
+			}
+		}
+		if len(failures) > 0 {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				fmt.Sprintf("%d problems found", len(failures)),
+				strings.Join(failures, "\n"),
+			}
+		}
+		testCase.SystemOut = strings.Join(warnings, "\n")
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	return junitSuites{Suites: []junitSuite{suite}}
+}
+
+func writeJUnit(env *environment, report junitSuites) error {
+	fmt.Fprint(env.stdout, xml.Header)
+	encoder := xml.NewEncoder(env.stdout)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout)
+	return nil
+}
+
+// validateDAGs lints DAG files and directories the way the server loads them, without a cluster or
+// database
+func validateDAGs(env *environment, args []string) error {
+	flags := env.newFlagSet("validate", "PATH...", false, outputTable, outputJSON, outputJUnit)
+	configPath := flags.String(
+		"config",
+		paths.GetGoDefaultHomePath(),
+		"The goflow configuration file whose defaults are applied to the DAGs",
+	)
+	resolveImages := flags.Bool("resolve-images", false, "Check that images exist in their registry")
+	strict := flags.Bool("strict", false, "Fail on warnings as well as errors")
+	positional, err := env.parse(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(*configPath); err != nil {
+		return fmt.Errorf("could not read the goflow configuration: %s", err)
+	}
+	goflowConfig := config.CreateConfig(*configPath)
+	options := lint.Options{}
+	if *resolveImages {
+		options.Resolver = lint.NewRegistryResolver()
+	}
+	report := lint.Lint(positional, *goflowConfig, options)
+	if env.options.output == outputJUnit {
+		err = writeJUnit(env, newJUnitReport(report, *strict))
+	} else {
+		err = env.print(report, func(table *tabwriter.Writer) {
+			row(table, "FILE", "DAG", "SEVERITY", "RULE", "MESSAGE")
+			for _, fileReport := range report.Files {
+				if len(fileReport.Findings) == 0 {
+					row(table, fileReport.File, fileReport.DAG, "ok", "-", "-")
+				}
+				for _, finding := range fileReport.Findings {
+					row(table, fileReport.File, fileReport.DAG, finding.Severity, finding.Rule, finding.Message)
+				}
+			}
+		})
+		if err == nil && env.options.output == outputTable {
+			fmt.Fprintf(
+				env.stdout,
+				"\n%d files, %d errors, %d warnings\n",
+				len(report.Files),
+				report.Errors,
+				report.Warnings,
+			)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if report.Errors > 0 || (*strict && report.Warnings > 0) {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+// AuthConfig configures authentication and authorization of the REST API
+// Authentication is disabled when no tokens, user file or OIDC provider are configured
+type AuthConfig struct {
+	Tokens   []TokenConfig
+	UserFile string
+	OIDC     *OIDCConfig
+	Bindings []RoleBinding
+}
+
+// TokenConfig is a static API token, stored as the hex encoded SHA-256 hash of the token
+type TokenConfig struct {
+	Name   string
+	SHA256 string
+	Groups []string
+}
+
+// OIDCConfig configures validation of JWTs issued by an OIDC provider
+type OIDCConfig struct {
+	Issuer        string
+	Audience      string
+	JWKSFile      string
+	UsernameClaim string
+	GroupsClaim   string
+}
+
+// RoleBinding grants a role to users and groups, for the given DAGs and namespaces
+// A binding without DAGs or namespaces applies to every DAG
+type RoleBinding struct {
+	Role       string
+	Users      []string
+	Groups     []string
+	DAGs       []string
+	Namespaces []string
+}
+
+// Enabled returns true if any authentication method is configured
+func (auth *AuthConfig) Enabled() bool {
+	return auth != nil && (len(auth.Tokens) > 0 || auth.UserFile != "" || auth.OIDC != nil)
+}
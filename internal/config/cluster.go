@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var validClusterNameRegex = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+// ClusterConfig is a named execution target that DAGs select with their Cluster
+// KubeConfig is the path of the kubeconfig of the cluster, ~/.kube/config if empty, and Context
+// the context of it to use, its current context if empty
+// DAGs running in the cluster without a namespace use DefaultNamespace, or the default namespace
+// of goflow if it is empty
+type ClusterConfig struct {
+	KubeConfig       string
+	Context          string
+	DefaultNamespace string
+}
+
+// ClusterNamespace returns the namespace of the DAGs without one that run in the cluster, DAGs
+// without a cluster run in the cluster of goflow
+func (config *GoFlowConfig) ClusterNamespace(cluster string) string {
+	if target, ok := config.Clusters[cluster]; ok && target.DefaultNamespace != "" {
+		return target.DefaultNamespace
+	}
+	return config.DefaultNamespace
+}
+
+// HasCluster returns true if the cluster is an execution target, DAGs without a cluster run in
+// the cluster of goflow
+func (config *GoFlowConfig) HasCluster(cluster string) bool {
+	_, ok := config.Clusters[cluster]
+	return cluster == "" || ok
+}
+
+func verifyClusters(clusters map[string]*ClusterConfig) error {
+	for name, cluster := range clusters {
+		if !validClusterNameRegex.MatchString(name) {
+			return fmt.Errorf("cluster name %q must be lower case alphanumeric with dashes", name)
+		}
+		if cluster == nil {
+			return fmt.Errorf("cluster %s has no configuration", name)
+		}
+	}
+	return nil
+}
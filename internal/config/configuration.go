@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"goflow/internal/jsonpanic"
 	"goflow/internal/logs"
 	"io/ioutil"
@@ -9,19 +10,52 @@ import (
 	core "k8s.io/api/core/v1"
 )
 
+// ExecutorPod runs each DAG run as a bare pod that goflow deletes once the run is done
+const ExecutorPod = "pod"
+
+// ExecutorJob runs each DAG run as a Job, which Kubernetes retries and cleans up
+const ExecutorJob = "job"
+
+// ExecutorLocal runs each DAG run as a process on the goflow host, without Kubernetes
+const ExecutorLocal = "local"
+
 // GoFlowConfig is a configuration struct for the GoFlow application settings
+// JobTTLSeconds is how long finished Jobs are kept before Kubernetes deletes them
+// LocalContainerRuntime, such as docker or podman, runs the images of local DAG runs
+// Notifications configures the delivery of the notifications that DAGs ask for
+// Pools are the number of slots of each named pool, which limit how many runs of all the DAGs
+// using a pool run at once, on each instance with sharding
+// Scheduler configures the order in which runs that are due are started
+// LeaderElection lets several replicas run at once, only one of them scheduling DAGs
+// Sharding instead lets several instances run at once, each scheduling a share of the DAGs
+// Clusters are the execution targets other than the cluster of goflow, by name
 type GoFlowConfig struct {
-	DefaultNamespace     string
-	DefaultDockerImage   string
-	DefaultRestartPolicy core.RestartPolicy
-	Parallelism          int32
-	TimeLimit            int64
-	Retries              int32
-	MaxActiveRuns        int
-	DAGPath              string
-	DateFormat           string
-	DatabaseDNS          string
-	DAGsOn               bool
+	DefaultNamespace       string
+	DefaultDockerImage     string
+	DefaultRestartPolicy   core.RestartPolicy
+	Parallelism            int32
+	TimeLimit              int64
+	Retries                int32
+	MaxActiveRuns          int
+	DefaultExecutor        string
+	JobTTLSeconds          int32
+	LocalContainerRuntime  string
+	DAGPath                string
+	DateFormat             string
+	DatabaseDNS            string
+	DAGsOn                 bool
+	LogStorage             string
+	LogPath                string
+	Auth                   *AuthConfig
+	Server                 *ServerConfig
+	Notifications          *NotificationConfig
+	Pools                  map[string]int
+	Scheduler              *SchedulerConfig
+	LeaderElection         *LeaderElectionConfig
+	Sharding               *ShardingConfig
+	Clusters               map[string]*ClusterConfig
+	ShutdownPolicy         string
+	ShutdownTimeoutSeconds int
 }
 
 func readConfig(filePath string) []byte {
@@ -39,6 +73,58 @@ func verifyConfig(config GoFlowConfig) {
 	if config.DatabaseDNS == "" {
 		panic("Database DNS must be specified!")
 	}
+	if config.DefaultExecutor != "" &&
+		config.DefaultExecutor != ExecutorPod &&
+		config.DefaultExecutor != ExecutorJob &&
+		config.DefaultExecutor != ExecutorLocal {
+		panic(fmt.Sprintf(
+			"Default executor must be \"%s\", \"%s\" or \"%s\"!",
+			ExecutorPod,
+			ExecutorJob,
+			ExecutorLocal,
+		))
+	}
+	if config.ShutdownPolicy != "" &&
+		config.ShutdownPolicy != ShutdownWait &&
+		config.ShutdownPolicy != ShutdownDetach {
+		panic(fmt.Sprintf(
+			"Shutdown policy must be \"%s\" or \"%s\"!",
+			ShutdownWait,
+			ShutdownDetach,
+		))
+	}
+	for name, slots := range config.Pools {
+		if slots < 0 {
+			panic(fmt.Sprintf("Pool %s must not have a negative number of slots!", name))
+		}
+	}
+	err := config.Server.verify()
+	if err != nil {
+		panic(err)
+	}
+	err = config.Notifications.verify()
+	if err != nil {
+		panic(err)
+	}
+	err = config.Scheduler.verify()
+	if err != nil {
+		panic(err)
+	}
+	err = config.LeaderElection.verify()
+	if err != nil {
+		panic(err)
+	}
+	err = config.Sharding.verify()
+	if err != nil {
+		panic(err)
+	}
+	if config.LeaderElection != nil && config.Sharding != nil {
+		panic("Leader election and sharding cannot be used together!")
+	}
+	err = verifyClusters(config.Clusters)
+	if err != nil {
+		panic(err)
+	}
 }
 
 // CreateConfig creates a configuration object based on the file at the given path
@@ -3,6 +3,7 @@ package config
 import (
 	"goflow/internal/jsonpanic"
 	"goflow/internal/testutils"
+	"reflect"
 	"testing"
 
 	core "k8s.io/api/core/v1"
@@ -30,7 +31,7 @@ func TestReadConfig(t *testing.T) {
 		DatabaseDNS:          "goflow.sqlite3",
 		DAGsOn:               true,
 	}
-	if *foundConfig != expectedConfig {
+	if !reflect.DeepEqual(*foundConfig, expectedConfig) {
 		t.Error("Configs do not match")
 		t.Errorf("Found: %s", jsonpanic.JSONPanicFormat(foundConfig))
 		t.Errorf("Expected: %s", jsonpanic.JSONPanicFormat(expectedConfig))
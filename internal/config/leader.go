@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultLeaseName is the name of the Lease that replicas compete for
+const defaultLeaseName = "goflow"
+
+// Default durations of leader election, as used by the Kubernetes control plane
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElectionConfig lets several goflow replicas share a database, only the replica holding
+// the Lease LeaseName in LeaseNamespace schedules DAGs while the others serve the read API
+// LeaseNamespace defaults to the default namespace and Identity to the host name, which is the
+// pod name when running in Kubernetes
+type LeaderElectionConfig struct {
+	LeaseName            string
+	LeaseNamespace       string
+	Identity             string
+	LeaseDurationSeconds int
+	RenewDeadlineSeconds int
+	RetryPeriodSeconds   int
+}
+
+// Name returns the name of the Lease
+func (election *LeaderElectionConfig) Name() string {
+	if election.LeaseName == "" {
+		return defaultLeaseName
+	}
+	return election.LeaseName
+}
+
+// Namespace returns the namespace of the Lease
+func (election *LeaderElectionConfig) Namespace(defaultNamespace string) string {
+	if election.LeaseNamespace == "" {
+		return defaultNamespace
+	}
+	return election.LeaseNamespace
+}
+
+// ID returns the identity of the replica in the Lease
+func (election *LeaderElectionConfig) ID() string {
+	return identityOrHostname(election.Identity)
+}
+
+// InstanceID returns the identity of the instance with sharding or leader election, which labels
+// the pods it watches so that the instance taking over its DAGs adopts them, and "" otherwise
+func (config *GoFlowConfig) InstanceID() string {
+	if config.Sharding != nil {
+		return config.Sharding.ID()
+	}
+	if config.LeaderElection != nil {
+		return config.LeaderElection.ID()
+	}
+	return ""
+}
+
+func identityOrHostname(identity string) string {
+	if identity != "" {
+		return identity
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	return hostname
+}
+
+// LeaseDuration returns how long followers wait before taking over a Lease that is not renewed
+func (election *LeaderElectionConfig) LeaseDuration() time.Duration {
+	return secondsOr(election.LeaseDurationSeconds, defaultLeaseDuration)
+}
+
+// RenewDeadline returns how long the leader tries to renew the Lease before giving it up
+func (election *LeaderElectionConfig) RenewDeadline() time.Duration {
+	return secondsOr(election.RenewDeadlineSeconds, defaultRenewDeadline)
+}
+
+// RetryPeriod returns how long replicas wait between attempts at acquiring or renewing the Lease
+func (election *LeaderElectionConfig) RetryPeriod() time.Duration {
+	return secondsOr(election.RetryPeriodSeconds, defaultRetryPeriod)
+}
+
+func secondsOr(seconds int, defaultDuration time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultDuration
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (election *LeaderElectionConfig) verify() error {
+	if election == nil {
+		return nil
+	}
+	// Leases are renewed every retry period with a jitter of up to 20%
+	if election.LeaseDuration() <= election.RenewDeadline() ||
+		election.RenewDeadline()*5 <= election.RetryPeriod()*6 {
+		return fmt.Errorf("leader election needs a lease duration longer than the renew deadline, " +
+			"itself longer than 1.2 retry periods")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultNotificationAttempts is how many times a notification is delivered before giving up
+const defaultNotificationAttempts = 3
+
+// defaultNotificationRetryDelay is the delay before the first retry of a failed delivery
+const defaultNotificationRetryDelay = 5 * time.Second
+
+// NotificationConfig configures how notifications of DAG runs are delivered
+// Webhook payloads are signed with HMAC-SHA256 using WebhookSecret when it is set
+// Failed deliveries are retried with a delay that doubles after each attempt
+type NotificationConfig struct {
+	WebhookSecret     string
+	SMTP              *SMTPConfig
+	MaxAttempts       int
+	RetryDelaySeconds int
+}
+
+// SMTPConfig is the mail server that email notifications are sent through
+// Authentication is used when a username is given
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Address returns the host:port address of the mail server
+func (smtp *SMTPConfig) Address() string {
+	return fmt.Sprintf("%s:%d", smtp.Host, smtp.Port)
+}
+
+// Attempts returns how many times a notification is delivered before giving up
+func (notifications *NotificationConfig) Attempts() int {
+	if notifications == nil || notifications.MaxAttempts <= 0 {
+		return defaultNotificationAttempts
+	}
+	return notifications.MaxAttempts
+}
+
+// RetryDelay returns the delay before the first retry of a failed delivery
+func (notifications *NotificationConfig) RetryDelay() time.Duration {
+	if notifications == nil || notifications.RetryDelaySeconds <= 0 {
+		return defaultNotificationRetryDelay
+	}
+	return time.Duration(notifications.RetryDelaySeconds) * time.Second
+}
+
+func (notifications *NotificationConfig) verify() error {
+	if notifications == nil || notifications.SMTP == nil {
+		return nil
+	}
+	if notifications.SMTP.Host == "" || notifications.SMTP.Port <= 0 {
+		return fmt.Errorf("SMTP notifications require a host and a port")
+	}
+	if notifications.SMTP.From == "" {
+		return fmt.Errorf("SMTP notifications require a from address")
+	}
+	return nil
+}
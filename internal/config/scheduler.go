@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultAgingInterval is how long a pending run waits for each point of priority it gains
+const defaultAgingInterval = time.Minute
+
+// SchedulerConfig configures the queue that runs due are started from
+// At most MaxRunsPerCycle runs are started every cycle when it is set, and pending runs gain a
+// point of priority for every AgingSeconds they wait so that runs of low priority are not starved
+type SchedulerConfig struct {
+	MaxRunsPerCycle int
+	AgingSeconds    int
+}
+
+// RunsPerCycle returns how many runs are started every cycle, zero when there is no limit
+func (scheduler *SchedulerConfig) RunsPerCycle() int {
+	if scheduler == nil {
+		return 0
+	}
+	return scheduler.MaxRunsPerCycle
+}
+
+// AgingInterval returns how long a pending run waits for each point of priority it gains
+func (scheduler *SchedulerConfig) AgingInterval() time.Duration {
+	if scheduler == nil || scheduler.AgingSeconds <= 0 {
+		return defaultAgingInterval
+	}
+	return time.Duration(scheduler.AgingSeconds) * time.Second
+}
+
+func (scheduler *SchedulerConfig) verify() error {
+	if scheduler == nil {
+		return nil
+	}
+	if scheduler.MaxRunsPerCycle < 0 || scheduler.AgingSeconds < 0 {
+		return fmt.Errorf("scheduler runs per cycle and aging must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShutdownWait makes goflow wait for active DAG runs to finish when shutting down
+const ShutdownWait = "wait"
+
+// ShutdownDetach makes goflow leave active DAG run pods running when shutting down
+const ShutdownDetach = "detach"
+
+// defaultShutdownTimeout bounds how long shutting down may take when no timeout is configured
+const defaultShutdownTimeout = 30 * time.Second
+
+// ServerConfig configures TLS and timeouts of the REST server
+// TLS is enabled when a certificate and key are given, and the files are reloaded when they change
+type ServerConfig struct {
+	TLSCertFile         string
+	TLSKeyFile          string
+	ClientCAFile        string
+	RequireClientCert   bool
+	ReadTimeoutSeconds  int
+	WriteTimeoutSeconds int
+	IdleTimeoutSeconds  int
+}
+
+// TLSEnabled returns true if the server should serve TLS
+func (server *ServerConfig) TLSEnabled() bool {
+	return server != nil && server.TLSCertFile != ""
+}
+
+func (server *ServerConfig) verify() error {
+	if server == nil {
+		return nil
+	}
+	if (server.TLSCertFile == "") != (server.TLSKeyFile == "") {
+		return fmt.Errorf("TLS requires both a certificate and a key file")
+	}
+	if server.ClientCAFile != "" && !server.TLSEnabled() {
+		return fmt.Errorf("client certificate verification requires TLS")
+	}
+	if server.RequireClientCert && server.ClientCAFile == "" {
+		return fmt.Errorf("requiring client certificates needs a client CA file")
+	}
+	return nil
+}
+
+// ShutdownTimeout returns how long draining requests and waiting for active runs may each take
+func (config GoFlowConfig) ShutdownTimeout() time.Duration {
+	if config.ShutdownTimeoutSeconds <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+}
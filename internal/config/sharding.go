@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default durations of sharding
+const (
+	defaultHeartbeat       = 5 * time.Second
+	defaultInstanceTimeout = 30 * time.Second
+)
+
+// ShardingConfig splits the DAGs between goflow instances sharing a database, each scheduling the
+// DAGs that consistent hashing on their ids assigns to it among the live instances
+// Instances record a heartbeat every HeartbeatSeconds and are considered dead once they have not
+// for InstanceTimeoutSeconds, their DAGs and the pods of their runs are then taken over by others
+// Identity defaults to the host name, which is the pod name when running in Kubernetes
+// Pools are not shared, each instance has the configured slots of every pool for its own runs
+type ShardingConfig struct {
+	Identity               string
+	HeartbeatSeconds       int
+	InstanceTimeoutSeconds int
+	VirtualNodes           int
+}
+
+// ID returns the identity of the instance, or an empty string without sharding
+func (sharding *ShardingConfig) ID() string {
+	if sharding == nil {
+		return ""
+	}
+	return identityOrHostname(sharding.Identity)
+}
+
+// Heartbeat returns how often the instance records that it is alive
+func (sharding *ShardingConfig) Heartbeat() time.Duration {
+	return secondsOr(sharding.HeartbeatSeconds, defaultHeartbeat)
+}
+
+// InstanceTimeout returns how long after their last heartbeat instances are considered dead
+func (sharding *ShardingConfig) InstanceTimeout() time.Duration {
+	return secondsOr(sharding.InstanceTimeoutSeconds, defaultInstanceTimeout)
+}
+
+func (sharding *ShardingConfig) verify() error {
+	if sharding == nil {
+		return nil
+	}
+	if sharding.InstanceTimeout() <= sharding.Heartbeat() {
+		return fmt.Errorf("sharding needs an instance timeout longer than the heartbeat")
+	}
+	return nil
+}
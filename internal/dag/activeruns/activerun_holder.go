@@ -34,3 +34,14 @@ func (runs *ActiveRuns) Dec() {
 	runs.count--
 	runs.lock.Unlock()
 }
+
+// TryInc increments the number of runs if it is below max, returning true if it did
+func (runs *ActiveRuns) TryInc(max int) bool {
+	runs.lock.Lock()
+	defer runs.lock.Unlock()
+	if runs.count >= max {
+		return false
+	}
+	runs.count++
+	return true
+}
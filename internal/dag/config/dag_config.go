@@ -2,17 +2,28 @@ package config
 
 import (
 	"encoding/json"
-	"goflow/internal/config"
+	"fmt"
+	goflowconfig "goflow/internal/config"
 	"goflow/internal/jsonpanic"
+	"goflow/internal/notify"
 	"io/ioutil"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/robfig/cron"
 	core "k8s.io/api/core/v1"
 )
 
 const validNameRegexString = "^[[:alpha:]][a-zA-Z0-9_-]+$"
 
+const validDatasetNameRegexString = "^[a-zA-Z0-9][a-zA-Z0-9_.-]*$"
+
+// DateFormat is the format of the start and end dates of a DAG
+const DateFormat = "2006-01-02"
+
 var validNameRegex *regexp.Regexp
+var validDatasetNameRegex *regexp.Regexp
 
 func init() {
 	compiledRegex, err := regexp.Compile(validNameRegexString)
@@ -20,26 +31,57 @@ func init() {
 		panic(err)
 	}
 	validNameRegex = compiledRegex
+	validDatasetNameRegex = regexp.MustCompile(validDatasetNameRegexString)
 }
 
 // DAGConfig is a struct storing the configurable values provided from the user in the DAG
 // definition file
+// Runs of DAGs with DryRun set are recorded without submitting their pods
+// Executor is config.ExecutorPod, config.ExecutorJob or config.ExecutorLocal
+// Local runs execute Command on the host, or DockerImage with ContainerRuntime if it is set
+// Notify rules send notifications of the outcomes of runs
+// Runs that have not succeeded by the time set by SLA are recorded as SLA misses
+// Runs wait for the runs of other DAGs listed in WaitFor before they are submitted
+// Successful runs update the datasets in Produces, and runs are triggered once all the datasets in
+// Consumes have been updated, in which case Schedule may be left empty
+// Runs are submitted once all their Sensors are satisfied
+// Runs of DAGs with a Pool take PoolSlots slots of that pool of the goflow config, one by default,
+// and are queued while the pool is full, runs with a higher PriorityWeight first
+// The scheduler also starts the due runs of DAGs with a higher PriorityWeight first
+// Runs are submitted to the Cluster of the goflow config with that name, to the cluster of goflow
+// if it is empty
 type DAGConfig struct {
-	Name          string
-	Namespace     string
-	Schedule      string
-	DockerImage   string
-	RetryPolicy   core.RestartPolicy
-	Command       []string
-	Parallelism   int32
-	TimeLimit     *int64
-	Retries       int32
-	MaxActiveRuns int
-	StartDateTime string
-	EndDateTime   string
-	Labels        map[string]string
-	Annotations   map[string]string
-	WithLogs      bool
+	Name             string
+	Namespace        string
+	Schedule         string
+	DockerImage      string
+	RetryPolicy      core.RestartPolicy
+	Command          []string
+	Parallelism      int32
+	TimeLimit        *int64
+	Retries          int32
+	MaxActiveRuns    int
+	StartDateTime    string
+	EndDateTime      string
+	Labels           map[string]string
+	Annotations      map[string]string
+	Env              map[string]string
+	Resources        core.ResourceRequirements
+	WithLogs         bool
+	DryRun           bool
+	Executor         string
+	JobTTLSeconds    int32
+	ContainerRuntime string
+	Notify           []notify.Rule
+	SLA              *SLA
+	WaitFor          []WaitFor
+	Produces         []string
+	Consumes         []string
+	Sensors          []SensorConfig
+	Pool             string
+	PoolSlots        int
+	PriorityWeight   int
+	Cluster          string
 }
 
 // Marshal returns a json bytes representation of DAGConfig
@@ -67,6 +109,15 @@ func makeStrMapCopy(src map[string]string) map[string]string {
 	return cpy
 }
 
+func makeStrSliceCopy(src []string) []string {
+	if src == nil {
+		return nil
+	}
+	cpy := make([]string, len(src))
+	copy(cpy, src)
+	return cpy
+}
+
 // Copy returns a copy of the DAGConfig
 func (config DAGConfig) Copy() DAGConfig {
 	configCopy := config
@@ -74,16 +125,44 @@ func (config DAGConfig) Copy() DAGConfig {
 	copy(configCopy.Command, config.Command)
 	configCopy.Annotations = makeStrMapCopy(config.Annotations)
 	configCopy.Labels = makeStrMapCopy(config.Labels)
+	configCopy.Env = makeStrMapCopy(config.Env)
+	configCopy.Resources = *config.Resources.DeepCopy()
+	configCopy.Produces = makeStrSliceCopy(config.Produces)
+	configCopy.Consumes = makeStrSliceCopy(config.Consumes)
+	if config.SLA != nil {
+		sla := *config.SLA
+		configCopy.SLA = &sla
+	}
+	if config.WaitFor != nil {
+		configCopy.WaitFor = make([]WaitFor, len(config.WaitFor))
+		copy(configCopy.WaitFor, config.WaitFor)
+	}
+	if config.Sensors != nil {
+		configCopy.Sensors = make([]SensorConfig, len(config.Sensors))
+		for i, sensor := range config.Sensors {
+			configCopy.Sensors[i] = sensor
+			if sensor.Object != nil {
+				object := *sensor.Object
+				configCopy.Sensors[i].Object = &object
+			}
+		}
+	}
+	if config.Notify != nil {
+		configCopy.Notify = make([]notify.Rule, len(config.Notify))
+		for i, rule := range config.Notify {
+			configCopy.Notify[i] = rule.Copy()
+		}
+	}
 	return configCopy
 }
 
 // SetDefaults sets the defaults on the dag config using the goflow config settings
-func (config *DAGConfig) SetDefaults(goflowConfig config.GoFlowConfig) {
+func (config *DAGConfig) SetDefaults(goflowConfig goflowconfig.GoFlowConfig) {
 	if config.DockerImage == "" {
 		config.DockerImage = goflowConfig.DefaultDockerImage
 	}
 	if config.Namespace == "" {
-		config.Namespace = goflowConfig.DefaultNamespace
+		config.Namespace = goflowConfig.ClusterNamespace(config.Cluster)
 	}
 	if config.RetryPolicy == "" {
 		config.RetryPolicy = goflowConfig.DefaultRestartPolicy
@@ -97,6 +176,26 @@ func (config *DAGConfig) SetDefaults(goflowConfig config.GoFlowConfig) {
 	if config.MaxActiveRuns == 0 {
 		config.MaxActiveRuns = goflowConfig.MaxActiveRuns
 	}
+	if config.Executor == "" {
+		config.Executor = goflowConfig.DefaultExecutor
+	}
+	if config.Executor == "" {
+		config.Executor = goflowconfig.ExecutorPod
+	}
+	if config.JobTTLSeconds == 0 {
+		config.JobTTLSeconds = goflowConfig.JobTTLSeconds
+	}
+	if config.ContainerRuntime == "" {
+		config.ContainerRuntime = goflowConfig.LocalContainerRuntime
+	}
+}
+
+// PoolSlotCount returns the number of slots of its pool that each run of the DAG takes
+func (config *DAGConfig) PoolSlotCount() int {
+	if config.PoolSlots == 0 {
+		return 1
+	}
+	return config.PoolSlots
 }
 
 // IsNameValid returns false if name does not match required DAG naming pattern
@@ -104,6 +203,156 @@ func (config *DAGConfig) IsNameValid() bool {
 	return validNameRegex.Match([]byte(config.Name))
 }
 
+// ValidationError lists the problems that prevent a DAG from being loaded
+type ValidationError struct {
+	Name     string
+	Problems []error
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, 0, len(err.Problems))
+	for _, problem := range err.Problems {
+		messages = append(messages, problem.Error())
+	}
+	return fmt.Sprintf("DAG %s is invalid: %s", err.Name, strings.Join(messages, "; "))
+}
+
+// Load parses a DAG file, sets the defaults of the goflow config and validates the result
+// Invalid DAGs are returned along with a *ValidationError
+func Load(dagBytes []byte, goflowConfig goflowconfig.GoFlowConfig) (DAGConfig, error) {
+	dagConfig := DAGConfig{}
+	err := json.Unmarshal(dagBytes, &dagConfig)
+	if err != nil {
+		return DAGConfig{}, err
+	}
+	dagConfig.SetDefaults(goflowConfig)
+	problems := dagConfig.Validate()
+	if !goflowConfig.HasCluster(dagConfig.Cluster) {
+		problems = append(problems, fmt.Errorf("cluster %q is not in the goflow config", dagConfig.Cluster))
+	}
+	if slots, ok := goflowConfig.Pools[dagConfig.Pool]; ok && dagConfig.PoolSlotCount() > slots {
+		problems = append(problems, fmt.Errorf(
+			"runs take %d slots of pool %q, which only has %d",
+			dagConfig.PoolSlotCount(),
+			dagConfig.Pool,
+			slots,
+		))
+	}
+	if len(problems) > 0 {
+		return dagConfig, &ValidationError{dagConfig.Name, problems}
+	}
+	return dagConfig, nil
+}
+
+// Validate returns every problem that prevents the DAG from being loaded
+// Defaults are expected to have been set beforehand
+func (config *DAGConfig) Validate() []error {
+	problems := make([]error, 0)
+	if !config.IsNameValid() {
+		problems = append(problems, fmt.Errorf("name %q does not match the pattern %s", config.Name, validNameRegexString))
+	}
+	if _, err := cron.Parse(config.Schedule); err != nil && (config.Schedule != "" || len(config.Consumes) == 0) {
+		problems = append(problems, fmt.Errorf("schedule %q is invalid: %s", config.Schedule, err))
+	}
+	if _, err := time.Parse(DateFormat, config.StartDateTime); err != nil {
+		problems = append(problems, fmt.Errorf("start date %q must have the format %s", config.StartDateTime, DateFormat))
+	}
+	if _, err := time.Parse(DateFormat, config.EndDateTime); config.EndDateTime != "" && err != nil {
+		problems = append(problems, fmt.Errorf("end date %q must have the format %s", config.EndDateTime, DateFormat))
+	}
+	if config.MaxActiveRuns < 1 {
+		problems = append(problems, fmt.Errorf("max active runs must be greater than 0, got %d", config.MaxActiveRuns))
+	}
+	switch config.Executor {
+	case goflowconfig.ExecutorPod:
+	case goflowconfig.ExecutorJob, goflowconfig.ExecutorLocal:
+		if config.Executor == goflowconfig.ExecutorLocal && config.Cluster != "" {
+			problems = append(problems, fmt.Errorf("the %s executor does not run in a cluster", config.Executor))
+		}
+		if config.RetryPolicy == core.RestartPolicyAlways {
+			problems = append(problems, fmt.Errorf(
+				"retry policy %s is not supported by the %s executor",
+				config.RetryPolicy,
+				config.Executor,
+			))
+		}
+	default:
+		problems = append(problems, fmt.Errorf(
+			"executor %q must be %s, %s or %s",
+			config.Executor,
+			goflowconfig.ExecutorPod,
+			goflowconfig.ExecutorJob,
+			goflowconfig.ExecutorLocal,
+		))
+	}
+	if config.JobTTLSeconds < 0 {
+		problems = append(problems, fmt.Errorf("job TTL must not be negative, got %d", config.JobTTLSeconds))
+	}
+	for _, rule := range config.Notify {
+		problems = append(problems, rule.Validate()...)
+	}
+	if config.SLA != nil {
+		problems = append(problems, config.SLA.validate()...)
+	}
+	for _, waitFor := range config.WaitFor {
+		problems = append(problems, waitFor.validate(config.Name)...)
+	}
+	sensorNames := make(map[string]bool)
+	for _, sensor := range config.Sensors {
+		problems = append(problems, sensor.validate()...)
+		if sensorNames[sensor.Name] {
+			problems = append(problems, fmt.Errorf("sensor name %q is used more than once", sensor.Name))
+		}
+		sensorNames[sensor.Name] = true
+	}
+	if config.PoolSlots < 0 {
+		problems = append(problems, fmt.Errorf("pool slots must not be negative, got %d", config.PoolSlots))
+	}
+	if config.PoolSlots != 0 && config.Pool == "" {
+		problems = append(problems, fmt.Errorf("pool slots are set without a pool"))
+	}
+	problems = append(problems, validateDatasets("produced", config.Produces)...)
+	problems = append(problems, validateDatasets("consumed", config.Consumes)...)
+	for name, request := range config.Resources.Requests {
+		limit, ok := config.Resources.Limits[name]
+		if ok && request.Cmp(limit) > 0 {
+			problems = append(problems, fmt.Errorf("%s request %s exceeds its limit %s", name, request.String(), limit.String()))
+		}
+	}
+	return problems
+}
+
+// IsDatasetNameValid returns false if name does not match the required dataset naming pattern
+func IsDatasetNameValid(name string) bool {
+	return validDatasetNameRegex.MatchString(name)
+}
+
+// validateDatasets returns the problems of the names of the produced or consumed datasets
+func validateDatasets(kind string, datasets []string) []error {
+	problems := make([]error, 0)
+	seen := make(map[string]bool)
+	for _, dataset := range datasets {
+		if !IsDatasetNameValid(dataset) {
+			problems = append(problems, fmt.Errorf(
+				"%s dataset %q does not match the pattern %s",
+				kind,
+				dataset,
+				validDatasetNameRegexString,
+			))
+		}
+		if seen[dataset] {
+			problems = append(problems, fmt.Errorf("%s dataset %q is listed more than once", kind, dataset))
+		}
+		seen[dataset] = true
+	}
+	return problems
+}
+
+// IsScheduled returns false for DAGs that are only triggered by updates of the datasets they consume
+func (config *DAGConfig) IsScheduled() bool {
+	return config.Schedule != ""
+}
+
 // WriteToFile writes a dag file to the given folder
 func (config *DAGConfig) WriteToFile(path string) error {
 	return ioutil.WriteFile(path, jsonpanic.JSONPanicFormatBytes(config), 0600)
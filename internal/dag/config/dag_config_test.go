@@ -3,9 +3,12 @@ package config
 import (
 	"goflow/internal/config"
 	"goflow/internal/jsonpanic"
+	"goflow/internal/notify"
 	"testing"
+	"time"
 
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestSetConfigDefaults(t *testing.T) {
@@ -34,6 +37,7 @@ func TestSetConfigDefaults(t *testing.T) {
 		Retries:       1,
 		MaxActiveRuns: 1,
 		WithLogs:      false,
+		Executor:      config.ExecutorPod,
 	}
 	dagConfigCases := []DAGConfig{
 		{
@@ -53,3 +57,166 @@ func TestSetConfigDefaults(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	validConfig := DAGConfig{
+		Name:          "test-config",
+		Schedule:      "* * * * *",
+		StartDateTime: "2019-01-01",
+		MaxActiveRuns: 1,
+		Executor:      config.ExecutorJob,
+	}
+	if problems := validConfig.Validate(); len(problems) != 0 {
+		t.Errorf("Expected no problems, found %v", problems)
+	}
+	invalidConfig := DAGConfig{
+		Name:          "0-invalid name",
+		Schedule:      "every minute",
+		StartDateTime: "01/01/2019",
+		EndDateTime:   "2019-13-01",
+		Executor:      config.ExecutorJob,
+		RetryPolicy:   core.RestartPolicyAlways,
+		JobTTLSeconds: -1,
+		Resources: core.ResourceRequirements{
+			Requests: core.ResourceList{core.ResourceMemory: resource.MustParse("2Gi")},
+			Limits:   core.ResourceList{core.ResourceMemory: resource.MustParse("1Gi")},
+		},
+	}
+	if problems := invalidConfig.Validate(); len(problems) != 8 {
+		t.Errorf("Expected a problem with each of the 8 fields, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.Executor = "vm"
+	if problems := invalidConfig.Validate(); len(problems) != 1 {
+		t.Errorf("Expected the unknown executor to be a problem, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.Executor = config.ExecutorLocal
+	invalidConfig.RetryPolicy = core.RestartPolicyAlways
+	if problems := invalidConfig.Validate(); len(problems) != 1 {
+		t.Errorf("Expected local runs not to restart forever, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.Notify = []notify.Rule{
+		{On: []string{notify.EventFailure}, Channel: notify.ChannelSlack, URL: "https://hooks.example.com/x"},
+		{On: []string{"finish"}, Channel: notify.ChannelEmail},
+	}
+	if problems := invalidConfig.Validate(); len(problems) != 2 {
+		t.Errorf("Expected the event and addresses of the email rule to be problems, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.SLA = &SLA{MaxDurationSeconds: -1, Deadline: "6am"}
+	if problems := invalidConfig.Validate(); len(problems) != 2 {
+		t.Errorf("Expected the duration and deadline of the SLA to be problems, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.WaitFor = []WaitFor{
+		{DAG: "ingestion", OffsetSeconds: -3600, Status: WaitStatusFinished, OnTimeout: OnTimeoutSkip},
+		{DAG: "test-config", Status: "Done", TimeoutSeconds: -1, OnTimeout: "retry"},
+	}
+	if problems := invalidConfig.Validate(); len(problems) != 4 {
+		t.Errorf("Expected each field of the second wait for to be a problem, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.WaitFor = []WaitFor{{DAG: "ingestion' OR '1'='1"}}
+	if problems := invalidConfig.Validate(); len(problems) != 1 {
+		t.Errorf("Expected the invalid name of the DAG waited for to be a problem, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.Sensors = []SensorConfig{
+		{Name: "api", Kind: SensorHTTP, URL: "https://example.com/ready", SoftFail: true},
+		{Name: "input", Kind: SensorFile, Path: "/data/in/_SUCCESS", PokeIntervalSeconds: 30},
+		{Name: "job", Kind: SensorKubernetes, Object: &ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "ingest"}},
+	}
+	if problems := invalidConfig.Validate(); len(problems) != 0 {
+		t.Errorf("Expected valid sensors, found %v", problems)
+	}
+	invalidConfig.Sensors = []SensorConfig{
+		{Name: "api", Kind: SensorHTTP, URL: "example.com"},
+		{Name: "api", Kind: SensorFile, Path: "in/_SUCCESS", TimeoutSeconds: -1},
+		{Name: "job", Kind: SensorKubernetes},
+		{Name: "queue", Kind: "kafka"},
+	}
+	if problems := invalidConfig.Validate(); len(problems) != 6 {
+		t.Errorf("Expected a problem with each of the sensors and the repeated name, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.PoolSlots = -1
+	if problems := invalidConfig.Validate(); len(problems) != 2 {
+		t.Errorf("Expected the negative pool slots and the missing pool to be problems, found %v", problems)
+	}
+	datasetConfig := validConfig
+	datasetConfig.Schedule = ""
+	datasetConfig.Consumes = []string{"orders", "customers.v2"}
+	if problems := datasetConfig.Validate(); len(problems) != 0 {
+		t.Errorf("Expected DAGs consuming datasets not to need a schedule, found %v", problems)
+	}
+	datasetConfig.Consumes = []string{"orders", "orders"}
+	datasetConfig.Produces = []string{"daily/report"}
+	if problems := datasetConfig.Validate(); len(problems) != 2 {
+		t.Errorf("Expected the repeated and invalid datasets to be problems, found %v", problems)
+	}
+	invalidConfig = validConfig
+	invalidConfig.Executor = config.ExecutorLocal
+	invalidConfig.Cluster = "east"
+	if problems := invalidConfig.Validate(); len(problems) != 1 {
+		t.Errorf("Expected local runs not to target a cluster, found %v", problems)
+	}
+}
+
+func TestLoadCluster(t *testing.T) {
+	goflowConfig := config.GoFlowConfig{
+		DefaultNamespace: "default",
+		MaxActiveRuns:    1,
+		Clusters:         map[string]*config.ClusterConfig{"east": {DefaultNamespace: "batch"}},
+	}
+	dagBytes := []byte(`{"Name": "east-dag", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "Cluster": "east"}`)
+	dagConfig, err := Load(dagBytes, goflowConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dagConfig.Namespace != "batch" {
+		t.Errorf("Expected the default namespace of the cluster, found %s", dagConfig.Namespace)
+	}
+	dagBytes = []byte(`{"Name": "west-dag", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "Cluster": "west"}`)
+	if _, err = Load(dagBytes, goflowConfig); err == nil {
+		t.Error("Expected a cluster missing from the goflow config to be a problem")
+	}
+}
+
+func TestLoadPoolSlots(t *testing.T) {
+	goflowConfig := config.GoFlowConfig{
+		DefaultNamespace: "default",
+		MaxActiveRuns:    1,
+		Pools:            map[string]int{"database": 2},
+	}
+	dagBytes := []byte(`{"Name": "pool-dag", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "Pool": "database", "PoolSlots": 2}`)
+	if _, err := Load(dagBytes, goflowConfig); err != nil {
+		t.Fatal(err)
+	}
+	dagBytes = []byte(`{"Name": "pool-dag", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "Pool": "database", "PoolSlots": 3}`)
+	if _, err := Load(dagBytes, goflowConfig); err == nil {
+		t.Error("Expected runs taking more slots than their pool has to be a problem")
+	}
+}
+
+func TestSLADue(t *testing.T) {
+	executionDate := time.Date(2019, 1, 1, 5, 0, 0, 0, time.UTC)
+	tables := []struct {
+		name        string
+		sla         *SLA
+		expectedDue time.Time
+	}{
+		{"duration", &SLA{MaxDurationSeconds: 1800}, time.Date(2019, 1, 1, 5, 30, 0, 0, time.UTC)},
+		{"deadline", &SLA{Deadline: "06:00"}, time.Date(2019, 1, 1, 6, 0, 0, 0, time.UTC)},
+		{"next day deadline", &SLA{Deadline: "05:00"}, time.Date(2019, 1, 2, 5, 0, 0, 0, time.UTC)},
+		{"earliest", &SLA{MaxDurationSeconds: 7200, Deadline: "06:00"}, time.Date(2019, 1, 1, 6, 0, 0, 0, time.UTC)},
+		{"none", nil, time.Time{}},
+	}
+	for _, table := range tables {
+		due, ok := table.sla.Due(executionDate)
+		if !due.Equal(table.expectedDue) || ok == table.expectedDue.IsZero() {
+			t.Errorf("%s: expected due %s, found %s", table.name, table.expectedDue, due)
+		}
+	}
+}
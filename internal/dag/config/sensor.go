@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Kinds of sensors
+const (
+	// SensorHTTP waits for a URL to answer with status 200
+	SensorHTTP = "http"
+	// SensorFile waits for a file to exist, typically on a mounted volume
+	SensorFile = "file"
+	// SensorKubernetes waits for a Kubernetes object to exist and reach a condition
+	SensorKubernetes = "kubernetes"
+)
+
+// defaultPokeInterval is how often sensors are poked when no interval is set
+const defaultPokeInterval = 60 * time.Second
+
+// defaultSensorTimeout is how long runs wait for a sensor when no timeout is set
+const defaultSensorTimeout = 24 * time.Hour
+
+// SensorConfig is a condition that runs of the DAG wait for before they are submitted
+// Sensors are poked every PokeIntervalSeconds, runs whose sensors are not satisfied within
+// TimeoutSeconds fail, or are skipped if SoftFail is set
+type SensorConfig struct {
+	Name                string
+	Kind                string
+	URL                 string
+	Path                string
+	Object              *ObjectRef
+	PokeIntervalSeconds int64
+	TimeoutSeconds      int64
+	SoftFail            bool
+}
+
+// ObjectRef is the Kubernetes object of a sensor, such as a ConfigMap, a Job or a custom resource
+// Resource is the plural name of its kind, such as configmaps, and Namespace defaults to the one of
+// the DAG. The object must have the status condition Condition set to true and the value Value
+// at the dot separated path Field, when they are set
+type ObjectRef struct {
+	APIVersion string
+	Resource   string
+	Namespace  string
+	Name       string
+	Condition  string
+	Field      string
+	Value      string
+}
+
+// GroupVersionResource returns the resource of the object
+func (object *ObjectRef) GroupVersionResource() (schema.GroupVersionResource, error) {
+	groupVersion, err := schema.ParseGroupVersion(object.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	return groupVersion.WithResource(object.Resource), nil
+}
+
+// PokeInterval returns how often the sensor is poked
+func (sensor SensorConfig) PokeInterval() time.Duration {
+	if sensor.PokeIntervalSeconds == 0 {
+		return defaultPokeInterval
+	}
+	return time.Duration(sensor.PokeIntervalSeconds) * time.Second
+}
+
+// Timeout returns how long runs wait for the sensor
+func (sensor SensorConfig) Timeout() time.Duration {
+	if sensor.TimeoutSeconds == 0 {
+		return defaultSensorTimeout
+	}
+	return time.Duration(sensor.TimeoutSeconds) * time.Second
+}
+
+// validate returns the problems of the sensor
+func (sensor SensorConfig) validate() []error {
+	problems := make([]error, 0)
+	if sensor.Name == "" {
+		problems = append(problems, fmt.Errorf("sensors need a name"))
+	}
+	switch sensor.Kind {
+	case SensorHTTP:
+		if parsedURL, err := url.Parse(sensor.URL); err != nil ||
+			(parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			problems = append(problems, fmt.Errorf("sensor %s needs an http or https URL, got %q", sensor.Name, sensor.URL))
+		}
+	case SensorFile:
+		if !filepath.IsAbs(sensor.Path) {
+			problems = append(problems, fmt.Errorf("sensor %s needs an absolute path, got %q", sensor.Name, sensor.Path))
+		}
+	case SensorKubernetes:
+		if sensor.Object == nil || sensor.Object.Resource == "" || sensor.Object.Name == "" {
+			problems = append(problems, fmt.Errorf("sensor %s needs the resource and name of an object", sensor.Name))
+		} else if _, err := sensor.Object.GroupVersionResource(); err != nil {
+			problems = append(problems, fmt.Errorf("sensor %s has an invalid API version: %s", sensor.Name, err))
+		}
+	default:
+		problems = append(problems, fmt.Errorf(
+			"sensor %s kind %q must be %s, %s or %s",
+			sensor.Name,
+			sensor.Kind,
+			SensorHTTP,
+			SensorFile,
+			SensorKubernetes,
+		))
+	}
+	if sensor.PokeIntervalSeconds < 0 || sensor.TimeoutSeconds < 0 {
+		problems = append(problems, fmt.Errorf("sensor %s poke interval and timeout must not be negative", sensor.Name))
+	}
+	return problems
+}
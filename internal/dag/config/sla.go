@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeadlineFormat is the format of the time of day of SLA deadlines
+const DeadlineFormat = "15:04"
+
+// SLA is when runs of a DAG are expected to have succeeded
+// MaxDurationSeconds counts from the execution date of a run, Deadline is the time of day that
+// follows the execution date, in its time zone, such as "06:00"
+// Runs are due by the earliest of the two that is set
+type SLA struct {
+	MaxDurationSeconds int64
+	Deadline           string
+}
+
+// Due returns when the run for the execution date is expected to have succeeded, false if
+// neither a maximum duration nor a deadline is set
+func (sla *SLA) Due(executionDate time.Time) (time.Time, bool) {
+	if sla == nil {
+		return time.Time{}, false
+	}
+	var due time.Time
+	if sla.MaxDurationSeconds > 0 {
+		due = executionDate.Add(time.Duration(sla.MaxDurationSeconds) * time.Second)
+	}
+	if deadline, err := time.Parse(DeadlineFormat, sla.Deadline); sla.Deadline != "" && err == nil {
+		deadlineDate := time.Date(
+			executionDate.Year(),
+			executionDate.Month(),
+			executionDate.Day(),
+			deadline.Hour(),
+			deadline.Minute(),
+			0,
+			0,
+			executionDate.Location(),
+		)
+		if !deadlineDate.After(executionDate) {
+			deadlineDate = deadlineDate.AddDate(0, 0, 1)
+		}
+		if due.IsZero() || deadlineDate.Before(due) {
+			due = deadlineDate
+		}
+	}
+	return due, !due.IsZero()
+}
+
+// Span returns the longest time a run may be due after its execution date
+func (sla *SLA) Span() time.Duration {
+	span := time.Duration(sla.MaxDurationSeconds) * time.Second
+	if sla.Deadline != "" && span < 24*time.Hour {
+		span = 24 * time.Hour
+	}
+	return span
+}
+
+// validate returns the problems of the SLA
+func (sla *SLA) validate() []error {
+	problems := make([]error, 0)
+	if sla.MaxDurationSeconds < 0 {
+		problems = append(problems, fmt.Errorf("SLA max duration must not be negative, got %d", sla.MaxDurationSeconds))
+	}
+	if _, err := time.Parse(DeadlineFormat, sla.Deadline); sla.Deadline != "" && err != nil {
+		problems = append(problems, fmt.Errorf("SLA deadline %q must have the format %s", sla.Deadline, DeadlineFormat))
+	}
+	if sla.MaxDurationSeconds == 0 && sla.Deadline == "" {
+		problems = append(problems, fmt.Errorf("SLA needs a max duration or a deadline"))
+	}
+	return problems
+}
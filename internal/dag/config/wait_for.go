@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+// WaitStatusFinished is the status of WaitFor met by runs that have finished, whatever their outcome
+const WaitStatusFinished = "Finished"
+
+// What happens to a run when a run it waits for has not reached its status in time
+const (
+	// OnTimeoutFail fails the run, this is the default
+	OnTimeoutFail = "fail"
+	// OnTimeoutSkip records the run as skipped without submitting it
+	OnTimeoutSkip = "skip"
+	// OnTimeoutRun stops waiting for the run and submits the run anyway
+	OnTimeoutRun = "run"
+)
+
+// defaultWaitTimeout is how long a run waits for a run of another DAG when no timeout is set
+const defaultWaitTimeout = 24 * time.Hour
+
+// WaitFor is a run of another DAG that runs of the DAG wait for before they are submitted
+// The run of DAG whose execution date is the one of the waiting run shifted by OffsetSeconds must
+// reach Status, Succeeded by default, within TimeoutSeconds of the start of the waiting run
+type WaitFor struct {
+	DAG            string
+	OffsetSeconds  int64
+	Status         string
+	TimeoutSeconds int64
+	OnTimeout      string
+}
+
+// RequiredStatus returns the status the run of the other DAG must reach
+func (waitFor WaitFor) RequiredStatus() string {
+	if waitFor.Status == "" {
+		return string(core.PodSucceeded)
+	}
+	return waitFor.Status
+}
+
+// ExecutionDate returns the execution date of the run waited for by the run for the given date
+func (waitFor WaitFor) ExecutionDate(executionDate time.Time) time.Time {
+	return executionDate.Add(time.Duration(waitFor.OffsetSeconds) * time.Second)
+}
+
+// Timeout returns how long a run waits for the run of the other DAG
+func (waitFor WaitFor) Timeout() time.Duration {
+	if waitFor.TimeoutSeconds == 0 {
+		return defaultWaitTimeout
+	}
+	return time.Duration(waitFor.TimeoutSeconds) * time.Second
+}
+
+// validate returns the problems of the WaitFor of the DAG with the given name
+func (waitFor WaitFor) validate(dagName string) []error {
+	problems := make([]error, 0)
+	if waitFor.DAG == "" {
+		problems = append(problems, fmt.Errorf("wait for needs the name of a DAG"))
+	} else if !validNameRegex.MatchString(waitFor.DAG) {
+		problems = append(problems, fmt.Errorf(
+			"wait for DAG %q does not match the pattern %s",
+			waitFor.DAG,
+			validNameRegexString,
+		))
+	}
+	if waitFor.DAG == dagName {
+		problems = append(problems, fmt.Errorf("DAG %s cannot wait for itself", dagName))
+	}
+	switch waitFor.RequiredStatus() {
+	case string(core.PodSucceeded), string(core.PodFailed), WaitStatusFinished:
+	default:
+		problems = append(problems, fmt.Errorf(
+			"wait for status %q must be %s, %s or %s",
+			waitFor.Status,
+			core.PodSucceeded,
+			core.PodFailed,
+			WaitStatusFinished,
+		))
+	}
+	if waitFor.TimeoutSeconds < 0 {
+		problems = append(problems, fmt.Errorf("wait for timeout must not be negative, got %d", waitFor.TimeoutSeconds))
+	}
+	switch waitFor.OnTimeout {
+	case "", OnTimeoutFail, OnTimeoutSkip, OnTimeoutRun:
+	default:
+		problems = append(problems, fmt.Errorf(
+			"wait for on timeout %q must be %s, %s or %s",
+			waitFor.OnTimeout,
+			OnTimeoutFail,
+			OnTimeoutSkip,
+			OnTimeoutRun,
+		))
+	}
+	return problems
+}
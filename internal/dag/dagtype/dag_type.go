@@ -2,15 +2,21 @@ package dagtype
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	goflowconfig "goflow/internal/config"
 	"goflow/internal/dag/activeruns"
 	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/metrics"
+	"goflow/internal/dag/pool"
 	dagrun "goflow/internal/dag/run"
+	"goflow/internal/executor"
 	"goflow/internal/jsonpanic"
-	"goflow/internal/k8s/pod/event/holder"
 	"goflow/internal/logs"
+	"goflow/internal/logstore"
+	"goflow/internal/notify"
+	"goflow/internal/sensor"
+	"goflow/telemetry"
 	"io/ioutil"
 	"os"
 	"path"
@@ -22,33 +28,61 @@ import (
 
 	dagtable "goflow/internal/dag/sql/dag"
 	dagruntable "goflow/internal/dag/sql/dagrun"
+	datasettable "goflow/internal/dag/sql/dataset"
 
 	"github.com/robfig/cron"
-	"k8s.io/client-go/kubernetes"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // ScheduleCache is a map from string to cron schedule
 type ScheduleCache map[string]cron.Schedule
 
+// finishedRunsKept is the number of finished runs kept in memory per DAG, older runs are only
+// available from the dagrun table
+const finishedRunsKept = 10
+
+// ErrMaxActiveRuns is returned when triggering a run of a DAG that has its maximum of active runs
+var ErrMaxActiveRuns = errors.New("the DAG already has its maximum number of active runs")
+
+// ErrRunExists is returned when starting a run of a DAG that was already started with the same
+// trigger for the execution date, by this goflow instance or another one
+var ErrRunExists = errors.New("the DAG already has a run with the same trigger for the execution date")
+
+// ErrRunNotActive is returned when cancelling a run that is not among the cached runs of a DAG
+var ErrRunNotActive = errors.New("the DAG has no active run with the given id")
+
 // DAG is directed acyclic graph for hold job information
 // Note that LastUpdated is set in Orchestrator.collectDAG()
+// DAGRuns is a bounded cache holding the active runs and the most recently finished ones
+// lastDatasetRun is the execution date of the last run triggered by the datasets the DAG consumes
 type DAG struct {
 	Config              *dagconfig.DAGConfig
 	Code                string
 	StartDateTime       time.Time
 	EndDateTime         time.Time
 	DAGRuns             []*dagrun.DAGRun
-	kubeClient          kubernetes.Interface
+	runsLock            *sync.Mutex
+	executors           executor.Registry
 	ActiveRuns          *activeruns.ActiveRuns
 	MostRecentExecution time.Time
 	timeLock            *sync.Mutex
 	schedules           ScheduleCache
 	*dagtable.TableClient
-	filePath          string
-	dagRunTableClient *dagruntable.TableClient
-	ID                int
-	IsOn              bool
-	LastUpdated       time.Time
+	filePath           string
+	dagRunTableClient  *dagruntable.TableClient
+	datasetTableClient *datasettable.TableClient
+	lastDatasetRun     time.Time
+	logStore           logstore.Store
+	notifier           *notify.Notifier
+	sensors            sensor.Registry
+	pools              *pool.Pools
+	ID                 int
+	IsOn               bool
+	LastUpdated        time.Time
+	// ClaimsRuns is set on the DAGs of sharded instances, which share the dagrun table, so that
+	// each run is claimed in it before being started
+	ClaimsRuns bool
 }
 
 func readDAGFile(dagFilePath string) ([]byte, error) {
@@ -60,7 +94,7 @@ func readDAGFile(dagFilePath string) ([]byte, error) {
 }
 
 func getDateFromString(dateStr string) time.Time {
-	time, err := time.Parse("2006-01-02", dateStr)
+	time, err := time.Parse(dagconfig.DateFormat, dateStr)
 	if err != nil {
 		panic(err)
 	}
@@ -71,11 +105,16 @@ func getDateFromString(dateStr string) time.Time {
 func CreateDAG(
 	config *dagconfig.DAGConfig,
 	code string,
-	client kubernetes.Interface,
+	executors executor.Registry,
 	schedules ScheduleCache,
 	tableClient *dagtable.TableClient,
 	filePath string,
 	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
 	defaultIsOn bool,
 ) DAG {
 	if config.Annotations == nil {
@@ -86,17 +125,23 @@ func CreateDAG(
 	}
 	// TODO: Restore these from database table on restart
 	dag := DAG{
-		Config:            config,
-		Code:              code,
-		DAGRuns:           make([]*dagrun.DAGRun, 0),
-		kubeClient:        client,
-		ActiveRuns:        activeruns.New(),
-		timeLock:          &sync.Mutex{},
-		schedules:         schedules,
-		TableClient:       tableClient,
-		filePath:          filePath,
-		dagRunTableClient: dagRunTableClient,
-		IsOn:              defaultIsOn,
+		Config:             config,
+		Code:               code,
+		DAGRuns:            make([]*dagrun.DAGRun, 0),
+		runsLock:           &sync.Mutex{},
+		executors:          executors,
+		ActiveRuns:         activeruns.New(),
+		timeLock:           &sync.Mutex{},
+		schedules:          schedules,
+		TableClient:        tableClient,
+		filePath:           filePath,
+		dagRunTableClient:  dagRunTableClient,
+		datasetTableClient: datasetTableClient,
+		logStore:           logStore,
+		notifier:           notifier,
+		sensors:            sensors,
+		pools:              pools,
+		IsOn:               defaultIsOn,
 	}
 	dag.StartDateTime = getDateFromString(dag.Config.StartDateTime)
 	if dag.Config.EndDateTime != "" {
@@ -126,40 +171,36 @@ func newDagRow(dag *DAG) dagtable.Row {
 
 func createDAGFromJSONBytes(
 	dagBytes []byte,
-	client kubernetes.Interface,
+	executors executor.Registry,
 	goflowConfig goflowconfig.GoFlowConfig,
 	scheduleCache ScheduleCache,
 	tableClient *dagtable.TableClient,
 	filePath string,
 	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
 ) (DAG, error) {
-	dagConfigStruct := dagconfig.DAGConfig{}
-	err := json.Unmarshal(dagBytes, &dagConfigStruct)
-	dagConfigStruct.SetDefaults(goflowConfig)
+	dagConfigStruct, err := dagconfig.Load(dagBytes, goflowConfig)
 	if err != nil {
 		return DAG{}, err
 	}
 
-	// Validate schedule
-	_, err = cron.Parse(dagConfigStruct.Schedule)
-	if err != nil {
-		panic(
-			fmt.Sprintf(
-				"DAG %s has a scheduling err with schedule \"%s\": ",
-				dagConfigStruct.Name,
-				dagConfigStruct.Schedule,
-			) + err.Error(),
-		)
-	}
-
 	dag := CreateDAG(
 		&dagConfigStruct,
 		string(dagBytes),
-		client,
+		executors,
 		scheduleCache,
 		tableClient,
 		filePath,
 		dagRunTableClient,
+		datasetTableClient,
+		logStore,
+		notifier,
+		sensors,
+		pools,
 		goflowConfig.DAGsOn,
 	)
 	return dag, nil
@@ -168,12 +209,17 @@ func createDAGFromJSONBytes(
 // getDAGFromJSON creates a new dag struct from a dag file
 func getDAGFromJSON(
 	dagFilePath string,
-	client kubernetes.Interface,
+	executors executor.Registry,
 	metricsClient *metrics.DAGMetricsClient,
 	goflowConfig goflowconfig.GoFlowConfig,
 	scheduleCache ScheduleCache,
 	tableClient *dagtable.TableClient,
 	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
 ) (DAG, error) {
 	dagBytes, err := readDAGFile(dagFilePath)
 	if err != nil {
@@ -181,15 +227,20 @@ func getDAGFromJSON(
 	}
 	dagJSON, err := createDAGFromJSONBytes(
 		dagBytes,
-		client,
+		executors,
 		goflowConfig,
 		scheduleCache,
 		tableClient,
 		dagFilePath,
 		dagRunTableClient,
+		datasetTableClient,
+		logStore,
+		notifier,
+		sensors,
+		pools,
 	)
 	if err != nil {
-		logs.ErrorLogger.Printf("Error parsing dag file %s", dagFilePath)
+		logs.ErrorLogger.Printf("Error parsing dag file %s: %s", dagFilePath, err)
 		return DAG{}, err
 	}
 	dagJSON.Code = string(dagBytes)
@@ -221,38 +272,137 @@ func getDirSliceRecur(directory string) []string {
 	return files
 }
 
+// DAGFilePaths returns the paths of the DAG files loaded from the folder and its subfolders
+// Only JSON DAG files are loaded
+func DAGFilePaths(folder string) []string {
+	files := make([]string, 0)
+	for _, file := range getDirSliceRecur(folder) {
+		if strings.ToLower(filepath.Ext(file)) == ".json" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
 // GetDAGSFromFolder returns a slice of DAG structs, one for each DAG file
 // Each file must have the "dag" suffix
 // E.g., my_dag.py, some_dag.json
 func GetDAGSFromFolder(
 	folder string,
-	client kubernetes.Interface,
+	executors executor.Registry,
+	metricsClient *metrics.DAGMetricsClient,
+	goflowConfig goflowconfig.GoFlowConfig,
+	schedules ScheduleCache,
+	tableClient *dagtable.TableClient,
+	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
+) []*DAG {
+	return getDAGsFromFiles(
+		DAGFilePaths(folder),
+		executors,
+		metricsClient,
+		goflowConfig,
+		schedules,
+		tableClient,
+		dagRunTableClient,
+		datasetTableClient,
+		logStore,
+		notifier,
+		sensors,
+		pools,
+	)
+}
+
+// GetStoredDAGsFromFolder returns the DAGs of the folder that are already in the dag table, so
+// that replicas that do not schedule never add DAGs to the table
+func GetStoredDAGsFromFolder(
+	folder string,
+	executors executor.Registry,
+	metricsClient *metrics.DAGMetricsClient,
+	goflowConfig goflowconfig.GoFlowConfig,
+	schedules ScheduleCache,
+	tableClient *dagtable.TableClient,
+	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
+) []*DAG {
+	files := make([]string, 0)
+	for _, file := range DAGFilePaths(folder) {
+		dagBytes, err := readDAGFile(file)
+		if err != nil {
+			continue
+		}
+		dagConfig, err := dagconfig.Load(dagBytes, goflowConfig)
+		if err == nil && tableClient.IsDagPresent(dagConfig.Name, dagConfig.Namespace) {
+			files = append(files, file)
+		}
+	}
+	return getDAGsFromFiles(
+		files,
+		executors,
+		metricsClient,
+		goflowConfig,
+		schedules,
+		tableClient,
+		dagRunTableClient,
+		datasetTableClient,
+		logStore,
+		notifier,
+		sensors,
+		pools,
+	)
+}
+
+func getDAGsFromFiles(
+	files []string,
+	executors executor.Registry,
 	metricsClient *metrics.DAGMetricsClient,
 	goflowConfig goflowconfig.GoFlowConfig,
 	schedules ScheduleCache,
 	tableClient *dagtable.TableClient,
 	dagRunTableClient *dagruntable.TableClient,
+	datasetTableClient *datasettable.TableClient,
+	logStore logstore.Store,
+	notifier *notify.Notifier,
+	sensors sensor.Registry,
+	pools *pool.Pools,
 ) []*DAG {
-	files := getDirSliceRecur(folder)
 	dags := make([]*DAG, 0, len(files))
+	failedFiles := make([]string, 0)
 	for _, file := range files {
-		if strings.ToLower(filepath.Ext(file)) == ".json" {
-			dag, err := getDAGFromJSON(
-				file,
-				client,
-				metricsClient,
-				goflowConfig,
-				schedules,
-				tableClient,
-				dagRunTableClient,
-			)
-			if os.ErrNotExist == err {
-				logs.ErrorLogger.Printf("File %s no longer exists", file)
-			}
-			if err == nil {
-				dags = append(dags, &dag)
-			}
+		dag, err := getDAGFromJSON(
+			file,
+			executors,
+			metricsClient,
+			goflowConfig,
+			schedules,
+			tableClient,
+			dagRunTableClient,
+			datasetTableClient,
+			logStore,
+			notifier,
+			sensors,
+			pools,
+		)
+		if os.ErrNotExist == err {
+			logs.ErrorLogger.Printf("File %s no longer exists", file)
+		}
+		if err != nil {
+			failedFiles = append(failedFiles, file)
+			continue
 		}
+		dags = append(dags, &dag)
+	}
+	telemetry.DAGImportErrors.Reset()
+	for _, file := range failedFiles {
+		telemetry.DAGImportErrors.Set(1, file)
 	}
 	return dags
 }
@@ -261,22 +411,162 @@ func GetDAGSFromFolder(
 func (dag *DAG) AddDagRun(
 	executionDate time.Time,
 	withLogs bool,
-	holder *holder.ChannelHolder,
 ) *dagrun.DAGRun {
 	dagRun := dagrun.NewDAGRun(
 		executionDate,
 		dag.Config,
 		withLogs,
-		dag.kubeClient,
-		holder,
+		dag.logStore,
+		dag.executors.Get(dag.Config),
+		dag.notifier,
+		dag.sensors.Get(dag.Config),
+		dag.pools,
 		dag.ActiveRuns,
 		dag.dagRunTableClient,
 		dag.ID,
 	)
+	dag.runsLock.Lock()
 	dag.DAGRuns = append(dag.DAGRuns, dagRun)
+	dag.runsLock.Unlock()
 	return dagRun
 }
 
+// Runs returns the cached runs of the DAG, in the order they were added
+func (dag *DAG) Runs() []*dagrun.DAGRun {
+	dag.runsLock.Lock()
+	defer dag.runsLock.Unlock()
+	runs := make([]*dagrun.DAGRun, len(dag.DAGRuns))
+	copy(runs, dag.DAGRuns)
+	return runs
+}
+
+// evictFinishedRuns drops all but the most recently finished runs from the cache
+func (dag *DAG) evictFinishedRuns() {
+	dag.runsLock.Lock()
+	defer dag.runsLock.Unlock()
+	finishedCount := 0
+	for _, run := range dag.DAGRuns {
+		if run.Finished() {
+			finishedCount++
+		}
+	}
+	// A new slice is built so that slices handed out earlier are left untouched
+	runs := make([]*dagrun.DAGRun, 0, len(dag.DAGRuns))
+	for _, run := range dag.DAGRuns {
+		if run.Finished() && finishedCount > finishedRunsKept {
+			finishedCount--
+			continue
+		}
+		runs = append(runs, run)
+	}
+	dag.DAGRuns = runs
+}
+
+// startRun runs the dag run, updates the datasets the DAG produces if it succeeded and evicts
+// finished runs from the cache once it is done
+func (dag *DAG) startRun(dagRun *dagrun.DAGRun) {
+	dagRun.Start()
+	if dagRun.HandedOver() {
+		dag.removeRun(dagRun)
+		return
+	}
+	dag.finishRun(dagRun)
+}
+
+// removeRun drops the dag run from the cache
+func (dag *DAG) removeRun(dagRun *dagrun.DAGRun) {
+	dag.runsLock.Lock()
+	defer dag.runsLock.Unlock()
+	// A new slice is built so that slices handed out earlier are left untouched
+	runs := make([]*dagrun.DAGRun, 0, len(dag.DAGRuns))
+	for _, run := range dag.DAGRuns {
+		if run != dagRun {
+			runs = append(runs, run)
+		}
+	}
+	dag.DAGRuns = runs
+}
+
+// adoptRun is startRun for dag runs taken over from another goflow instance
+func (dag *DAG) adoptRun(dagRun *dagrun.DAGRun) {
+	dagRun.Adopt()
+	dag.finishRun(dagRun)
+}
+
+func (dag *DAG) finishRun(dagRun *dagrun.DAGRun) {
+	if dagRun.Status() == string(core.PodSucceeded) {
+		dag.emitDatasetEvents(dagRun)
+	}
+	dag.evictFinishedRuns()
+}
+
+// emitDatasetEvents records an update of each dataset the DAG produces by the dag run
+func (dag *DAG) emitDatasetEvents(dagRun *dagrun.DAGRun) {
+	// Events are stored with second precision
+	eventDate := dagRun.EndTime.UTC().Truncate(time.Second)
+	for _, dataset := range dag.Config.Produces {
+		dag.datasetTableClient.InsertEvent(
+			datasettable.NewRow(dataset, eventDate, datasettable.OriginRun, dag.Config.Name, dagRun.Name),
+		)
+		telemetry.DatasetEvents.Inc(dataset, datasettable.OriginRun)
+		logs.InfoLogger.Printf("Dag run %s updated dataset %s", dagRun.Name, dataset)
+	}
+}
+
+// datasetCursor returns the execution date of the last run triggered by datasets, restoring it
+// from the dagrun table the first time, or the start date of the DAG if there was none
+// timeLock must be held
+func (dag *DAG) datasetCursor() time.Time {
+	if dag.lastDatasetRun.IsZero() {
+		dag.lastDatasetRun = dag.StartDateTime
+		rows := dag.dagRunTableClient.GetDagRuns(dagruntable.Filter{
+			DagIDs:     []int{dag.ID},
+			Triggers:   []string{dagruntable.TriggerDataset},
+			Descending: true,
+			Limit:      1,
+		})
+		if len(rows) > 0 && rows[0].ExecutionDate.After(dag.lastDatasetRun) {
+			dag.lastDatasetRun = rows[0].ExecutionDate
+		}
+	}
+	return dag.lastDatasetRun
+}
+
+// RestoreMostRecentExecution moves the most recent execution of the DAG up to the latest
+// scheduled run in the dagrun table, so that a replica taking over scheduling does not start
+// again the runs that another replica started
+func (dag *DAG) RestoreMostRecentExecution() {
+	rows := dag.dagRunTableClient.GetDagRuns(dagruntable.Filter{
+		DagIDs:     []int{dag.ID},
+		Triggers:   []string{dagruntable.TriggerScheduled},
+		Descending: true,
+		Limit:      1,
+	})
+	dag.timeLock.Lock()
+	defer dag.timeLock.Unlock()
+	if len(rows) > 0 && rows[0].ExecutionDate.After(dag.MostRecentExecution) {
+		dag.MostRecentExecution = rows[0].ExecutionDate
+	}
+}
+
+// datasetsUpdatedDate returns the date of the latest update of the datasets the DAG consumes,
+// false unless each of them has been updated since the last run triggered by datasets
+// timeLock must be held
+func (dag *DAG) datasetsUpdatedDate() (time.Time, bool) {
+	since := dag.datasetCursor()
+	var updated time.Time
+	for _, dataset := range dag.Config.Consumes {
+		event, ok := dag.datasetTableClient.LatestEvent(dataset)
+		if !ok || !event.EventDate.After(since) {
+			return time.Time{}, false
+		}
+		if event.EventDate.After(updated) {
+			updated = event.EventDate
+		}
+	}
+	return updated, true
+}
+
 // getSchedule parses and caches or returns the stored schedule
 func (dag *DAG) getSchedule() cron.Schedule {
 	schedule, ok := dag.schedules[dag.Config.Schedule]
@@ -296,37 +586,207 @@ func (dag *DAG) getNextTime(lastTime time.Time) time.Time {
 	return next
 }
 
+// PendingRun is a run of the DAG that is due but has not been started
+type PendingRun struct {
+	ExecutionDate time.Time
+	Trigger       string
+}
+
+// scheduleReady returns true if the run following the scheduled run for the last execution date
+// is due
+func (dag *DAG) scheduleReady(lastExecution, now time.Time) bool {
+	return lastExecution.Before(now) ||
+		lastExecution.Equal(now) && lastExecution.Before(dag.EndDateTime)
+}
+
+// PendingRuns returns up to limit runs of the DAG that are due, in the order they must be started
+// A run triggered by the datasets the DAG consumes comes first once they have all been updated,
+// followed by the scheduled runs that are due up to the end date of the DAG, so that DAGs that
+// missed several ticks catch up
+func (dag *DAG) PendingRuns(limit int) []PendingRun {
+	pending := make([]PendingRun, 0)
+	dag.timeLock.Lock()
+	defer dag.timeLock.Unlock()
+	if len(dag.Config.Consumes) > 0 {
+		executionDate, ok := dag.datasetsUpdatedDate()
+		if ok && (dag.EndDateTime.IsZero() || !executionDate.After(dag.EndDateTime)) {
+			pending = append(pending, PendingRun{executionDate, dagruntable.TriggerDataset})
+		}
+	}
+	if !dag.Config.IsScheduled() {
+		return pending
+	}
+	now := time.Now()
+	lastExecution := dag.MostRecentExecution
+	for len(pending) < limit && dag.scheduleReady(lastExecution, now) {
+		if lastExecution.IsZero() {
+			lastExecution = dag.StartDateTime
+		} else {
+			lastExecution = dag.getNextTime(lastExecution)
+		}
+		if !dag.EndDateTime.IsZero() && lastExecution.After(dag.EndDateTime) {
+			break
+		}
+		pending = append(pending, PendingRun{lastExecution, dagruntable.TriggerScheduled})
+	}
+	return pending
+}
+
+// StartPendingRun starts the pending run, which must be the first of the pending runs of the DAG
+// ErrRunExists is returned if the run was already started, the DAG moves on to the next pending run
+func (dag *DAG) StartPendingRun(pending PendingRun) (*dagrun.DAGRun, error) {
+	dag.timeLock.Lock()
+	if pending.Trigger == dagruntable.TriggerDataset {
+		dag.lastDatasetRun = pending.ExecutionDate
+	} else {
+		dag.MostRecentExecution = pending.ExecutionDate
+	}
+	dagRun, err := dag.addRun(pending.ExecutionDate, pending.Trigger)
+	dag.timeLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	dag.ActiveRuns.Inc()
+	go dag.startRun(dagRun)
+	return dagRun, nil
+}
+
+// addRun adds a run of the DAG with the trigger for the execution date to the cache, unless such a
+// run is cached or, for DAGs that claim their runs, was claimed by another goflow instance
+func (dag *DAG) addRun(executionDate time.Time, trigger string) (*dagrun.DAGRun, error) {
+	for _, run := range dag.Runs() {
+		if run.ExecutionDate.Time.Equal(executionDate) && run.Trigger == trigger {
+			return nil, ErrRunExists
+		}
+	}
+	dagRun := dag.AddDagRun(executionDate, dag.Config.WithLogs)
+	dagRun.Trigger = trigger
+	if dag.ClaimsRuns && !dagRun.Claim() {
+		logs.WarningLogger.Printf("Dag run %s was claimed by another goflow instance", dagRun.Name)
+		dag.removeRun(dagRun)
+		return nil, ErrRunExists
+	}
+	return dagRun, nil
+}
+
+// AdoptRun takes over the dag run with the given name that another goflow instance submitted
+// and is still running, without submitting it again
+func (dag *DAG) AdoptRun(runID string, executionDate time.Time, trigger string) *dagrun.DAGRun {
+	dagRun := dag.AddDagRun(executionDate, dag.Config.WithLogs)
+	dagRun.Name = runID
+	dagRun.Trigger = trigger
+	dag.ActiveRuns.Inc()
+	go dag.adoptRun(dagRun)
+	return dagRun
+}
+
 // AddNextDagRunIfReady adds the next dag run if ready for it, returns true if added, else false
-func (dag *DAG) AddNextDagRunIfReady(holder *holder.ChannelHolder) (ready bool) {
-	ready = dag.Ready()
-	if ready {
-		dag.timeLock.Lock()
-		switch {
-		case dag.MostRecentExecution.IsZero():
-			dag.MostRecentExecution = dag.StartDateTime
-		default:
-			dag.MostRecentExecution = dag.getNextTime(dag.MostRecentExecution)
+// Runs are added when the datasets the DAG consumes have been updated, or else when its schedule
+// is due
+func (dag *DAG) AddNextDagRunIfReady() bool {
+	if !dag.IsOn || dag.ActiveRuns.Get() >= dag.Config.MaxActiveRuns {
+		return false
+	}
+	pending := dag.PendingRuns(1)
+	if len(pending) == 0 {
+		return false
+	}
+	_, err := dag.StartPendingRun(pending[0])
+	return err == nil
+}
+
+// NextExecutionDate returns the execution date of the next scheduled run of the DAG, the current
+// time for DAGs without a schedule
+func (dag *DAG) NextExecutionDate() time.Time {
+	if !dag.Config.IsScheduled() {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	dag.timeLock.Lock()
+	defer dag.timeLock.Unlock()
+	if dag.MostRecentExecution.IsZero() {
+		return dag.StartDateTime
+	}
+	return dag.getNextTime(dag.MostRecentExecution)
+}
+
+// ScheduledDateAfter returns the first execution date of the schedule of the DAG after the date,
+// false if the DAG ends before it or has no schedule
+func (dag *DAG) ScheduledDateAfter(date time.Time) (time.Time, bool) {
+	if !dag.Config.IsScheduled() {
+		return time.Time{}, false
+	}
+	next := dag.StartDateTime
+	if !date.Before(next) {
+		next = dag.getSchedule().Next(date)
+	}
+	if !dag.EndDateTime.IsZero() && next.After(dag.EndDateTime) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Render returns the pod, Job or process a run of the DAG would create for the execution date
+func (dag *DAG) Render(executionDate time.Time) (runtime.Object, error) {
+	runExecutor := dag.executors.Get(dag.Config)
+	if runExecutor == nil {
+		return nil, dagrun.ErrNoExecutor
+	}
+	return dagrun.Render(runExecutor, dag.Config, dag.ID, executionDate), nil
+}
+
+// TriggerRun adds and starts a manually triggered run executing at the current time
+// ErrRunExists is returned if a run was already triggered in the same second
+func (dag *DAG) TriggerRun() (*dagrun.DAGRun, error) {
+	// Execution dates are stored with second precision
+	return dag.triggerRun(time.Now().UTC().Truncate(time.Second))
+}
+
+// triggerRun adds and starts a manually triggered run for the execution date
+func (dag *DAG) triggerRun(executionDate time.Time) (*dagrun.DAGRun, error) {
+	dag.timeLock.Lock()
+	defer dag.timeLock.Unlock()
+	if dag.ActiveRuns.Get() >= dag.Config.MaxActiveRuns {
+		return nil, ErrMaxActiveRuns
+	}
+	dagRun, err := dag.addRun(executionDate, dagruntable.TriggerManual)
+	if err != nil {
+		return nil, err
+	}
+	dag.ActiveRuns.Inc()
+	go dag.startRun(dagRun)
+	return dagRun, nil
+}
+
+// CachedRun returns the cached run with the given id, false if it is not cached
+func (dag *DAG) CachedRun(runID string) (*dagrun.DAGRun, bool) {
+	for _, run := range dag.Runs() {
+		if run.Name == runID {
+			return run, true
 		}
-		dagRun := dag.AddDagRun(dag.MostRecentExecution, dag.Config.WithLogs, holder)
-		dag.timeLock.Unlock()
-		dag.ActiveRuns.Inc()
-		go dagRun.Start()
 	}
-	return
+	return nil, false
 }
 
-// TerminateAndDeleteRuns removes all active DAG runs and their associated pods
+// CancelRun cancels the cached run with the given id and returns it
+func (dag *DAG) CancelRun(runID string) (*dagrun.DAGRun, error) {
+	if run, ok := dag.CachedRun(runID); ok {
+		return run, run.Cancel()
+	}
+	return nil, ErrRunNotActive
+}
+
+// TerminateAndDeleteRuns stops all active DAG runs and their associated pods, Jobs or processes
 func (dag *DAG) TerminateAndDeleteRuns() {
-	for _, run := range dag.DAGRuns {
-		run.DeletePod()
+	for _, run := range dag.Runs() {
+		if !run.Finished() {
+			run.Terminate()
+		}
 	}
 }
 
 // Ready returns true if the DAG is ready for another DAG Run to be created
 func (dag *DAG) Ready() bool {
-	currentTime := time.Now()
-	scheduleReady := (dag.MostRecentExecution.Before(currentTime) ||
-		dag.MostRecentExecution.Equal(currentTime) && dag.MostRecentExecution.Before(dag.EndDateTime))
+	scheduleReady := dag.scheduleReady(dag.MostRecentExecution, time.Now())
 	logs.InfoLogger.Printf("dag %s is ready: %v\n", dag.Config.Name, scheduleReady)
 	return (dag.ActiveRuns.Get() < dag.Config.MaxActiveRuns) && scheduleReady && dag.IsOn
 }
@@ -8,9 +8,15 @@ import (
 	"goflow/internal/dag/metrics"
 	dagrun "goflow/internal/dag/run"
 	"goflow/internal/database"
+	"goflow/internal/executor"
 	k8sclient "goflow/internal/k8s/client"
+	k8sexecutor "goflow/internal/k8s/executor"
 	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/logstore"
 	"goflow/internal/testutils"
+	"goflow/telemetry"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -21,6 +27,7 @@ import (
 
 	dagtable "goflow/internal/dag/sql/dag"
 	dagruntable "goflow/internal/dag/sql/dagrun"
+	datasettable "goflow/internal/dag/sql/dataset"
 
 	core "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,6 +39,7 @@ var DAGPATH string
 var TABLECLIENT *dagtable.TableClient
 var SQLCLIENT *database.SQLClient
 var RUNTABLECLIENT *dagruntable.TableClient
+var DATASETTABLECLIENT *datasettable.TableClient
 var METRICSCLIENT metrics.DAGMetricsClient
 
 func setUpNamespaces(client kubernetes.Interface) {
@@ -58,6 +66,7 @@ func TestMain(m *testing.M) {
 	SQLCLIENT = database.NewSQLiteClient(testutils.GetSQLiteLocation())
 	TABLECLIENT = dagtable.NewTableClient(SQLCLIENT)
 	RUNTABLECLIENT = dagruntable.NewTableClient(SQLCLIENT)
+	DATASETTABLECLIENT = datasettable.NewTableClient(SQLCLIENT)
 	m.Run()
 }
 
@@ -87,6 +96,7 @@ func (stringMap StringMap) Bytes() []byte {
 func setUpDatabase() {
 	TABLECLIENT.CreateTable()
 	RUNTABLECLIENT.CreateTable()
+	DATASETTABLECLIENT.CreateTable()
 }
 
 func TestDAGFromJSONBytes(t *testing.T) {
@@ -107,6 +117,7 @@ func TestDAGFromJSONBytes(t *testing.T) {
 		Labels:        map[string]string{"test": "test-label"},
 		Annotations:   map[string]string{"anno": "value"},
 		MaxActiveRuns: 1,
+		Executor:      goflowconfig.ExecutorPod,
 	}
 	formattedJSONString := string(config.Marshal())
 	expectedDAG := DAG{
@@ -115,21 +126,25 @@ func TestDAGFromJSONBytes(t *testing.T) {
 		StartDateTime:       time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
 		EndDateTime:         time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
 		DAGRuns:             make([]*dagrun.DAGRun, 0),
-		kubeClient:          nil,
+		executors:           nil,
 		ActiveRuns:          activeruns.New(),
 		MostRecentExecution: time.Time{},
 		timeLock:            &sync.Mutex{},
 	}
 	expectedJSONString := string(expectedDAG.Marshal())
-	kubeClient := fake.NewSimpleClientset()
 	dag, err := createDAGFromJSONBytes(
 		[]byte(formattedJSONString),
-		kubeClient,
+		getTestExecutors(fake.NewSimpleClientset()),
 		goflowconfig.GoFlowConfig{},
 		make(ScheduleCache),
 		TABLECLIENT,
 		"path",
 		RUNTABLECLIENT,
+		DATASETTABLECLIENT,
+		logstore.NewLocalStore(testutils.GetLogsFolder()),
+		nil,
+		nil,
+		nil,
 	)
 	if err != nil {
 		panic(err)
@@ -165,6 +180,40 @@ func TestReadFiles(t *testing.T) {
 	}
 }
 
+func TestDAGImportErrors(t *testing.T) {
+	folder, err := ioutil.TempDir("", "dags")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(folder)
+	brokenFile := filepath.Join(folder, "broken_dag.json")
+	if err := ioutil.WriteFile(brokenFile, []byte("{"), 0644); err != nil {
+		panic(err)
+	}
+	getDAGs := func() []*DAG {
+		return GetDAGSFromFolder(
+			folder, nil, nil, goflowconfig.GoFlowConfig{}, make(ScheduleCache), TABLECLIENT,
+			RUNTABLECLIENT, DATASETTABLECLIENT, nil, nil, nil, nil,
+		)
+	}
+
+	getDAGs()
+	getDAGs()
+	if errors := telemetry.DAGImportErrors.Get(brokenFile); errors != 1 {
+		t.Errorf("Expected 1 import error for %s, found %v", brokenFile, errors)
+	}
+
+	os.Remove(brokenFile)
+	getDAGs()
+	if errors := telemetry.DAGImportErrors.Get(brokenFile); errors != 0 {
+		t.Errorf("Expected no import error for %s, found %v", brokenFile, errors)
+	}
+}
+
+func getTestExecutors(client kubernetes.Interface) executor.Registry {
+	return executor.Registry{goflowconfig.ExecutorPod: k8sexecutor.NewPodExecutor(client, holder.New(), "")}
+}
+
 func getTestDAG(client kubernetes.Interface) *DAG {
 	dag := CreateDAG(&dagconfig.DAGConfig{
 		Name:          "test",
@@ -177,7 +226,7 @@ func getTestDAG(client kubernetes.Interface) *DAG {
 		MaxActiveRuns: 1,
 		StartDateTime: "2019-01-01",
 		EndDateTime:   "",
-	}, "", client, make(ScheduleCache), TABLECLIENT, "path", RUNTABLECLIENT, false)
+	}, "", getTestExecutors(client), make(ScheduleCache), TABLECLIENT, "path", RUNTABLECLIENT, DATASETTABLECLIENT, nil, nil, nil, nil, false)
 	return &dag
 }
 
@@ -237,7 +286,7 @@ func TestAddDagRun(t *testing.T) {
 	setUpDatabase()
 	testDAG := getTestDAGFakeClient(getNewTestClient())
 	currentTime := getTestDate()
-	testDAG.AddDagRun(currentTime, testDAG.Config.WithLogs, holder.New())
+	testDAG.AddDagRun(currentTime, testDAG.Config.WithLogs)
 	reportErrorCounts(t, len(testDAG.DAGRuns), 1, testDAG)
 }
 
@@ -258,24 +307,158 @@ func TestAddDagRunIfReady(t *testing.T) {
 
 	for _, action := range actionCases {
 		func() {
+			defer database.PurgeDB(SQLCLIENT)
 			setUpDatabase()
 			client := getNewTestClient()
 			testDAG := getTestDAGFakeClient(client)
 			testDAG.IsOn = true // Turn on DAG
-			channelHolder := holder.New()
-			testDAG.AddNextDagRunIfReady(channelHolder)
+			testDAG.AddNextDagRunIfReady()
 			action.actionFunc(testDAG)
-			testDAG.AddNextDagRunIfReady(channelHolder)
+			testDAG.AddNextDagRunIfReady()
 			reportErrorCounts(t, len(testDAG.DAGRuns), action.expectedRuns, testDAG)
-			time.Sleep(10000)
-			// Make sure there are no more active dagruns before test terminates
-			if testDAG.ActiveRuns.Get() != 0 {
-				testDAG.ActiveRuns.Dec()
-			}
-			for testDAG.ActiveRuns.Get() != 0 {
-				time.Sleep(10000)
+			// Make sure the runs are stored as running before the database is purged, their pods
+			// never finish so they write nothing after that
+			for !runsStored(testDAG, action.expectedRuns) {
+				time.Sleep(time.Millisecond)
 			}
 		}()
 	}
-	database.PurgeDB(SQLCLIENT)
+}
+
+func TestStartPendingRunClaimedByAnotherInstance(t *testing.T) {
+	defer database.PurgeDB(SQLCLIENT)
+	setUpDatabase()
+	executionDate := getTestDate()
+	otherInstanceDAG := getTestDatasetDAG("test-claims-runs")
+	if !otherInstanceDAG.AddDagRun(executionDate, false).Claim() {
+		t.Fatal("Expected the run to be claimed by the other instance")
+	}
+
+	testDAG := getTestDatasetDAG("test-claims-runs")
+	testDAG.ClaimsRuns = true
+	dagRun, err := testDAG.StartPendingRun(PendingRun{executionDate, dagruntable.TriggerScheduled})
+	if err != ErrRunExists || dagRun != nil {
+		t.Errorf("Expected the claimed run not to be started, found %v", err)
+	}
+	if len(testDAG.Runs()) != 0 || testDAG.ActiveRuns.Get() != 0 || !testDAG.MostRecentExecution.Equal(executionDate) {
+		t.Errorf("Expected the DAG to move past the claimed run without caching it, found %d runs", len(testDAG.Runs()))
+	}
+}
+
+func TestTriggerRunTwice(t *testing.T) {
+	defer database.PurgeDB(SQLCLIENT)
+	setUpDatabase()
+	testDAG := getTestDatasetDAG("test-trigger-twice")
+	testDAG.Config.MaxActiveRuns = 3
+	testDAG.ClaimsRuns = true
+	executionDate := getTestDate()
+	if _, err := testDAG.StartPendingRun(PendingRun{executionDate, dagruntable.TriggerScheduled}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testDAG.triggerRun(executionDate); err != nil {
+		t.Errorf("Expected a run to be triggered on a scheduled tick, found %v", err)
+	}
+	if _, err := testDAG.triggerRun(executionDate); err != ErrRunExists {
+		t.Errorf("Expected a second run triggered for the same date to be refused, found %v", err)
+	}
+	if len(testDAG.Runs()) != 2 {
+		t.Errorf("Expected the scheduled and the manual run to be cached, found %d runs", len(testDAG.Runs()))
+	}
+	for testDAG.ActiveRuns.Get() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// runsStored returns true if the last count runs of the DAG are stored as running
+func runsStored(dag *DAG, count int) bool {
+	rows := RUNTABLECLIENT.GetLastNRunsForDagID(dag.ID, count)
+	for _, row := range rows {
+		if row.Status != string(core.PodRunning) {
+			return false
+		}
+	}
+	return len(rows) == count
+}
+
+func TestPendingRuns(t *testing.T) {
+	defer database.PurgeDB(SQLCLIENT)
+	setUpDatabase()
+	testDAG := getTestDAGFakeClient(getNewTestClient())
+	pending := testDAG.PendingRuns(3)
+	if len(pending) != 3 {
+		t.Fatalf("Expected the DAG to catch up with 3 runs, found %v", pending)
+	}
+	for i, run := range pending {
+		expected := getTestDate().Add(time.Duration(i) * time.Second)
+		if !run.ExecutionDate.Equal(expected) || run.Trigger != dagruntable.TriggerScheduled {
+			t.Errorf("Expected a scheduled run at %s, found %v", expected, run)
+		}
+	}
+	testDAG.MostRecentExecution = time.Now().Add(time.Hour)
+	if len(testDAG.PendingRuns(3)) != 0 {
+		t.Error("Expected no pending runs until the schedule is due")
+	}
+	testDAG.MostRecentExecution = time.Time{}
+	testDAG.EndDateTime = getTestDate().Add(time.Second)
+	if pending := testDAG.PendingRuns(3); len(pending) != 2 {
+		t.Errorf("Expected no pending runs after the end date, found %v", pending)
+	}
+}
+
+func getTestDatasetDAG(name string) *DAG {
+	dag := CreateDAG(&dagconfig.DAGConfig{
+		Name:          name,
+		Namespace:     "default",
+		MaxActiveRuns: 1,
+		StartDateTime: "2019-01-01",
+		DryRun:        true,
+		Consumes:      []string{"orders", "customers"},
+		Produces:      []string{"report"},
+	}, "", executor.Registry{}, make(ScheduleCache), TABLECLIENT, "path", RUNTABLECLIENT, DATASETTABLECLIENT, nil, nil, nil, nil, true)
+	return &dag
+}
+
+func TestAddDatasetRunIfReady(t *testing.T) {
+	defer database.PurgeDB(SQLCLIENT)
+	setUpDatabase()
+	testDAG := getTestDatasetDAG("consumer")
+	updateDate := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	DATASETTABLECLIENT.InsertEvent(datasettable.NewRow("orders", updateDate, datasettable.OriginExternal, "test", ""))
+	if testDAG.AddNextDagRunIfReady() {
+		t.Error("Expected no run until every consumed dataset has been updated")
+	}
+	DATASETTABLECLIENT.InsertEvent(
+		datasettable.NewRow("customers", updateDate.Add(time.Hour), datasettable.OriginExternal, "test", ""),
+	)
+	if !testDAG.AddNextDagRunIfReady() {
+		t.Fatal("Expected a run once every consumed dataset has been updated")
+	}
+	dagRun := testDAG.Runs()[0]
+	if dagRun.Trigger != dagruntable.TriggerDataset || !dagRun.ExecutionDate.Time.Equal(updateDate.Add(time.Hour)) {
+		t.Errorf("Expected a dataset run executing at the latest update, found %s", dagRun)
+	}
+	for testDAG.ActiveRuns.Get() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if testDAG.AddNextDagRunIfReady() {
+		t.Error("Expected no run until the datasets are updated again")
+	}
+	// The last dataset run is restored from the dagrun table
+	if getTestDatasetDAG("consumer").AddNextDagRunIfReady() {
+		t.Error("Expected the datasets consumed by the last run not to trigger another one")
+	}
+}
+
+func TestEmitDatasetEvents(t *testing.T) {
+	defer database.PurgeDB(SQLCLIENT)
+	setUpDatabase()
+	testDAG := getTestDatasetDAG("producer")
+	dagRun := testDAG.AddDagRun(getTestDate(), false)
+	dagRun.EndTime = v1.Time{Time: time.Date(2019, 1, 1, 1, 0, 0, 0, time.UTC)}
+	testDAG.emitDatasetEvents(dagRun)
+	event, ok := DATASETTABLECLIENT.LatestEvent("report")
+	if !ok || event.Source != "producer" || event.RunID != dagRun.Name || !event.EventDate.Equal(dagRun.EndTime.Time) {
+		t.Errorf("Expected the run to have updated the report dataset, found %s", event)
+	}
 }
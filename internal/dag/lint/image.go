@@ -0,0 +1,205 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dockerHubRegistry is the registry of images that do not name one
+const dockerHubRegistry = "registry-1.docker.io"
+
+var (
+	pathComponentRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagRegex           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegex        = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+	bearerParamRegex   = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// ErrImageNotFound is returned by resolvers when the registry does not have the image
+var ErrImageNotFound = errors.New("image not found")
+
+// Image is a parsed container image reference
+// Reference is the digest of the image if there is one, else its tag
+type Image struct {
+	Registry   string
+	Repository string
+	Reference  string
+}
+
+func (image Image) String() string {
+	separator := ":"
+	if strings.Contains(image.Reference, ":") {
+		separator = "@"
+	}
+	return image.Registry + "/" + image.Repository + separator + image.Reference
+}
+
+// ParseImage parses an image reference the way container runtimes do, defaulting to the latest tag
+// on Docker Hub
+func ParseImage(reference string) (Image, error) {
+	invalid := fmt.Errorf("image %q is not a valid image reference", reference)
+	if reference == "" {
+		return Image{}, fmt.Errorf("image must be set")
+	}
+	image := Image{Registry: dockerHubRegistry, Reference: "latest"}
+	name := reference
+	if at := strings.Index(name, "@"); at >= 0 {
+		image.Reference = name[at+1:]
+		name = name[:at]
+		if !digestRegex.MatchString(image.Reference) {
+			return Image{}, invalid
+		}
+	}
+	components := strings.Split(name, "/")
+	// The first component names a registry if it looks like a host
+	if len(components) > 1 &&
+		(strings.ContainsAny(components[0], ".:") || components[0] == "localhost") {
+		image.Registry = components[0]
+		components = components[1:]
+	}
+	last := components[len(components)-1]
+	if colon := strings.LastIndex(last, ":"); colon >= 0 {
+		tag := last[colon+1:]
+		if !tagRegex.MatchString(tag) {
+			return Image{}, invalid
+		}
+		if !strings.Contains(image.Reference, ":") {
+			image.Reference = tag
+		}
+		components[len(components)-1] = last[:colon]
+	}
+	for _, component := range components {
+		if !pathComponentRegex.MatchString(component) {
+			return Image{}, invalid
+		}
+	}
+	if image.Registry == dockerHubRegistry && len(components) == 1 {
+		components = append([]string{"library"}, components...)
+	}
+	image.Repository = strings.Join(components, "/")
+	return image, nil
+}
+
+// ImageResolver checks that images exist in their registry
+// Resolve returns ErrImageNotFound if the registry does not have the image, and another error if
+// the registry could not tell
+type ImageResolver interface {
+	Resolve(image Image) error
+}
+
+// registryResolver looks images up with the registry HTTP API, authenticating anonymously
+type registryResolver struct {
+	client *http.Client
+	scheme string
+}
+
+// NewRegistryResolver returns a resolver that looks images up in their registry
+func NewRegistryResolver() ImageResolver {
+	return &registryResolver{&http.Client{Timeout: 10 * time.Second}, "https"}
+}
+
+// manifestTypes are the manifest media types accepted from registries
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+func (resolver *registryResolver) headManifest(image Image, token string) (*http.Response, error) {
+	manifestURL := fmt.Sprintf(
+		"%s://%s/v2/%s/manifests/%s",
+		resolver.scheme,
+		image.Registry,
+		image.Repository,
+		image.Reference,
+	)
+	request, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := resolver.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	return response, nil
+}
+
+// anonymousToken requests a pull token for the challenge of a registry
+func (resolver *registryResolver) anonymousToken(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("registry requires credentials")
+	}
+	params := make(map[string]string)
+	for _, match := range bearerParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry sent an invalid authentication challenge")
+	}
+	query := tokenURL.Query()
+	for _, name := range []string{"service", "scope"} {
+		if params[name] != "" {
+			query.Set(name, params[name])
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+	response, err := resolver.client.Get(tokenURL.String())
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry refused an anonymous token with status %d", response.StatusCode)
+	}
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+func (resolver *registryResolver) Resolve(image Image) error {
+	response, err := resolver.headManifest(image, "")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		token, err := resolver.anonymousToken(response.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return err
+		}
+		response, err = resolver.headManifest(image, token)
+		if err != nil {
+			return err
+		}
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrImageNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// Registries hide private images from anonymous users
+		return fmt.Errorf("registry requires credentials")
+	}
+	return fmt.Errorf("registry returned status %d", response.StatusCode)
+}
@@ -0,0 +1,203 @@
+// Package lint checks DAG files the way the server loads them, without a cluster or database, and
+// reports mistakes that would otherwise only show up once the DAG is running
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"goflow/internal/config"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/dagtype"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities of findings, only errors prevent a DAG from working
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Rules reported by the linter
+const (
+	RuleLoad           = "load"
+	RuleUnknownField   = "unknown-field"
+	RuleDuplicateName  = "duplicate-name"
+	RuleEndBeforeStart = "end-before-start"
+	RuleImage          = "image"
+)
+
+// Finding is a problem found in a DAG file
+type Finding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// FileReport holds the findings of a DAG file
+type FileReport struct {
+	File     string    `json:"file"`
+	DAG      string    `json:"dag"`
+	Findings []Finding `json:"findings"`
+}
+
+// Report holds the findings of all linted files
+type Report struct {
+	Files    []FileReport `json:"files"`
+	Errors   int          `json:"errors"`
+	Warnings int          `json:"warnings"`
+}
+
+// Options configure the checks of the linter
+// Images are only looked up in their registry when a resolver is given
+type Options struct {
+	Resolver ImageResolver
+}
+
+// knownFields holds the lower case names of the fields of a DAG file, as encoding/json matches
+// field names case insensitively
+var knownFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	configType := reflect.TypeOf(dagconfig.DAGConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		fields[strings.ToLower(configType.Field(i).Name)] = true
+	}
+	return fields
+}()
+
+func (report *FileReport) add(severity string, rule string, format string, args ...interface{}) {
+	report.Findings = append(report.Findings, Finding{severity, rule, fmt.Sprintf(format, args...)})
+}
+
+// filePaths returns the DAG files among the paths, directories are searched like the DAG path of
+// the server
+func filePaths(paths []string) []string {
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			files = append(files, dagtype.DAGFilePaths(path)...)
+			continue
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// lintFile loads the DAG file like the server and checks it for mistakes the server accepts
+func lintFile(
+	file string,
+	goflowConfig config.GoFlowConfig,
+	options Options,
+	imageErrors map[string]error,
+) (FileReport, *dagconfig.DAGConfig) {
+	report := FileReport{File: file, Findings: make([]Finding, 0)}
+	dagBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		report.add(SeverityError, RuleLoad, "%s", err)
+		return report, nil
+	}
+	dagConfig, err := dagconfig.Load(dagBytes, goflowConfig)
+	report.DAG = dagConfig.Name
+	if validationErr, ok := err.(*dagconfig.ValidationError); ok {
+		for _, problem := range validationErr.Problems {
+			report.add(SeverityError, RuleLoad, "%s", problem)
+		}
+	} else if err != nil {
+		report.add(SeverityError, RuleLoad, "invalid JSON: %s", err)
+		return report, nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if json.Unmarshal(dagBytes, &fields) == nil {
+		unknown := make([]string, 0)
+		for field := range fields {
+			if !knownFields[strings.ToLower(field)] {
+				unknown = append(unknown, field)
+			}
+		}
+		sort.Strings(unknown)
+		for _, field := range unknown {
+			report.add(SeverityWarning, RuleUnknownField, "field %q is not a DAG setting and is ignored", field)
+		}
+	}
+
+	startDate, startErr := time.Parse(dagconfig.DateFormat, dagConfig.StartDateTime)
+	endDate, endErr := time.Parse(dagconfig.DateFormat, dagConfig.EndDateTime)
+	if startErr == nil && endErr == nil && endDate.Before(startDate) {
+		report.add(
+			SeverityError,
+			RuleEndBeforeStart,
+			"end date %s is before start date %s, the DAG never runs",
+			dagConfig.EndDateTime,
+			dagConfig.StartDateTime,
+		)
+	}
+
+	image, err := ParseImage(dagConfig.DockerImage)
+	switch {
+	case err != nil:
+		report.add(SeverityError, RuleImage, "%s", err)
+	case options.Resolver != nil:
+		resolveErr, checked := imageErrors[image.String()]
+		if !checked {
+			resolveErr = options.Resolver.Resolve(image)
+			imageErrors[image.String()] = resolveErr
+		}
+		if resolveErr == ErrImageNotFound {
+			report.add(SeverityError, RuleImage, "image %s does not exist", dagConfig.DockerImage)
+		} else if resolveErr != nil {
+			report.add(SeverityWarning, RuleImage, "could not resolve image %s: %s", dagConfig.DockerImage, resolveErr)
+		}
+	}
+	return report, &dagConfig
+}
+
+// Lint checks the DAG files at the paths, applying the defaults of the goflow config
+func Lint(paths []string, goflowConfig config.GoFlowConfig, options Options) Report {
+	report := Report{Files: make([]FileReport, 0)}
+	filesByName := make(map[string][]int)
+	imageErrors := make(map[string]error)
+	for _, file := range filePaths(paths) {
+		fileReport, dagConfig := lintFile(file, goflowConfig, options, imageErrors)
+		if dagConfig != nil && dagConfig.Name != "" {
+			filesByName[dagConfig.Name] = append(filesByName[dagConfig.Name], len(report.Files))
+		}
+		report.Files = append(report.Files, fileReport)
+	}
+	// The server keeps only one of the DAGs sharing a name
+	for name, indexes := range filesByName {
+		if len(indexes) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			others := make([]string, 0, len(indexes)-1)
+			for _, j := range indexes {
+				if j != i {
+					others = append(others, report.Files[j].File)
+				}
+			}
+			report.Files[i].add(
+				SeverityError,
+				RuleDuplicateName,
+				"DAG name %s is also used by %s",
+				name,
+				strings.Join(others, ", "),
+			)
+		}
+	}
+	for _, fileReport := range report.Files {
+		for _, finding := range fileReport.Findings {
+			if finding.Severity == SeverityError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+		}
+	}
+	return report
+}
@@ -0,0 +1,150 @@
+package lint
+
+import (
+	"fmt"
+	"goflow/internal/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	for _, testCase := range []struct {
+		reference string
+		expected  string
+		valid     bool
+	}{
+		{"busybox", "registry-1.docker.io/library/busybox:latest", true},
+		{"team/app:1.2", "registry-1.docker.io/team/app:1.2", true},
+		{"localhost:5000/app", "localhost:5000/app:latest", true},
+		{"gcr.io/project/app:v1@" + digest, "gcr.io/project/app@" + digest, true},
+		{"Busybox", "", false},
+		{"busybox:", "", false},
+		{"busybox@sha256:short", "", false},
+		{"", "", false},
+	} {
+		image, err := ParseImage(testCase.reference)
+		if (err == nil) != testCase.valid {
+			t.Errorf("Expected %q to be valid: %v, found error %v", testCase.reference, testCase.valid, err)
+			continue
+		}
+		if err == nil && image.String() != testCase.expected {
+			t.Errorf("Expected %q to parse as %s, found %s", testCase.reference, testCase.expected, image)
+		}
+	}
+}
+
+// testResolver reports the images of the missing repository as not found
+type testResolver struct {
+	calls int
+}
+
+func (resolver *testResolver) Resolve(image Image) error {
+	resolver.calls++
+	if image.Repository == "library/missing" {
+		return ErrImageNotFound
+	}
+	return nil
+}
+
+func writeDAGFile(folder string, name string, content string) string {
+	filePath := path.Join(folder, name)
+	err := ioutil.WriteFile(filePath, []byte(content), 0600)
+	if err != nil {
+		panic(err)
+	}
+	return filePath
+}
+
+func rules(report FileReport) string {
+	found := make([]string, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		found = append(found, finding.Rule)
+	}
+	return strings.Join(found, ",")
+}
+
+func TestLint(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goflow-lint")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(folder)
+	valid := writeDAGFile(folder, "valid_dag.json", `{"Name": "valid", "Schedule": "* * * * *", "StartDateTime": "2019-01-01"}`)
+	files := []string{
+		valid,
+		writeDAGFile(folder, "unknown_dag.json", `{"Name": "unknown", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "schedul": "x"}`),
+		writeDAGFile(folder, "dates_dag.json", `{"Name": "dates", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "EndDateTime": "2018-01-01"}`),
+		writeDAGFile(folder, "copy_dag.json", `{"Name": "valid", "Schedule": "* * * * *", "StartDateTime": "2019-01-01"}`),
+		writeDAGFile(folder, "invalid_dag.json", `{"Name": "invalid", "Schedule": "never", "StartDateTime": "2019-01-01"}`),
+		writeDAGFile(folder, "image_dag.json", `{"Name": "image", "Schedule": "* * * * *", "StartDateTime": "2019-01-01", "DockerImage": "missing"}`),
+		writeDAGFile(folder, "json_dag.json", `{"Name": `),
+	}
+	expectedRules := []string{
+		RuleDuplicateName,
+		RuleUnknownField,
+		RuleEndBeforeStart,
+		RuleDuplicateName,
+		RuleLoad,
+		RuleImage,
+		RuleLoad,
+	}
+	goflowConfig := config.GoFlowConfig{DefaultDockerImage: "busybox", MaxActiveRuns: 1}
+	resolver := &testResolver{}
+	report := Lint(files, goflowConfig, Options{resolver})
+	if len(report.Files) != len(files) {
+		t.Fatalf("Expected a report for each of the %d files, found %d", len(files), len(report.Files))
+	}
+	for i, fileReport := range report.Files {
+		if rules(fileReport) != expectedRules[i] {
+			t.Errorf("Expected %s to break rule %s, found %v", fileReport.File, expectedRules[i], fileReport.Findings)
+		}
+	}
+	if report.Errors != 6 || report.Warnings != 1 {
+		t.Errorf("Expected 6 errors and 1 warning, found %d and %d", report.Errors, report.Warnings)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("Expected each image to be resolved once, resolved %d times", resolver.calls)
+	}
+
+	report = Lint([]string{folder}, goflowConfig, Options{})
+	if len(report.Files) != len(files) {
+		t.Errorf("Expected the DAG files of the folder to be linted, found %v", report.Files)
+	}
+}
+
+func TestRegistryResolver(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token": "anonymous"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set(
+				"WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:app:pull"`, server.URL),
+			)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/team/app/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	resolver := &registryResolver{server.Client(), "http"}
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	if err := resolver.Resolve(Image{registry, "team/app", "v1"}); err != nil {
+		t.Errorf("Expected the image to resolve, found %s", err)
+	}
+	if err := resolver.Resolve(Image{registry, "team/app", "v2"}); err != ErrImageNotFound {
+		t.Errorf("Expected the missing tag not to be found, found %v", err)
+	}
+}
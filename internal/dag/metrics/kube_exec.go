@@ -27,6 +27,7 @@ func execCmd(
 	client kubernetes.Interface,
 	config *restclient.Config,
 	podName string,
+	namespace string,
 	command string,
 	stdin io.Reader,
 	stdout io.Writer,
@@ -39,7 +40,7 @@ func execCmd(
 		command,
 	}
 	req := client.CoreV1().RESTClient().Post().Resource("pods").Name(podName).
-		Namespace("default").SubResource("exec")
+		Namespace(namespace).SubResource("exec")
 	option := &core.PodExecOptions{
 		Command:   cmd,
 		Stdin:     true,
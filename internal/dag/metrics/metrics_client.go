@@ -5,8 +5,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"goflow/internal/jsonpanic"
+	"goflow/internal/k8s/pod/utils"
 	"goflow/internal/logs"
 	"math/rand"
+	"strconv"
 	"time"
 
 	restclient "k8s.io/client-go/rest"
@@ -28,6 +30,10 @@ type DAGMetricsClient struct {
 // PodMetrics holds information about the resource usage of a given pod
 type PodMetrics struct {
 	PodName string
+	DAGID   int
+	RunID   string
+	Task    string
+	Attempt int
 	Time    time.Time
 	Memory  int64
 	CPU     int64
@@ -37,8 +43,25 @@ func (metric PodMetrics) String() string {
 	return jsonpanic.JSONPanicFormat(metric)
 }
 
-func newPodMetrics(podName string) PodMetrics {
-	return PodMetrics{podName, time.Now(), 0, 0}
+// newPodMetrics returns empty metrics attributed using the goflow labels on the pod
+func newPodMetrics(pod core.Pod) (PodMetrics, error) {
+	labels := pod.Labels
+	dagID, err := strconv.Atoi(labels[utils.DAGIDLabelKey])
+	if err != nil {
+		return PodMetrics{}, fmt.Errorf("pod %s has an invalid DAG id label: %s", pod.Name, err)
+	}
+	attempt, err := strconv.Atoi(labels[utils.AttemptLabelKey])
+	if err != nil {
+		return PodMetrics{}, fmt.Errorf("pod %s has an invalid attempt label: %s", pod.Name, err)
+	}
+	return PodMetrics{
+		PodName: pod.Name,
+		DAGID:   dagID,
+		RunID:   labels[utils.RunIDLabelKey],
+		Task:    labels[utils.TaskLabelKey],
+		Attempt: attempt,
+		Time:    time.Now(),
+	}, nil
 }
 
 // NewDAGMetricsClient returns a new DAGMetricsClient from a metrics clientset
@@ -46,11 +69,20 @@ func NewDAGMetricsClient(clientSet kubernetes.Interface, testMode bool) *DAGMetr
 	return &DAGMetricsClient{clientSet, getRestConfig(), testMode}
 }
 
+// NewDAGMetricsClientForConfig returns a new DAGMetricsClient for the cluster of the rest config
+func NewDAGMetricsClientForConfig(
+	clientSet kubernetes.Interface,
+	restConfig *restclient.Config,
+	testMode bool,
+) *DAGMetricsClient {
+	return &DAGMetricsClient{clientSet, restConfig, testMode}
+}
+
 type getMetricsOptions struct {
-	kubeClient                      kubernetes.Interface
-	restConfig                      *restclient.Config
-	podName, command, containerName string
-	testMode                        bool
+	kubeClient                                 kubernetes.Interface
+	restConfig                                 *restclient.Config
+	podName, namespace, command, containerName string
+	testMode                                   bool
 }
 
 func getContainerOutput(options getMetricsOptions) ([]byte, error) {
@@ -59,6 +91,7 @@ func getContainerOutput(options getMetricsOptions) ([]byte, error) {
 		options.kubeClient,
 		options.restConfig,
 		options.podName,
+		options.namespace,
 		options.command,
 		os.Stdin,
 		&reader,
@@ -99,7 +132,10 @@ func getContainerCPU(options getMetricsOptions) (int64, error) {
 func (client *DAGMetricsClient) GetPodMetrics(
 	pod core.Pod,
 ) (PodMetrics, error) {
-	metrics := newPodMetrics(pod.Name)
+	metrics, err := newPodMetrics(pod)
+	if err != nil {
+		return PodMetrics{}, err
+	}
 	hasActiveContainers := false
 	for _, containerStatus := range pod.Status.ContainerStatuses {
 		containerStarted := *containerStatus.Started
@@ -110,6 +146,7 @@ func (client *DAGMetricsClient) GetPodMetrics(
 		options := getMetricsOptions{
 			kubeClient:    client.kubeClient,
 			podName:       pod.Name,
+			namespace:     pod.Namespace,
 			containerName: containerStatus.Name,
 			restConfig:    client.restConfig,
 			testMode:      client.testMode,
@@ -134,23 +171,25 @@ func (client *DAGMetricsClient) GetPodMetrics(
 	return PodMetrics{}, fmt.Errorf("No available containers")
 }
 
-// ListPodMetrics returns a list of all metrics for pods in a given namespace
+// ListPodMetrics returns a list of all metrics for goflow pods in a given namespace
 func (client *DAGMetricsClient) ListPodMetrics(namespace string) []PodMetrics {
 	metricList := make([]PodMetrics, 0)
 	pods, err := client.kubeClient.CoreV1().Pods(
 		namespace,
 	).List(
 		context.TODO(),
-		k8sapi.ListOptions{},
+		k8sapi.ListOptions{LabelSelector: utils.AppLabelSelectorString()},
 	)
 	if err != nil {
 		panic(err)
 	}
 	for _, pod := range pods.Items {
 		metrics, err := client.GetPodMetrics(pod)
-		if err == nil {
-			metricList = append(metricList, metrics)
+		if err != nil {
+			logs.InfoLogger.Printf("Skipping metrics for pod %s: %s\n", pod.Name, err)
+			continue
 		}
+		metricList = append(metricList, metrics)
 	}
 	return metricList
 }
@@ -3,6 +3,7 @@ package metrics
 import (
 	// "context"
 	// "fmt"
+	"goflow/internal/k8s/pod/utils"
 	"testing"
 
 	core "k8s.io/api/core/v1"
@@ -29,6 +30,13 @@ func getFakePod(name string) *core.Pod {
 		ObjectMeta: k8sapi.ObjectMeta{
 			Name:      name,
 			Namespace: "default",
+			Labels: map[string]string{
+				utils.AppSelectorKey:  utils.AppName,
+				utils.DAGIDLabelKey:   "1",
+				utils.RunIDLabelKey:   name,
+				utils.TaskLabelKey:    "task",
+				utils.AttemptLabelKey: "1",
+			},
 		},
 		Status: core.PodStatus{
 			ContainerStatuses: []core.ContainerStatus{container},
@@ -39,22 +47,36 @@ func getFakePod(name string) *core.Pod {
 func TestMain(m *testing.M) {
 	fakePod = getFakePod("test1")
 	fakePod2 := getFakePod("test2")
-	fakeMetricsClient := fake.NewSimpleClientset(fakePod, fakePod2)
+	otherPod := getFakePod("other")
+	otherPod.Labels = nil
+	fakeMetricsClient := fake.NewSimpleClientset(fakePod, fakePod2, otherPod)
 	metricsClient = NewDAGMetricsClient(fakeMetricsClient, true)
 	m.Run()
 }
 
 // This is really just to ensure the code doesn't fail in test mode
 func TestGetTestPodMetrics(t *testing.T) {
-	_, err := metricsClient.GetPodMetrics(*fakePod)
+	metrics, err := metricsClient.GetPodMetrics(*fakePod)
 	if err != nil {
 		panic(err)
 	}
+	if metrics.DAGID != 1 || metrics.RunID != fakePod.Name || metrics.Attempt != 1 {
+		t.Errorf("Metrics not attributed from pod labels: %s", metrics)
+	}
+}
+
+func TestGetUnlabeledPodMetrics(t *testing.T) {
+	unlabeledPod := getFakePod("unlabeled")
+	unlabeledPod.Labels = map[string]string{utils.AppSelectorKey: utils.AppName}
+	_, err := metricsClient.GetPodMetrics(*unlabeledPod)
+	if err == nil {
+		t.Error("Pod without DAG labels should not have metrics")
+	}
 }
 
 func TestGetAllMetrics(t *testing.T) {
 	metrics := metricsClient.ListPodMetrics(fakePod.Namespace)
 	if len(metrics) != 2 {
-		t.Error("Only expected two pods worth of metrics")
+		t.Error("Only expected two goflow pods worth of metrics")
 	}
 }
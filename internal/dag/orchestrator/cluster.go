@@ -0,0 +1,82 @@
+package orchestrator
+
+import (
+	"goflow/internal/config"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/metrics"
+	"goflow/internal/executor"
+	k8sclient "goflow/internal/k8s/client"
+	k8sexecutor "goflow/internal/k8s/executor"
+	"goflow/internal/k8s/pod/event/holder"
+	localexecutor "goflow/internal/local/executor"
+	"goflow/internal/sensor"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cluster is an execution target of DAG runs, its informers report the events of pods and Jobs
+// through its channel holder
+type cluster struct {
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	channelHolder *holder.ChannelHolder
+	metricsClient *metrics.DAGMetricsClient
+}
+
+// newClusterExecutors returns the Kubernetes executors of a cluster, which receive the events of
+// their pods and Jobs through the channel holder of the cluster
+// Pods are labelled with the instance, so that other instances can adopt them
+func newClusterExecutors(client kubernetes.Interface, channelHolder *holder.ChannelHolder, instance string) executor.Registry {
+	return executor.Registry{
+		config.ExecutorPod: k8sexecutor.NewPodExecutor(client, channelHolder, instance),
+		config.ExecutorJob: k8sexecutor.NewJobExecutor(client, channelHolder),
+	}
+}
+
+// newExecutors returns the executors that DAGs without a cluster can select
+func newExecutors(client kubernetes.Interface, channelHolder *holder.ChannelHolder, instance string) executor.Registry {
+	registry := newClusterExecutors(client, channelHolder, instance)
+	registry[config.ExecutorLocal] = localexecutor.New()
+	return registry
+}
+
+// AddCluster registers the clients of the cluster of the goflow config with the given name, along
+// with its executors and the sensor factory of its runs, it must be called before the orchestrator
+// starts
+// Kubernetes sensors of the runs in the cluster are not available when the dynamic client is nil
+func (orchestrator *Orchestrator) AddCluster(
+	name string,
+	kubeClient kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	metricsClient *metrics.DAGMetricsClient,
+) {
+	channelHolder := holder.New()
+	orchestrator.clusters[name] = &cluster{kubeClient, dynamicClient, channelHolder, metricsClient}
+	orchestrator.sensors[name] = sensor.NewFactory(dynamicClient)
+	executors := newClusterExecutors(kubeClient, channelHolder, orchestrator.config.InstanceID())
+	for executorName, clusterExecutor := range executors {
+		orchestrator.executors[executor.ClusterKey(executorName, name)] = clusterExecutor
+	}
+}
+
+// addConfiguredClusters creates the clients of the clusters of the goflow config
+func (orchestrator *Orchestrator) addConfiguredClusters() {
+	for name, clusterConfig := range orchestrator.config.Clusters {
+		restConfig := k8sclient.CreateClusterConfig(clusterConfig.KubeConfig, clusterConfig.Context)
+		kubeClient := kubernetes.NewForConfigOrDie(restConfig)
+		orchestrator.AddCluster(
+			name,
+			kubeClient,
+			dynamic.NewForConfigOrDie(restConfig),
+			metrics.NewDAGMetricsClientForConfig(kubeClient, restConfig, false),
+		)
+	}
+}
+
+// clusterOf returns the cluster that the runs of the DAG are submitted to, false if it was not
+// added
+func (orchestrator *Orchestrator) clusterOf(dagConfig *dagconfig.DAGConfig) (*cluster, bool) {
+	target, ok := orchestrator.clusters[dagConfig.Cluster]
+	return target, ok
+}
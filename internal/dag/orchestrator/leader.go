@@ -0,0 +1,150 @@
+package orchestrator
+
+import (
+	"context"
+	dagtype "goflow/internal/dag/dagtype"
+	"goflow/internal/logs"
+	"goflow/internal/stringutils"
+	"time"
+
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// IsLeader returns true if the orchestrator schedules DAGs, which is always the case without
+// leader election
+func (orchestrator *Orchestrator) IsLeader() bool {
+	orchestrator.leaderLock.RLock()
+	defer orchestrator.leaderLock.RUnlock()
+	return orchestrator.leading
+}
+
+// Leader returns the identity of the replica holding the lease, or an empty string if there is
+// no leader election or no leader was observed yet
+func (orchestrator *Orchestrator) Leader() string {
+	orchestrator.leaderLock.RLock()
+	defer orchestrator.leaderLock.RUnlock()
+	return orchestrator.leader
+}
+
+func (orchestrator *Orchestrator) setLeading(leading bool) {
+	orchestrator.leaderLock.Lock()
+	orchestrator.leading = leading
+	orchestrator.leaderLock.Unlock()
+}
+
+func (orchestrator *Orchestrator) setLeader(identity string) {
+	orchestrator.leaderLock.Lock()
+	orchestrator.leader = identity
+	orchestrator.leaderLock.Unlock()
+}
+
+// lead runs the cycles that only the leader runs until the context is done, collecting DAGs with
+// collect
+func (orchestrator *Orchestrator) lead(ctx context.Context, collect func(), cycleDuration time.Duration) {
+	go cycleUntilDone(
+		ctx,
+		collect,
+		cycleDuration,
+		"Collect DAGs",
+	)
+	go cycleUntilDone(
+		ctx,
+		orchestrator.RunDags,
+		cycleDuration,
+		"Run DAGs",
+	)
+	go cycleUntilDone(
+		ctx,
+		orchestrator.CheckSLAs,
+		cycleDuration,
+		"Check SLAs",
+	)
+	go orchestrator.StoreMetricsEvery(ctx, 2)
+}
+
+// takeOver restores the scheduling state of the DAGs synced from the database and adopts the runs
+// that previous leaders left before leading
+func (orchestrator *Orchestrator) takeOver() {
+	for _, dag := range orchestrator.DAGs() {
+		dag.RestoreMostRecentExecution()
+	}
+	orchestrator.adoptOrphanedRuns(stringutils.NewStringSet([]string{orchestrator.config.InstanceID()}))
+	orchestrator.setLeading(true)
+}
+
+// SyncDAGs fills up the dag map with the DAGs that the leader stored, without storing or auditing
+// anything, so that followers serve the read API
+func (orchestrator *Orchestrator) SyncDAGs() {
+	dagSlice := dagtype.GetStoredDAGsFromFolder(
+		orchestrator.config.DAGPath,
+		orchestrator.executors,
+		orchestrator.metricsClient,
+		*orchestrator.config,
+		orchestrator.schedules,
+		orchestrator.dagTableClient,
+		orchestrator.dagrunTableClient,
+		orchestrator.datasetTableClient,
+		orchestrator.logStore,
+		orchestrator.notifier,
+		orchestrator.sensors,
+		orchestrator.pools,
+	)
+	for _, dag := range dagSlice {
+		if !orchestrator.isDagPresent(*dag) {
+			orchestrator.AddDAG(dag)
+		} else if orchestrator.isStoredDagDifferent(*dag) {
+			orchestrator.UpdateDag(dag)
+		}
+	}
+}
+
+// campaign competes for the lease of the leader election config until the orchestrator stops,
+// leading while it holds the lease and syncing DAGs otherwise
+func (orchestrator *Orchestrator) campaign(cycleDuration time.Duration) {
+	election := orchestrator.config.LeaderElection
+	identity := election.ID()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: k8sapi.ObjectMeta{
+			Name:      election.Name(),
+			Namespace: election.Namespace(orchestrator.config.DefaultNamespace),
+		},
+		Client:     orchestrator.kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	go cycleUntilDone(
+		orchestrator.ctx,
+		func() {
+			if !orchestrator.IsLeader() {
+				orchestrator.SyncDAGs()
+			}
+		},
+		cycleDuration,
+		"Sync DAGs",
+	)
+	for orchestrator.ctx.Err() == nil {
+		leaderelection.RunOrDie(orchestrator.ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			Name:            election.Name(),
+			LeaseDuration:   election.LeaseDuration(),
+			RenewDeadline:   election.RenewDeadline(),
+			RetryPeriod:     election.RetryPeriod(),
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logs.InfoLogger.Printf("%s is now the leader, scheduling DAGs\n", identity)
+					orchestrator.takeOver()
+					orchestrator.lead(ctx, orchestrator.CollectDAGs, cycleDuration)
+				},
+				OnStoppedLeading: func() {
+					if orchestrator.IsLeader() {
+						logs.WarningLogger.Printf("%s is no longer the leader, active runs keep going\n", identity)
+					}
+					orchestrator.setLeading(false)
+				},
+				OnNewLeader: orchestrator.setLeader,
+			},
+		})
+	}
+}
@@ -2,27 +2,41 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	dagconfig "goflow/internal/dag/config"
 	dagtype "goflow/internal/dag/dagtype"
 	"goflow/internal/dag/metrics"
+	"goflow/internal/dag/pool"
 	dagrun "goflow/internal/dag/run"
 	"goflow/internal/database"
 	"goflow/internal/jsonpanic"
 	"goflow/internal/logs"
+	"goflow/internal/logstore"
+	"goflow/internal/notify"
+	"goflow/internal/sensor"
+	"goflow/internal/stringutils"
+	"goflow/telemetry"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"goflow/internal/config"
+	"goflow/internal/dag/shard"
+	audittable "goflow/internal/dag/sql/audit"
 	dagtable "goflow/internal/dag/sql/dag"
 	dagruntable "goflow/internal/dag/sql/dagrun"
+	datasettable "goflow/internal/dag/sql/dataset"
+	instancetable "goflow/internal/dag/sql/instance"
 	metricstable "goflow/internal/dag/sql/metrics"
+	notificationtable "goflow/internal/dag/sql/notification"
+	slatable "goflow/internal/dag/sql/sla"
+	"goflow/internal/executor"
 	k8sclient "goflow/internal/k8s/client"
+	jobinform "goflow/internal/k8s/job/inform"
 	"goflow/internal/k8s/pod/event/holder"
 	"goflow/internal/k8s/pod/inform"
 	"goflow/internal/k8s/pod/utils"
@@ -31,55 +45,112 @@ import (
 	"path"
 
 	"github.com/kennygrant/sanitize"
-	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
 // Orchestrator holds information for all DAGs
 type Orchestrator struct {
-	dagMapLock         *sync.RWMutex
-	dagMap             map[string]*dagtype.DAG
-	kubeClient         kubernetes.Interface
-	config             *config.GoFlowConfig
-	channelHolder      *holder.ChannelHolder
-	schedules          dagtype.ScheduleCache
-	closingChannel     chan struct{}
-	dagTableClient     *dagtable.TableClient
-	dagrunTableClient  *dagruntable.TableClient
-	metricsClient      *metrics.DAGMetricsClient
-	metricsTableClient *metricstable.TableClient
+	dagMapLock          *sync.RWMutex
+	dagMap              map[string]*dagtype.DAG
+	kubeClient          kubernetes.Interface
+	config              *config.GoFlowConfig
+	channelHolder       *holder.ChannelHolder
+	schedules           dagtype.ScheduleCache
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	dagTableClient      *dagtable.TableClient
+	dagrunTableClient   *dagruntable.TableClient
+	metricsClient       *metrics.DAGMetricsClient
+	metricsTableClient  *metricstable.TableClient
+	logStore            *logstore.Broker
+	auditTableClient    *audittable.TableClient
+	executors           executor.Registry
+	notificationTable   *notificationtable.TableClient
+	notifier            *notify.Notifier
+	slaTableClient      *slatable.TableClient
+	slaCursors          map[string]time.Time
+	slaLock             *sync.Mutex
+	datasetTableClient  *datasettable.TableClient
+	sensors             sensor.Registry
+	pools               *pool.Pools
+	schedulerLock       *sync.Mutex
+	decisions           []Decision
+	queuedSince         map[string]time.Time
+	leaderLock          *sync.RWMutex
+	leading             bool
+	leader              string
+	instanceTableClient *instancetable.TableClient
+	shardLock           *sync.RWMutex
+	ring                *shard.Ring
+	clusters            map[string]*cluster
 }
 
 // NewOrchestratorFromClientsAndConfig creates an orchestractor from a given k8s client and goflow config
+// Kubernetes sensors of the DAGs in the cluster of goflow are not available when the dynamic client
+// is nil
 func NewOrchestratorFromClientsAndConfig(
 	client kubernetes.Interface,
+	dynamicClient dynamic.Interface,
 	config *config.GoFlowConfig,
 	metricsClient *metrics.DAGMetricsClient,
 ) *Orchestrator {
 	sqlClient := database.NewSQLiteClient(config.DatabaseDNS)
+	logStore, err := logstore.New(config.LogStorage, config.LogPath)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	channelHolder := holder.New()
+	notificationTable := notificationtable.NewTableClient(sqlClient)
 	return &Orchestrator{
 		&sync.RWMutex{},
 		make(map[string]*dagtype.DAG),
 		client,
 		config,
-		holder.New(),
+		channelHolder,
 		make(dagtype.ScheduleCache),
-		make(chan struct{}),
+		ctx,
+		cancel,
 		dagtable.NewTableClient(sqlClient),
 		dagruntable.NewTableClient(sqlClient),
 		metricsClient,
 		metricstable.NewTableClient(sqlClient),
+		logstore.NewBroker(logStore),
+		audittable.NewTableClient(sqlClient),
+		newExecutors(client, channelHolder, config.InstanceID()),
+		notificationTable,
+		notify.New(config.Notifications, notificationTable),
+		slatable.NewTableClient(sqlClient),
+		make(map[string]time.Time),
+		&sync.Mutex{},
+		datasettable.NewTableClient(sqlClient),
+		sensor.Registry{"": sensor.NewFactory(dynamicClient)},
+		pool.New(config.Pools),
+		&sync.Mutex{},
+		make([]Decision, 0),
+		make(map[string]time.Time),
+		&sync.RWMutex{},
+		config.LeaderElection == nil,
+		"",
+		instancetable.NewTableClient(sqlClient),
+		&sync.RWMutex{},
+		nil,
+		map[string]*cluster{"": {client, dynamicClient, channelHolder, metricsClient}},
 	}
 }
 
-// NewOrchestrator creates an empty instance of Orchestrator
+// NewOrchestrator creates an empty instance of Orchestrator, with the clusters of its config
 func NewOrchestrator(configPath string) *Orchestrator {
 	kubeClient := k8sclient.CreateKubeClient()
-	return NewOrchestratorFromClientsAndConfig(
+	orchestrator := NewOrchestratorFromClientsAndConfig(
 		kubeClient,
+		k8sclient.CreateDynamicClient(),
 		config.CreateConfig(configPath),
 		metrics.NewDAGMetricsClient(kubeClient, false),
 	)
+	orchestrator.addConfiguredClusters()
+	return orchestrator
 }
 
 // AddDAG adds a DAG to the Orchestrator
@@ -91,6 +162,7 @@ func (orchestrator *Orchestrator) AddDAG(dag *dagtype.DAG) {
 		jsonpanic.JSONPanicFormat(dag.Config),
 	)
 	dag.LastUpdated = time.Now()
+	dag.ClaimsRuns = orchestrator.config.Sharding != nil
 	orchestrator.dagMapLock.Lock()
 	orchestrator.dagMap[dag.Config.Name] = dag
 	orchestrator.dagMapLock.Unlock()
@@ -112,11 +184,17 @@ func (orchestrator *Orchestrator) UpdateDag(dag *dagtype.DAG) {
 	orchestrator.dagMapLock.Unlock()
 }
 
+// addDAGServiceAccount creates the service account of the runs of the DAG in its cluster
 func (orchestrator *Orchestrator) addDAGServiceAccount(dag *dagtype.DAG) {
+	target, ok := orchestrator.clusterOf(dag.Config)
+	if !ok {
+		logs.ErrorLogger.Printf("Cluster %s of DAG %s was not added\n", dag.Config.Cluster, dag.Config.Name)
+		return
+	}
 	serviceAccountHandler := serviceaccount.New(
 		utils.AppName,
 		dag.Config.Namespace,
-		orchestrator.kubeClient,
+		target.kubeClient,
 	)
 	if serviceAccountHandler.Exists() {
 		return
@@ -126,61 +204,82 @@ func (orchestrator *Orchestrator) addDAGServiceAccount(dag *dagtype.DAG) {
 
 // DeleteDAG removes a DAG from the orchestrator
 func (orchestrator *Orchestrator) DeleteDAG(dagName string, namespace string) {
+	orchestrator.dagMapLock.Lock()
 	dag := orchestrator.dagMap[dagName]
-	dag.TerminateAndDeleteRuns()
 	delete(orchestrator.dagMap, dagName)
+	orchestrator.dagMapLock.Unlock()
+	dag.TerminateAndDeleteRuns()
 }
 
 // DAGs returns []DAGs with all DAGs present in the map
-func (orchestrator Orchestrator) DAGs() dagtype.DAGList {
-	dagSlice := make([]*dagtype.DAG, 0, len(orchestrator.dagMap))
+func (orchestrator *Orchestrator) DAGs() dagtype.DAGList {
 	orchestrator.dagMapLock.RLock()
+	defer orchestrator.dagMapLock.RUnlock()
+	dagSlice := make([]*dagtype.DAG, 0, len(orchestrator.dagMap))
 	for dagName := range orchestrator.dagMap {
 		dagSlice = append(dagSlice, orchestrator.dagMap[dagName])
 	}
-	orchestrator.dagMapLock.RUnlock()
 	return dagSlice
 }
 
 // isDagPresent returns true if the given dag is present
-func (orchestrator Orchestrator) isDagPresent(dag dagtype.DAG) bool {
-	_, ok := orchestrator.dagMap[dag.Config.Name]
-	return ok
+func (orchestrator *Orchestrator) isDagPresent(dag dagtype.DAG) bool {
+	return orchestrator.GetDag(dag.Config.Name) != nil
 }
 
 // isStoredDagDifferent returns true if the given dag source code is different
-func (orchestrator Orchestrator) isStoredDagDifferent(dag dagtype.DAG) bool {
-	currentDag, _ := orchestrator.dagMap[dag.Config.Name]
-	return currentDag.Code != dag.Code
+func (orchestrator *Orchestrator) isStoredDagDifferent(dag dagtype.DAG) bool {
+	return orchestrator.GetDag(dag.Config.Name).Code != dag.Code
 }
 
 // GetDag returns the DAG with the given name
-func (orchestrator Orchestrator) GetDag(dagName string) *dagtype.DAG {
-	dag, _ := orchestrator.dagMap[dagName]
-	return dag
+func (orchestrator *Orchestrator) GetDag(dagName string) *dagtype.DAG {
+	orchestrator.dagMapLock.RLock()
+	defer orchestrator.dagMapLock.RUnlock()
+	return orchestrator.dagMap[dagName]
 }
 
-// DagRuns returns all the dag runs across all dags
-func (orchestrator Orchestrator) DagRuns() []dagrun.DAGRun {
+// DagRuns returns the cached active and recently finished dag runs across all dags
+// Use RetrieveDagRuns for the full history
+func (orchestrator *Orchestrator) DagRuns() []dagrun.DAGRun {
 	runs := make([]dagrun.DAGRun, 0)
 	for _, dag := range orchestrator.DAGs() {
-		for _, run := range dag.DAGRuns {
+		for _, run := range dag.Runs() {
 			runs = append(runs, *run)
 		}
 	}
 	return runs
 }
 
+// TriggerDAGRun starts a manually triggered run of the dag
+func (orchestrator *Orchestrator) TriggerDAGRun(dag *dagtype.DAG) (*dagrun.DAGRun, error) {
+	dagRun, err := dag.TriggerRun()
+	if err != nil {
+		return nil, err
+	}
+	telemetry.ActiveRuns.Set(float64(dag.ActiveRuns.Get()), dag.Config.Name)
+	return dagRun, nil
+}
+
 func (orchestrator *Orchestrator) collectDAG(dag *dagtype.DAG) {
 	dagPresent := orchestrator.isDagPresent(*dag)
 	if !dagPresent {
 		orchestrator.addDAGServiceAccount(dag)
 		orchestrator.AddDAG(dag)
+		orchestrator.RecordAuditEvent(
+			audittable.SchedulerActor, audittable.ActionDAGCreate, dag.Config.Name, "", nil, dag.Config, "",
+		)
 	} else if dagPresent && orchestrator.isStoredDagDifferent(*dag) {
 		logs.InfoLogger.Printf("Updating DAG %s which will run in namespace %s", dag.Config.Name, dag.Config.Namespace)
+		previousConfig := orchestrator.GetDag(dag.Config.Name).Config
 		logs.InfoLogger.Printf("Old DAG code: %s\n", orchestrator.GetDag(dag.Config.Name).Code)
 		logs.InfoLogger.Printf("New DAG code: %s\n", dag.Code)
+		// The cluster or namespace of the runs may have changed
+		orchestrator.addDAGServiceAccount(dag)
 		orchestrator.UpdateDag(dag)
+		orchestrator.RecordAuditEvent(
+			audittable.SchedulerActor, audittable.ActionDAGUpdate, dag.Config.Name, "", previousConfig, dag.Config, "",
+		)
 	}
 }
 
@@ -188,83 +287,172 @@ func (orchestrator *Orchestrator) collectDAG(dag *dagtype.DAG) {
 func (orchestrator *Orchestrator) CollectDAGs() {
 	dagSlice := dagtype.GetDAGSFromFolder(
 		orchestrator.config.DAGPath,
-		orchestrator.kubeClient,
+		orchestrator.executors,
 		orchestrator.metricsClient,
 		*orchestrator.config,
 		orchestrator.schedules,
 		orchestrator.dagTableClient,
 		orchestrator.dagrunTableClient,
+		orchestrator.datasetTableClient,
+		orchestrator.logStore,
+		orchestrator.notifier,
+		orchestrator.sensors,
+		orchestrator.pools,
 	)
 	for _, dag := range dagSlice {
 		orchestrator.collectDAG(dag)
 	}
+	telemetry.DAGsLoaded.Set(float64(len(orchestrator.DAGs())))
 }
 
-// RunDags schedules pods for all dags that are ready
-func (orchestrator *Orchestrator) RunDags() {
-	for _, dag := range orchestrator.DAGs() {
-		dag.AddNextDagRunIfReady(orchestrator.channelHolder)
-	}
-}
-
-func cycleUntilChannelClose(
+// cycleUntilDone calls callable every cycleDuration until the context is done
+func cycleUntilDone(
+	ctx context.Context,
 	callable func(),
-	close chan struct{},
 	cycleDuration time.Duration,
 	loopName string,
 ) {
+	loopLabel := strings.ToLower(strings.ReplaceAll(loopName, " ", "_"))
 	for {
+		start := time.Now()
+		callable()
+		telemetry.SchedulerLoopDuration.Observe(telemetry.Since(start), loopLabel)
 		select {
-		case _, ok := <-close:
-			if !ok {
-				logs.InfoLogger.Printf("Closing %s\n", loopName)
-				return
-			}
-		default:
-			callable()
-			time.Sleep(cycleDuration)
+		case <-ctx.Done():
+			logs.InfoLogger.Printf("Closing %s\n", loopName)
+			return
+		case <-time.After(cycleDuration):
 		}
 	}
 }
 
-func (orchestrator *Orchestrator) getTaskInformer() inform.TaskInformer {
-	return inform.New(orchestrator.kubeClient, orchestrator.channelHolder)
-}
-
 func (orchestrator *Orchestrator) setupDatabaseTables() {
 	orchestrator.dagTableClient.CreateTable()
 	orchestrator.dagrunTableClient.CreateTable()
 	orchestrator.metricsTableClient.CreateTable()
+	orchestrator.auditTableClient.CreateTable()
+	orchestrator.notificationTable.CreateTable()
+	orchestrator.slaTableClient.CreateTable()
+	orchestrator.datasetTableClient.CreateTable()
+	orchestrator.instanceTableClient.CreateTable()
 }
 
 // Start begins the orchestrator event loop
+// With leader election, the DAGs are only scheduled while the orchestrator holds the lease
+// With sharding, only the DAGs that the orchestrator owns are scheduled
 func (orchestrator *Orchestrator) Start(cycleDuration time.Duration) {
 	orchestrator.setupDatabaseTables()
-	taskInformer := orchestrator.getTaskInformer()
-	taskInformer.Start()
-	go cycleUntilChannelClose(
-		orchestrator.CollectDAGs,
-		orchestrator.closingChannel,
-		cycleDuration,
-		"Collect DAGs",
-	)
-	go cycleUntilChannelClose(
-		orchestrator.RunDags,
-		orchestrator.closingChannel,
-		cycleDuration,
-		"Run DAGs",
-	)
-	go orchestrator.StoreMetricsEvery(2)
+	for _, target := range orchestrator.clusters {
+		taskInformer := inform.New(target.kubeClient, target.channelHolder)
+		taskInformer.Start()
+		jobInformer := jobinform.New(target.kubeClient, target.channelHolder)
+		jobInformer.Start()
+		go func() {
+			<-orchestrator.ctx.Done()
+			taskInformer.Stop()
+			jobInformer.Stop()
+		}()
+	}
+	if orchestrator.config.LeaderElection != nil {
+		orchestrator.setLeading(false)
+		go orchestrator.campaign(cycleDuration)
+		return
+	}
+	if orchestrator.config.Sharding != nil {
+		orchestrator.shareWork(cycleDuration)
+		return
+	}
+	orchestrator.lead(orchestrator.ctx, orchestrator.CollectDAGs, cycleDuration)
 }
 
 // Wait blocks the current thread until the orchestrator has terminated
 func (orchestrator *Orchestrator) Wait() {
-	<-orchestrator.closingChannel
+	<-orchestrator.ctx.Done()
 }
 
-// Stop terminates the orchestrators cycles
+// Stop terminates the orchestrators cycles, active dag runs keep going
 func (orchestrator *Orchestrator) Stop() {
-	close(orchestrator.closingChannel)
+	orchestrator.cancel()
+}
+
+// activeRunCount returns the number of active runs across all dags
+func (orchestrator *Orchestrator) activeRunCount() int {
+	count := 0
+	for _, dag := range orchestrator.DAGs() {
+		count += dag.ActiveRuns.Get()
+	}
+	return count
+}
+
+// Shutdown stops the orchestrator cycles and then handles active dag runs according to the
+// configured shutdown policy. With the wait policy it waits for active runs to finish until
+// the context is done and then terminates the runs it started that are still active, with the
+// detach policy pods are left running in the cluster
+// Followers leave the runs to the leader
+// Notifications still being delivered are then waited for until the context is done
+func (orchestrator *Orchestrator) Shutdown(ctx context.Context) error {
+	// The lease is released once the orchestrator stops
+	leading := orchestrator.IsLeader()
+	orchestrator.Stop()
+	var err error
+	if orchestrator.config.ShutdownPolicy == config.ShutdownDetach {
+		logs.InfoLogger.Printf(
+			"Detaching from %d active dag runs, their pods keep running\n",
+			orchestrator.activeRunCount(),
+		)
+	} else if leading {
+		err = orchestrator.waitForActiveRuns(ctx)
+		orchestrator.terminateActiveRuns()
+	}
+	if notifyErr := orchestrator.waitForNotifications(ctx); err == nil {
+		err = notifyErr
+	}
+	return err
+}
+
+// waitForActiveRuns waits for the active runs of the orchestrator to finish until the context is
+// done
+func (orchestrator *Orchestrator) waitForActiveRuns(ctx context.Context) error {
+	for {
+		activeRuns := orchestrator.activeRunCount()
+		if activeRuns == 0 {
+			return nil
+		}
+		logs.InfoLogger.Printf("Waiting for %d active dag runs to finish\n", activeRuns)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d dag runs were still active at shutdown", activeRuns)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// waitForNotifications waits for the notifications being delivered until the context is done
+func (orchestrator *Orchestrator) waitForNotifications(ctx context.Context) error {
+	delivered := make(chan struct{})
+	go func() {
+		orchestrator.notifier.Wait()
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		return nil
+	case <-ctx.Done():
+		return errors.New("notifications were still being delivered at shutdown")
+	}
+}
+
+// terminateActiveRuns terminates the active runs of the orchestrator, deleting their pods and
+// Jobs in their clusters, the resources of other runs and the service accounts are left
+// With sharding, runs that can be adopted are left to the instances owning their DAGs
+func (orchestrator *Orchestrator) terminateActiveRuns() {
+	for _, dag := range orchestrator.DAGs() {
+		_, adoptable := orchestrator.executors.Get(dag.Config).(executor.Adopter)
+		if orchestrator.config.Sharding != nil && adoptable && !dag.Config.DryRun {
+			continue
+		}
+		dag.TerminateAndDeleteRuns()
+	}
 }
 
 // WriteDAGFile writes a new DAG to the dag file location
@@ -292,46 +480,105 @@ func (orchestrator *Orchestrator) WriteDAGFile(config *dagconfig.DAGConfig) (int
 	return http.StatusOK, err
 }
 
-func extractDAGFromPodName(podName string) string {
-	re := regexp.MustCompile(`(?P<name>.*)-\d{4}-\d{2}-\d{4}-\d{2}-\d{2}plus\d{4}utc`)
-	matches := re.FindStringSubmatch(podName)
-	if len(matches) < 2 {
-		logs.ErrorLogger.Println("Error in DAG name extraction from pod")
+// dagNamespaces returns the set of namespaces that DAGs run in within the cluster
+func (orchestrator *Orchestrator) dagNamespaces(cluster string) stringutils.StringSet {
+	namespaces := make(stringutils.StringSet)
+	for _, dag := range orchestrator.DAGs() {
+		if dag.Config.Cluster == cluster {
+			namespaces.Add(dag.Config.Namespace)
+		}
 	}
-	return matches[1]
+	return namespaces
 }
 
-// StoreMetricsEvery stores usage metrics for all pods every 'seconds' unit of time
-func (orchestrator *Orchestrator) StoreMetricsEvery(seconds time.Duration) {
-	for {
-		namespaces, err := orchestrator.kubeClient.CoreV1().Namespaces().List(
-			context.TODO(),
-			k8sapi.ListOptions{},
-		)
-		if err != nil {
-			panic(err)
+// dagsByID returns a map from DAG id to DAG for all DAGs present in the map
+func (orchestrator *Orchestrator) dagsByID() map[int]*dagtype.DAG {
+	dags := make(map[int]*dagtype.DAG)
+	for _, dag := range orchestrator.DAGs() {
+		dags[dag.ID] = dag
+	}
+	return dags
+}
+
+// StoreMetrics stores usage metrics for all goflow pods in the namespaces that have DAGs, in each
+// cluster
+// With sharding, only the pods of the DAGs the orchestrator owns are stored
+func (orchestrator *Orchestrator) StoreMetrics() {
+	dags := orchestrator.dagsByID()
+	for name, target := range orchestrator.clusters {
+		orchestrator.storeClusterMetrics(name, target, dags)
+	}
+	orchestrator.storeLocalMetrics(dags)
+}
+
+// storeClusterMetrics stores usage metrics for the pods of the DAGs that run in the cluster
+func (orchestrator *Orchestrator) storeClusterMetrics(name string, target *cluster, dags map[int]*dagtype.DAG) {
+	for namespace := range orchestrator.dagNamespaces(name) {
+		metrics := target.metricsClient.ListPodMetrics(namespace)
+		for _, metric := range metrics {
+			dag, ok := dags[metric.DAGID]
+			if !ok {
+				logs.InfoLogger.Printf(
+					"Skipping metrics for pod %s, DAG with id %d not found",
+					metric.PodName,
+					metric.DAGID,
+				)
+				continue
+			}
+			if dag.Config.Cluster != name || !orchestrator.Owns(dag) {
+				continue
+			}
+			row := metricstable.NewRow(
+				0,
+				metric.DAGID,
+				dag.Config.Name,
+				metric.RunID,
+				metric.PodName,
+				metric.Task,
+				metric.Attempt,
+				metric.Memory,
+				metric.CPU,
+				metric.Time,
+			)
+			orchestrator.metricsTableClient.InsertMetric(row)
 		}
-		for _, namespace := range namespaces.Items {
-			if namespace.Name[:4] == "kube" {
+	}
+}
+
+// storeLocalMetrics stores the usage that local dag runs sampled from their processes
+func (orchestrator *Orchestrator) storeLocalMetrics(dags map[int]*dagtype.DAG) {
+	for _, dag := range dags {
+		for _, run := range dag.Runs() {
+			usage, attempt, ok := run.Usage()
+			if !ok {
 				continue
 			}
-			metrics := orchestrator.metricsClient.ListPodMetrics(namespace.Name)
-			for _, metric := range metrics {
-				row := metricstable.NewRow(
-					0,
-					extractDAGFromPodName(metric.PodName),
-					metric.PodName,
-					metric.Memory,
-					metric.CPU,
-					metric.Time,
-				)
-				orchestrator.metricsTableClient.InsertMetric(row)
+			if !orchestrator.Owns(dag) {
+				continue
 			}
+			row := metricstable.NewRow(
+				0,
+				dag.ID,
+				dag.Config.Name,
+				run.Name,
+				"",
+				executor.TaskName,
+				attempt,
+				usage.Memory,
+				usage.CPU,
+				time.Now(),
+			)
+			orchestrator.metricsTableClient.InsertMetric(row)
 		}
-		time.Sleep(seconds * time.Second)
 	}
 }
 
+// StoreMetricsEvery stores usage metrics for all goflow pods every 'seconds' unit of time
+// until the context is done
+func (orchestrator *Orchestrator) StoreMetricsEvery(ctx context.Context, seconds time.Duration) {
+	cycleUntilDone(ctx, orchestrator.StoreMetrics, seconds*time.Second, "Store Metrics")
+}
+
 // MetricRowList is a list of metrics table rows
 type MetricRowList []metricstable.Row
 
@@ -354,9 +601,155 @@ func (orchestrator *Orchestrator) RetrieveDAGMetrics(
 	dagName string,
 	timeRange ...time.Time,
 ) (MetricRowList, error) {
-	_, ok := orchestrator.dagMap[dagName]
-	if !ok {
+	if orchestrator.GetDag(dagName) == nil {
 		return nil, fmt.Errorf("Given DAG not present")
 	}
 	return orchestrator.metricsTableClient.GetMetricsForDag(dagName, timeRange...)
 }
+
+// RetrieveDAGRunMetrics returns the metrics for a single run of a dag
+func (orchestrator *Orchestrator) RetrieveDAGRunMetrics(
+	dagName string,
+	runID string,
+) (MetricRowList, error) {
+	dag := orchestrator.GetDag(dagName)
+	if dag == nil {
+		return nil, fmt.Errorf("Given DAG not present")
+	}
+	return orchestrator.metricsTableClient.GetMetricsForRun(dag.ID, runID), nil
+}
+
+// RetrieveDagRuns returns the stored dag runs matching the filter
+func (orchestrator *Orchestrator) RetrieveDagRuns(filter dagruntable.Filter) dagruntable.RowList {
+	return orchestrator.dagrunTableClient.GetDagRuns(filter)
+}
+
+// CountDagRunsByStatus returns the number of stored dag runs matching the filter for each status
+func (orchestrator *Orchestrator) CountDagRunsByStatus(filter dagruntable.Filter) map[string]int {
+	return orchestrator.dagrunTableClient.CountDagRunsByStatus(filter)
+}
+
+// RunDependencies returns the state of the runs of other DAGs that the run of the DAG for the
+// execution date waits for
+func (orchestrator *Orchestrator) RunDependencies(dag *dagtype.DAG, executionDate time.Time) []dagrun.Dependency {
+	return dagrun.Dependencies(dag.Config, executionDate, orchestrator.dagrunTableClient)
+}
+
+// SignalDatasetUpdate records an update of the dataset signalled from outside of goflow by source,
+// the DAGs consuming the dataset are triggered once all their datasets have been updated
+func (orchestrator *Orchestrator) SignalDatasetUpdate(dataset, source string) datasettable.Row {
+	// Events are stored with second precision
+	event := orchestrator.datasetTableClient.InsertEvent(datasettable.NewRow(
+		dataset,
+		time.Now().UTC().Truncate(time.Second),
+		datasettable.OriginExternal,
+		source,
+		"",
+	))
+	telemetry.DatasetEvents.Inc(dataset, datasettable.OriginExternal)
+	logs.InfoLogger.Printf("%s updated dataset %s", source, dataset)
+	return event
+}
+
+// RetrieveMetrics returns the metrics rows matching the filter
+func (orchestrator *Orchestrator) RetrieveMetrics(filter metricstable.Filter) MetricRowList {
+	return orchestrator.metricsTableClient.GetMetrics(filter)
+}
+
+// logKey returns the log key for an attempt of a dag run
+// An attempt below 1 selects the most recent attempt
+func (orchestrator *Orchestrator) logKey(dagName string, runID string, attempt int) (logstore.Key, error) {
+	if orchestrator.GetDag(dagName) == nil {
+		return logstore.Key{}, fmt.Errorf("Given DAG not present")
+	}
+	if attempt < 1 {
+		latestAttempt, err := logstore.LatestAttempt(orchestrator.logStore, dagName, runID)
+		if err != nil {
+			return logstore.Key{}, err
+		}
+		attempt = latestAttempt
+	}
+	return logstore.Key{DAGName: dagName, RunID: runID, Attempt: attempt}, nil
+}
+
+// RetrieveDAGRunLogs returns the stored log lines for an attempt of a dag run
+// An attempt below 1 returns the logs of the most recent attempt
+func (orchestrator *Orchestrator) RetrieveDAGRunLogs(
+	dagName string,
+	runID string,
+	attempt int,
+	options logstore.ReadOptions,
+) ([]string, error) {
+	key, err := orchestrator.logKey(dagName, runID, attempt)
+	if err != nil {
+		return nil, err
+	}
+	return orchestrator.logStore.Read(key, options)
+}
+
+// FollowDAGRunLogs returns the stored log lines for an attempt of a dag run and,
+// if follow is true and the attempt is still running, subscribes to its new lines
+func (orchestrator *Orchestrator) FollowDAGRunLogs(
+	dagName string,
+	runID string,
+	attempt int,
+	options logstore.ReadOptions,
+	follow bool,
+) (*logstore.Subscription, error) {
+	key, err := orchestrator.logKey(dagName, runID, attempt)
+	if err != nil {
+		return nil, err
+	}
+	return orchestrator.logStore.Follow(key, options, follow)
+}
+
+// Config returns the goflow configuration of the orchestrator
+func (orchestrator *Orchestrator) Config() *config.GoFlowConfig {
+	return orchestrator.config
+}
+
+// Pools returns the pools limiting the runs of all DAGs
+func (orchestrator *Orchestrator) Pools() *pool.Pools {
+	return orchestrator.pools
+}
+
+// Executors returns the executors that the DAGs of the orchestrator select from
+func (orchestrator *Orchestrator) Executors() executor.Registry {
+	return orchestrator.executors
+}
+
+// auditPayload returns the JSON representation of an audited value, or an empty string for nil
+func auditPayload(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return jsonpanic.JSONPanic(value)
+}
+
+// RecordAuditEvent stores an audit event for an action taken by the actor on a DAG or dag run
+// before and after are the states of the target before and after the action, and may be nil
+func (orchestrator *Orchestrator) RecordAuditEvent(
+	actor, action, dagName, runID string,
+	before, after interface{},
+	sourceIP string,
+) {
+	orchestrator.auditTableClient.InsertEvent(audittable.NewRow(
+		actor,
+		action,
+		dagName,
+		runID,
+		auditPayload(before),
+		auditPayload(after),
+		sourceIP,
+	))
+}
+
+// RetrieveAuditEvents returns the audit events matching the filter along with their total count
+func (orchestrator *Orchestrator) RetrieveAuditEvents(filter audittable.Filter) ([]audittable.Row, int) {
+	return orchestrator.auditTableClient.GetEvents(filter), orchestrator.auditTableClient.CountEvents(filter)
+}
+
+// LogStore returns the store holding the logs of dag runs
+func (orchestrator *Orchestrator) LogStore() *logstore.Broker {
+	return orchestrator.logStore
+}
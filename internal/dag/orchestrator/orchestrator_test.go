@@ -1,15 +1,35 @@
 package orchestrator
 
 import (
+	"context"
 	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/metrics"
 	"goflow/internal/database"
+	"goflow/internal/executor"
+	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/k8s/pod/utils"
+	"goflow/internal/k8s/serviceaccount"
+	"goflow/internal/notify"
 	"goflow/internal/testutils"
+	"goflow/telemetry"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"goflow/internal/config"
 	"goflow/internal/dag/dagtype"
+	audittable "goflow/internal/dag/sql/audit"
+	dagruntable "goflow/internal/dag/sql/dagrun"
+	slatable "goflow/internal/dag/sql/sla"
 
+	core "k8s.io/api/core/v1"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -37,16 +57,23 @@ func testOrchestrator() *Orchestrator {
 	configuration := config.CreateConfig(configPath)
 	configuration.DAGPath = dagPath
 	configuration.DatabaseDNS = testutils.GetSQLiteLocation()
+	configuration.LogPath = testutils.GetLogsFolder()
 	return NewOrchestratorFromClientsAndConfig(
 		kubeClient,
+		nil,
 		configuration,
 		metrics.NewDAGMetricsClient(kubeClient, true),
 	)
 }
 
 func getTestDAG(orch *Orchestrator) dagtype.DAG {
+	return getNamedTestDAG(orch, "test")
+}
+
+// getNamedTestDAG returns a test DAG stored under the given name, so that it has its own id
+func getNamedTestDAG(orch *Orchestrator, name string) dagtype.DAG {
 	config := &dagconfig.DAGConfig{
-		Name:          "test",
+		Name:          name,
 		Namespace:     "default",
 		Schedule:      "* * * * *",
 		DockerImage:   "busybox",
@@ -60,11 +87,16 @@ func getTestDAG(orch *Orchestrator) dagtype.DAG {
 	return dagtype.CreateDAG(
 		config,
 		config.String(),
-		orch.kubeClient,
+		orch.executors,
 		make(dagtype.ScheduleCache),
 		orch.dagTableClient,
 		"path",
 		orch.dagrunTableClient,
+		orch.datasetTableClient,
+		orch.logStore,
+		orch.notifier,
+		orch.sensors,
+		orch.pools,
 		true,
 	)
 }
@@ -73,6 +105,7 @@ func TestRegisterDAG(t *testing.T) {
 	defer database.PurgeDB(sqlClient)
 	orch := testOrchestrator()
 	orch.dagTableClient.CreateTable()
+	orch.auditTableClient.CreateTable()
 	dag := getTestDAG(orch)
 	const expectedLength = 1
 	orch.AddDAG(&dag)
@@ -97,6 +130,7 @@ func TestDAGUpdate(t *testing.T) {
 	defer database.PurgeDB(sqlClient)
 	orch := testOrchestrator()
 	orch.dagTableClient.CreateTable()
+	orch.auditTableClient.CreateTable()
 	dag := getTestDAG(orch)
 	orch.AddDAG(&dag)
 	updatedDAG := getDagWithDifferentDockerImage(orch)
@@ -110,6 +144,7 @@ func TestCollectDagUpdatedTime(t *testing.T) {
 	defer database.PurgeDB(sqlClient)
 	orch := testOrchestrator()
 	orch.dagTableClient.CreateTable()
+	orch.auditTableClient.CreateTable()
 	dag := getTestDAG(orch)
 	orch.collectDAG(&dag)
 	addedTime := dag.LastUpdated
@@ -129,11 +164,12 @@ func TestUpdateDAGWhileRunning(t *testing.T) {
 	defer database.PurgeDB(sqlClient)
 	orch := testOrchestrator()
 	orch.dagTableClient.CreateTable()
+	orch.auditTableClient.CreateTable()
 	orch.dagrunTableClient.CreateTable()
 	dag := getTestDAG(orch)
 	dag.IsOn = true
 	orch.collectDAG(&dag)
-	dag.AddNextDagRunIfReady(orch.channelHolder)
+	dag.AddNextDagRunIfReady()
 	updatedDAG := getDagWithDifferentDockerImage(orch)
 	updatedDAG.IsOn = true
 	orch.collectDAG(&updatedDAG)
@@ -141,12 +177,17 @@ func TestUpdateDAGWhileRunning(t *testing.T) {
 	if retrievedDAG.Config.DockerImage != newImageName {
 		t.Errorf("Expected image name to be updated to \"%s\"", newImageName)
 	}
+	// The run keeps waiting on its pod, it must have stored its row before the tables are purged
+	for len(orch.dagrunTableClient.GetLastNRunsForDagID(dag.ID, 1)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
 }
 
 func TestCollectDags(t *testing.T) {
 	defer database.PurgeDB(sqlClient)
 	orch := testOrchestrator()
 	orch.dagTableClient.CreateTable()
+	orch.auditTableClient.CreateTable()
 	orch.CollectDAGs()
 	dagCount := len(orch.DAGs())
 	if dagCount == 0 {
@@ -157,4 +198,780 @@ func TestCollectDags(t *testing.T) {
 			panic("Key doesn't match up with dag name!")
 		}
 	}
+	events, total := orch.RetrieveAuditEvents(audittable.Filter{
+		Actor:  audittable.SchedulerActor,
+		Action: audittable.ActionDAGCreate,
+	})
+	if total != dagCount || events[0].After == "" {
+		t.Errorf("Expected %d audited DAG creations, found %d", dagCount, total)
+	}
+}
+
+func TestStoreMetrics(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	dag := getTestDAG(orch)
+	orch.AddDAG(&dag)
+	dagRun := dag.AddDagRun(time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), false)
+
+	started := true
+	podClient := orch.kubeClient.CoreV1().Pods(dag.Config.Namespace)
+	for _, pod := range []*core.Pod{
+		{
+			ObjectMeta: k8sapi.ObjectMeta{
+				Name:      dagRun.Name,
+				Namespace: dag.Config.Namespace,
+				Labels: map[string]string{
+					utils.AppSelectorKey:  utils.AppName,
+					utils.DAGIDLabelKey:   strconv.Itoa(dag.ID),
+					utils.RunIDLabelKey:   dagRun.Name,
+					utils.TaskLabelKey:    "task",
+					utils.AttemptLabelKey: "1",
+				},
+			},
+			Status: core.PodStatus{ContainerStatuses: []core.ContainerStatus{
+				{Name: "task", Started: &started},
+			}},
+		},
+		{
+			ObjectMeta: k8sapi.ObjectMeta{Name: "not-goflow", Namespace: dag.Config.Namespace},
+			Status: core.PodStatus{ContainerStatuses: []core.ContainerStatus{
+				{Name: "task", Started: &started},
+			}},
+		},
+	} {
+		_, err := podClient.Create(context.TODO(), pod, k8sapi.CreateOptions{})
+		if err != nil {
+			panic(err)
+		}
+		defer podClient.Delete(context.TODO(), pod.Name, k8sapi.DeleteOptions{})
+	}
+
+	orch.StoreMetrics()
+
+	rows, err := orch.RetrieveDAGRunMetrics(dag.Config.Name, dagRun.Name)
+	if err != nil {
+		panic(err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected 1 metrics row for run %s, found %d", dagRun.Name, len(rows))
+		return
+	}
+	row := rows[0]
+	if row.DagID != dag.ID || row.DagName != dag.Config.Name || row.Task != "task" || row.Attempt != 1 {
+		t.Errorf("Metrics row not attributed to run: %s", row)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tables := []struct {
+		policy     string
+		activeRuns int
+		expectErr  bool
+	}{
+		{config.ShutdownWait, 0, false},
+		{config.ShutdownWait, 1, true},
+		{config.ShutdownDetach, 1, false},
+	}
+	for _, table := range tables {
+		func() {
+			defer database.PurgeDB(sqlClient)
+			orch := testOrchestrator()
+			orch.kubeClient = createFakeKubeClient()
+			orch.config.ShutdownPolicy = table.policy
+			orch.dagTableClient.CreateTable()
+			dag := getTestDAG(orch)
+			orch.AddDAG(&dag)
+			for i := 0; i < table.activeRuns; i++ {
+				dag.ActiveRuns.Inc()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := orch.Shutdown(ctx)
+			if (err != nil) != table.expectErr {
+				t.Errorf(
+					"Shutdown with policy %s and %d active runs returned error: %v",
+					table.policy,
+					table.activeRuns,
+					err,
+				)
+			}
+			select {
+			case <-orch.ctx.Done():
+			default:
+				t.Errorf("Expected shutdown to stop the orchestrator cycles")
+			}
+		}()
+	}
+}
+
+// waitForPod returns the pod with the given name once it has been created
+func waitForPod(t *testing.T, client kubernetes.Interface, namespace, name string) *core.Pod {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		pod, err := client.CoreV1().Pods(namespace).Get(context.TODO(), name, k8sapi.GetOptions{})
+		if err == nil {
+			return pod
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected pod %s to be created: %s", name, err)
+		}
+	}
+}
+
+// podExists returns true if the pod with the given name exists
+func podExists(client kubernetes.Interface, namespace, name string) bool {
+	_, err := client.CoreV1().Pods(namespace).Get(context.TODO(), name, k8sapi.GetOptions{})
+	return err == nil
+}
+
+func TestShutdownWaitsForNotifications(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	rules := []notify.Rule{{On: []string{notify.EventSLAMiss}, Channel: notify.ChannelWebhook, URL: server.URL}}
+	orch.notifier.Notify(rules, notify.Notification{Event: notify.EventSLAMiss, DAGName: "test"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := orch.Shutdown(ctx); err == nil {
+		t.Error("Expected shutdown to report the notification still being delivered")
+	}
+	close(release)
+	if err := orch.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected shutdown to wait for the delivery, found %v", err)
+	}
+}
+
+func TestShutdownTerminatesOwnRuns(t *testing.T) {
+	for _, leading := range []bool{true, false} {
+		func() {
+			defer database.PurgeDB(sqlClient)
+			client := createFakeKubeClient()
+			orch := testOrchestrator()
+			orch.setupDatabaseTables()
+			orch.executors = newExecutors(client, orch.channelHolder, "")
+			orch.clusters[""] = &cluster{client, nil, orch.channelHolder, orch.metricsClient}
+			orch.setLeading(leading)
+			dag := getTestDAG(orch)
+			orch.AddDAG(&dag)
+			namespace := dag.Config.Namespace
+			podClient := client.CoreV1().Pods(namespace)
+			utils.CreateTestPod(&podClient, "other-run", namespace, core.PodRunning)
+			serviceAccountHandler := serviceaccount.New(utils.AppName, namespace, client)
+			serviceAccountHandler.Create()
+			dagRun, err := orch.TriggerDAGRun(&dag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitForPod(t, client, namespace, dagRun.Name)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			orch.Shutdown(ctx)
+			if podExists(client, namespace, dagRun.Name) == leading {
+				t.Errorf("Expected the pod of the run to be deleted only by the leader, leading: %v", leading)
+			}
+			if !podExists(client, namespace, "other-run") || !serviceAccountHandler.Exists() {
+				t.Errorf("Expected the pods of other runs and the service account to be left")
+			}
+		}()
+	}
+}
+
+func TestShutdownTerminatesRunsPerCluster(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	clients := map[string]*fake.Clientset{"east": createFakeKubeClient(), "west": createFakeKubeClient()}
+	runs := make(map[string]string)
+	for name, client := range clients {
+		orch.AddCluster(name, client, nil, metrics.NewDAGMetricsClient(client, true))
+		dag := getNamedTestDAG(orch, name)
+		dag.Config.Cluster = name
+		orch.AddDAG(&dag)
+		podClient := client.CoreV1().Pods(dag.Config.Namespace)
+		utils.CreateTestPod(&podClient, "other-run", dag.Config.Namespace, core.PodRunning)
+		serviceAccountHandler := serviceaccount.New(utils.AppName, dag.Config.Namespace, client)
+		serviceAccountHandler.Create()
+		dagRun, err := orch.TriggerDAGRun(&dag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForPod(t, client, dag.Config.Namespace, dagRun.Name)
+		runs[name] = dagRun.Name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	orch.Shutdown(ctx)
+	for name, client := range clients {
+		if podExists(client, "default", runs[name]) {
+			t.Errorf("Expected the pod of the run in cluster %s to be deleted", name)
+		}
+		serviceAccountHandler := serviceaccount.New(utils.AppName, "default", client)
+		if !podExists(client, "default", "other-run") || !serviceAccountHandler.Exists() {
+			t.Errorf("Expected the pods of other runs and the service account of cluster %s to be left", name)
+		}
+	}
+}
+
+func TestShutdownLeavesShardedRunsForAdoption(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	client := createFakeKubeClient()
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	orch.config.Sharding = &config.ShardingConfig{Identity: "leaving"}
+	orch.executors = newExecutors(client, orch.channelHolder, "leaving")
+	orch.clusters[""] = &cluster{client, nil, orch.channelHolder, orch.metricsClient}
+	dag := getTestDAG(orch)
+	orch.AddDAG(&dag)
+	dagRun, err := orch.TriggerDAGRun(&dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPod(t, client, dag.Config.Namespace, dagRun.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	orch.Shutdown(ctx)
+	pod := waitForPod(t, client, dag.Config.Namespace, dagRun.Name)
+	if pod.Labels[utils.InstanceLabelKey] != "leaving" {
+		t.Errorf("Expected the pod to be left for adoption, found labels %v", pod.Labels)
+	}
+}
+
+func TestCycleUntilDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 100)
+	done := make(chan struct{})
+	go func() {
+		cycleUntilDone(ctx, func() { calls <- struct{}{} }, time.Millisecond, "Test Loop")
+		close(done)
+	}()
+	<-calls
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the loop to stop once the context is done")
+	}
+}
+
+func TestCheckSLAs(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	events := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(notify.EventHeader)
+	}))
+	defer server.Close()
+	dag := getTestDAG(orch)
+	dag.Config.Schedule = "0 0 * * * *"
+	dag.Config.SLA = &dagconfig.SLA{MaxDurationSeconds: 1800}
+	dag.Config.Notify = []notify.Rule{{On: []string{notify.EventSLAMiss}, Channel: notify.ChannelWebhook, URL: server.URL}}
+	dag.IsOn = false
+	orch.AddDAG(&dag)
+
+	hour := func(hour, minute int) time.Time {
+		return time.Date(2019, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+	for _, run := range []struct {
+		executionDate time.Time
+		status        core.PodPhase
+		endDate       time.Time
+	}{
+		{hour(0, 0), core.PodSucceeded, hour(0, 10)},
+		{hour(1, 0), core.PodSucceeded, hour(1, 45)},
+		{hour(2, 0), core.PodFailed, hour(2, 5)},
+		{hour(3, 0), core.PodRunning, time.Time{}},
+	} {
+		row := dagruntable.NewRow(dag.ID, run.executionDate.String(), dagruntable.TriggerScheduled, string(run.status), run.executionDate)
+		row.EndDate = run.endDate
+		orch.dagrunTableClient.UpsertDagRun(row)
+	}
+	paused := telemetry.SLAMisses.Get(dag.Config.Name, slatable.ReasonPaused)
+	orch.checkSLAs(hour(5, 30))
+	orch.checkSLAs(hour(5, 45))
+	orch.notifier.Wait()
+
+	expectedReasons := map[time.Time]string{
+		hour(1, 0): slatable.ReasonLate,
+		hour(2, 0): slatable.ReasonFailed,
+		hour(3, 0): slatable.ReasonUnfinished,
+		hour(4, 0): slatable.ReasonPaused,
+		hour(5, 0): slatable.ReasonPaused,
+	}
+	misses := orch.RetrieveSLAMisses(slatable.Filter{DagNames: []string{dag.Config.Name}})
+	if len(misses) != len(expectedReasons) {
+		t.Fatalf("Expected %d SLA misses, found %v", len(expectedReasons), misses)
+	}
+	for _, miss := range misses {
+		if expectedReasons[miss.ExecutionDate.UTC()] != miss.Reason {
+			t.Errorf("Expected the miss for %s to be %s, found %s", miss.ExecutionDate, expectedReasons[miss.ExecutionDate.UTC()], miss.Reason)
+		}
+	}
+	if telemetry.SLAMisses.Get(dag.Config.Name, slatable.ReasonPaused) != paused+2 {
+		t.Error("Expected the SLA misses of runs that never started to be counted")
+	}
+	if len(events) != len(expectedReasons) {
+		t.Errorf("Expected a notification for each SLA miss, found %d", len(events))
+	}
+}
+
+func TestOrderCandidates(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newCandidate := func(name, namespace string, priority int, waited time.Duration) candidate {
+		dag := &dagtype.DAG{Config: &dagconfig.DAGConfig{Name: name, Namespace: namespace}}
+		return candidate{dag, dagtype.PendingRun{ExecutionDate: start}, name, priority, start.Add(-waited), 0}
+	}
+	candidates := []candidate{
+		newCandidate("a1", "a", 0, 3*time.Minute),
+		newCandidate("a2", "a", 0, 2*time.Minute),
+		newCandidate("a3", "a", 0, time.Minute),
+		newCandidate("b1", "b", 0, 0),
+		newCandidate("low", "b", -1, time.Hour),
+		newCandidate("high", "b", 1, 0),
+	}
+	orderCandidates(candidates)
+	expected := []string{"high", "a1", "b1", "a2", "a3", "low"}
+	for i, name := range expected {
+		if candidates[i].dag.Config.Name != name {
+			t.Errorf("Expected %s at position %d, found %s", name, i, candidates[i].dag.Config.Name)
+		}
+	}
+}
+
+func TestRunDags(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	orch.config.Scheduler = &config.SchedulerConfig{MaxRunsPerCycle: 1, AgingSeconds: 60}
+	orch.pools.Resize("full", 0)
+	addDAG := func(name string, priority int) *dagtype.DAG {
+		dag := getNamedTestDAG(orch, name)
+		dag.Config.DryRun = true
+		dag.Config.PriorityWeight = priority
+		orch.AddDAG(&dag)
+		return &dag
+	}
+	addDAG("paused", 10).IsOn = false
+	addDAG("pooled", 10).Config.Pool = "full"
+	busy := addDAG("busy", 10)
+	busy.ActiveRuns.Inc()
+	defer busy.ActiveRuns.Dec()
+	low := addDAG("low", 0)
+	high := addDAG("high", 1)
+
+	waitForRuns := func() {
+		for _, dag := range []*dagtype.DAG{low, high} {
+			for dag.ActiveRuns.Get() > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+	expectReasons := func(expected map[string]string) {
+		decisions := orch.SchedulerDecisions()
+		if len(decisions) != len(expected) {
+			t.Errorf("Expected %d decisions, found %v", len(expected), decisions)
+		}
+		for _, decision := range decisions {
+			if expected[decision.DAG] != decision.Reason {
+				t.Errorf("Expected the run of %s to be %s, found %s", decision.DAG, expected[decision.DAG], decision.Reason)
+			}
+		}
+	}
+
+	now := time.Now()
+	orch.runDags(now)
+	waitForRuns()
+	if len(high.Runs()) != 1 || len(low.Runs()) != 0 {
+		t.Error("Expected the run of higher priority to be started first")
+	}
+	expectReasons(map[string]string{
+		"paused": ReasonPaused,
+		"pooled": ReasonPoolFull,
+		"busy":   ReasonMaxActiveRuns,
+		"low":    ReasonQueued,
+	})
+
+	orch.runDags(now.Add(2 * time.Minute))
+	waitForRuns()
+	if len(low.Runs()) != 1 {
+		t.Error("Expected the run of lower priority to be started once it has waited long enough")
+	}
+	for _, decision := range orch.SchedulerDecisions() {
+		if decision.DAG == "high" && (decision.Reason != ReasonQueued || decision.Priority != 1) {
+			t.Errorf("Expected the run of high to be queued with its own priority, found %v", decision)
+		}
+	}
+}
+
+func TestRunDagsConcurrently(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	dag := getTestDAG(orch)
+	dag.IsOn = false
+	orch.AddDAG(&dag)
+
+	// The cycles of the leader run concurrently, which the race detector checks
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			orch.runDags(time.Now())
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			orch.DAGs()
+			orch.SchedulerDecisions()
+		}
+	}
+	decisions := orch.SchedulerDecisions()
+	if len(decisions) != 1 || decisions[0].Reason != ReasonPaused {
+		t.Errorf("Expected the run of the paused DAG to be explained, found %v", decisions)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	client := createFakeKubeClient()
+	replicas := make(map[string]*Orchestrator)
+	for _, identity := range []string{"first", "second"} {
+		orch := testOrchestrator()
+		orch.kubeClient = client
+		orch.config.DAGsOn = false
+		orch.config.LeaderElection = &config.LeaderElectionConfig{
+			Identity:             identity,
+			LeaseDurationSeconds: 3,
+			RenewDeadlineSeconds: 2,
+			RetryPeriodSeconds:   1,
+		}
+		orch.Start(100 * time.Millisecond)
+		if orch.IsLeader() {
+			t.Errorf("Expected %s not to lead before winning the election", identity)
+		}
+		replicas[identity] = orch
+	}
+	waitFor := func(condition func() bool, message string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatal(message)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	var leader, follower *Orchestrator
+	waitFor(func() bool {
+		switch {
+		case replicas["first"].IsLeader() && replicas["second"].Leader() == "first":
+			leader, follower = replicas["first"], replicas["second"]
+		case replicas["second"].IsLeader() && replicas["first"].Leader() == "second":
+			leader, follower = replicas["second"], replicas["first"]
+		}
+		return leader != nil
+	}, "Expected a replica to be elected")
+	if follower.IsLeader() {
+		t.Fatal("Expected a single leader")
+	}
+	waitFor(func() bool {
+		return len(leader.DAGs()) > 0 && len(follower.DAGs()) == len(leader.DAGs())
+	}, "Expected the follower to sync the DAGs collected by the leader")
+
+	dag := leader.DAGs()[0]
+	executionDate := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	leader.dagrunTableClient.UpsertDagRun(
+		dagruntable.NewRow(dag.ID, "run", dagruntable.TriggerScheduled, string(core.PodSucceeded), executionDate),
+	)
+	leader.Stop()
+	waitFor(follower.IsLeader, "Expected the follower to take over once the leader stopped")
+	if !follower.GetDag(dag.Config.Name).MostRecentExecution.Equal(executionDate) {
+		t.Error("Expected the new leader to carry on from the runs of the previous leader")
+	}
+	follower.Stop()
+	time.Sleep(300 * time.Millisecond)
+}
+
+func TestTakeOverAdoptsRuns(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	client := createFakeKubeClient()
+	orch := testOrchestrator()
+	orch.kubeClient = client
+	orch.config.LeaderElection = &config.LeaderElectionConfig{Identity: "next"}
+	orch.executors = newExecutors(client, orch.channelHolder, orch.config.InstanceID())
+	orch.clusters[""] = &cluster{client, nil, orch.channelHolder, orch.metricsClient}
+	orch.setupDatabaseTables()
+	dag := getTestDAG(orch)
+	orch.collectDAG(&dag)
+	stored := orch.GetDag(dag.Config.Name)
+
+	// The previous leader submitted the run before it lost the lease
+	runID := "run-of-previous-leader"
+	spec := executor.Spec{Name: runID, DAGID: stored.ID, Attempt: 1, Config: stored.Config}
+	if _, err := newExecutors(client, holder.New(), "previous").Get(stored.Config).Submit(spec); err != nil {
+		t.Fatal(err)
+	}
+	orch.dagrunTableClient.UpsertDagRun(
+		dagruntable.NewRow(stored.ID, runID, dagruntable.TriggerScheduled, string(core.PodRunning), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	orch.takeOver()
+
+	runs := stored.Runs()
+	if len(runs) != 1 || runs[0].Name != runID {
+		t.Fatalf("Expected the new leader to adopt the run of the previous leader, found %v", runs)
+	}
+	if !orch.IsLeader() {
+		t.Error("Expected the orchestrator to lead once it took over")
+	}
+	var pod *core.Pod
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		pod, err = client.CoreV1().Pods(stored.Config.Namespace).Get(context.TODO(), runID, k8sapi.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Labels[utils.InstanceLabelKey] == "next" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pod to be relabelled with the new leader, found %v", pod.Labels)
+		}
+	}
+	pod.Status.Phase = core.PodSucceeded
+	orch.channelHolder.GetChannelGroup(runID).Ready <- pod
+	for deadline := time.Now().Add(5 * time.Second); !runs[0].Finished(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the adopted run to finish")
+		}
+	}
+}
+
+func TestSharding(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	client := createFakeKubeClient()
+	instances := make([]*Orchestrator, 0)
+	for _, identity := range []string{"first", "second"} {
+		orch := testOrchestrator()
+		orch.kubeClient = client
+		orch.config.DAGsOn = false
+		orch.config.Sharding = &config.ShardingConfig{Identity: identity}
+		orch.executors = newExecutors(client, orch.channelHolder, identity)
+		orch.clusters[""] = &cluster{client, nil, orch.channelHolder, orch.metricsClient}
+		orch.setupDatabaseTables()
+		instances = append(instances, orch)
+	}
+	first, second := instances[0], instances[1]
+	first.CollectDAGs()
+	second.SyncDAGs()
+	if len(first.DAGs()) == 0 || len(second.DAGs()) != len(first.DAGs()) {
+		t.Fatal("Expected both instances to hold the collected DAGs")
+	}
+	if first.Owns(first.DAGs()[0]) {
+		t.Error("Expected no DAG to be owned before the first heartbeat")
+	}
+	now := time.Now()
+	first.heartbeat(now)
+	second.heartbeat(now)
+	first.heartbeat(now)
+	if !first.isCoordinator() || second.isCoordinator() {
+		t.Error("Expected the first instance by name to collect the DAGs")
+	}
+	var owned *dagtype.DAG
+	for _, dag := range first.DAGs() {
+		if first.Owns(dag) == second.Owns(second.GetDag(dag.Config.Name)) {
+			t.Errorf("Expected DAG %s to be owned by exactly one instance", dag.Config.Name)
+		}
+		if second.Owns(dag) {
+			owned = second.GetDag(dag.Config.Name)
+		}
+	}
+	if len(second.Shards()) != 2 {
+		t.Errorf("Expected a shard per live instance, found %v", second.Shards())
+	}
+	if owned == nil {
+		t.Fatal("Expected the second instance to own a DAG")
+	}
+
+	// A pod of an instance that never sent a heartbeat is handed over to the owner of its DAG
+	runID := "sharded-run"
+	spec := executor.Spec{Name: runID, DAGID: owned.ID, Attempt: 1, Config: owned.Config}
+	_, err := newExecutors(client, holder.New(), "dead").Get(owned.Config).Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.dagrunTableClient.UpsertDagRun(
+		dagruntable.NewRow(owned.ID, runID, dagruntable.TriggerScheduled, string(core.PodRunning), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	first.heartbeat(now)
+	second.heartbeat(now)
+	second.heartbeat(now)
+	if len(first.GetDag(owned.Config.Name).Runs()) != 0 {
+		t.Error("Expected the run not to be adopted by an instance not owning its DAG")
+	}
+	runs := owned.Runs()
+	if len(runs) != 1 || runs[0].Name != runID {
+		t.Fatalf("Expected the run to be adopted once, found %v", runs)
+	}
+	podClient := client.CoreV1().Pods(owned.Config.Namespace)
+	var pod *core.Pod
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		pod, err = podClient.Get(context.TODO(), runID, k8sapi.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Labels[utils.InstanceLabelKey] == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pod to be relabelled, found %v", pod.Labels)
+		}
+	}
+	pod.Status.Phase = core.PodSucceeded
+	second.channelHolder.GetChannelGroup(runID).Ready <- pod
+	for deadline := time.Now().Add(5 * time.Second); !runs[0].Finished(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the adopted run to finish")
+		}
+	}
+	if runs[0].Status() != string(core.PodSucceeded) {
+		t.Errorf("Expected the adopted run to succeed, found %s", runs[0].Status())
+	}
+	if _, err = podClient.Get(context.TODO(), runID, k8sapi.GetOptions{}); err == nil {
+		t.Error("Expected the pod of the adopted run to be deleted")
+	}
+}
+
+func TestClusterSensors(t *testing.T) {
+	orch := testOrchestrator()
+	flags := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "flags", "namespace": "default"},
+	}}
+	east := createFakeKubeClient()
+	orch.AddCluster(
+		"east",
+		east,
+		dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), flags),
+		metrics.NewDAGMetricsClient(east, true),
+	)
+	sensorConfig := dagconfig.SensorConfig{
+		Name:   "flags",
+		Kind:   dagconfig.SensorKubernetes,
+		Object: &dagconfig.ObjectRef{APIVersion: "v1", Resource: "configmaps", Name: "flags"},
+	}
+
+	eastSensor, err := orch.sensors.Get(&dagconfig.DAGConfig{Cluster: "east"}).New(sensorConfig, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if satisfied, err := eastSensor.Poke(context.TODO()); !satisfied || err != nil {
+		t.Errorf("Expected the sensor of a DAG in cluster east to find the object in east, found %t, %v", satisfied, err)
+	}
+	// The test orchestrator has no dynamic client for the cluster of goflow
+	if _, err := orch.sensors.Get(&dagconfig.DAGConfig{}).New(sensorConfig, "default"); err == nil {
+		t.Error("Expected the sensors of DAGs in the cluster of goflow to use its own dynamic client")
+	}
+	if orch.sensors.Get(&dagconfig.DAGConfig{Cluster: "west"}) != nil {
+		t.Error("Expected no sensor factory for a cluster that was not added")
+	}
+}
+
+func TestDAGClusterUpdate(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	east := createFakeKubeClient()
+	orch.AddCluster("east", east, nil, metrics.NewDAGMetricsClient(east, true))
+	dag := getTestDAG(orch)
+	orch.collectDAG(&dag)
+
+	movedDAG := getTestDAG(orch)
+	movedDAG.Config.Cluster = "east"
+	movedDAG.Config.Namespace = "moved"
+	movedDAG.Code = movedDAG.Config.String()
+	orch.collectDAG(&movedDAG)
+	if orch.GetDag(dag.Config.Name).Config.Cluster != "east" {
+		t.Fatal("Expected the DAG to be moved to cluster east")
+	}
+	serviceAccountHandler := serviceaccount.New(utils.AppName, "moved", east)
+	if !serviceAccountHandler.Exists() {
+		t.Error("Expected the service account to be created in the new cluster and namespace of the DAG")
+	}
+}
+
+func TestClusters(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	orch := testOrchestrator()
+	orch.setupDatabaseTables()
+	orch.config.Clusters = map[string]*config.ClusterConfig{"east": {}}
+	east := createFakeKubeClient()
+	orch.AddCluster("east", east, nil, metrics.NewDAGMetricsClient(east, true))
+	dag := getTestDAG(orch)
+	dag.Config.Cluster = "east"
+	orch.AddDAG(&dag)
+	orch.addDAGServiceAccount(&dag)
+	_, err := east.CoreV1().ServiceAccounts(dag.Config.Namespace).Get(context.TODO(), utils.AppName, k8sapi.GetOptions{})
+	if err != nil {
+		t.Errorf("Expected the service account to be created in the cluster of the DAG: %s", err)
+	}
+
+	dagRun, err := orch.TriggerDAGRun(&dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eastPods := east.CoreV1().Pods(dag.Config.Namespace)
+	var pod *core.Pod
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		pod, err = eastPods.Get(context.TODO(), dagRun.Name, k8sapi.GetOptions{})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pod of the run in the cluster of the DAG: %s", err)
+		}
+	}
+	_, err = orch.kubeClient.CoreV1().Pods(dag.Config.Namespace).Get(context.TODO(), dagRun.Name, k8sapi.GetOptions{})
+	if err == nil {
+		t.Error("Expected no pod of the run in the cluster of goflow")
+	}
+	rows := orch.RetrieveDagRuns(dagruntable.Filter{RunID: dagRun.Name})
+	if len(rows) != 1 || rows[0].Cluster != "east" {
+		t.Errorf("Expected the run to be recorded in cluster east, found %v", rows)
+	}
+
+	started := true
+	pod.Status.ContainerStatuses = []core.ContainerStatus{{Name: "task", Started: &started}}
+	pod, err = eastPods.UpdateStatus(context.TODO(), pod, k8sapi.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orch.StoreMetrics()
+	metricRows, err := orch.RetrieveDAGRunMetrics(dag.Config.Name, dagRun.Name)
+	if err != nil || len(metricRows) != 1 {
+		t.Errorf("Expected the metrics of the pod in cluster east, found %v", metricRows)
+	}
+
+	pod.Status.Phase = core.PodSucceeded
+	orch.clusters["east"].channelHolder.GetChannelGroup(dagRun.Name).Ready <- pod
+	for deadline := time.Now().Add(5 * time.Second); !dagRun.Finished(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the run to finish from the events of its cluster")
+		}
+	}
+	if dagRun.Status() != string(core.PodSucceeded) {
+		t.Errorf("Expected the run to succeed, found %s", dagRun.Status())
+	}
 }
@@ -0,0 +1,245 @@
+package orchestrator
+
+import (
+	dagtype "goflow/internal/dag/dagtype"
+	dagrun "goflow/internal/dag/run"
+	"goflow/internal/logs"
+	"goflow/telemetry"
+	"sort"
+	"time"
+
+	audittable "goflow/internal/dag/sql/audit"
+
+	core "k8s.io/api/core/v1"
+)
+
+// Reasons why a run that is due has not been started
+const (
+	// ReasonPaused is given for the runs of DAGs that are off
+	ReasonPaused = "paused"
+	// ReasonMaxActiveRuns is given for the runs of DAGs that have reached MaxActiveRuns
+	ReasonMaxActiveRuns = "max_active_runs"
+	// ReasonPoolFull is given for the runs waiting for the slots of their pool
+	ReasonPoolFull = "pool_full"
+	// ReasonWaitingOnDependency is given for the runs waiting for the runs of other DAGs
+	ReasonWaitingOnDependency = "waiting_on_dependency"
+	// ReasonWaitingOnSensor is given for the runs waiting for their sensors
+	ReasonWaitingOnSensor = "waiting_on_sensor"
+	// ReasonQueued is given for the runs left for a later cycle once the cycle started as many runs
+	// as the scheduler config allows
+	ReasonQueued = "queued"
+)
+
+// Decision explains why a run of a DAG has not been started yet
+// RunID is only set for runs that were added but wait before being submitted, Priority includes
+// what the run gained from waiting since Since
+type Decision struct {
+	DAG           string
+	Namespace     string
+	RunID         string
+	ExecutionDate time.Time
+	Priority      int
+	Since         time.Time
+	Reason        string
+}
+
+// candidate is a pending run that the scheduler may start in this cycle
+type candidate struct {
+	dag      *dagtype.DAG
+	pending  dagtype.PendingRun
+	key      string
+	priority int
+	since    time.Time
+	rank     int
+}
+
+// pendingKey identifies a pending run across cycles
+func pendingKey(dagName string, executionDate time.Time) string {
+	return dagName + "/" + executionDate.Format(time.RFC3339Nano)
+}
+
+// RunDags starts the runs of all DAGs that are due, highest priority first
+// Pending runs gain priority while they wait, and runs of the same priority are started in turns
+// across namespaces. Runs that cannot be started are explained by the scheduler decisions
+func (orchestrator *Orchestrator) RunDags() {
+	orchestrator.runDags(time.Now())
+}
+
+func (orchestrator *Orchestrator) runDags(now time.Time) {
+	orchestrator.schedulerLock.Lock()
+	defer orchestrator.schedulerLock.Unlock()
+	aging := orchestrator.config.Scheduler.AgingInterval()
+	decisions := make([]Decision, 0)
+	candidates := make([]candidate, 0)
+	queuedSince := make(map[string]time.Time)
+	for _, dag := range orchestrator.ownedDAGs() {
+		decisions = append(decisions, heldRunDecisions(dag)...)
+		free := dag.Config.MaxActiveRuns - dag.ActiveRuns.Get()
+		limit := free
+		if limit < 1 {
+			limit = 1
+		}
+		for i, pending := range dag.PendingRuns(limit) {
+			if !dag.IsOn {
+				decisions = append(decisions, newDecision(dag, pending, dag.Config.PriorityWeight, now, ReasonPaused))
+				break
+			}
+			key := pendingKey(dag.Config.Name, pending.ExecutionDate)
+			since, ok := orchestrator.queuedSince[key]
+			if !ok {
+				since = now
+			}
+			queuedSince[key] = since
+			priority := dag.Config.PriorityWeight + int(now.Sub(since)/aging)
+			if i >= free {
+				decisions = append(decisions, newDecision(dag, pending, priority, since, ReasonMaxActiveRuns))
+				continue
+			}
+			candidates = append(candidates, candidate{dag, pending, key, priority, since, 0})
+		}
+	}
+	orderCandidates(candidates)
+
+	started := 0
+	claimed := make(map[string]int)
+	blocked := make(map[string]string)
+	for _, next := range candidates {
+		reason, ok := blocked[next.dag.Config.Name]
+		if !ok {
+			reason = orchestrator.blockedReason(next.dag, started, claimed)
+		}
+		if reason != "" {
+			blocked[next.dag.Config.Name] = reason
+			decisions = append(decisions, newDecision(next.dag, next.pending, next.priority, next.since, reason))
+			continue
+		}
+		dagRun, err := next.dag.StartPendingRun(next.pending)
+		delete(queuedSince, next.key)
+		if err != nil {
+			logs.WarningLogger.Printf("Did not start the run of DAG %s: %s\n", next.dag.Config.Name, err)
+			continue
+		}
+		started++
+		if next.dag.Config.Pool != "" {
+			claimed[next.dag.Config.Pool] += next.dag.Config.PoolSlotCount()
+		}
+		orchestrator.RecordAuditEvent(
+			audittable.SchedulerActor, audittable.ActionRunTrigger, next.dag.Config.Name, dagRun.Name, nil, nil, "",
+		)
+	}
+	orchestrator.queuedSince = queuedSince
+	orchestrator.decisions = decisions
+
+	for _, dag := range orchestrator.DAGs() {
+		telemetry.ActiveRuns.Set(float64(dag.ActiveRuns.Get()), dag.Config.Name)
+	}
+	reasons := make(map[string]int)
+	for _, decision := range decisions {
+		reasons[decision.Reason]++
+	}
+	telemetry.PendingRuns.Reset()
+	for reason, count := range reasons {
+		telemetry.PendingRuns.Set(float64(count), reason)
+	}
+}
+
+// orderCandidates sorts the candidates by priority, then takes turns between the namespaces of
+// the same priority, starting with the runs that have waited the longest
+func orderCandidates(candidates []candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		switch {
+		case candidates[i].priority != candidates[j].priority:
+			return candidates[i].priority > candidates[j].priority
+		case !candidates[i].since.Equal(candidates[j].since):
+			return candidates[i].since.Before(candidates[j].since)
+		case !candidates[i].pending.ExecutionDate.Equal(candidates[j].pending.ExecutionDate):
+			return candidates[i].pending.ExecutionDate.Before(candidates[j].pending.ExecutionDate)
+		default:
+			return candidates[i].dag.Config.Name < candidates[j].dag.Config.Name
+		}
+	})
+	type turn struct {
+		namespace string
+		priority  int
+	}
+	turns := make(map[turn]int)
+	for i := range candidates {
+		key := turn{candidates[i].dag.Config.Namespace, candidates[i].priority}
+		candidates[i].rank = turns[key]
+		turns[key]++
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+}
+
+// blockedReason returns why the next run of the DAG cannot be started in this cycle, or an empty
+// string if it can, given the runs started and the pool slots claimed earlier in the cycle
+func (orchestrator *Orchestrator) blockedReason(dag *dagtype.DAG, started int, claimed map[string]int) string {
+	limit := orchestrator.config.Scheduler.RunsPerCycle()
+	if limit > 0 && started >= limit {
+		return ReasonQueued
+	}
+	if dag.Config.Pool == "" {
+		return ""
+	}
+	occupancy, ok := orchestrator.pools.Get(dag.Config.Pool)
+	if ok && (occupancy.Queued > 0 ||
+		occupancy.Occupied+claimed[dag.Config.Pool]+dag.Config.PoolSlotCount() > occupancy.Slots) {
+		return ReasonPoolFull
+	}
+	return ""
+}
+
+// heldRunDecisions explains the runs of the DAG that were added but wait before being submitted
+func heldRunDecisions(dag *dagtype.DAG) []Decision {
+	decisions := make([]Decision, 0)
+	for _, dagRun := range dag.Runs() {
+		var reason string
+		switch core.PodPhase(dagRun.Status()) {
+		case dagrun.PhaseWaiting:
+			reason = ReasonWaitingOnDependency
+		case dagrun.PhaseSensing:
+			reason = ReasonWaitingOnSensor
+		case dagrun.PhaseQueued:
+			reason = ReasonPoolFull
+		default:
+			continue
+		}
+		decisions = append(decisions, Decision{
+			dag.Config.Name,
+			dag.Config.Namespace,
+			dagRun.Name,
+			dagRun.ExecutionDate.Time,
+			dag.Config.PriorityWeight,
+			dagRun.StartTime.Time,
+			reason,
+		})
+	}
+	return decisions
+}
+
+func newDecision(dag *dagtype.DAG, pending dagtype.PendingRun, priority int, since time.Time, reason string) Decision {
+	return Decision{
+		dag.Config.Name,
+		dag.Config.Namespace,
+		"",
+		pending.ExecutionDate,
+		priority,
+		since,
+		reason,
+	}
+}
+
+// SchedulerDecisions returns why the runs that are due or waiting were not started as of the last
+// scheduler cycle
+func (orchestrator *Orchestrator) SchedulerDecisions() []Decision {
+	orchestrator.schedulerLock.Lock()
+	defer orchestrator.schedulerLock.Unlock()
+	decisions := make([]Decision, len(orchestrator.decisions))
+	copy(decisions, orchestrator.decisions)
+	return decisions
+}
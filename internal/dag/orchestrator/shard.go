@@ -0,0 +1,222 @@
+package orchestrator
+
+import (
+	"context"
+	dagtype "goflow/internal/dag/dagtype"
+	"goflow/internal/dag/shard"
+	dagruntable "goflow/internal/dag/sql/dagrun"
+	"goflow/internal/executor"
+	"goflow/internal/k8s/pod/utils"
+	"goflow/internal/logs"
+	"goflow/internal/stringutils"
+	"strconv"
+	"time"
+
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Shard is the share of the DAGs that a live instance schedules
+type Shard struct {
+	Instance string
+	DAGs     []string
+}
+
+// Owns returns true if the orchestrator schedules the DAG, which is always the case without
+// sharding and never before the first heartbeat with sharding
+func (orchestrator *Orchestrator) Owns(dag *dagtype.DAG) bool {
+	if orchestrator.config.Sharding == nil {
+		return true
+	}
+	owner, ok := orchestrator.owner(dag)
+	return ok && owner == orchestrator.config.Sharding.ID()
+}
+
+// owner returns the instance that schedules the DAG, false before the first heartbeat
+func (orchestrator *Orchestrator) owner(dag *dagtype.DAG) (string, bool) {
+	orchestrator.shardLock.RLock()
+	defer orchestrator.shardLock.RUnlock()
+	if orchestrator.ring == nil {
+		return "", false
+	}
+	return orchestrator.ring.Owner(dag.ID), true
+}
+
+// DAGOwner returns the instance that schedules the DAG with the given name and whether it is
+// this one, which is the case without sharding or for DAGs that are not present
+func (orchestrator *Orchestrator) DAGOwner(dagName string) (string, bool) {
+	dag := orchestrator.GetDag(dagName)
+	if orchestrator.config.Sharding == nil || dag == nil {
+		return orchestrator.config.Sharding.ID(), true
+	}
+	owner, _ := orchestrator.owner(dag)
+	return owner, owner == orchestrator.config.Sharding.ID()
+}
+
+// ownedDAGs returns the DAGs that the orchestrator schedules
+func (orchestrator *Orchestrator) ownedDAGs() dagtype.DAGList {
+	dags := make(dagtype.DAGList, 0)
+	for _, dag := range orchestrator.DAGs() {
+		if orchestrator.Owns(dag) {
+			dags = append(dags, dag)
+		}
+	}
+	return dags
+}
+
+// Shards returns the DAGs of each live instance as of the last heartbeat, by instance
+func (orchestrator *Orchestrator) Shards() []Shard {
+	orchestrator.shardLock.RLock()
+	ring := orchestrator.ring
+	orchestrator.shardLock.RUnlock()
+	if ring == nil {
+		return []Shard{}
+	}
+	instances := ring.Instances()
+	if len(instances) == 0 {
+		return []Shard{}
+	}
+	shards := make([]Shard, 0, len(instances))
+	indexes := make(map[string]int)
+	for i, instance := range instances {
+		shards = append(shards, Shard{instance, make([]string, 0)})
+		indexes[instance] = i
+	}
+	for _, dag := range orchestrator.DAGs() {
+		i := indexes[ring.Owner(dag.ID)]
+		shards[i].DAGs = append(shards[i].DAGs, dag.Config.Name)
+	}
+	return shards
+}
+
+// isCoordinator returns true if the orchestrator collects the DAGs into the database for all
+// instances, which the first live instance by name does
+func (orchestrator *Orchestrator) isCoordinator() bool {
+	orchestrator.shardLock.RLock()
+	defer orchestrator.shardLock.RUnlock()
+	if orchestrator.ring == nil {
+		return false
+	}
+	instances := orchestrator.ring.Instances()
+	return len(instances) > 0 && instances[0] == orchestrator.config.Sharding.ID()
+}
+
+// heartbeat records that the orchestrator is alive and splits the DAGs between the live
+// instances, the orchestrator then takes over the DAGs it gained and the runs of dead instances
+func (orchestrator *Orchestrator) heartbeat(now time.Time) {
+	sharding := orchestrator.config.Sharding
+	identity := sharding.ID()
+	orchestrator.instanceTableClient.Heartbeat(identity, now)
+	rows := orchestrator.instanceTableClient.LiveInstances(now.Add(-sharding.InstanceTimeout()))
+	instances := make([]string, 0, len(rows))
+	for _, row := range rows {
+		instances = append(instances, row.Instance)
+	}
+	ring := shard.New(instances, sharding.VirtualNodes)
+	owned := make(map[string]bool)
+	for _, dag := range orchestrator.DAGs() {
+		owned[dag.Config.Name] = orchestrator.Owns(dag)
+	}
+	orchestrator.shardLock.Lock()
+	orchestrator.ring = ring
+	orchestrator.shardLock.Unlock()
+	for _, dag := range orchestrator.DAGs() {
+		if orchestrator.Owns(dag) && !owned[dag.Config.Name] {
+			logs.InfoLogger.Printf("%s now schedules DAG %s\n", identity, dag.Config.Name)
+			dag.RestoreMostRecentExecution()
+		}
+	}
+	orchestrator.adoptOrphanedRuns(stringutils.NewStringSet(instances))
+}
+
+// adoptOrphanedRuns takes over the runs of the DAGs the orchestrator schedules whose pods are
+// watched by instances that are not live, or by this one before it restarted, a new leader only
+// counts itself as live so that it adopts the runs of the previous leaders
+// Pods are found in each cluster by the labels of the pod executor and only adopted if their run
+// was stored
+func (orchestrator *Orchestrator) adoptOrphanedRuns(live stringutils.StringSet) {
+	clusterDAGs := make(map[string]map[string]*dagtype.DAG)
+	for _, dag := range orchestrator.ownedDAGs() {
+		if _, ok := orchestrator.executors.Get(dag.Config).(executor.Adopter); !ok || dag.Config.DryRun {
+			continue
+		}
+		if clusterDAGs[dag.Config.Cluster] == nil {
+			clusterDAGs[dag.Config.Cluster] = make(map[string]*dagtype.DAG)
+		}
+		clusterDAGs[dag.Config.Cluster][strconv.Itoa(dag.ID)] = dag
+	}
+	for name, dags := range clusterDAGs {
+		if target, ok := orchestrator.clusters[name]; ok {
+			orchestrator.adoptClusterOrphans(target, dags, live)
+		}
+	}
+}
+
+// adoptClusterOrphans adopts the orphaned pods of the cluster whose DAG id is in dags
+func (orchestrator *Orchestrator) adoptClusterOrphans(
+	target *cluster,
+	dags map[string]*dagtype.DAG,
+	live stringutils.StringSet,
+) {
+	identity := orchestrator.config.InstanceID()
+	pods, err := target.kubeClient.CoreV1().Pods("").List(
+		context.TODO(),
+		k8sapi.ListOptions{LabelSelector: utils.AppLabelSelectorString()},
+	)
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not list pods to adopt: %s\n", err)
+		return
+	}
+	for _, pod := range pods.Items {
+		dag, ok := dags[pod.Labels[utils.DAGIDLabelKey]]
+		instance := pod.Labels[utils.InstanceLabelKey]
+		runID := pod.Labels[utils.RunIDLabelKey]
+		if !ok || instance == "" || pod.Name != runID || (live.Contains(instance) && instance != identity) {
+			continue
+		}
+		if isRunCached(dag, runID) {
+			continue
+		}
+		rows := orchestrator.dagrunTableClient.GetDagRuns(dagruntable.Filter{
+			DagIDs: []int{dag.ID},
+			RunID:  runID,
+			Limit:  1,
+		})
+		if len(rows) == 0 {
+			logs.WarningLogger.Printf("Not adopting pod %s, its run was not stored\n", pod.Name)
+			continue
+		}
+		logs.InfoLogger.Printf("%s adopts run %s of DAG %s from %s\n", identity, runID, dag.Config.Name, instance)
+		dag.AdoptRun(runID, rows[0].ExecutionDate, rows[0].Trigger)
+	}
+}
+
+// isRunCached returns true if the dag run is in the cache of the DAG
+func isRunCached(dag *dagtype.DAG, runID string) bool {
+	for _, dagRun := range dag.Runs() {
+		if dagRun.Name == runID {
+			return true
+		}
+	}
+	return false
+}
+
+// shardDAGs keeps the DAGs of the orchestrator in sync with the database, the coordinator
+// collecting them from the DAG folder and the other instances syncing the stored ones
+func (orchestrator *Orchestrator) shardDAGs() {
+	if orchestrator.isCoordinator() {
+		orchestrator.CollectDAGs()
+		return
+	}
+	orchestrator.SyncDAGs()
+}
+
+// shareWork runs the cycles of a sharded orchestrator until it stops
+func (orchestrator *Orchestrator) shareWork(cycleDuration time.Duration) {
+	go cycleUntilDone(
+		orchestrator.ctx,
+		func() { orchestrator.heartbeat(time.Now()) },
+		orchestrator.config.Sharding.Heartbeat(),
+		"Heartbeat",
+	)
+	orchestrator.lead(orchestrator.ctx, orchestrator.shardDAGs, cycleDuration)
+}
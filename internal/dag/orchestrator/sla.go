@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	dagtype "goflow/internal/dag/dagtype"
+	dagrun "goflow/internal/dag/run"
+	"goflow/internal/logs"
+	"goflow/internal/notify"
+	"goflow/telemetry"
+	"time"
+
+	dagruntable "goflow/internal/dag/sql/dagrun"
+	slatable "goflow/internal/dag/sql/sla"
+
+	core "k8s.io/api/core/v1"
+)
+
+// slaLookback is how long before checking started runs whose SLA was due are still checked
+const slaLookback = 24 * time.Hour
+
+// CheckSLAs records the runs of DAGs with an SLA that had not succeeded when they were due,
+// including runs that never started
+func (orchestrator *Orchestrator) CheckSLAs() {
+	orchestrator.checkSLAs(time.Now())
+}
+
+func (orchestrator *Orchestrator) checkSLAs(now time.Time) {
+	orchestrator.slaLock.Lock()
+	defer orchestrator.slaLock.Unlock()
+	for _, dag := range orchestrator.ownedDAGs() {
+		if dag.Config.SLA == nil || dag.Config.DryRun {
+			continue
+		}
+		orchestrator.checkDAGSLA(dag, now)
+	}
+}
+
+// checkDAGSLA checks the runs of the DAG that were due since the last check, in the order of
+// their execution dates
+func (orchestrator *Orchestrator) checkDAGSLA(dag *dagtype.DAG, now time.Time) {
+	sla := dag.Config.SLA
+	checked, ok := orchestrator.slaCursors[dag.Config.Name]
+	if !ok {
+		checked = now.Add(-sla.Span() - slaLookback)
+	}
+	for {
+		executionDate, ok := dag.ScheduledDateAfter(checked)
+		if !ok || executionDate.After(now) {
+			break
+		}
+		due, ok := sla.Due(executionDate)
+		if !ok || due.After(now) {
+			break
+		}
+		orchestrator.checkRunSLA(dag, executionDate, due)
+		checked = executionDate
+	}
+	orchestrator.slaCursors[dag.Config.Name] = checked
+}
+
+// slaMissReason returns why the run for the execution date missed its SLA, false if it did not
+func slaMissReason(dag *dagtype.DAG, row *dagruntable.Row, due time.Time) (string, bool) {
+	switch {
+	case row == nil && !dag.IsOn:
+		return slatable.ReasonPaused, true
+	case row == nil && dag.ActiveRuns.Get() >= dag.Config.MaxActiveRuns:
+		return slatable.ReasonBlocked, true
+	case row == nil:
+		return slatable.ReasonNotStarted, true
+	case row.Status == string(core.PodSucceeded) && row.EndDate.After(due):
+		return slatable.ReasonLate, true
+	case row.Status == string(core.PodSucceeded):
+		return "", false
+	case row.Status == string(core.PodFailed) ||
+		row.Status == string(dagrun.PhaseCancelled) ||
+		row.Status == string(dagrun.PhaseSkipped):
+		return slatable.ReasonFailed, true
+	case row.Status == string(dagrun.PhaseWaiting):
+		return slatable.ReasonWaiting, true
+	case row.Status == string(dagrun.PhaseSensing):
+		return slatable.ReasonSensing, true
+	case row.Status == string(dagrun.PhaseQueued):
+		return slatable.ReasonQueued, true
+	}
+	return slatable.ReasonUnfinished, true
+}
+
+// checkRunSLA records a miss for the run of the DAG for the execution date if it had not
+// succeeded when it was due, and notifies of it
+func (orchestrator *Orchestrator) checkRunSLA(dag *dagtype.DAG, executionDate, due time.Time) {
+	var row *dagruntable.Row
+	if found, ok := orchestrator.dagrunTableClient.GetDagRun(dag.ID, executionDate); ok {
+		row = &found
+	}
+	reason, missed := slaMissReason(dag, row, due)
+	if !missed {
+		return
+	}
+	runID, status := "", ""
+	if row != nil {
+		runID, status = row.RunID, row.Status
+	}
+	miss, inserted := orchestrator.slaTableClient.InsertMiss(
+		slatable.NewRow(dag.ID, dag.Config.Name, executionDate, due, reason, runID, status),
+	)
+	if !inserted {
+		return
+	}
+	logs.WarningLogger.Printf(
+		"Run of DAG %s for %s missed its SLA due at %s: %s",
+		dag.Config.Name,
+		executionDate,
+		due,
+		reason,
+	)
+	telemetry.SLAMisses.Inc(dag.Config.Name, reason)
+	orchestrator.notifier.Notify(dag.Config.Notify, notify.Notification{
+		Event:         notify.EventSLAMiss,
+		DAGName:       miss.DagName,
+		RunID:         miss.RunID,
+		Status:        miss.Reason,
+		ExecutionDate: miss.ExecutionDate,
+	})
+}
+
+// RetrieveSLAMisses returns the SLA misses matching the filter, most recently detected first
+func (orchestrator *Orchestrator) RetrieveSLAMisses(filter slatable.Filter) []slatable.Row {
+	return orchestrator.slaTableClient.GetMisses(filter)
+}
@@ -0,0 +1,174 @@
+package pool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"goflow/telemetry"
+)
+
+// ErrNoPool is returned when taking slots of a pool that does not exist
+var ErrNoPool = errors.New("the pool does not exist")
+
+// ErrTooManySlots is returned when taking more slots than the pool has, which would never be granted
+var ErrTooManySlots = errors.New("more slots are taken than the pool has")
+
+// Occupancy is the state of a pool, Queued is the number of runs waiting for its slots
+type Occupancy struct {
+	Name     string
+	Slots    int
+	Occupied int
+	Queued   int
+}
+
+// Ticket is a claim on the slots of a pool by a run, granted once the slots are free
+type Ticket struct {
+	pool     string
+	slots    int
+	priority int
+	granted  chan struct{}
+}
+
+// Granted returns a channel that is closed once the ticket has been granted its slots
+func (ticket *Ticket) Granted() <-chan struct{} {
+	return ticket.granted
+}
+
+func (ticket *Ticket) isGranted() bool {
+	select {
+	case <-ticket.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+type pool struct {
+	slots    int
+	occupied int
+	queue    []*Ticket
+}
+
+// Pools limits how many slots the runs of all DAGs take at once in each named pool
+// Tickets that cannot be granted are queued, higher priority weights first and then in the order
+// they were taken. A ticket is only granted once the tickets ahead of it have been, so that runs
+// taking many slots are not starved by smaller ones
+// Pools are held in memory, with sharding each instance has its own slots for the runs it
+// schedules and resizing a pool only resizes it on the instance serving the request
+type Pools struct {
+	lock  *sync.Mutex
+	pools map[string]*pool
+}
+
+// New returns pools with the given number of slots by name
+func New(slots map[string]int) *Pools {
+	pools := &Pools{&sync.Mutex{}, make(map[string]*pool)}
+	for name, count := range slots {
+		pools.pools[name] = &pool{slots: count}
+		pools.record(name)
+	}
+	return pools
+}
+
+// record exports the occupancy of the pool, the lock must be held
+func (pools *Pools) record(name string) {
+	current := pools.pools[name]
+	telemetry.PoolSlots.Set(float64(current.slots), name)
+	telemetry.PoolOccupiedSlots.Set(float64(current.occupied), name)
+	telemetry.PoolQueuedRuns.Set(float64(len(current.queue)), name)
+}
+
+// dispatch grants the slots of the pool to the tickets at the head of its queue while they fit,
+// the lock must be held
+func (pools *Pools) dispatch(name string) {
+	current := pools.pools[name]
+	for len(current.queue) > 0 && current.occupied+current.queue[0].slots <= current.slots {
+		ticket := current.queue[0]
+		current.queue = current.queue[1:]
+		current.occupied += ticket.slots
+		close(ticket.granted)
+	}
+	pools.record(name)
+}
+
+// Acquire takes a ticket for the slots of the pool, which is granted right away if nothing is
+// queued for the pool and the slots are free
+// Tickets for more slots than the pool has are refused, since they would hold up the queue forever
+func (pools *Pools) Acquire(name string, slots, priority int) (*Ticket, error) {
+	pools.lock.Lock()
+	defer pools.lock.Unlock()
+	current, ok := pools.pools[name]
+	if !ok {
+		return nil, ErrNoPool
+	}
+	if slots > current.slots {
+		return nil, ErrTooManySlots
+	}
+	ticket := &Ticket{name, slots, priority, make(chan struct{})}
+	position := sort.Search(len(current.queue), func(i int) bool {
+		return current.queue[i].priority < priority
+	})
+	current.queue = append(current.queue, nil)
+	copy(current.queue[position+1:], current.queue[position:])
+	current.queue[position] = ticket
+	pools.dispatch(name)
+	return ticket, nil
+}
+
+// Release gives back the slots of a granted ticket, or takes a ticket that has not been granted
+// out of the queue
+func (pools *Pools) Release(ticket *Ticket) {
+	pools.lock.Lock()
+	defer pools.lock.Unlock()
+	current := pools.pools[ticket.pool]
+	if ticket.isGranted() {
+		current.occupied -= ticket.slots
+	} else {
+		for i, queued := range current.queue {
+			if queued == ticket {
+				current.queue = append(current.queue[:i], current.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	pools.dispatch(ticket.pool)
+}
+
+// Resize sets the number of slots of the pool, creating it if it does not exist
+// Runs holding slots keep them when a pool shrinks, queued runs wait until they fit
+func (pools *Pools) Resize(name string, slots int) Occupancy {
+	pools.lock.Lock()
+	defer pools.lock.Unlock()
+	current, ok := pools.pools[name]
+	if !ok {
+		current = &pool{}
+		pools.pools[name] = current
+	}
+	current.slots = slots
+	pools.dispatch(name)
+	return Occupancy{name, current.slots, current.occupied, len(current.queue)}
+}
+
+// Get returns the occupancy of the pool, false if it does not exist
+func (pools *Pools) Get(name string) (Occupancy, bool) {
+	pools.lock.Lock()
+	defer pools.lock.Unlock()
+	current, ok := pools.pools[name]
+	if !ok {
+		return Occupancy{}, false
+	}
+	return Occupancy{name, current.slots, current.occupied, len(current.queue)}, true
+}
+
+// List returns the occupancy of every pool, ordered by name
+func (pools *Pools) List() []Occupancy {
+	pools.lock.Lock()
+	defer pools.lock.Unlock()
+	occupancies := make([]Occupancy, 0, len(pools.pools))
+	for name, current := range pools.pools {
+		occupancies = append(occupancies, Occupancy{name, current.slots, current.occupied, len(current.queue)})
+	}
+	sort.Slice(occupancies, func(i, j int) bool { return occupancies[i].Name < occupancies[j].Name })
+	return occupancies
+}
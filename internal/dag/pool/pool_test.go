@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"goflow/telemetry"
+	"testing"
+)
+
+func acquire(t *testing.T, pools *Pools, name string, slots, priority int) *Ticket {
+	ticket, err := pools.Acquire(name, slots, priority)
+	if err != nil {
+		t.Fatalf("Could not acquire slots of %s: %s", name, err)
+	}
+	return ticket
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	pools := New(map[string]int{"database": 3})
+	first := acquire(t, pools, "database", 2, 0)
+	if !first.isGranted() {
+		t.Fatal("Expected the first ticket to be granted right away")
+	}
+	heavy := acquire(t, pools, "database", 2, 0)
+	low := acquire(t, pools, "database", 1, 0)
+	if heavy.isGranted() || low.isGranted() {
+		t.Error("Expected tickets behind a queued ticket to be queued")
+	}
+	high := acquire(t, pools, "database", 1, 5)
+	if !high.isGranted() {
+		t.Error("Expected the high priority ticket to go ahead of the queue")
+	}
+	occupancy, _ := pools.Get("database")
+	if occupancy != (Occupancy{"database", 3, 3, 2}) {
+		t.Errorf("Expected 3 occupied slots and 2 queued runs, found %v", occupancy)
+	}
+	if telemetry.PoolQueuedRuns.Get("database") != 2 {
+		t.Errorf("Expected the queued runs to be exported, found %f", telemetry.PoolQueuedRuns.Get("database"))
+	}
+
+	pools.Release(first)
+	if !heavy.isGranted() || low.isGranted() {
+		t.Error("Expected the heavy ticket to be granted before the one queued after it")
+	}
+	pools.Release(low)
+	pools.Release(high)
+	pools.Release(heavy)
+	if occupancy, _ := pools.Get("database"); occupancy != (Occupancy{"database", 3, 0, 0}) {
+		t.Errorf("Expected an empty pool, found %v", occupancy)
+	}
+	if _, err := pools.Acquire("cluster", 1, 0); err != ErrNoPool {
+		t.Errorf("Expected an unknown pool to be an error, found %v", err)
+	}
+	if _, err := pools.Acquire("database", 4, 0); err != ErrTooManySlots {
+		t.Errorf("Expected a ticket for more slots than the pool has to be an error, found %v", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	pools := New(map[string]int{"database": 1})
+	first := acquire(t, pools, "database", 1, 0)
+	second := acquire(t, pools, "database", 1, 0)
+	pools.Resize("database", 2)
+	if !second.isGranted() {
+		t.Error("Expected the queued ticket to be granted once the pool grew")
+	}
+	pools.Resize("database", 0)
+	pools.Release(first)
+	if occupancy, _ := pools.Get("database"); occupancy.Occupied != 1 {
+		t.Errorf("Expected runs to keep their slots when the pool shrinks, found %v", occupancy)
+	}
+	pools.Resize("cluster", 4)
+	occupancies := pools.List()
+	if len(occupancies) != 2 || occupancies[0].Name != "cluster" || occupancies[0].Slots != 4 {
+		t.Errorf("Expected the created pool to be listed first, found %v", occupancies)
+	}
+}
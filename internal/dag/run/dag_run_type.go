@@ -1,17 +1,23 @@
 package run
 
 import (
-	"context"
-	"fmt"
+	"errors"
+	"io"
+	"sync"
 
+	"goflow/internal/executor"
 	"goflow/internal/jsonpanic"
+	"goflow/internal/local/procstat"
 	"goflow/internal/logs"
+	"goflow/internal/logstore"
+	"goflow/internal/notify"
+	"goflow/internal/sensor"
+	"goflow/telemetry"
 
 	"goflow/internal/dag/activeruns"
 	dagconfig "goflow/internal/dag/config"
-	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/dag/pool"
 	"goflow/internal/k8s/pod/utils"
-	podwatch "goflow/internal/k8s/pod/watch"
 
 	"time"
 
@@ -19,27 +25,50 @@ import (
 
 	core "k8s.io/api/core/v1"
 	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
-const serviceAccount = "goflow"
+// PhaseCancelled is the status of dag runs cancelled before they finished
+const PhaseCancelled core.PodPhase = "Cancelled"
 
-// DAGRun is a single run of a given dag - corresponds with a kubernetes pod
+// PhaseDryRun is the status of dag runs of dry-run DAGs, which are recorded without being submitted
+const PhaseDryRun core.PodPhase = "DryRun"
+
+// ErrRunFinished is returned when cancelling a dag run that has already finished
+var ErrRunFinished = errors.New("the dag run has already finished")
+
+// ErrNoExecutor is returned when submitting a dag run whose executor is not available
+var ErrNoExecutor = errors.New("the executor of the DAG is not available")
+
+// ErrNoAdopter is returned when adopting a dag run whose executor cannot take over runs
+var ErrNoAdopter = errors.New("the executor of the DAG cannot adopt runs")
+
+// DAGRun is a single run of a given dag, carried out by the executor selected by the DAG
 type DAGRun struct {
 	Name          string
+	Trigger       string
 	Config        *dagconfig.DAGConfig
 	ExecutionDate k8sapi.Time // This is the date that will be passed to the pod that runs
 	StartTime     k8sapi.Time
 	EndTime       k8sapi.Time
-	pod           *core.Pod
 	withLogs      bool
-	kubeClient    kubernetes.Interface
-	watcher       *podwatch.PodWatcher
-	holder        *holder.ChannelHolder
+	logStore      logstore.Store
+	executor      executor.Executor
+	handle        executor.RunHandle
+	notifier      *notify.Notifier
+	sensorFactory *sensor.Factory
+	pools         *pool.Pools
 	dagRunCount   *activeruns.ActiveRuns
 	*dagruntable.TableClient
-	dagID int
+	dagID        int
+	attempt      int
+	status       core.PodPhase
+	finished     bool
+	cancelled    bool
+	handedOver   bool
+	holdsSlot    bool
+	sensorStates []SensorState
+	statusLock   *sync.RWMutex
 }
 
 // NewDAGRun returns a new instance of DAGRun
@@ -47,16 +76,19 @@ func NewDAGRun(
 	executionDate time.Time,
 	dagConfig *dagconfig.DAGConfig,
 	withLogs bool,
-	kubeClient kubernetes.Interface,
-	channelHolder *holder.ChannelHolder,
+	logStore logstore.Store,
+	runExecutor executor.Executor,
+	notifier *notify.Notifier,
+	sensorFactory *sensor.Factory,
+	pools *pool.Pools,
 	activeRuns *activeruns.ActiveRuns,
 	tableClient *dagruntable.TableClient,
 	dagID int,
 ) *DAGRun {
-	podName := utils.CleanK8sName(dagConfig.Name + "-" + executionDate.String())
 	return &DAGRun{
-		Name:   podName,
-		Config: dagConfig,
+		Name:    getRunName(dagConfig, executionDate),
+		Trigger: dagruntable.TriggerScheduled,
+		Config:  dagConfig,
 		ExecutionDate: k8sapi.Time{
 			Time: executionDate,
 		},
@@ -66,146 +98,362 @@ func NewDAGRun(
 		EndTime: k8sapi.Time{
 			Time: time.Time{},
 		},
-		withLogs:   withLogs,
-		kubeClient: kubeClient,
-		watcher: podwatch.NewPodWatcher(
-			podName,
-			dagConfig.Namespace,
-			kubeClient,
-			withLogs,
-			channelHolder,
-		),
-		holder:      channelHolder,
-		dagRunCount: activeRuns,
-		TableClient: tableClient,
-		dagID:       dagID,
-	}
-}
-
-func (dagRun *DAGRun) getContainerFrame() core.Container {
-	return core.Container{
-		Name:            "task",
-		Image:           dagRun.Config.DockerImage,
-		Command:         dagRun.Config.Command,
-		Args:            nil,
-		WorkingDir:      "",
-		EnvFrom:         nil,
-		Env:             nil,
-		VolumeMounts:    nil,
-		VolumeDevices:   nil,
-		ImagePullPolicy: core.PullIfNotPresent,
-	}
-}
-
-func copyStringMap(mapToCopy map[string]string) map[string]string {
-	copy := make(map[string]string)
-	for key := range mapToCopy {
-		copy[key] = mapToCopy[key]
-	}
-	return copy
-}
-
-// getPodFrame returns a pod from a DagRun
-func (dagRun *DAGRun) getPodFrame() core.Pod {
-	labels := copyStringMap(dagRun.Config.Labels)
-	labels["Name"] = dagRun.Name
-	labels["App"] = "goflow"
-	return core.Pod{
-		TypeMeta: k8sapi.TypeMeta{
-			Kind:       "Pod",
-			APIVersion: "v1",
-		},
-		ObjectMeta: k8sapi.ObjectMeta{
-			Name:        dagRun.Name,
-			Namespace:   dagRun.Config.Namespace,
-			Labels:      labels,
-			Annotations: dagRun.Config.Annotations,
-		},
-		Spec: core.PodSpec{
-			Volumes:               nil,
-			Containers:            []core.Container{dagRun.getContainerFrame()},
-			EphemeralContainers:   nil,
-			RestartPolicy:         dagRun.Config.RetryPolicy,
-			ActiveDeadlineSeconds: dagRun.Config.TimeLimit,
-			ServiceAccountName:    serviceAccount,
-		},
+		withLogs:      withLogs,
+		logStore:      logStore,
+		executor:      runExecutor,
+		notifier:      notifier,
+		sensorFactory: sensorFactory,
+		pools:         pools,
+		dagRunCount:   activeRuns,
+		TableClient:   tableClient,
+		dagID:         dagID,
+		attempt:       1,
+		status:        core.PodPending,
+		statusLock:    &sync.RWMutex{},
 	}
 }
 
-// createPod creates and registers a new pod with
-func (dagRun *DAGRun) createPod() {
-	podFrame := dagRun.getPodFrame()
-	logs.InfoLogger.Printf("Creating pod %s...\n", podFrame.Name)
-	pod, err := dagRun.podClient().Create(
-		context.TODO(),
-		&podFrame,
-		k8sapi.CreateOptions{},
-	)
+// getRunName returns the name of the run, which is also the name of its pod or Job
+func getRunName(dagConfig *dagconfig.DAGConfig, executionDate time.Time) string {
+	return utils.CleanK8sName(dagConfig.Name + "-" + executionDate.String())
+}
+
+// Render returns what the executor would create for a run of the DAG on the execution date,
+// without creating anything
+func Render(
+	runExecutor executor.Executor,
+	dagConfig *dagconfig.DAGConfig,
+	dagID int,
+	executionDate time.Time,
+) runtime.Object {
+	return runExecutor.Render(executor.Spec{
+		Name:          getRunName(dagConfig, executionDate),
+		DAGID:         dagID,
+		Attempt:       1,
+		ExecutionDate: executionDate,
+		Config:        dagConfig,
+	})
+}
+
+// spec returns the spec of the current attempt of the dag run
+func (dagRun *DAGRun) spec() executor.Spec {
+	return executor.Spec{
+		Name:          dagRun.Name,
+		DAGID:         dagRun.dagID,
+		Attempt:       dagRun.attempt,
+		ExecutionDate: dagRun.ExecutionDate.Time,
+		Config:        dagRun.Config,
+	}
+}
+
+// logKey returns the key the logs of the current attempt are stored under
+func (dagRun *DAGRun) logKey() logstore.Key {
+	return logstore.Key{DAGName: dagRun.Config.Name, RunID: dagRun.Name, Attempt: dagRun.attempt}
+}
+
+// newLogWriter returns the writer of the logs of the current attempt, or nil if logs are not
+// stored
+func (dagRun *DAGRun) newLogWriter() io.WriteCloser {
+	if !dagRun.withLogs || dagRun.logStore == nil {
+		return nil
+	}
+	logWriter, err := dagRun.logStore.NewWriter(dagRun.logKey())
 	if err != nil {
-		panic(err)
+		logs.ErrorLogger.Printf("Logs for dag run %s will not be stored: %s", dagRun.Name, err)
+		return nil
 	}
-	logs.InfoLogger.Printf(
-		"Pod '%s' created in namespace '%s'\n",
-		podFrame.Name,
-		podFrame.Namespace,
+	return logWriter
+}
+
+func (dagRun *DAGRun) row(status string) dagruntable.Row {
+	row := dagruntable.NewRow(dagRun.dagID, dagRun.Name, dagRun.Trigger, status, dagRun.ExecutionDate.Time)
+	row.EndDate = dagRun.EndTime.Time
+	row.Cluster = dagRun.Config.Cluster
+	return row
+}
+
+// Status returns the pod phase of the dag run, the final phase once it has finished
+func (dagRun *DAGRun) Status() string {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	return string(dagRun.status)
+}
+
+// Finished returns true once the outcome of the dag run has been recorded
+func (dagRun *DAGRun) Finished() bool {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	return dagRun.finished
+}
+
+func (dagRun *DAGRun) setStatus(status core.PodPhase, finished bool) {
+	dagRun.statusLock.Lock()
+	dagRun.status = status
+	dagRun.finished = finished
+	dagRun.statusLock.Unlock()
+}
+
+// notify sends the notifications that the DAG asks for of the event on the given attempt
+func (dagRun *DAGRun) notify(event string, attempt int) {
+	if dagRun.notifier == nil || len(dagRun.Config.Notify) == 0 {
+		return
+	}
+	dagRun.notifier.Notify(dagRun.Config.Notify, notify.Notification{
+		Event:         event,
+		DAGName:       dagRun.Config.Name,
+		RunID:         dagRun.Name,
+		Status:        dagRun.Status(),
+		ExecutionDate: dagRun.ExecutionDate.Time,
+		Attempt:       attempt,
+	})
+}
+
+// recordOutcome stores and exports the final status of the dag run and notifies of it
+func (dagRun *DAGRun) recordOutcome(status core.PodPhase, attempt int) {
+	dagRun.EndTime = k8sapi.Time{Time: time.Now()}
+	dagRun.setStatus(status, true)
+	dagRun.UpsertDagRun(dagRun.row(string(status)))
+	telemetry.RunOutcomes.Inc(dagRun.Config.Name, string(status))
+	telemetry.RunDuration.Observe(
+		dagRun.EndTime.Sub(dagRun.StartTime.Time).Seconds(),
+		dagRun.Config.Name,
+		string(status),
 	)
-	dagRun.pod = pod
+	switch status {
+	case core.PodSucceeded:
+		dagRun.notify(notify.EventSuccess, attempt)
+	case core.PodFailed:
+		dagRun.notify(notify.EventFailure, attempt)
+	}
 }
 
-// podClient returns the api endpoint for pods
-func (dagRun *DAGRun) podClient() v1.PodInterface {
-	return dagRun.kubeClient.CoreV1().Pods(dagRun.Config.Namespace)
+// submit submits the dag run to its executor and keeps its handle
+func (dagRun *DAGRun) submit() (executor.RunHandle, error) {
+	if dagRun.executor == nil {
+		return nil, ErrNoExecutor
+	}
+	handle, err := dagRun.executor.Submit(dagRun.spec())
+	if err != nil {
+		return nil, err
+	}
+	dagRun.keepHandle(handle)
+	return handle, nil
 }
 
-// Run runs the pods and monitoring methods
-func (dagRun *DAGRun) Run() {
-	podFrame := dagRun.getPodFrame()
-	dagRun.holder.AddChannelGroup(podFrame.Name)
-	go dagRun.watcher.MonitorPod() // Start monitoring before the pod is actually running
-	dagRun.createPod()
+// adopt takes over the dag run that another goflow instance submitted to the executor and keeps
+// its handle
+func (dagRun *DAGRun) adopt() (executor.RunHandle, error) {
+	adopter, ok := dagRun.executor.(executor.Adopter)
+	if !ok {
+		return nil, ErrNoAdopter
+	}
+	handle, err := adopter.Adopt(dagRun.spec())
+	if err != nil {
+		return nil, err
+	}
+	dagRun.keepHandle(handle)
+	return handle, nil
 }
 
-func (dagRun *DAGRun) row() dagruntable.Row {
-	return dagruntable.NewRow(dagRun.dagID, "", dagRun.ExecutionDate.Time)
+// keepHandle keeps the handle of the submitted dag run, which is cancelled right away if the dag
+// run was cancelled in the meantime
+func (dagRun *DAGRun) keepHandle(handle executor.RunHandle) {
+	dagRun.statusLock.Lock()
+	dagRun.handle = handle
+	cancelled := dagRun.cancelled
+	dagRun.statusLock.Unlock()
+	if cancelled {
+		err := handle.Cancel()
+		if err != nil {
+			logs.ErrorLogger.Printf("Could not cancel dag run %s: %s", dagRun.Name, err)
+		}
+	}
 }
 
 // Start runs the dagrun and waits for the monitoring to finish
+// Dag runs that another goflow instance already submitted are handed over to it
+// Dag runs of DAGs with WaitFor are held as waiting until the runs they wait for are done, then
+// dag runs of DAGs with Sensors are held as sensing until their sensors are satisfied
+// The dag run holds the active run slot it was started with until it finishes, except while sensing
+// Dag runs of DAGs with a Pool are then held as queued until they get the slots of their pool
 func (dagRun *DAGRun) Start() {
-	defer dagRun.DeletePod()
-	defer dagRun.dagRunCount.Dec()
-	go dagRun.Run()
-	dagRun.UpsertDagRun(dagRun.row())
-	dagRun.watcher.WaitForMonitorDone()
+	dagRun.holdsSlot = true
+	defer dagRun.releaseSlot()
+	if len(dagRun.Config.WaitFor) > 0 && !dagRun.Config.DryRun {
+		dagRun.setStatus(PhaseWaiting, false)
+		dagRun.UpsertDagRun(dagRun.row(string(PhaseWaiting)))
+		if outcome, ok := dagRun.waitForDependencies(); !ok {
+			dagRun.recordOutcome(outcome, 0)
+			return
+		}
+	}
+	if len(dagRun.Config.Sensors) > 0 && !dagRun.Config.DryRun {
+		dagRun.setStatus(PhaseSensing, false)
+		dagRun.UpsertDagRun(dagRun.row(string(PhaseSensing)))
+		if outcome, ok := dagRun.sense(); !ok {
+			dagRun.recordOutcome(outcome, 0)
+			return
+		}
+	}
+	if dagRun.Config.Pool != "" && !dagRun.Config.DryRun {
+		ticket, outcome, ok := dagRun.queueForPool()
+		if !ok {
+			dagRun.recordOutcome(outcome, 0)
+			return
+		}
+		defer dagRun.pools.Release(ticket)
+	}
+	dagRun.setStatus(core.PodRunning, false)
+	dagRun.UpsertDagRun(dagRun.row(string(core.PodRunning)))
+	if dagRun.Config.DryRun {
+		manifest := "nothing, its executor is not available"
+		if dagRun.executor != nil {
+			manifest = jsonpanic.JSONPanic(dagRun.executor.Render(dagRun.spec()))
+		}
+		logs.InfoLogger.Printf("Dag run %s is a dry run, not submitting %s", dagRun.Name, manifest)
+		dagRun.recordOutcome(PhaseDryRun, 0)
+		return
+	}
+	handle, err := dagRun.submit()
+	if err == executor.ErrAlreadySubmitted {
+		dagRun.handOver()
+		return
+	}
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not submit dag run %s: %s", dagRun.Name, err)
+		dagRun.recordOutcome(core.PodFailed, 0)
+		return
+	}
+	dagRun.follow(handle)
 }
 
-// Logs returns the channel holding the watcher's logs
-func (dagRun *DAGRun) Logs() chan string {
-	return dagRun.watcher.Logs
+// Claim stores the dag run unless a run of its DAG with the same id and trigger was stored,
+// returning false if another goflow instance claimed it first
+func (dagRun *DAGRun) Claim() bool {
+	return dagRun.ClaimDagRun(dagRun.row(dagRun.Status()))
 }
 
-// DeletePod deletes the dag run's associated pod
-func (dagRun *DAGRun) DeletePod() {
-	logs.InfoLogger.Printf(
-		"Deleting pod %s, in namespace %s",
-		dagRun.pod.Name,
-		dagRun.pod.Namespace,
-	)
-	err := dagRun.podClient().Delete(
-		context.TODO(),
-		dagRun.Name,
-		k8sapi.DeleteOptions{},
-	)
+// handOver leaves the dag run to the goflow instance that started it, the dag run finishes without
+// recording anything
+func (dagRun *DAGRun) handOver() {
+	logs.WarningLogger.Printf("Dag run %s was started by another goflow instance, leaving it", dagRun.Name)
+	dagRun.statusLock.Lock()
+	dagRun.handedOver = true
+	dagRun.finished = true
+	dagRun.statusLock.Unlock()
+}
+
+// HandedOver returns true if the dag run was left to the goflow instance that started it
+func (dagRun *DAGRun) HandedOver() bool {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	return dagRun.handedOver
+}
+
+// Adopt takes over the dag run that another goflow instance submitted and waits for the monitoring
+// to finish, the dag run is recorded as failed if its executor cannot adopt it
+// Adopted dag runs hold their active run slot but not the slots of their pool, since they are
+// already running
+func (dagRun *DAGRun) Adopt() {
+	dagRun.holdsSlot = true
+	defer dagRun.releaseSlot()
+	dagRun.setStatus(core.PodRunning, false)
+	handle, err := dagRun.adopt()
 	if err != nil {
-		panic(err)
+		logs.ErrorLogger.Printf("Could not adopt dag run %s: %s", dagRun.Name, err)
+		dagRun.recordOutcome(core.PodFailed, 0)
+		return
+	}
+	dagRun.follow(handle)
+}
+
+// follow streams the logs and records the phases of the submitted dag run until it has finished
+func (dagRun *DAGRun) follow(handle executor.RunHandle) {
+	defer handle.Cleanup()
+	if logWriter := dagRun.newLogWriter(); logWriter != nil {
+		handle.StreamLogs(logWriter)
+	}
+	// Executors send Running as each attempt starts, later attempts are retries
+	phase := core.PodUnknown
+	attempts := 0
+	for phase = range handle.Watch() {
+		dagRun.setStatus(phase, false)
+		if phase == core.PodRunning {
+			attempts++
+			if attempts > 1 {
+				dagRun.notify(notify.EventRetry, attempts)
+			}
+		}
+	}
+	dagRun.statusLock.RLock()
+	cancelled := dagRun.cancelled
+	dagRun.statusLock.RUnlock()
+	if cancelled {
+		dagRun.recordOutcome(PhaseCancelled, attempts)
+		return
+	}
+	dagRun.recordOutcome(phase, attempts)
+}
+
+// runHandle returns the handle of the submitted dag run, nil if it has not been submitted
+func (dagRun *DAGRun) runHandle() executor.RunHandle {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	return dagRun.handle
+}
+
+// Cancel stops an unfinished dag run, which is then recorded as cancelled
+func (dagRun *DAGRun) Cancel() error {
+	dagRun.statusLock.Lock()
+	if dagRun.finished {
+		dagRun.statusLock.Unlock()
+		return ErrRunFinished
+	}
+	dagRun.cancelled = true
+	handle := dagRun.handle
+	dagRun.statusLock.Unlock()
+	logs.InfoLogger.Printf("Cancelling dag run %s", dagRun.Name)
+	if handle == nil {
+		// The dag run is cancelled once it has been submitted
+		return nil
+	}
+	return handle.Cancel()
+}
+
+// Terminate stops the dag run if it has been submitted and has not finished, dag runs that
+// have not been submitted yet never are
+func (dagRun *DAGRun) Terminate() {
+	dagRun.statusLock.Lock()
+	handle := dagRun.handle
+	if handle == nil && !dagRun.finished {
+		dagRun.cancelled = true
+	}
+	dagRun.statusLock.Unlock()
+	if handle == nil {
+		return
+	}
+	err := handle.Cancel()
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not terminate dag run %s: %s", dagRun.Name, err)
+	}
+}
+
+// Usage returns the last sampled resource usage of the running dag run and the number of its
+// attempt, false if its executor does not sample usage
+func (dagRun *DAGRun) Usage() (procstat.Usage, int, bool) {
+	reporter, ok := dagRun.runHandle().(executor.UsageReporter)
+	if !ok {
+		return procstat.Usage{}, 0, false
 	}
+	return reporter.Usage()
 }
 
-// MostRecentPod returns the pod run for this dag run
-func (dagRun *DAGRun) MostRecentPod() (core.Pod, error) {
-	if dagRun.pod == nil {
-		return core.Pod{}, fmt.Errorf("pod %s has not been created yet", dagRun.Name)
+// Logs returns the stored log lines for the current attempt of the dag run
+func (dagRun *DAGRun) Logs(options logstore.ReadOptions) ([]string, error) {
+	if dagRun.logStore == nil {
+		return nil, logstore.ErrNotFound
 	}
-	return *dagRun.pod, nil
+	return dagRun.logStore.Read(dagRun.logKey(), options)
 }
 
 func (dagRun *DAGRun) String() string {
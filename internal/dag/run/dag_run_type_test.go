@@ -1,15 +1,24 @@
 package run
 
 import (
-	"context"
+	"fmt"
+	goflowconfig "goflow/internal/config"
 	"goflow/internal/dag/activeruns"
 	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/pool"
 	"goflow/internal/database"
-	"goflow/internal/jsonpanic"
+	"goflow/internal/executor"
+	"goflow/internal/logstore"
+	"goflow/internal/notify"
+	"goflow/internal/sensor"
 	"goflow/internal/testutils"
-
-	"goflow/internal/k8s/pod/event/holder"
-	podutils "goflow/internal/k8s/pod/utils"
+	"goflow/telemetry"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -20,22 +29,94 @@ import (
 
 	core "k8s.io/api/core/v1"
 	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 var TABLECLIENT *dagruntable.TableClient
 var DAGTABLECLIENT *dagtable.TableClient
 var SQLCLIENT *database.SQLClient
+var LOGSTORE logstore.Store
+var POOLS *pool.Pools
 
 func TestMain(m *testing.M) {
 	testutils.RemoveSQLiteDB()
+	testutils.RemoveLogs()
+	defer testutils.RemoveLogs()
+	LOGSTORE = logstore.NewLocalStore(testutils.GetLogsFolder())
+	POOLS = pool.New(map[string]int{"database": 1})
 	SQLCLIENT = database.NewSQLiteClient(testutils.GetSQLiteLocation())
 	TABLECLIENT = dagruntable.NewTableClient(SQLCLIENT)
 	DAGTABLECLIENT = dagtable.NewTableClient(SQLCLIENT)
 	m.Run()
 }
 
+// fakeExecutor submits runs that finish with the phase sent on their handle's finish channel
+// Each run starts attempts attempts, all but the last one failing
+type fakeExecutor struct {
+	submitErr error
+	attempts  int
+	handles   chan *fakeHandle
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{handles: make(chan *fakeHandle, 1)}
+}
+
+func (fake *fakeExecutor) Render(spec executor.Spec) runtime.Object {
+	return &core.Pod{ObjectMeta: k8sapi.ObjectMeta{Name: spec.Name}}
+}
+
+func (fake *fakeExecutor) Submit(spec executor.Spec) (executor.RunHandle, error) {
+	if fake.submitErr != nil {
+		return nil, fake.submitErr
+	}
+	handle := &fakeHandle{spec: spec, attempts: fake.attempts, finish: make(chan core.PodPhase, 1)}
+	fake.handles <- handle
+	return handle, nil
+}
+
+type fakeHandle struct {
+	spec      executor.Spec
+	logWriter io.WriteCloser
+	attempts  int
+	finish    chan core.PodPhase
+	cleanedUp bool
+}
+
+func (handle *fakeHandle) StreamLogs(writer io.WriteCloser) {
+	handle.logWriter = writer
+}
+
+func (handle *fakeHandle) Watch() <-chan core.PodPhase {
+	phases := make(chan core.PodPhase)
+	go func() {
+		defer close(phases)
+		phases <- core.PodRunning
+		for attempt := 1; attempt < handle.attempts; attempt++ {
+			phases <- core.PodRunning
+		}
+		phase := <-handle.finish
+		if handle.logWriter != nil {
+			fmt.Fprintln(handle.logWriter, "fake logs")
+			handle.logWriter.Close()
+		}
+		phases <- phase
+	}()
+	return phases
+}
+
+func (handle *fakeHandle) Cancel() error {
+	select {
+	case handle.finish <- core.PodFailed:
+	default:
+	}
+	return nil
+}
+
+func (handle *fakeHandle) Cleanup() {
+	handle.cleanedUp = true
+}
+
 func getTestDate() time.Time {
 	return time.Date(2019, 1, 1, 0, 0, 0, 0, time.Now().Location())
 }
@@ -58,42 +139,41 @@ func getTestDAGConfig(name string, command []string) *dagconfig.DAGConfig {
 	}
 }
 
-func TestCreatePod(t *testing.T) {
-	client := fake.NewSimpleClientset()
-	defer podutils.CleanUpEnvironment(client)
-	dagRun := NewDAGRun(
+func newTestDAGRun(name string, withLogs bool, runExecutor executor.Executor) *DAGRun {
+	return newNotifyingTestDAGRun(name, withLogs, runExecutor, nil)
+}
+
+func newNotifyingTestDAGRun(
+	name string,
+	withLogs bool,
+	runExecutor executor.Executor,
+	notifier *notify.Notifier,
+) *DAGRun {
+	return NewDAGRun(
 		getTestDate(),
-		getTestDAGConfig("test-create-pod", []string{}),
-		false,
-		client,
-		holder.New(),
+		getTestDAGConfig(name, []string{}),
+		withLogs,
+		LOGSTORE,
+		runExecutor,
+		notifier,
+		sensor.NewFactory(nil),
+		POOLS,
 		activeruns.New(),
 		TABLECLIENT,
 		0,
 	)
-	dagRun.createPod()
-	foundPod, err := dagRun.kubeClient.CoreV1().Pods(
-		dagRun.Config.Namespace,
-	).Get(
-		context.TODO(),
-		dagRun.pod.Name,
-		k8sapi.GetOptions{},
-	)
-	if err != nil {
-		panic(err)
-	}
-	foundPodValue := jsonpanic.JSONPanic(*foundPod)
-	expectedValue := jsonpanic.JSONPanic(*dagRun.pod)
-	if foundPodValue != expectedValue {
-		t.Error("Expected:", expectedValue)
-		t.Error("Found:", foundPodValue)
-	}
 }
 
-func TestRunPod(t *testing.T) {
-	// Test with logs and without logs
-	client := fake.NewSimpleClientset()
-	defer podutils.CleanUpEnvironment(client)
+func setupDatabase() {
+	DAGTABLECLIENT.CreateTable()
+	TABLECLIENT.CreateTable()
+	DAGTABLECLIENT.UpsertDAG(dagtable.NewRow(0, true, "test", "default", "0.0.0", "test", "json"))
+}
+
+func TestStart(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
 	tables := []struct {
 		name     string
 		withLogs bool
@@ -103,169 +183,422 @@ func TestRunPod(t *testing.T) {
 	}
 	for _, table := range tables {
 		t.Logf("Test case: %s", table.name)
-		func() {
-			expectedLogMessage := "Hello World!!!"
-			dagRun := NewDAGRun(
-				getTestDate(),
-				getTestDAGConfig(
-					"test-start-pod"+podutils.CleanK8sName(table.name),
-					[]string{"echo", expectedLogMessage},
-				),
-				table.withLogs,
-				client,
-				holder.New(),
-				activeruns.New(),
-				TABLECLIENT,
-				0,
-			)
-			dagRun.Run()
-
-			dagRun.holder.GetChannelGroup(dagRun.pod.Name).Ready <- dagRun.pod
-
-			podCopy := dagRun.pod.DeepCopy()
-			podCopy.Status.Phase = core.PodSucceeded
-			dagRun.holder.GetChannelGroup(dagRun.pod.Name).Update <- podCopy
-
-			dagRun.watcher.WaitForMonitorDone()
-
-			// Test for dag completion in state of dag
-			if (dagRun.watcher.Phase != core.PodSucceeded) &&
-				(dagRun.watcher.Phase != core.PodFailed) {
-				t.Errorf(
-					"A finished dagRun should be in phase %s or state %s, but found in state %s",
-					core.PodSucceeded,
-					core.PodFailed,
-					dagRun.watcher.Phase,
-				)
-			}
-
-			// Test for log output if logs enabled
-			if table.withLogs {
-				logMsg := <-dagRun.Logs()
-				logMsg = strings.ReplaceAll(logMsg, "\n", "")
-				if logMsg != expectedLogMessage && logMsg != "fake logs" {
-					t.Errorf(
-						"Expected log message %s, found log message %s",
-						expectedLogMessage,
-						logMsg,
-					)
-				}
-			}
+		fakeExecutor := newFakeExecutor()
+		dagRun := newTestDAGRun("test-start-"+strings.ReplaceAll(strings.ToLower(table.name), " ", "-"), table.withLogs, fakeExecutor)
+		done := make(chan struct{})
+		go func() {
+			dagRun.Start()
+			close(done)
 		}()
+		handle := <-fakeExecutor.handles
+		if handle.spec.Name != dagRun.Name || handle.spec.Attempt != 1 {
+			t.Errorf("Expected the spec of the first attempt of %s, found %v", dagRun.Name, handle.spec)
+		}
+		handle.finish <- core.PodSucceeded
+		<-done
 
+		if dagRun.Status() != string(core.PodSucceeded) || !dagRun.Finished() {
+			t.Errorf("Expected dag run to have succeeded, found %s", dagRun.Status())
+		}
+		if !handle.cleanedUp {
+			t.Error("Expected the finished run to be cleaned up")
+		}
+		rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+		if len(rows) != 1 || rows[0].Status != string(core.PodSucceeded) {
+			t.Errorf("Expected succeeded dag run row, found %s", rows)
+		}
+		logLines, err := dagRun.Logs(logstore.ReadOptions{})
+		if table.withLogs && (err != nil || strings.Join(logLines, "") != "fake logs") {
+			t.Errorf("Expected the logs of the run to be stored, found %v, %v", logLines, err)
+		}
+		if !table.withLogs && len(logLines) != 0 {
+			t.Errorf("Expected no logs to be stored, found %v", logLines)
+		}
 	}
+}
+
+func TestStartRecordsOutcome(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
 
+	dagName := "test-start-records-outcome"
+	fakeExecutor := newFakeExecutor()
+	fakeExecutor.submitErr = fmt.Errorf("submission refused")
+	dagRun := newTestDAGRun(dagName, false, fakeExecutor)
+	outcomes := telemetry.RunOutcomes.Get(dagName, string(core.PodFailed))
+	dagRun.Start()
+
+	if telemetry.RunOutcomes.Get(dagName, string(core.PodFailed)) != outcomes+1 {
+		t.Error("Failed run outcome should have been counted")
+	}
+	rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+	if len(rows) != 1 || rows[0].Status != string(core.PodFailed) {
+		t.Errorf("Expected failed dag run row, found %s", rows)
+	}
 }
 
-func TestDeletePod(t *testing.T) {
-	client := fake.NewSimpleClientset()
-	defer podutils.CleanUpEnvironment(client)
-	dagRun := NewDAGRun(
-		getTestDate(),
-		getTestDAGConfig("test-delete-pod", []string{}),
-		false,
-		client,
-		holder.New(),
-		activeruns.New(),
-		TABLECLIENT,
-		0,
-	)
-	podFrame := dagRun.getPodFrame()
-	podsClient := client.CoreV1().Pods(dagRun.Config.Namespace)
+func TestClaim(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
 
-	createdPod, err := podsClient.Create(context.TODO(), &podFrame, k8sapi.CreateOptions{})
-	dagRun.pod = createdPod
+	dagRun := newTestDAGRun("test-claim", false, newFakeExecutor())
+	if !dagRun.Claim() {
+		t.Error("Expected the first claim of the dag run to succeed")
+	}
+	if newTestDAGRun("test-claim", false, newFakeExecutor()).Claim() {
+		t.Error("Expected the dag run claimed by another instance not to be claimed again")
+	}
+	manual := newTestDAGRun("test-claim", false, newFakeExecutor())
+	manual.Trigger = dagruntable.TriggerManual
+	if !manual.Claim() {
+		t.Error("Expected the manual dag run of the same execution date to be claimed")
+	}
+}
+
+func TestStartHandsOverSubmittedRuns(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	fakeExecutor := newFakeExecutor()
+	fakeExecutor.submitErr = executor.ErrAlreadySubmitted
+	dagRun := newTestDAGRun("test-start-hands-over-submitted", false, fakeExecutor)
+	dagRun.Start()
+
+	if !dagRun.HandedOver() || !dagRun.Finished() {
+		t.Errorf("Expected the submitted dag run to be handed over, found %s", dagRun.Status())
+	}
+	rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+	if len(rows) != 1 || rows[0].Status != string(core.PodRunning) {
+		t.Errorf("Expected the dag run not to be recorded as failed, found %s", rows)
+	}
+}
+
+func TestStartWithoutExecutor(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	dagRun := newTestDAGRun("test-start-without-executor", false, nil)
+	dagRun.Start()
+	if dagRun.Status() != string(core.PodFailed) {
+		t.Errorf("Expected a dag run without executor to fail, found %s", dagRun.Status())
+	}
+}
+
+func TestCancel(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-cancel", false, fakeExecutor)
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	<-fakeExecutor.handles
+	for dagRun.runHandle() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := dagRun.Cancel()
 	if err != nil {
-		panic(err)
+		t.Fatalf("Could not cancel dag run: %s", err)
+	}
+	<-done
+	if dagRun.Status() != string(PhaseCancelled) {
+		t.Errorf("Expected dag run to be %s, found %s", PhaseCancelled, dagRun.Status())
+	}
+	rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+	if len(rows) != 1 || rows[0].Status != string(PhaseCancelled) {
+		t.Errorf("Expected cancelled dag run row, found %s", rows)
+	}
+	if dagRun.Cancel() != ErrRunFinished {
+		t.Error("Expected cancelling a finished dag run to fail")
 	}
-	dagRun.DeletePod()
-	list, err := podsClient.List(context.TODO(), k8sapi.ListOptions{})
+}
+
+func TestCancelBeforeSubmit(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	dagRun := newTestDAGRun("test-cancel-before-submit", false, newFakeExecutor())
+	err := dagRun.Cancel()
 	if err != nil {
-		panic(err)
+		t.Fatalf("Could not cancel dag run: %s", err)
+	}
+	dagRun.Start()
+	if dagRun.Status() != string(PhaseCancelled) {
+		t.Errorf("Expected dag run to be cancelled once submitted, found %s", dagRun.Status())
+	}
+}
+
+func TestStartNotifies(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	events := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(notify.EventHeader)
+	}))
+	defer server.Close()
+	notifier := notify.New(&goflowconfig.NotificationConfig{MaxAttempts: 1}, nil)
+	fakeExecutor := newFakeExecutor()
+	fakeExecutor.attempts = 2
+	dagRun := newNotifyingTestDAGRun("test-start-notifies", false, fakeExecutor, notifier)
+	dagRun.Config.Notify = []notify.Rule{
+		{On: []string{notify.EventRetry, notify.EventFailure}, Channel: notify.ChannelWebhook, URL: server.URL},
+	}
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	(<-fakeExecutor.handles).finish <- core.PodFailed
+	<-done
+	notifier.Wait()
+
+	// The notifications are delivered concurrently, so they may arrive in any order
+	close(events)
+	received := make(map[string]int)
+	for event := range events {
+		received[event]++
+	}
+	if len(received) != 2 || received[notify.EventRetry] != 1 || received[notify.EventFailure] != 1 {
+		t.Errorf("Expected a retry and a failure notification, found %v", received)
+	}
+}
+
+func TestStartDryRun(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-dry-run", false, fakeExecutor)
+	dagRun.Config.DryRun = true
+	dagRun.Start()
+
+	if len(fakeExecutor.handles) != 0 {
+		t.Error("Expected a dry run not to be submitted")
+	}
+	rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+	if len(rows) != 1 || rows[0].Status != string(PhaseDryRun) {
+		t.Errorf("Expected dry run row, found %s", rows)
 	}
-	for _, pod := range list.Items {
-		if jsonpanic.JSONPanic(*createdPod) == jsonpanic.JSONPanic(pod) {
-			t.Errorf("Pod %s should have been deleted", createdPod.Name)
+}
+
+func TestRender(t *testing.T) {
+	dagConfig := getTestDAGConfig("test-render", []string{})
+	pod := Render(newFakeExecutor(), dagConfig, 3, getTestDate()).(*core.Pod)
+	dagRun := newTestDAGRun("test-render", false, nil)
+	if pod.Name != dagRun.Name {
+		t.Errorf("Expected the rendered object to be named after the run, found %s", pod.Name)
+	}
+}
+
+func TestStartWaitsFor(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	upstream := DAGTABLECLIENT.UpsertDAG(dagtable.NewRow(0, true, "upstream", "default", "0.0.0", "upstream", "json"))
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-start-waits-for", false, fakeExecutor)
+	dagRun.Config.WaitFor = []dagconfig.WaitFor{{DAG: "upstream", OffsetSeconds: -3600}}
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	for dagRun.Status() != string(PhaseWaiting) {
+		time.Sleep(time.Millisecond)
+	}
+	dependencies := dagRun.Dependencies()
+	if len(dependencies) != 1 || dependencies[0].Met || !dependencies[0].ExecutionDate.Equal(getTestDate().Add(-time.Hour)) {
+		t.Errorf("Expected the unmet run of upstream an hour earlier, found %v", dependencies)
+	}
+	rows := TABLECLIENT.GetLastNRunsForDagID(0, 1)
+	if len(rows) != 1 || rows[0].Status != string(PhaseWaiting) {
+		t.Errorf("Expected waiting dag run row, found %s", rows)
+	}
+
+	TABLECLIENT.UpsertDagRun(dagruntable.NewRow(
+		upstream.ID,
+		"upstream-run",
+		dagruntable.TriggerScheduled,
+		string(core.PodSucceeded),
+		getTestDate().Add(-time.Hour),
+	))
+	(<-fakeExecutor.handles).finish <- core.PodSucceeded
+	<-done
+	if dagRun.Status() != string(core.PodSucceeded) {
+		t.Errorf("Expected the dag run to run once upstream succeeded, found %s", dagRun.Status())
+	}
+}
+
+func TestStartWaitForTimeout(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+
+	tables := []struct {
+		onTimeout      string
+		expectedStatus core.PodPhase
+		submitted      bool
+	}{
+		{"", core.PodFailed, false},
+		{dagconfig.OnTimeoutSkip, PhaseSkipped, false},
+		{dagconfig.OnTimeoutRun, core.PodSucceeded, true},
+	}
+	for _, table := range tables {
+		fakeExecutor := newFakeExecutor()
+		dagRun := newTestDAGRun("test-wait-for-timeout-"+table.onTimeout, false, fakeExecutor)
+		dagRun.Config.WaitFor = []dagconfig.WaitFor{{DAG: "upstream", TimeoutSeconds: 60, OnTimeout: table.onTimeout}}
+		dagRun.StartTime.Time = time.Now().Add(-time.Hour)
+		if table.submitted {
+			go func() { (<-fakeExecutor.handles).finish <- core.PodSucceeded }()
+		}
+		dagRun.Start()
+		if dagRun.Status() != string(table.expectedStatus) {
+			t.Errorf("Expected a timed out dag run with %q to be %s, found %s", table.onTimeout, table.expectedStatus, dagRun.Status())
 		}
 	}
 }
 
-func setupDatabase() {
-	DAGTABLECLIENT.CreateTable()
-	TABLECLIENT.CreateTable()
-	DAGTABLECLIENT.UpsertDAG(dagtable.NewRow(0, true, "test", "default", "0.0.0", "test", "json"))
+func TestCancelWaiting(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-cancel-waiting", false, fakeExecutor)
+	dagRun.Config.WaitFor = []dagconfig.WaitFor{{DAG: "upstream"}}
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	for dagRun.Status() != string(PhaseWaiting) {
+		time.Sleep(time.Millisecond)
+	}
+	err := dagRun.Cancel()
+	if err != nil {
+		t.Fatalf("Could not cancel dag run: %s", err)
+	}
+	<-done
+	if dagRun.Status() != string(PhaseCancelled) || len(fakeExecutor.handles) != 0 {
+		t.Errorf("Expected the waiting dag run to be cancelled without being submitted, found %s", dagRun.Status())
+	}
 }
 
-func TestStart(t *testing.T) {
-	// Test with logs and without logs
-	client := fake.NewSimpleClientset()
-	defer podutils.CleanUpEnvironment(client)
+func TestStartSenses(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+	dir, err := ioutil.TempDir("", "sensor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	// Set up DB
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-start-senses", false, fakeExecutor)
+	dagRun.Config.Sensors = []dagconfig.SensorConfig{
+		{Name: "input", Kind: dagconfig.SensorFile, Path: filepath.Join(dir, "_SUCCESS"), PokeIntervalSeconds: 1},
+	}
+	dagRun.dagRunCount.Inc()
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	for dagRun.dagRunCount.Get() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	states := dagRun.SensorStates()
+	if dagRun.Status() != string(PhaseSensing) || len(states) != 1 || states[0].Satisfied || states[0].Pokes != 1 {
+		t.Errorf("Expected a sensing dag run with an unsatisfied sensor, found %s %v", dagRun.Status(), states)
+	}
+
+	if err := ioutil.WriteFile(dagRun.Config.Sensors[0].Path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	(<-fakeExecutor.handles).finish <- core.PodSucceeded
+	<-done
+	states = dagRun.SensorStates()
+	if dagRun.Status() != string(core.PodSucceeded) || !states[0].Satisfied || dagRun.dagRunCount.Get() != 0 {
+		t.Errorf("Expected the dag run to run once its sensor was satisfied, found %s %v", dagRun.Status(), states)
+	}
+}
+
+func TestStartSensorTimeout(t *testing.T) {
 	setupDatabase()
 	defer database.PurgeDB(SQLCLIENT)
 
-	// Run tests
 	tables := []struct {
-		name     string
-		withLogs bool
+		softFail       bool
+		expectedStatus core.PodPhase
 	}{
-		{"Without Logs", false},
-		{"With Logs", true},
+		{false, core.PodFailed},
+		{true, PhaseSkipped},
 	}
 	for _, table := range tables {
-		t.Logf("Test case: %s", table.name)
-		func() {
-			expectedLogMessage := "Hello World!!!"
-			dagRun := NewDAGRun(
-				getTestDate(),
-				getTestDAGConfig(
-					"test-start-pod"+podutils.CleanK8sName(table.name),
-					[]string{"echo", expectedLogMessage},
-				),
-				table.withLogs,
-				client,
-				holder.New(),
-				activeruns.New(),
-				TABLECLIENT,
-				0,
-			)
-			go dagRun.Start()
-
-			for {
-				// Need to make sure that dag is actually totally ready before
-				// moving on with test
-				if dagRun.holder.Contains(dagRun.Name) && dagRun.pod != nil {
-					break
-				}
-				time.Sleep(1 * time.Millisecond)
-			}
-
-			dagRun.holder.GetChannelGroup(dagRun.Name).Ready <- dagRun.pod
-
-			podCopy := dagRun.pod.DeepCopy()
-			podCopy.Status.Phase = core.PodSucceeded
-			dagRun.holder.GetChannelGroup(dagRun.Name).Update <- podCopy
-
-			time.Sleep(3 * time.Millisecond)
-
-			podList, err := client.CoreV1().Pods(
-				dagRun.Config.Namespace,
-			).List(
-				context.TODO(),
-				k8sapi.ListOptions{},
-			)
-			if err != nil {
-				panic(err)
-			}
-			for _, item := range podList.Items {
-				t.Log(item.Name)
-				if item.Name == dagRun.Name {
-					t.Errorf("Pod with name %s should have been deleted", dagRun.Name)
-				}
-			}
-		}()
+		fakeExecutor := newFakeExecutor()
+		dagRun := newTestDAGRun(fmt.Sprintf("test-sensor-timeout-%t", table.softFail), false, fakeExecutor)
+		dagRun.Config.Sensors = []dagconfig.SensorConfig{{
+			Name:                "input",
+			Kind:                dagconfig.SensorFile,
+			Path:                "/nonexistent/_SUCCESS",
+			PokeIntervalSeconds: 60,
+			TimeoutSeconds:      1,
+			SoftFail:            table.softFail,
+		}}
+		dagRun.Start()
+		if dagRun.Status() != string(table.expectedStatus) || len(fakeExecutor.handles) != 0 {
+			t.Errorf("Expected a timed out sensor with soft fail %t to be %s, found %s", table.softFail, table.expectedStatus, dagRun.Status())
+		}
+	}
+}
 
+func TestStartQueuesForPool(t *testing.T) {
+	setupDatabase()
+	defer database.PurgeDB(SQLCLIENT)
+	defer func(interval time.Duration) { slotPollInterval = interval }(slotPollInterval)
+	slotPollInterval = time.Millisecond
+
+	occupying, err := POOLS.Acquire("database", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeExecutor := newFakeExecutor()
+	dagRun := newTestDAGRun("test-start-queues-for-pool", false, fakeExecutor)
+	dagRun.Config.Pool = "database"
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	for rows := TABLECLIENT.GetLastNRunsForDagID(0, 1); len(rows) == 0 || rows[0].Status != string(PhaseQueued); rows = TABLECLIENT.GetLastNRunsForDagID(0, 1) {
+		time.Sleep(time.Millisecond)
+	}
+	if dagRun.Status() != string(PhaseQueued) || len(fakeExecutor.handles) != 0 {
+		t.Errorf("Expected the dag run to be queued without being submitted, found %s", dagRun.Status())
 	}
 
+	POOLS.Release(occupying)
+	handle := <-fakeExecutor.handles
+	if occupancy, _ := POOLS.Get("database"); occupancy.Occupied != 1 {
+		t.Errorf("Expected the dag run to take the slot of the pool, found %v", occupancy)
+	}
+	handle.finish <- core.PodSucceeded
+	<-done
+	if occupancy, _ := POOLS.Get("database"); dagRun.Status() != string(core.PodSucceeded) || occupancy.Occupied != 0 {
+		t.Errorf("Expected the dag run to give back its slot once it succeeded, found %s %v", dagRun.Status(), occupancy)
+	}
+
+	dagRun = newTestDAGRun("test-start-unknown-pool", false, fakeExecutor)
+	dagRun.Config.Pool = "cluster"
+	dagRun.Start()
+	if dagRun.Status() != string(core.PodFailed) || len(fakeExecutor.handles) != 0 {
+		t.Errorf("Expected the dag run of an unknown pool to fail without being submitted, found %s", dagRun.Status())
+	}
 }
@@ -0,0 +1,130 @@
+package run
+
+import (
+	"time"
+
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/logs"
+
+	dagruntable "goflow/internal/dag/sql/dagrun"
+
+	core "k8s.io/api/core/v1"
+)
+
+// PhaseWaiting is the status of dag runs waiting for the runs of other DAGs listed in WaitFor
+const PhaseWaiting core.PodPhase = "Waiting"
+
+// PhaseSkipped is the status of dag runs that were not submitted because the runs they waited for
+// did not reach their status in time
+const PhaseSkipped core.PodPhase = "Skipped"
+
+// waitPollInterval is how often waiting dag runs check the runs they wait for
+var waitPollInterval = 10 * time.Second
+
+// Dependency is the state of a run of another DAG that a dag run waits for
+// Status is empty while the run has not been recorded
+type Dependency struct {
+	DAG            string
+	ExecutionDate  time.Time
+	RequiredStatus string
+	Status         string
+	Met            bool
+}
+
+// isFinal returns true if dag runs with the status have finished
+func isFinal(status string) bool {
+	switch core.PodPhase(status) {
+	case core.PodSucceeded, core.PodFailed, PhaseCancelled, PhaseDryRun, PhaseSkipped:
+		return true
+	}
+	return false
+}
+
+// getDependency returns the state of the run waited for by the run for the execution date
+func getDependency(
+	waitFor dagconfig.WaitFor,
+	executionDate time.Time,
+	tableClient *dagruntable.TableClient,
+) Dependency {
+	dependency := Dependency{
+		DAG:            waitFor.DAG,
+		ExecutionDate:  waitFor.ExecutionDate(executionDate),
+		RequiredStatus: waitFor.RequiredStatus(),
+	}
+	if row, ok := tableClient.GetDagRunOfDAG(dependency.DAG, dependency.ExecutionDate); ok {
+		dependency.Status = row.Status
+	}
+	if dependency.RequiredStatus == dagconfig.WaitStatusFinished {
+		dependency.Met = isFinal(dependency.Status)
+	} else {
+		dependency.Met = dependency.Status == dependency.RequiredStatus
+	}
+	return dependency
+}
+
+// Dependencies returns the state of the runs that the run of the DAG for the execution date waits for
+func Dependencies(
+	dagConfig *dagconfig.DAGConfig,
+	executionDate time.Time,
+	tableClient *dagruntable.TableClient,
+) []Dependency {
+	dependencies := make([]Dependency, 0, len(dagConfig.WaitFor))
+	for _, waitFor := range dagConfig.WaitFor {
+		dependencies = append(dependencies, getDependency(waitFor, executionDate, tableClient))
+	}
+	return dependencies
+}
+
+// isCancelled returns true once the dag run has been cancelled
+func (dagRun *DAGRun) isCancelled() bool {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	return dagRun.cancelled
+}
+
+// waitForDependencies holds the dag run until the runs it waits for have reached their status
+// It returns false along with the outcome of the dag run if it must not be submitted
+func (dagRun *DAGRun) waitForDependencies() (core.PodPhase, bool) {
+	pending := dagRun.Config.WaitFor
+	for {
+		if dagRun.isCancelled() {
+			return PhaseCancelled, false
+		}
+		waiting := make([]dagconfig.WaitFor, 0, len(pending))
+		for _, waitFor := range pending {
+			dependency := getDependency(waitFor, dagRun.ExecutionDate.Time, dagRun.TableClient)
+			if dependency.Met {
+				continue
+			}
+			if time.Since(dagRun.StartTime.Time) < waitFor.Timeout() {
+				waiting = append(waiting, waitFor)
+				continue
+			}
+			logs.WarningLogger.Printf(
+				"Dag run %s timed out waiting for the run of %s for %s to be %s, found %q",
+				dagRun.Name,
+				dependency.DAG,
+				dependency.ExecutionDate,
+				dependency.RequiredStatus,
+				dependency.Status,
+			)
+			switch waitFor.OnTimeout {
+			case dagconfig.OnTimeoutRun:
+			case dagconfig.OnTimeoutSkip:
+				return PhaseSkipped, false
+			default:
+				return core.PodFailed, false
+			}
+		}
+		if len(waiting) == 0 {
+			return core.PodRunning, true
+		}
+		pending = waiting
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// Dependencies returns the state of the runs that the dag run waits for
+func (dagRun *DAGRun) Dependencies() []Dependency {
+	return Dependencies(dagRun.Config, dagRun.ExecutionDate.Time, dagRun.TableClient)
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+	"time"
+
+	"goflow/internal/dag/pool"
+	"goflow/internal/logs"
+
+	core "k8s.io/api/core/v1"
+)
+
+// PhaseQueued is the status of dag runs waiting for the slots of their pool
+const PhaseQueued core.PodPhase = "Queued"
+
+// queueForPool waits for the slots of the pool of the dag run, which is queued while the pool is
+// full. It returns false along with the outcome of the dag run if it must not be submitted
+func (dagRun *DAGRun) queueForPool() (*pool.Ticket, core.PodPhase, bool) {
+	if dagRun.pools == nil {
+		logs.ErrorLogger.Printf("Dag run %s has pool %s but pools are not available", dagRun.Name, dagRun.Config.Pool)
+		return nil, core.PodFailed, false
+	}
+	ticket, err := dagRun.pools.Acquire(
+		dagRun.Config.Pool,
+		dagRun.Config.PoolSlotCount(),
+		dagRun.Config.PriorityWeight,
+	)
+	if err != nil {
+		logs.ErrorLogger.Printf("Dag run %s cannot take slots of pool %s: %s", dagRun.Name, dagRun.Config.Pool, err)
+		return nil, core.PodFailed, false
+	}
+	select {
+	case <-ticket.Granted():
+		return ticket, core.PodRunning, true
+	default:
+	}
+	dagRun.setStatus(PhaseQueued, false)
+	dagRun.UpsertDagRun(dagRun.row(string(PhaseQueued)))
+	for {
+		select {
+		case <-ticket.Granted():
+			return ticket, core.PodRunning, true
+		case <-time.After(slotPollInterval):
+			if dagRun.isCancelled() {
+				dagRun.pools.Release(ticket)
+				return nil, PhaseCancelled, false
+			}
+		}
+	}
+}
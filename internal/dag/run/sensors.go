@@ -0,0 +1,163 @@
+package run
+
+import (
+	"time"
+
+	"goflow/internal/logs"
+	"goflow/internal/sensor"
+
+	core "k8s.io/api/core/v1"
+)
+
+// PhaseSensing is the status of dag runs waiting for their sensors to be satisfied
+const PhaseSensing core.PodPhase = "Sensing"
+
+// slotPollInterval is how often sensing dag runs check whether they were cancelled and try to
+// take back an active run slot
+var slotPollInterval = time.Second
+
+// SensorState is the state of a sensor of a dag run
+// Error explains why the sensor was not satisfied on its last poke, if it is known
+type SensorState struct {
+	Name      string
+	Kind      string
+	Satisfied bool
+	Pokes     int
+	LastPoke  time.Time
+	Error     string
+}
+
+// SensorStates returns the state of the sensors of the dag run, nil until it starts sensing
+func (dagRun *DAGRun) SensorStates() []SensorState {
+	dagRun.statusLock.RLock()
+	defer dagRun.statusLock.RUnlock()
+	if dagRun.sensorStates == nil {
+		return nil
+	}
+	states := make([]SensorState, len(dagRun.sensorStates))
+	copy(states, dagRun.sensorStates)
+	return states
+}
+
+func (dagRun *DAGRun) setSensorState(i int, state SensorState) {
+	dagRun.statusLock.Lock()
+	dagRun.sensorStates[i] = state
+	dagRun.statusLock.Unlock()
+}
+
+// releaseSlot gives up the active run slot of the dag run if it holds it
+func (dagRun *DAGRun) releaseSlot() {
+	if dagRun.holdsSlot {
+		dagRun.dagRunCount.Dec()
+		dagRun.holdsSlot = false
+	}
+}
+
+// sleepUntil waits until the time, returning false as soon as the dag run is cancelled
+func (dagRun *DAGRun) sleepUntil(wakeUp time.Time) bool {
+	for time.Now().Before(wakeUp) {
+		if dagRun.isCancelled() {
+			return false
+		}
+		wait := time.Until(wakeUp)
+		if wait > slotPollInterval {
+			wait = slotPollInterval
+		}
+		time.Sleep(wait)
+	}
+	return !dagRun.isCancelled()
+}
+
+// acquireSlot waits for an active run slot of the DAG, returning false if the dag run is
+// cancelled in the meantime
+func (dagRun *DAGRun) acquireSlot() bool {
+	for !dagRun.dagRunCount.TryInc(dagRun.Config.MaxActiveRuns) {
+		if dagRun.isCancelled() {
+			return false
+		}
+		time.Sleep(slotPollInterval)
+	}
+	dagRun.holdsSlot = true
+	return true
+}
+
+// sense pokes the sensors of the dag run until they are all satisfied, giving up the active run
+// slot of the dag run between pokes so that sensing runs do not keep other runs from starting
+// It returns false along with the outcome of the dag run if it must not be submitted
+func (dagRun *DAGRun) sense() (core.PodPhase, bool) {
+	sensors := make([]sensor.Sensor, len(dagRun.Config.Sensors))
+	states := make([]SensorState, len(dagRun.Config.Sensors))
+	for i, config := range dagRun.Config.Sensors {
+		if dagRun.sensorFactory == nil {
+			logs.ErrorLogger.Printf("Dag run %s has sensors but no sensor factory", dagRun.Name)
+			return core.PodFailed, false
+		}
+		built, err := dagRun.sensorFactory.New(config, dagRun.Config.Namespace)
+		if err != nil {
+			logs.ErrorLogger.Printf("Could not create sensor %s of dag run %s: %s", config.Name, dagRun.Name, err)
+			return core.PodFailed, false
+		}
+		sensors[i] = built
+		states[i] = SensorState{Name: config.Name, Kind: config.Kind}
+	}
+	dagRun.statusLock.Lock()
+	// The states of the dag run are a copy, only updated by setSensorState
+	dagRun.sensorStates = append([]SensorState(nil), states...)
+	dagRun.statusLock.Unlock()
+	started := time.Now()
+	nextPokes := make([]time.Time, len(sensors))
+	for {
+		if dagRun.isCancelled() {
+			return PhaseCancelled, false
+		}
+		var nextPoke time.Time
+		for i, config := range dagRun.Config.Sensors {
+			state := states[i]
+			if state.Satisfied {
+				continue
+			}
+			if now := time.Now(); !now.Before(nextPokes[i]) {
+				satisfied, err := sensor.Poke(sensors[i])
+				state.Satisfied = satisfied
+				state.Pokes++
+				state.LastPoke = now
+				state.Error = ""
+				if err != nil {
+					state.Error = err.Error()
+				}
+				states[i] = state
+				dagRun.setSensorState(i, state)
+				nextPokes[i] = now.Add(config.PokeInterval())
+			}
+			if state.Satisfied {
+				continue
+			}
+			if time.Since(started) >= config.Timeout() {
+				logs.WarningLogger.Printf(
+					"Dag run %s timed out waiting for sensor %s: %s",
+					dagRun.Name,
+					config.Name,
+					state.Error,
+				)
+				if config.SoftFail {
+					return PhaseSkipped, false
+				}
+				return core.PodFailed, false
+			}
+			due := nextPokes[i]
+			if deadline := started.Add(config.Timeout()); deadline.Before(due) {
+				due = deadline
+			}
+			if nextPoke.IsZero() || due.Before(nextPoke) {
+				nextPoke = due
+			}
+		}
+		if nextPoke.IsZero() {
+			return core.PodRunning, true
+		}
+		dagRun.releaseSlot()
+		if !dagRun.sleepUntil(nextPoke) || !dagRun.acquireSlot() {
+			return PhaseCancelled, false
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is how many points each instance has on the ring when none is configured,
+// enough for DAGs to be spread evenly across a few instances
+const DefaultVirtualNodes = 64
+
+// point is a position of an instance on the ring
+type point struct {
+	hash     uint32
+	instance string
+}
+
+// Ring assigns DAGs to instances by consistent hashing on their ids, so that only the DAGs of
+// an instance that joins or leaves move to another instance
+type Ring struct {
+	points    []point
+	instances []string
+}
+
+func hash(key string) uint32 {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	return hasher.Sum32()
+}
+
+// New returns the ring of the instances, each placed at virtualNodes points
+func New(instances []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	ring := &Ring{make([]point, 0, len(instances)*virtualNodes), make([]string, len(instances))}
+	copy(ring.instances, instances)
+	sort.Strings(ring.instances)
+	for _, instance := range ring.instances {
+		for i := 0; i < virtualNodes; i++ {
+			ring.points = append(ring.points, point{hash(instance + "#" + strconv.Itoa(i)), instance})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		if ring.points[i].hash != ring.points[j].hash {
+			return ring.points[i].hash < ring.points[j].hash
+		}
+		return ring.points[i].instance < ring.points[j].instance
+	})
+	return ring
+}
+
+// Owner returns the instance owning the DAG, the first one at or after its hash on the ring,
+// or an empty string if the ring has no instances
+func (ring *Ring) Owner(dagID int) string {
+	if len(ring.points) == 0 {
+		return ""
+	}
+	dagHash := hash("dag#" + strconv.Itoa(dagID))
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i].hash >= dagHash })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.points[i].instance
+}
+
+// Instances returns the instances of the ring by name
+func (ring *Ring) Instances() []string {
+	instances := make([]string, len(ring.instances))
+	copy(instances, ring.instances)
+	return instances
+}
@@ -0,0 +1,53 @@
+package shard
+
+import (
+	"testing"
+)
+
+const dagCount = 1000
+
+func owners(ring *Ring) map[int]string {
+	owners := make(map[int]string)
+	for dagID := 0; dagID < dagCount; dagID++ {
+		owners[dagID] = ring.Owner(dagID)
+	}
+	return owners
+}
+
+func TestOwnerIsStable(t *testing.T) {
+	first := owners(New([]string{"a", "b", "c"}, 0))
+	second := owners(New([]string{"c", "a", "b"}, 0))
+	counts := make(map[string]int)
+	for dagID, owner := range first {
+		if second[dagID] != owner {
+			t.Fatalf("Expected DAG %d to have the same owner whatever the order of instances", dagID)
+		}
+		counts[owner]++
+	}
+	for _, instance := range []string{"a", "b", "c"} {
+		if counts[instance] < dagCount/6 {
+			t.Errorf("Expected DAGs to be spread across instances, found %v", counts)
+		}
+	}
+	if New(nil, 0).Owner(1) != "" {
+		t.Error("Expected no owner without instances")
+	}
+}
+
+func TestJoinMovesFewDAGs(t *testing.T) {
+	before := owners(New([]string{"a", "b", "c"}, 0))
+	after := owners(New([]string{"a", "b", "c", "d"}, 0))
+	moved := 0
+	for dagID, owner := range after {
+		if owner == before[dagID] {
+			continue
+		}
+		if owner != "d" {
+			t.Fatalf("Expected DAGs to only move to the instance that joined, DAG %d moved to %s", dagID, owner)
+		}
+		moved++
+	}
+	if moved == 0 || moved > dagCount/2 {
+		t.Errorf("Expected about a quarter of the DAGs to move, %d did", moved)
+	}
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"fmt"
+	"goflow/internal/database"
+	"strings"
+	"time"
+)
+
+const tableName = "audit_events"
+
+// Actions recorded in the audit log
+const (
+	ActionDAGCreate     = "dag.create"
+	ActionDAGUpdate     = "dag.update"
+	ActionDAGWrite      = "dag.write"
+	ActionDAGToggle     = "dag.toggle"
+	ActionRunTrigger    = "run.trigger"
+	ActionRunCancel     = "run.cancel"
+	ActionDatasetUpdate = "dataset.update"
+	ActionPoolResize    = "pool.resize"
+)
+
+// SchedulerActor is the actor of actions taken automatically by the scheduler
+const SchedulerActor = "scheduler"
+
+// Filter selects audit events, empty fields match every event
+// AfterID and BeforeID select only events newer or older than the event with that id
+type Filter struct {
+	Actor     string
+	Action    string
+	DagName   string
+	RunID     string
+	Since     time.Time
+	Until     time.Time
+	AfterID   int
+	BeforeID  int
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+// TableClient is a struct that interacts with the audit events table
+type TableClient struct {
+	sqlClient *database.SQLClient
+	tableDef  database.Table
+}
+
+// NewTableClient returns a new table client
+func NewTableClient(sqlClient *database.SQLClient) *TableClient {
+	return &TableClient{sqlClient, database.Table{Name: tableName,
+		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  IDName,
+			DType: database.Serial{},
+		},
+	}}
+}
+
+// CreateTable creates the table for storing audit events
+func (client *TableClient) CreateTable() {
+	client.sqlClient.CreateTable(client.tableDef)
+}
+
+// InsertEvent inserts an audit event and returns the stored row with the id SQLite assigned
+func (client *TableClient) InsertEvent(row Row) Row {
+	row.ID = client.sqlClient.InsertReturningID(tableName, row.columnar())
+	return row
+}
+
+// whereClause returns the SQL conditions for the filter
+func (filter Filter) whereClause() string {
+	equalities := make(database.ColumnWithValueSlice, 0)
+	for _, condition := range [][2]string{
+		{actorName, filter.Actor},
+		{actionName, filter.Action},
+		{dagNameName, filter.DagName},
+		{runIDName, filter.RunID},
+	} {
+		if condition[1] != "" {
+			equalities = append(equalities, database.ColumnWithValue{
+				Column: database.Column{Name: condition[0], DType: database.String{Val: condition[1]}},
+			})
+		}
+	}
+	conditions := make([]string, 0)
+	if len(equalities) > 0 {
+		conditions = append(conditions, equalities.Join(" AND "))
+	}
+	timeCondition := func(operator string, value time.Time) {
+		timeColumn := database.ColumnWithValue{
+			Column: database.Column{Name: eventTimeName, DType: database.TimeStamp{Val: value}},
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s %s", eventTimeName, operator, timeColumn.ValRep()))
+	}
+	if !filter.Since.IsZero() {
+		timeCondition(">=", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		timeCondition("<", filter.Until)
+	}
+	if filter.AfterID > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s > %d", IDName, filter.AfterID))
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s < %d", IDName, filter.BeforeID))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// GetEvents returns the audit events matching the filter, most recent first unless ascending
+func (client *TableClient) GetEvents(filter Filter) []Row {
+	result := newRowResult(filter.Limit)
+	order := "DESC"
+	if filter.Ascending {
+		order = "ASC"
+	}
+	query := fmt.Sprintf(
+		"SELECT * FROM %s%s ORDER BY %s %s",
+		tableName,
+		filter.whereClause(),
+		IDName,
+		order,
+	)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+	} else if filter.Offset > 0 {
+		query += fmt.Sprintf(" LIMIT -1 OFFSET %d", filter.Offset)
+	}
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.returnedRows
+}
+
+// CountEvents returns the number of audit events matching the filter, ignoring its limit and offset
+func (client *TableClient) CountEvents(filter Filter) int {
+	return client.sqlClient.QueryInt(
+		fmt.Sprintf("SELECT COUNT(*) FROM %s%s", tableName, filter.whereClause()),
+	)
+}
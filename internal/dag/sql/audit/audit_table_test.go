@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+var sqlClient *database.SQLClient
+var tableClient *TableClient
+
+var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
+
+func TestMain(m *testing.M) {
+	sqlClient = database.NewSQLiteClient(databaseFile)
+	tableClient = NewTableClient(sqlClient)
+	m.Run()
+}
+
+func TestCreateAuditTable(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	found := false
+	for _, table := range sqlClient.Tables() {
+		if table == tableName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Did not find table %s in tables", tableName)
+	}
+}
+
+func insertEvents() []Row {
+	rows := []Row{
+		NewRow("alice", ActionDAGWrite, "dag_a", "", "", `{"Name":"dag_a","Command":["echo","it's"]}`, "10.0.0.1"),
+		NewRow("bob", ActionDAGToggle, "dag_a", "", `{"IsOn":false}`, `{"IsOn":true}`, "10.0.0.2"),
+		NewRow(SchedulerActor, ActionRunTrigger, "dag_a", "dag-a-run", "", "", ""),
+		NewRow("alice", ActionDAGToggle, "dag_b", "", `{"IsOn":true}`, `{"IsOn":false}`, "10.0.0.1"),
+	}
+	for i, row := range rows {
+		rows[i] = tableClient.InsertEvent(row)
+	}
+	return rows
+}
+
+func TestGetEvents(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	inserted := insertEvents()
+	cases := []struct {
+		name        string
+		filter      Filter
+		expectedIDs []int
+		total       int
+	}{
+		{"all", Filter{}, []int{4, 3, 2, 1}, 4},
+		{"actor", Filter{Actor: "alice"}, []int{4, 1}, 2},
+		{"action and dag", Filter{Action: ActionDAGToggle, DagName: "dag_a"}, []int{2}, 1},
+		{"run", Filter{RunID: "dag-a-run"}, []int{3}, 1},
+		{"page", Filter{Limit: 2, Offset: 1}, []int{3, 2}, 4},
+		{"until", Filter{Until: inserted[0].EventTime.Add(-time.Hour)}, []int{}, 0},
+		{"since", Filter{Since: inserted[0].EventTime}, []int{4, 3, 2, 1}, 4},
+		{"quoted value", Filter{Actor: "o'brien"}, []int{}, 0},
+	}
+	for _, testCase := range cases {
+		rows := tableClient.GetEvents(testCase.filter)
+		ids := make([]int, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		if len(ids) != len(testCase.expectedIDs) {
+			t.Errorf("%s: expected ids %v, found %v", testCase.name, testCase.expectedIDs, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != testCase.expectedIDs[i] {
+				t.Errorf("%s: expected ids %v, found %v", testCase.name, testCase.expectedIDs, ids)
+				break
+			}
+		}
+		if count := tableClient.CountEvents(testCase.filter); count != testCase.total {
+			t.Errorf("%s: expected a total of %d, found %d", testCase.name, testCase.total, count)
+		}
+	}
+	stored := tableClient.GetEvents(Filter{Action: ActionDAGWrite})[0]
+	if stored.After != inserted[0].After || stored.SourceIP != "10.0.0.1" {
+		t.Errorf("Expected stored event %s, found %s", inserted[0], stored)
+	}
+}
+
+func TestInsertEventFromSeveralInstances(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	// Each instance has its own connection to the shared database
+	clients := []*TableClient{tableClient, NewTableClient(database.NewSQLiteClient(databaseFile))}
+	const eventsPerClient = 10
+	ids := make(chan int, len(clients)*eventsPerClient)
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *TableClient) {
+			defer wg.Done()
+			for i := 0; i < eventsPerClient; i++ {
+				ids <- client.InsertEvent(NewRow("alice", ActionRunTrigger, "dag_a", "", "", "", "")).ID
+			}
+		}(client)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Expected each event to get its own id, id %d was assigned twice", id)
+		}
+		seen[id] = true
+	}
+	if count := tableClient.CountEvents(Filter{}); count != len(clients)*eventsPerClient {
+		t.Errorf("Expected %d events, found %d", len(clients)*eventsPerClient, count)
+	}
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"database/sql"
+	"goflow/internal/database"
+	"goflow/internal/dateutils"
+	"goflow/internal/jsonpanic"
+	"time"
+)
+
+// Row is a single audited action
+// Before and After hold JSON representations of the target before and after the action
+type Row struct {
+	ID        int
+	EventTime time.Time
+	Actor     string
+	Action    string
+	DagName   string
+	RunID     string
+	Before    string
+	After     string
+	SourceIP  string
+}
+
+// IDName is the column name for the primary id column
+const IDName = "id"
+const eventTimeName = "event_time"
+const actorName = "actor"
+const actionName = "action"
+const dagNameName = "dag_name"
+const runIDName = "run_id"
+
+// NewRow returns a new row with the event time set to now
+func NewRow(actor, action, dagName, runID, before, after, sourceIP string) Row {
+	return Row{
+		0,
+		dateutils.GetDateTimeNowMilliSecond(),
+		actor,
+		action,
+		dagName,
+		runID,
+		before,
+		after,
+		sourceIP,
+	}
+}
+
+func (row Row) String() string {
+	return jsonpanic.JSONPanicFormat(row)
+}
+
+type auditRowResult struct {
+	returnedRows         []Row
+	hasUnlimitedCapacity bool
+}
+
+func newRowResult(n int) auditRowResult {
+	return auditRowResult{
+		returnedRows: make([]Row, 0, n), hasUnlimitedCapacity: n == 0,
+	}
+}
+
+func (row Row) columnar() database.ColumnWithValueSlice {
+	return []database.ColumnWithValue{
+		{Column: database.Column{Name: IDName, DType: database.Serial{Val: row.ID}}},
+		{Column: database.Column{Name: eventTimeName, DType: database.TimeStamp{Val: row.EventTime}}},
+		{Column: database.Column{Name: actorName, DType: database.String{Val: row.Actor}}},
+		{Column: database.Column{Name: actionName, DType: database.String{Val: row.Action}}},
+		{Column: database.Column{Name: dagNameName, DType: database.String{Val: row.DagName}}},
+		{Column: database.Column{Name: runIDName, DType: database.String{Val: row.RunID}}},
+		{Column: database.Column{Name: "before_payload", DType: database.String{Val: row.Before}}},
+		{Column: database.Column{Name: "after_payload", DType: database.String{Val: row.After}}},
+		{Column: database.Column{Name: "source_ip", DType: database.String{Val: row.SourceIP}}},
+	}
+}
+
+func (result *auditRowResult) ScanAppend(rows *sql.Rows) error {
+	row := Row{}
+	err := rows.Scan(
+		&row.ID,
+		&row.EventTime,
+		&row.Actor,
+		&row.Action,
+		&row.DagName,
+		&row.RunID,
+		&row.Before,
+		&row.After,
+		&row.SourceIP,
+	)
+	result.returnedRows = append(result.returnedRows, row)
+	return err
+}
+
+func (result *auditRowResult) Capacity() int {
+	return cap(result.returnedRows)
+}
+func (result *auditRowResult) HasUnlimitedCapacity() bool {
+	return result.hasUnlimitedCapacity
+}
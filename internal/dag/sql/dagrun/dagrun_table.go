@@ -1,16 +1,46 @@
 package dagrun
 
 import (
+	"database/sql"
 	"fmt"
 	dagtable "goflow/internal/dag/sql/dag"
 	"goflow/internal/database"
 	"goflow/internal/dateutils"
 	"sort"
+	"strings"
 	"time"
 )
 
 const tableName = "dagrun"
 
+// Ways a dag run can be triggered
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerDataset   = "dataset"
+)
+
+// Key identifies a dag run row, a DAG has at most one run per execution date
+type Key struct {
+	ExecutionDate time.Time
+	DagID         int
+}
+
+// Filter selects dag runs, empty fields match every run
+// Since and Until bound the execution date. Runs are ordered by execution date and then DAG id,
+// starting after the run with key After when it is set
+type Filter struct {
+	DagIDs     []int
+	RunID      string
+	Statuses   []string
+	Triggers   []string
+	Since      time.Time
+	Until      time.Time
+	After      *Key
+	Descending bool
+	Limit      int
+}
+
 // TableClient is a struct that interacts with the DAG table
 type TableClient struct {
 	sqlClient *database.SQLClient
@@ -36,6 +66,7 @@ func NewTableClient(sqlClient *database.SQLClient) *TableClient {
 // CreateTable creates the table for storing DAG related information
 func (client *TableClient) CreateTable() {
 	client.sqlClient.CreateTable(client.tableDef)
+	client.sqlClient.AddMissingColumns(client.tableDef)
 }
 
 // GetLastNRunsForDagID retrieves the rows for a given dag id
@@ -72,6 +103,52 @@ func (client *TableClient) isDagRunPresent(dagID int, executionDate time.Time) b
 	return len(rows.returnedRows) == 1
 }
 
+// GetDagRun returns the row of the run of the DAG for the execution date, false if there is none
+func (client *TableClient) GetDagRun(dagID int, executionDate time.Time) (Row, bool) {
+	rows := client.selectSpecificDagRun(dagID, executionDate).returnedRows
+	if len(rows) == 0 {
+		return Row{}, false
+	}
+	return rows[0], true
+}
+
+// GetDagRunOfDAG returns the row of the run of the DAG with the given name for the execution date,
+// false if there is none
+func (client *TableClient) GetDagRunOfDAG(dagName string, executionDate time.Time) (Row, bool) {
+	result := newRowResult(1)
+	client.sqlClient.QueryIntoResults(
+		&result,
+		fmt.Sprintf(
+			"SELECT dagrun.* FROM dagrun JOIN %s ON %s.%s = dagrun.dag_id "+
+				"WHERE %s.name = %s AND dagrun.execution_date = '%s' ORDER BY dagrun.last_updated_date desc",
+			dagtable.TableName,
+			dagtable.TableName,
+			dagtable.IDName,
+			dagtable.TableName,
+			database.ColumnWithValue{Column: database.Column{Name: "name", DType: database.String{Val: dagName}}}.ValRep(),
+			executionDate.Format(dateutils.SQLiteDateForm),
+		),
+	)
+	if len(result.returnedRows) == 0 {
+		return Row{}, false
+	}
+	return result.returnedRows[0], true
+}
+
+// ClaimDagRun inserts the dag run unless a run of its DAG with the same id and trigger was stored,
+// returning true if it was inserted, so that a single goflow instance starts each dag run
+func (client *TableClient) ClaimDagRun(dagRunRow Row) bool {
+	return client.sqlClient.InsertUnlessPresent(
+		tableName,
+		dagRunRow.columnar(),
+		[]database.ColumnWithValue{
+			{Column: database.Column{Name: dagIDName, DType: database.Int{Val: dagRunRow.DagID}}},
+			{Column: database.Column{Name: runIDName, DType: database.String{Val: dagRunRow.RunID}}},
+			{Column: database.Column{Name: triggerName, DType: database.String{Val: dagRunRow.Trigger}}},
+		},
+	)
+}
+
 // UpsertDagRun inserts or updates the dag run
 func (client *TableClient) UpsertDagRun(dagRunRow Row) {
 	if !client.isDagRunPresent(dagRunRow.DagID, dagRunRow.ExecutionDate) {
@@ -86,6 +163,18 @@ func (client *TableClient) UpsertDagRun(dagRunRow Row) {
 					DType: database.String{Val: dagRunRow.Status},
 				},
 			},
+			{
+				Column: database.Column{
+					Name:  endDateName,
+					DType: database.TimeStamp{Val: dagRunRow.EndDate},
+				},
+			},
+			{
+				Column: database.Column{
+					Name:  lastUpdatedDateName,
+					DType: database.TimeStamp{Val: dagRunRow.LastUpdatedDate},
+				},
+			},
 		},
 		[]database.ColumnWithValue{
 			{
@@ -102,3 +191,138 @@ func (client *TableClient) UpsertDagRun(dagRunRow Row) {
 			},
 		})
 }
+
+// valueList returns the SQL list of the values of a column
+func valueList(column string, values []database.SQLType) string {
+	reps := make([]string, 0, len(values))
+	for _, value := range values {
+		reps = append(reps, database.ColumnWithValue{
+			Column: database.Column{Name: column, DType: value},
+		}.ValRep())
+	}
+	return "(" + strings.Join(reps, ", ") + ")"
+}
+
+func stringValues(values []string) []database.SQLType {
+	sqlValues := make([]database.SQLType, 0, len(values))
+	for _, value := range values {
+		sqlValues = append(sqlValues, database.String{Val: value})
+	}
+	return sqlValues
+}
+
+func timeRep(value time.Time) string {
+	return database.ColumnWithValue{
+		Column: database.Column{Name: executionDateName, DType: database.TimeStamp{Val: value.UTC()}},
+	}.ValRep()
+}
+
+// whereClause returns the SQL conditions for the filter, ignoring its position and limit
+func (filter Filter) whereClause() string {
+	conditions := make([]string, 0)
+	if len(filter.DagIDs) > 0 {
+		ids := make([]database.SQLType, 0, len(filter.DagIDs))
+		for _, id := range filter.DagIDs {
+			ids = append(ids, database.Int{Val: id})
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN %s", dagIDName, valueList(dagIDName, ids)))
+	}
+	if filter.RunID != "" {
+		runIDColumn := database.ColumnWithValue{
+			Column: database.Column{Name: runIDName, DType: database.String{Val: filter.RunID}},
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = %s", runIDName, runIDColumn.ValRep()))
+	}
+	if len(filter.Statuses) > 0 {
+		conditions = append(
+			conditions,
+			fmt.Sprintf("%s IN %s", statusName, valueList(statusName, stringValues(filter.Statuses))),
+		)
+	}
+	if len(filter.Triggers) > 0 {
+		conditions = append(
+			conditions,
+			fmt.Sprintf("%s IN %s", triggerName, valueList(triggerName, stringValues(filter.Triggers))),
+		)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s >= %s", executionDateName, timeRep(filter.Since)))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s < %s", executionDateName, timeRep(filter.Until)))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// GetDagRuns returns the dag runs matching the filter
+func (client *TableClient) GetDagRuns(filter Filter) RowList {
+	result := newRowResult(filter.Limit)
+	conditions := filter.whereClause()
+	operator, order := ">", "ASC"
+	if filter.Descending {
+		operator, order = "<", "DESC"
+	}
+	if filter.After != nil {
+		afterDate := timeRep(filter.After.ExecutionDate)
+		positionCondition := fmt.Sprintf(
+			"(%s %s %s OR (%s = %s AND %s %s %d))",
+			executionDateName,
+			operator,
+			afterDate,
+			executionDateName,
+			afterDate,
+			dagIDName,
+			operator,
+			filter.After.DagID,
+		)
+		if conditions == "" {
+			conditions = positionCondition
+		} else {
+			conditions += " AND " + positionCondition
+		}
+	}
+	query := "SELECT * FROM " + tableName
+	if conditions != "" {
+		query += " WHERE " + conditions
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s", executionDateName, order, dagIDName, order)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.returnedRows
+}
+
+// statusCountResult holds the number of dag runs per status
+type statusCountResult struct {
+	counts map[string]int
+}
+
+func (result *statusCountResult) ScanAppend(rows *sql.Rows) error {
+	var status string
+	var count int
+	err := rows.Scan(&status, &count)
+	result.counts[status] = count
+	return err
+}
+
+func (result *statusCountResult) Capacity() int {
+	return len(result.counts)
+}
+
+func (result *statusCountResult) HasUnlimitedCapacity() bool {
+	return true
+}
+
+// CountDagRunsByStatus returns the number of dag runs matching the filter for each status,
+// ignoring the position and limit of the filter
+func (client *TableClient) CountDagRunsByStatus(filter Filter) map[string]int {
+	result := statusCountResult{make(map[string]int)}
+	query := "SELECT " + statusName + ", COUNT(*) FROM " + tableName
+	if conditions := filter.whereClause(); conditions != "" {
+		query += " WHERE " + conditions
+	}
+	query += " GROUP BY " + statusName
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.counts
+}
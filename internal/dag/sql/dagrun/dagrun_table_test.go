@@ -54,7 +54,7 @@ func insertDaysOfRuns(n int) []Row {
 			panic(err)
 		}
 
-		newRow := NewRow(testDagRow.ID, "Running", executionTime)
+		newRow := NewRow(testDagRow.ID, "run-"+timeStr, TriggerScheduled, "Running", executionTime)
 		insertedRows = append(insertedRows, newRow)
 		sqlClient.Insert(tableName, newRow.columnar())
 	}
@@ -107,7 +107,7 @@ func TestUpsertDagRun(t *testing.T) {
 	setUpTestTable()
 
 	startTime, _ := time.Parse("2006-01-02", "2019-01-01")
-	expectedRow := NewRow(testDagRow.ID, "RUNNING", startTime)
+	expectedRow := NewRow(testDagRow.ID, "run", TriggerScheduled, "RUNNING", startTime)
 
 	tableClient.UpsertDagRun(expectedRow)
 
@@ -126,6 +126,7 @@ func TestUpsertDagRun(t *testing.T) {
 	}
 
 	expectedRow.Status = "FAILED"
+	expectedRow.EndDate = startTime.Add(time.Hour)
 	tableClient.UpsertDagRun(expectedRow)
 
 	rows = getTestRows()
@@ -140,3 +141,126 @@ func TestUpsertDagRun(t *testing.T) {
 		)
 	}
 }
+
+func TestGetDagRunOfDAG(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpDagTable()
+	setUpTestTable()
+
+	executionDate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	expectedRow := NewRow(testDagRow.ID, "run", TriggerScheduled, "Succeeded", executionDate)
+	tableClient.UpsertDagRun(expectedRow)
+
+	row, ok := tableClient.GetDagRunOfDAG(testDagRow.Name, executionDate)
+	if !ok || row != expectedRow {
+		t.Errorf("Expected %s, got %s", expectedRow, row)
+	}
+	if _, ok := tableClient.GetDagRunOfDAG(testDagRow.Name, executionDate.Add(time.Hour)); ok {
+		t.Error("Expected no run for another execution date")
+	}
+	if _, ok := tableClient.GetDagRunOfDAG("other_dag", executionDate); ok {
+		t.Error("Expected no run for another DAG")
+	}
+	if _, ok := tableClient.GetDagRunOfDAG("other_dag' OR '1'='1", executionDate); ok {
+		t.Error("Expected the name of the DAG to be escaped")
+	}
+}
+
+func TestClaimDagRun(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpDagTable()
+	setUpTestTable()
+
+	executionDate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	claimed := NewRow(testDagRow.ID, "run", TriggerScheduled, "Running", executionDate)
+	if !tableClient.ClaimDagRun(claimed) {
+		t.Error("Expected the first claim of the run to succeed")
+	}
+	if tableClient.ClaimDagRun(NewRow(testDagRow.ID, "run", TriggerScheduled, "Failed", executionDate)) {
+		t.Error("Expected the second claim of the run to fail")
+	}
+	row, ok := tableClient.GetDagRunOfDAG(testDagRow.Name, executionDate)
+	if !ok || row != claimed {
+		t.Errorf("Expected %s, got %s", claimed, row)
+	}
+	if !tableClient.ClaimDagRun(NewRow(testDagRow.ID, "run", TriggerManual, "Running", executionDate)) {
+		t.Error("Expected the claim of another trigger of the run to succeed")
+	}
+	if !tableClient.ClaimDagRun(NewRow(testDagRow.ID, "other-run", TriggerScheduled, "Running", executionDate)) {
+		t.Error("Expected the claim of another run to succeed")
+	}
+}
+
+func TestGetDagRuns(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpDagTable()
+	setUpTestTable()
+
+	rows := insertDaysOfRuns(5)
+	failedRow := rows[3]
+	failedRow.Status = "Failed"
+	tableClient.UpsertDagRun(failedRow)
+
+	foundRows := tableClient.GetDagRuns(Filter{DagIDs: []int{testDagRow.ID}, Limit: 2})
+	if len(foundRows) != 2 || foundRows[0].RunID != rows[0].RunID || foundRows[1].RunID != rows[1].RunID {
+		t.Errorf("Expected the first 2 runs, found %s", foundRows)
+	}
+
+	after := Key{foundRows[1].ExecutionDate, foundRows[1].DagID}
+	foundRows = tableClient.GetDagRuns(Filter{After: &after})
+	if len(foundRows) != 3 || foundRows[0].RunID != rows[2].RunID {
+		t.Errorf("Expected the 3 runs after %s, found %s", rows[1].RunID, foundRows)
+	}
+
+	foundRows = tableClient.GetDagRuns(Filter{
+		Statuses:   []string{"Running"},
+		Triggers:   []string{TriggerScheduled},
+		Since:      rows[1].ExecutionDate,
+		Until:      rows[4].ExecutionDate,
+		Descending: true,
+	})
+	if len(foundRows) != 2 || foundRows[0].RunID != rows[2].RunID || foundRows[1].RunID != rows[1].RunID {
+		t.Errorf("Expected runs %s and %s, found %s", rows[2].RunID, rows[1].RunID, foundRows)
+	}
+
+	foundRows = tableClient.GetDagRuns(Filter{RunID: rows[4].RunID, Triggers: []string{TriggerManual}})
+	if len(foundRows) != 0 {
+		t.Errorf("Expected no manual runs, found %s", foundRows)
+	}
+
+	counts := tableClient.CountDagRunsByStatus(Filter{DagIDs: []int{testDagRow.ID}})
+	if counts["Running"] != 4 || counts["Failed"] != 1 || len(counts) != 2 {
+		t.Errorf("Expected 4 running and 1 failed run, found %v", counts)
+	}
+}
+
+func TestCreateTableAddsMissingColumns(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpDagTable()
+	err := sqlClient.Exec(fmt.Sprintf(
+		"CREATE TABLE %s(dag_id INT, status TEXT, execution_date TIMESTAMP, "+
+			"start_date TIMESTAMP, end_date TIMESTAMP, last_updated_date TIMESTAMP)",
+		tableName,
+	))
+	if err != nil {
+		panic(err)
+	}
+	executionDate, _ := time.Parse("2006-01-02", "2019-01-01")
+	err = sqlClient.Exec(fmt.Sprintf(
+		"INSERT INTO %s VALUES(%d, 'Succeeded', '2019-01-01 00:00:00', '2019-01-01 00:00:00', "+
+			"'2019-01-01 00:00:00', '2019-01-01 00:00:00')",
+		tableName,
+		testDagRow.ID,
+	))
+	if err != nil {
+		panic(err)
+	}
+
+	tableClient.CreateTable()
+	tableClient.UpsertDagRun(NewRow(testDagRow.ID, "run", TriggerManual, "Running", executionDate.Add(time.Hour)))
+
+	rows := getTestRows()
+	if len(rows) != 2 || rows[0].RunID != "" || rows[1].RunID != "run" || rows[1].Trigger != TriggerManual {
+		t.Errorf("Expected the existing run and the new run, found %s", rows)
+	}
+}
@@ -11,8 +11,14 @@ import (
 const statusName = "status"
 const dagIDName = "dag_id"
 const executionDateName = "execution_date"
+const endDateName = "end_date"
+const lastUpdatedDateName = "last_updated_date"
+const runIDName = "run_id"
+const triggerName = "trigger_type"
+const clusterName = "cluster"
 
 // Row is a struct containing data about a particular dag
+// Cluster is the cluster the run was submitted to, empty for the cluster of goflow
 type Row struct {
 	DagID           int
 	Status          string
@@ -20,6 +26,9 @@ type Row struct {
 	StartDate       time.Time
 	EndDate         time.Time
 	LastUpdatedDate time.Time
+	RunID           string
+	Trigger         string
+	Cluster         string
 }
 
 func (row Row) String() string {
@@ -27,10 +36,16 @@ func (row Row) String() string {
 }
 
 // NewRow returns a new row with the appropriate update and create time stamps
-func NewRow(dagID int, status string, executionDate time.Time) Row {
+func NewRow(dagID int, runID, trigger, status string, executionDate time.Time) Row {
 	creationTime := dateutils.GetDateTimeNowMilliSecond()
 	return Row{
-		DagID: dagID, Status: status, ExecutionDate: executionDate, StartDate: creationTime, LastUpdatedDate: creationTime,
+		DagID:           dagID,
+		Status:          status,
+		ExecutionDate:   executionDate,
+		StartDate:       creationTime,
+		LastUpdatedDate: creationTime,
+		RunID:           runID,
+		Trigger:         trigger,
 	}
 }
 
@@ -83,14 +98,18 @@ func (row Row) columnar() database.ColumnWithValueSlice {
 			},
 		},
 		{
-			Column: database.Column{Name: "end_date", DType: database.TimeStamp{Val: row.EndDate}},
+			Column: database.Column{Name: endDateName, DType: database.TimeStamp{Val: row.EndDate}},
 		},
 		{
 			Column: database.Column{
-				Name:  "last_updated_date",
+				Name:  lastUpdatedDateName,
 				DType: database.TimeStamp{Val: row.LastUpdatedDate},
 			},
 		},
+		// Columns added after the first release go last so that existing tables can be extended
+		{Column: database.Column{Name: runIDName, DType: database.String{Val: row.RunID}}},
+		{Column: database.Column{Name: triggerName, DType: database.String{Val: row.Trigger}}},
+		{Column: database.Column{Name: clusterName, DType: database.String{Val: row.Cluster}}},
 	}
 }
 
@@ -103,6 +122,9 @@ func (result *dagRowResult) ScanAppend(rows *sql.Rows) error {
 		&row.StartDate,
 		&row.EndDate,
 		&row.LastUpdatedDate,
+		&row.RunID,
+		&row.Trigger,
+		&row.Cluster,
 	)
 	result.returnedRows = append(result.returnedRows, row)
 	return err
@@ -0,0 +1,59 @@
+package dataset
+
+import (
+	"fmt"
+	"goflow/internal/database"
+)
+
+const tableName = "dataset_events"
+
+// TableClient is a struct that interacts with the dataset events table
+type TableClient struct {
+	sqlClient *database.SQLClient
+	tableDef  database.Table
+}
+
+// NewTableClient returns a new table client
+func NewTableClient(sqlClient *database.SQLClient) *TableClient {
+	return &TableClient{sqlClient, database.Table{Name: tableName,
+		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  IDName,
+			DType: database.Serial{},
+		},
+	}}
+}
+
+// CreateTable creates the table for storing dataset events
+func (client *TableClient) CreateTable() {
+	client.sqlClient.CreateTable(client.tableDef)
+}
+
+// InsertEvent records an event and returns the stored row with the id SQLite assigned
+func (client *TableClient) InsertEvent(row Row) Row {
+	row.ID = client.sqlClient.InsertReturningID(tableName, row.columnar())
+	return row
+}
+
+// LatestEvent returns the most recent update of the dataset, false if it was never updated
+func (client *TableClient) LatestEvent(dataset string) (Row, bool) {
+	result := newRowResult(1)
+	condition := database.ColumnWithValue{
+		Column: database.Column{Name: datasetName, DType: database.String{Val: dataset}},
+	}
+	client.sqlClient.QueryIntoResults(
+		&result,
+		fmt.Sprintf(
+			"SELECT * FROM %s WHERE %s = %s ORDER BY %s DESC, %s DESC LIMIT 1",
+			tableName,
+			datasetName,
+			condition.ValRep(),
+			eventDateName,
+			IDName,
+		),
+	)
+	if len(result.returnedRows) == 0 {
+		return Row{}, false
+	}
+	return result.returnedRows[0], true
+}
@@ -0,0 +1,60 @@
+package dataset
+
+import (
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"path"
+	"testing"
+	"time"
+)
+
+var sqlClient *database.SQLClient
+var tableClient *TableClient
+
+var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
+
+func TestMain(m *testing.M) {
+	sqlClient = database.NewSQLiteClient(databaseFile)
+	tableClient = NewTableClient(sqlClient)
+	m.Run()
+}
+
+func TestCreateDatasetTable(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	found := false
+	for _, table := range sqlClient.Tables() {
+		if table == tableName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Did not find table %s in tables", tableName)
+	}
+}
+
+func getTestDate(hour int) time.Time {
+	return time.Date(2019, 1, 1, hour, 0, 0, 0, time.UTC)
+}
+
+func TestInsertAndGetLatestEvent(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	rows := []Row{
+		NewRow("orders", getTestDate(1), OriginRun, "ingestion", "ingestion-run"),
+		NewRow("orders", getTestDate(2), OriginExternal, "alice", ""),
+		NewRow("customers", getTestDate(0), OriginRun, "ingestion", "ingestion-run"),
+	}
+	for i, row := range rows {
+		if inserted := tableClient.InsertEvent(row); inserted.ID != i+1 {
+			t.Errorf("Expected event %s to get id %d, found %d", row, i+1, inserted.ID)
+		}
+	}
+	latest, ok := tableClient.LatestEvent("orders")
+	if !ok || latest.ID != 2 || !latest.EventDate.Equal(getTestDate(2)) || latest.Source != "alice" {
+		t.Errorf("Expected the external update of orders, found %s", latest)
+	}
+	if _, ok := tableClient.LatestEvent("products"); ok {
+		t.Error("Expected no event for a dataset that was never updated")
+	}
+}
@@ -0,0 +1,85 @@
+package dataset
+
+import (
+	"database/sql"
+	"goflow/internal/database"
+	"goflow/internal/jsonpanic"
+	"time"
+)
+
+// Origins of dataset update events
+const (
+	// OriginRun is the origin of events emitted by successful runs of the DAGs producing a dataset
+	OriginRun = "run"
+	// OriginExternal is the origin of events signalled through the API
+	OriginExternal = "external"
+)
+
+// Row is an update of a dataset
+// Source is the DAG whose run updated the dataset, or whoever signalled the update through the API
+// RunID is empty for external updates
+type Row struct {
+	ID        int
+	Dataset   string
+	EventDate time.Time
+	Origin    string
+	Source    string
+	RunID     string
+}
+
+// IDName is the column name for the primary id column
+const IDName = "id"
+const datasetName = "dataset"
+const eventDateName = "event_date"
+
+// NewRow returns a new row of an update of the dataset at the given date
+func NewRow(dataset string, eventDate time.Time, origin, source, runID string) Row {
+	return Row{0, dataset, eventDate, origin, source, runID}
+}
+
+func (row Row) String() string {
+	return jsonpanic.JSONPanicFormat(row)
+}
+
+type eventRowResult struct {
+	returnedRows         []Row
+	hasUnlimitedCapacity bool
+}
+
+func newRowResult(n int) eventRowResult {
+	return eventRowResult{
+		returnedRows: make([]Row, 0, n), hasUnlimitedCapacity: n == 0,
+	}
+}
+
+func (row Row) columnar() database.ColumnWithValueSlice {
+	return []database.ColumnWithValue{
+		{Column: database.Column{Name: IDName, DType: database.Serial{Val: row.ID}}},
+		{Column: database.Column{Name: datasetName, DType: database.String{Val: row.Dataset}}},
+		{Column: database.Column{Name: eventDateName, DType: database.TimeStamp{Val: row.EventDate}}},
+		{Column: database.Column{Name: "origin", DType: database.String{Val: row.Origin}}},
+		{Column: database.Column{Name: "source", DType: database.String{Val: row.Source}}},
+		{Column: database.Column{Name: "run_id", DType: database.String{Val: row.RunID}}},
+	}
+}
+
+func (result *eventRowResult) ScanAppend(rows *sql.Rows) error {
+	row := Row{}
+	err := rows.Scan(
+		&row.ID,
+		&row.Dataset,
+		&row.EventDate,
+		&row.Origin,
+		&row.Source,
+		&row.RunID,
+	)
+	result.returnedRows = append(result.returnedRows, row)
+	return err
+}
+
+func (result *eventRowResult) Capacity() int {
+	return cap(result.returnedRows)
+}
+func (result *eventRowResult) HasUnlimitedCapacity() bool {
+	return result.hasUnlimitedCapacity
+}
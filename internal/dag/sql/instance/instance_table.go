@@ -0,0 +1,104 @@
+package instance
+
+import (
+	"database/sql"
+	"fmt"
+	"goflow/internal/database"
+	"time"
+)
+
+const tableName = "scheduler_instances"
+const instanceName = "instance"
+const heartbeatName = "heartbeat"
+
+// Row is the last heartbeat of a goflow instance sharing the database
+type Row struct {
+	Instance  string
+	Heartbeat time.Time
+}
+
+func (row Row) columnar() database.ColumnWithValueSlice {
+	return []database.ColumnWithValue{
+		{Column: database.Column{Name: instanceName, DType: database.String{Val: row.Instance}}},
+		{Column: database.Column{Name: heartbeatName, DType: database.TimeStamp{Val: row.Heartbeat.UTC()}}},
+	}
+}
+
+type instanceRowResult struct {
+	returnedRows []Row
+}
+
+func (result *instanceRowResult) ScanAppend(rows *sql.Rows) error {
+	row := Row{}
+	err := rows.Scan(&row.Instance, &row.Heartbeat)
+	result.returnedRows = append(result.returnedRows, row)
+	return err
+}
+
+func (result *instanceRowResult) Capacity() int {
+	return 0
+}
+
+func (result *instanceRowResult) HasUnlimitedCapacity() bool {
+	return true
+}
+
+// TableClient is a struct that interacts with the scheduler instances table
+type TableClient struct {
+	sqlClient *database.SQLClient
+	tableDef  database.Table
+}
+
+// NewTableClient returns a new table client
+func NewTableClient(sqlClient *database.SQLClient) *TableClient {
+	return &TableClient{sqlClient, database.Table{Name: tableName,
+		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  instanceName,
+			DType: database.String{},
+		},
+	}}
+}
+
+// CreateTable creates the table for storing the heartbeats of instances
+func (client *TableClient) CreateTable() {
+	client.sqlClient.CreateTable(client.tableDef)
+}
+
+// Heartbeat records that the instance is alive at the given time
+func (client *TableClient) Heartbeat(instance string, now time.Time) {
+	row := Row{instance, now}.columnar()
+	query := fmt.Sprintf(
+		"INSERT OR REPLACE INTO %s(%s, %s) VALUES(%s, %s)",
+		tableName,
+		instanceName,
+		heartbeatName,
+		row[0].ValRep(),
+		row[1].ValRep(),
+	)
+	err := client.sqlClient.Exec(query)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LiveInstances returns the instances whose last heartbeat is at or after since, by name
+func (client *TableClient) LiveInstances(since time.Time) []Row {
+	result := instanceRowResult{make([]Row, 0)}
+	condition := database.ColumnWithValue{
+		Column: database.Column{Name: heartbeatName, DType: database.TimeStamp{Val: since.UTC()}},
+	}
+	client.sqlClient.QueryIntoResults(
+		&result,
+		fmt.Sprintf(
+			"SELECT %s, %s FROM %s WHERE %s >= %s ORDER BY %s",
+			instanceName,
+			heartbeatName,
+			tableName,
+			heartbeatName,
+			condition.ValRep(),
+			instanceName,
+		),
+	)
+	return result.returnedRows
+}
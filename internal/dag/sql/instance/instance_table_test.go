@@ -0,0 +1,38 @@
+package instance
+
+import (
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"path"
+	"testing"
+	"time"
+)
+
+var sqlClient *database.SQLClient
+var tableClient *TableClient
+
+var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
+
+func TestMain(m *testing.M) {
+	sqlClient = database.NewSQLiteClient(databaseFile)
+	tableClient = NewTableClient(sqlClient)
+	m.Run()
+}
+
+func TestLiveInstances(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	tableClient.Heartbeat("second", now.Add(-time.Minute))
+	tableClient.Heartbeat("first", now.Add(-time.Hour))
+	tableClient.Heartbeat("dead", now.Add(-time.Hour))
+	tableClient.Heartbeat("first", now)
+
+	live := tableClient.LiveInstances(now.Add(-10 * time.Minute))
+	if len(live) != 2 || live[0].Instance != "first" || live[1].Instance != "second" {
+		t.Fatalf("Expected first and second to be alive, found %v", live)
+	}
+	if !live[0].Heartbeat.Equal(now) {
+		t.Errorf("Expected the latest heartbeat of first, found %s", live[0].Heartbeat)
+	}
+}
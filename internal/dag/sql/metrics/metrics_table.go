@@ -4,11 +4,26 @@ import (
 	"fmt"
 	"goflow/internal/database"
 	"goflow/internal/dateutils"
+	"strings"
 	"time"
 )
 
 const tableName = "metrics"
 
+// Filter selects metrics rows, empty fields match every row
+// Rows are returned in the order they were inserted, starting after the row with id AfterID,
+// or before the row with id BeforeID when Descending is set
+type Filter struct {
+	DagNames   []string
+	RunID      string
+	Since      time.Time
+	Until      time.Time
+	AfterID    int
+	BeforeID   int
+	Descending bool
+	Limit      int
+}
+
 // TableClient is a struct that interacts with the DAG table
 type TableClient struct {
 	sqlClient *database.SQLClient
@@ -19,12 +34,21 @@ type TableClient struct {
 func NewTableClient(sqlClient *database.SQLClient) *TableClient {
 	return &TableClient{sqlClient, database.Table{Name: tableName,
 		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  IDName,
+			DType: database.Serial{},
+		},
 	}}
 }
 
 // CreateTable creates the table for storing DAG related information
+// Tables of earlier versions, whose id is not the primary key, are rebuilt so that SQLite assigns
+// the ids
 func (client *TableClient) CreateTable() {
 	client.sqlClient.CreateTable(client.tableDef)
+	if !client.sqlClient.IsPrimaryKey(tableName, IDName) {
+		client.sqlClient.RebuildTable(client.tableDef)
+	}
 }
 
 func fmtSQLDate(dateStruct time.Time) string {
@@ -73,7 +97,86 @@ func (client *TableClient) GetMetricsForDag(dagName string, times ...time.Time)
 	return result.returnedRows, nil
 }
 
-// InsertMetric inserts the given metric row
+// GetMetricsForRun retrieves the metrics rows for a single run of a given dag id
+func (client *TableClient) GetMetricsForRun(dagID int, runID string) []Row {
+	result := newRowResult(0)
+	client.sqlClient.QueryIntoResults(
+		&result,
+		fmt.Sprintf(
+			"SELECT * FROM metrics WHERE %s = %d and %s = %s ORDER BY %s ASC",
+			dagIDName,
+			dagID,
+			runIDName,
+			stringRep(runIDName, runID),
+			metricsTimeName,
+		),
+	)
+	return result.returnedRows
+}
+
+// InsertMetric inserts the given metric row, leaving its id to SQLite
 func (client *TableClient) InsertMetric(metricRow Row) {
 	client.sqlClient.Insert(tableName, metricRow.columnar())
 }
+
+// stringRep returns the SQL representation of a string value of the given column
+func stringRep(column string, value string) string {
+	return database.ColumnWithValue{
+		Column: database.Column{Name: column, DType: database.String{Val: value}},
+	}.ValRep()
+}
+
+// whereClause returns the SQL conditions for the filter
+func (filter Filter) whereClause() string {
+	conditions := make([]string, 0)
+	if len(filter.DagNames) > 0 {
+		names := make([]string, 0, len(filter.DagNames))
+		for _, name := range filter.DagNames {
+			names = append(names, stringRep(dagNameName, name))
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", dagNameName, strings.Join(names, ", ")))
+	}
+	if filter.RunID != "" {
+		conditions = append(
+			conditions,
+			fmt.Sprintf("%s = %s", runIDName, stringRep(runIDName, filter.RunID)),
+		)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s >= %s", metricsTimeName, fmtSQLDate(filter.Since)))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s < %s", metricsTimeName, fmtSQLDate(filter.Until)))
+	}
+	if filter.AfterID > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s > %d", IDName, filter.AfterID))
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s < %d", IDName, filter.BeforeID))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// GetMetrics returns the metrics rows matching the filter
+func (client *TableClient) GetMetrics(filter Filter) []Row {
+	result := newRowResult(filter.Limit)
+	order := "ASC"
+	if filter.Descending {
+		order = "DESC"
+	}
+	query := fmt.Sprintf(
+		"SELECT * FROM %s%s ORDER BY %s %s",
+		tableName,
+		filter.whereClause(),
+		IDName,
+		order,
+	)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.returnedRows
+}
@@ -15,6 +15,7 @@ var tableClient *TableClient
 var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
 
 const testName = "test"
+const testDagID = 3
 
 func TestMain(m *testing.M) {
 	sqlClient = database.NewSQLiteClient(databaseFile)
@@ -50,7 +51,18 @@ func insertMetrics(n int) []Row {
 	for i := 0; i < n; i++ {
 		timeStr := fmt.Sprintf("2019-01-%02d", i+1)
 		executionTime := getTime(i)
-		newRow := NewRow(i, testName, testName+timeStr, 3000, 4000, executionTime)
+		newRow := NewRow(
+			i+1,
+			testDagID,
+			testName,
+			testName+timeStr,
+			testName+timeStr,
+			"task",
+			1,
+			3000,
+			4000,
+			executionTime,
+		)
 		insertedRows = append(insertedRows, newRow)
 		sqlClient.Insert(tableName, newRow.columnar())
 	}
@@ -85,3 +97,94 @@ func TestGetMetricsForDAG(t *testing.T) {
 	}
 
 }
+
+func TestGetMetricsForRun(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpTestTable()
+
+	expectedRows := insertMetrics(3)
+	expectedRow := expectedRows[1]
+
+	foundRows := tableClient.GetMetricsForRun(testDagID, expectedRow.RunID)
+	if len(foundRows) != 1 {
+		t.Errorf("Expected 1 row, found %d", len(foundRows))
+		return
+	}
+	if foundRows[0] != expectedRow {
+		t.Errorf("expected row %s, found row %s", expectedRow, foundRows[0])
+	}
+}
+
+func TestGetMetricsForRunEscapesRunID(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpTestTable()
+
+	insertMetrics(3)
+	expectedRow := NewRow(4, testDagID, testName, "it's", "pod", "task", 1, 10, 20, getTime(3))
+	sqlClient.Insert(tableName, expectedRow.columnar())
+
+	if foundRows := tableClient.GetMetricsForRun(testDagID, "x' OR '1'='1"); len(foundRows) != 0 {
+		t.Errorf("Expected no rows, found %s", foundRows)
+	}
+	foundRows := tableClient.GetMetricsForRun(testDagID, "it's")
+	if len(foundRows) != 1 || foundRows[0] != expectedRow {
+		t.Errorf("Expected row %s, found %s", expectedRow, foundRows)
+	}
+}
+
+func TestCreateTableAddsMissingColumns(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	err := sqlClient.Exec(fmt.Sprintf(
+		"CREATE TABLE %s(id INT, dag_name TEXT, pod_name TEXT, memory INT, cpu INT, "+
+			"metrics_time TIMESTAMP, created_date TIMESTAMP, last_updated_date TIMESTAMP)",
+		tableName,
+	))
+	if err != nil {
+		panic(err)
+	}
+	err = sqlClient.Exec(fmt.Sprintf(
+		"INSERT INTO %s VALUES(0, '%s', 'pod', 10, 20, '2019-01-01 00:00:00', "+
+			"'2019-01-01 00:00:00', '2019-01-01 00:00:00')",
+		tableName,
+		testName,
+	))
+	if err != nil {
+		panic(err)
+	}
+
+	tableClient.CreateTable()
+	tableClient.InsertMetric(NewRow(0, testDagID, testName, "run", "pod", "task", 1, 10, 20, getTime(1)))
+
+	rows := tableClient.GetMetrics(Filter{})
+	if len(rows) != 2 || rows[0].RunID != "" || rows[0].CPU != 20 || rows[1].RunID != "run" || rows[1].DagID != testDagID {
+		t.Errorf("Expected the existing metric and the new metric, found %s", rows)
+	}
+	if len(rows) == 2 && (rows[0].ID != 1 || rows[1].ID != 2) {
+		t.Errorf("Expected SQLite to assign the ids of the rebuilt table, found %s", rows)
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	setUpTestTable()
+
+	for i := 0; i < 4; i++ {
+		tableClient.InsertMetric(NewRow(0, testDagID, testName, "run", "pod", "task", 1, 10, 20, getTime(i)))
+	}
+	tableClient.InsertMetric(NewRow(0, testDagID, "other", "run", "pod", "task", 1, 10, 20, getTime(0)))
+
+	foundRows := tableClient.GetMetrics(Filter{DagNames: []string{testName}, AfterID: 1, Limit: 2})
+	if len(foundRows) != 2 || foundRows[0].ID != 2 || foundRows[1].ID != 3 {
+		t.Errorf("Expected rows with ids 2 and 3, found %s", foundRows)
+	}
+
+	foundRows = tableClient.GetMetrics(Filter{Since: getTime(1), Until: getTime(3), Descending: true})
+	if len(foundRows) != 2 || foundRows[0].ID != 3 || foundRows[1].ID != 2 {
+		t.Errorf("Expected rows with ids 3 and 2, found %s", foundRows)
+	}
+
+	foundRows = tableClient.GetMetrics(Filter{DagNames: []string{"other"}})
+	if len(foundRows) != 1 || foundRows[0].ID != 5 {
+		t.Errorf("Expected the row with id 5, found %s", foundRows)
+	}
+}
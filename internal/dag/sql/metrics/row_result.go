@@ -10,23 +10,46 @@ import (
 
 // Row is a struct containing data about a particular dag
 type Row struct {
-	ID               int
-	DagName, PodName string
-	Memory, CPU      int64
-	MetricTime       time.Time
-	CreatedDate      time.Time
-	LastUpdatedDate  time.Time
+	ID                      int
+	DagID                   int
+	DagName, RunID, PodName string
+	Task                    string
+	Attempt                 int
+	Memory, CPU             int64
+	MetricTime              time.Time
+	CreatedDate             time.Time
+	LastUpdatedDate         time.Time
 }
 
 // IDName is the column name for the primary id column
 const IDName = "id"
 const metricsTimeName = "metrics_time"
+const dagIDName = "dag_id"
+const runIDName = "run_id"
+const dagNameName = "dag_name"
 
 // NewRow returns a new row with the appropriate update and create time stamps
-func NewRow(id int, dagName, podName string, memory, cpu int64, metricTime time.Time) Row {
+func NewRow(
+	id, dagID int,
+	dagName, runID, podName, task string,
+	attempt int,
+	memory, cpu int64,
+	metricTime time.Time,
+) Row {
 	creationTime := dateutils.GetDateTimeNowMilliSecond()
 	return Row{
-		id, dagName, podName, memory, cpu, metricTime, creationTime, creationTime,
+		id,
+		dagID,
+		dagName,
+		runID,
+		podName,
+		task,
+		attempt,
+		memory,
+		cpu,
+		metricTime,
+		creationTime,
+		creationTime,
 	}
 }
 
@@ -49,8 +72,8 @@ func newRowResult(n int) dagRowResult {
 
 func (row Row) columnar() database.ColumnWithValueSlice {
 	return []database.ColumnWithValue{
-		{Column: database.Column{Name: IDName, DType: database.Int{Val: row.ID}}},
-		{Column: database.Column{Name: "dag_name", DType: database.String{Val: row.DagName}}},
+		{Column: database.Column{Name: IDName, DType: database.Serial{Val: row.ID}}},
+		{Column: database.Column{Name: dagNameName, DType: database.String{Val: row.DagName}}},
 		{Column: database.Column{Name: "pod_name", DType: database.String{Val: row.PodName}}},
 		{Column: database.Column{Name: "memory", DType: database.Int64{Val: row.Memory}}},
 		{Column: database.Column{Name: "cpu", DType: database.Int64{Val: row.CPU}}},
@@ -72,6 +95,10 @@ func (row Row) columnar() database.ColumnWithValueSlice {
 				DType: database.TimeStamp{Val: row.LastUpdatedDate},
 			},
 		},
+		{Column: database.Column{Name: dagIDName, DType: database.Int{Val: row.DagID}}},
+		{Column: database.Column{Name: runIDName, DType: database.String{Val: row.RunID}}},
+		{Column: database.Column{Name: "task", DType: database.String{Val: row.Task}}},
+		{Column: database.Column{Name: "attempt", DType: database.Int{Val: row.Attempt}}},
 	}
 }
 
@@ -86,6 +113,10 @@ func (result *dagRowResult) ScanAppend(rows *sql.Rows) error {
 		&row.MetricTime,
 		&row.CreatedDate,
 		&row.LastUpdatedDate,
+		&row.DagID,
+		&row.RunID,
+		&row.Task,
+		&row.Attempt,
 	)
 	result.returnedRows = append(result.returnedRows, row)
 	return err
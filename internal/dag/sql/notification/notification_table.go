@@ -0,0 +1,55 @@
+package notification
+
+import (
+	"fmt"
+	"goflow/internal/database"
+)
+
+const tableName = "notification_deliveries"
+
+// TableClient is a struct that interacts with the notification delivery log table
+type TableClient struct {
+	sqlClient *database.SQLClient
+	tableDef  database.Table
+}
+
+// NewTableClient returns a new table client
+func NewTableClient(sqlClient *database.SQLClient) *TableClient {
+	return &TableClient{sqlClient, database.Table{Name: tableName,
+		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  IDName,
+			DType: database.Serial{},
+		},
+	}}
+}
+
+// CreateTable creates the table for storing notification deliveries
+func (client *TableClient) CreateTable() {
+	client.sqlClient.CreateTable(client.tableDef)
+}
+
+// InsertDelivery inserts a delivery attempt and returns the stored row with the id SQLite assigned
+func (client *TableClient) InsertDelivery(row Row) Row {
+	row.ID = client.sqlClient.InsertReturningID(tableName, row.columnar())
+	return row
+}
+
+// GetDeliveries returns the most recent delivery attempts for the DAG, all DAGs if the name is
+// empty, and all attempts if limit is 0
+func (client *TableClient) GetDeliveries(dagName string, limit int) []Row {
+	result := newRowResult(limit)
+	where := ""
+	if dagName != "" {
+		dagNameColumn := database.ColumnWithValue{
+			Column: database.Column{Name: dagNameName, DType: database.String{Val: dagName}},
+		}
+		where = " WHERE " + database.ColumnWithValueSlice{dagNameColumn}.Join(" AND ")
+	}
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s DESC", tableName, where, IDName)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.returnedRows
+}
@@ -0,0 +1,78 @@
+package notification
+
+import (
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"path"
+	"testing"
+)
+
+var sqlClient *database.SQLClient
+var tableClient *TableClient
+
+var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
+
+func TestMain(m *testing.M) {
+	sqlClient = database.NewSQLiteClient(databaseFile)
+	tableClient = NewTableClient(sqlClient)
+	m.Run()
+}
+
+func TestCreateNotificationTable(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	found := false
+	for _, table := range sqlClient.Tables() {
+		if table == tableName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Did not find table %s in tables", tableName)
+	}
+}
+
+func TestGetDeliveries(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	inserted := []Row{
+		NewRow("dag_a", "run-1", "failure", "webhook", "hooks.example.com", 1, StatusFailed, "503 Service Unavailable"),
+		NewRow("dag_a", "run-1", "failure", "webhook", "hooks.example.com", 2, StatusDelivered, ""),
+		NewRow("dag_b", "run-2", "success", "email", "ops@example.com", 1, StatusDelivered, ""),
+	}
+	for i, row := range inserted {
+		inserted[i] = tableClient.InsertDelivery(row)
+	}
+	cases := []struct {
+		name        string
+		dagName     string
+		limit       int
+		expectedIDs []int
+	}{
+		{"all", "", 0, []int{3, 2, 1}},
+		{"dag", "dag_a", 0, []int{2, 1}},
+		{"limit", "dag_a", 1, []int{2}},
+		{"unknown dag", "dag_c", 0, []int{}},
+	}
+	for _, c := range cases {
+		rows := tableClient.GetDeliveries(c.dagName, c.limit)
+		ids := make([]int, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		if len(ids) != len(c.expectedIDs) {
+			t.Errorf("%s: expected ids %v, found %v", c.name, c.expectedIDs, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != c.expectedIDs[i] {
+				t.Errorf("%s: expected ids %v, found %v", c.name, c.expectedIDs, ids)
+				break
+			}
+		}
+	}
+	first := tableClient.GetDeliveries("dag_a", 0)[1]
+	if first.Attempt != 1 || first.Status != StatusFailed || first.Error != inserted[0].Error {
+		t.Errorf("Expected the failed first attempt, found %s", first)
+	}
+}
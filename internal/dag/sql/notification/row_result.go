@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"database/sql"
+	"goflow/internal/database"
+	"goflow/internal/dateutils"
+	"goflow/internal/jsonpanic"
+	"time"
+)
+
+// Statuses of delivery attempts
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Row is a single attempt at delivering a notification
+// Target is where the notification was sent, the host of webhook URLs or the email addresses
+type Row struct {
+	ID           int
+	DeliveryTime time.Time
+	DagName      string
+	RunID        string
+	Event        string
+	Channel      string
+	Target       string
+	Attempt      int
+	Status       string
+	Error        string
+}
+
+// IDName is the column name for the primary id column
+const IDName = "id"
+const dagNameName = "dag_name"
+
+// NewRow returns a new row with the delivery time set to now
+func NewRow(dagName, runID, event, channel, target string, attempt int, status, errorMessage string) Row {
+	return Row{
+		0,
+		dateutils.GetDateTimeNowMilliSecond(),
+		dagName,
+		runID,
+		event,
+		channel,
+		target,
+		attempt,
+		status,
+		errorMessage,
+	}
+}
+
+func (row Row) String() string {
+	return jsonpanic.JSONPanicFormat(row)
+}
+
+type deliveryRowResult struct {
+	returnedRows         []Row
+	hasUnlimitedCapacity bool
+}
+
+func newRowResult(n int) deliveryRowResult {
+	return deliveryRowResult{
+		returnedRows: make([]Row, 0, n), hasUnlimitedCapacity: n == 0,
+	}
+}
+
+func (row Row) columnar() database.ColumnWithValueSlice {
+	return []database.ColumnWithValue{
+		{Column: database.Column{Name: IDName, DType: database.Serial{Val: row.ID}}},
+		{Column: database.Column{Name: "delivery_time", DType: database.TimeStamp{Val: row.DeliveryTime}}},
+		{Column: database.Column{Name: dagNameName, DType: database.String{Val: row.DagName}}},
+		{Column: database.Column{Name: "run_id", DType: database.String{Val: row.RunID}}},
+		{Column: database.Column{Name: "event", DType: database.String{Val: row.Event}}},
+		{Column: database.Column{Name: "channel", DType: database.String{Val: row.Channel}}},
+		{Column: database.Column{Name: "target", DType: database.String{Val: row.Target}}},
+		{Column: database.Column{Name: "attempt", DType: database.Int{Val: row.Attempt}}},
+		{Column: database.Column{Name: "status", DType: database.String{Val: row.Status}}},
+		{Column: database.Column{Name: "error", DType: database.String{Val: row.Error}}},
+	}
+}
+
+func (result *deliveryRowResult) ScanAppend(rows *sql.Rows) error {
+	row := Row{}
+	err := rows.Scan(
+		&row.ID,
+		&row.DeliveryTime,
+		&row.DagName,
+		&row.RunID,
+		&row.Event,
+		&row.Channel,
+		&row.Target,
+		&row.Attempt,
+		&row.Status,
+		&row.Error,
+	)
+	result.returnedRows = append(result.returnedRows, row)
+	return err
+}
+
+func (result *deliveryRowResult) Capacity() int {
+	return cap(result.returnedRows)
+}
+func (result *deliveryRowResult) HasUnlimitedCapacity() bool {
+	return result.hasUnlimitedCapacity
+}
@@ -0,0 +1,119 @@
+package sla
+
+import (
+	"database/sql"
+	"goflow/internal/database"
+	"goflow/internal/dateutils"
+	"goflow/internal/jsonpanic"
+	"time"
+)
+
+// Reasons that runs missed their SLA
+const (
+	// ReasonPaused is given when the run never started because the DAG was off
+	ReasonPaused = "paused"
+	// ReasonBlocked is given when the run never started because the DAG had its maximum of active runs
+	ReasonBlocked = "blocked"
+	// ReasonNotStarted is given when the run never started for another reason
+	ReasonNotStarted = "not_started"
+	// ReasonWaiting is given when the run was still waiting for the runs of other DAGs when it was due
+	ReasonWaiting = "waiting"
+	// ReasonSensing is given when the run was still waiting for its sensors when it was due
+	ReasonSensing = "sensing"
+	// ReasonQueued is given when the run was still queued for the slots of its pool when it was due
+	ReasonQueued = "queued"
+	// ReasonUnfinished is given when the run was still going when it was due
+	ReasonUnfinished = "unfinished"
+	// ReasonFailed is given when the run finished without succeeding
+	ReasonFailed = "failed"
+	// ReasonLate is given when the run succeeded after it was due
+	ReasonLate = "late"
+)
+
+// Row is a run of a DAG that had not succeeded when it was due
+// RunID and Status are empty for runs that never started
+type Row struct {
+	ID            int
+	DagID         int
+	DagName       string
+	ExecutionDate time.Time
+	DueDate       time.Time
+	DetectedDate  time.Time
+	Reason        string
+	RunID         string
+	Status        string
+}
+
+// IDName is the column name for the primary id column
+const IDName = "id"
+const dagIDName = "dag_id"
+const dagNameName = "dag_name"
+const executionDateName = "execution_date"
+
+// NewRow returns a new row with the detection date set to now
+func NewRow(dagID int, dagName string, executionDate, dueDate time.Time, reason, runID, status string) Row {
+	return Row{
+		0,
+		dagID,
+		dagName,
+		executionDate,
+		dueDate,
+		dateutils.GetDateTimeNowMilliSecond(),
+		reason,
+		runID,
+		status,
+	}
+}
+
+func (row Row) String() string {
+	return jsonpanic.JSONPanicFormat(row)
+}
+
+type missRowResult struct {
+	returnedRows         []Row
+	hasUnlimitedCapacity bool
+}
+
+func newRowResult(n int) missRowResult {
+	return missRowResult{
+		returnedRows: make([]Row, 0, n), hasUnlimitedCapacity: n == 0,
+	}
+}
+
+func (row Row) columnar() database.ColumnWithValueSlice {
+	return []database.ColumnWithValue{
+		{Column: database.Column{Name: IDName, DType: database.Serial{Val: row.ID}}},
+		{Column: database.Column{Name: dagIDName, DType: database.Int{Val: row.DagID}}},
+		{Column: database.Column{Name: dagNameName, DType: database.String{Val: row.DagName}}},
+		{Column: database.Column{Name: executionDateName, DType: database.TimeStamp{Val: row.ExecutionDate}}},
+		{Column: database.Column{Name: "due_date", DType: database.TimeStamp{Val: row.DueDate}}},
+		{Column: database.Column{Name: "detected_date", DType: database.TimeStamp{Val: row.DetectedDate}}},
+		{Column: database.Column{Name: "reason", DType: database.String{Val: row.Reason}}},
+		{Column: database.Column{Name: "run_id", DType: database.String{Val: row.RunID}}},
+		{Column: database.Column{Name: "status", DType: database.String{Val: row.Status}}},
+	}
+}
+
+func (result *missRowResult) ScanAppend(rows *sql.Rows) error {
+	row := Row{}
+	err := rows.Scan(
+		&row.ID,
+		&row.DagID,
+		&row.DagName,
+		&row.ExecutionDate,
+		&row.DueDate,
+		&row.DetectedDate,
+		&row.Reason,
+		&row.RunID,
+		&row.Status,
+	)
+	result.returnedRows = append(result.returnedRows, row)
+	return err
+}
+
+func (result *missRowResult) Capacity() int {
+	return cap(result.returnedRows)
+}
+func (result *missRowResult) HasUnlimitedCapacity() bool {
+	return result.hasUnlimitedCapacity
+}
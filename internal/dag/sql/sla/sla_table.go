@@ -0,0 +1,92 @@
+package sla
+
+import (
+	"fmt"
+	"goflow/internal/database"
+	"strings"
+	"time"
+)
+
+const tableName = "sla_misses"
+
+// Filter selects SLA misses, empty fields match every miss
+type Filter struct {
+	DagNames []string
+	Limit    int
+}
+
+// TableClient is a struct that interacts with the SLA misses table
+type TableClient struct {
+	sqlClient *database.SQLClient
+	tableDef  database.Table
+}
+
+// NewTableClient returns a new table client
+func NewTableClient(sqlClient *database.SQLClient) *TableClient {
+	return &TableClient{sqlClient, database.Table{Name: tableName,
+		Cols: Row{}.columnar().Columns(),
+		PrimaryKeyCol: database.Column{
+			Name:  IDName,
+			DType: database.Serial{},
+		},
+	}}
+}
+
+// CreateTable creates the table for storing SLA misses
+func (client *TableClient) CreateTable() {
+	client.sqlClient.CreateTable(client.tableDef)
+}
+
+// missConditions returns the SQL conditions matching the miss of the run of the DAG for the
+// execution date
+func missConditions(dagID int, executionDate time.Time) database.ColumnWithValueSlice {
+	return database.ColumnWithValueSlice{
+		{Column: database.Column{Name: dagIDName, DType: database.Int{Val: dagID}}},
+		{Column: database.Column{Name: executionDateName, DType: database.TimeStamp{Val: executionDate}}},
+	}
+}
+
+// IsMissRecorded returns true if a miss is recorded for the run of the DAG for the execution date
+func (client *TableClient) IsMissRecorded(dagID int, executionDate time.Time) bool {
+	return client.sqlClient.QueryInt(
+		fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE %s",
+			tableName,
+			missConditions(dagID, executionDate).Join(" AND "),
+		),
+	) > 0
+}
+
+// InsertMiss records a miss and returns the stored row with the id SQLite assigned
+// Misses are recorded once per run, false is returned if the run already has a miss
+func (client *TableClient) InsertMiss(row Row) (Row, bool) {
+	id, inserted := client.sqlClient.InsertUnlessPresentReturningID(
+		tableName,
+		row.columnar(),
+		missConditions(row.DagID, row.ExecutionDate),
+	)
+	row.ID = id
+	return row, inserted
+}
+
+// GetMisses returns the SLA misses matching the filter, most recently detected first
+func (client *TableClient) GetMisses(filter Filter) []Row {
+	result := newRowResult(filter.Limit)
+	where := ""
+	if len(filter.DagNames) > 0 {
+		names := make([]string, 0, len(filter.DagNames))
+		for _, name := range filter.DagNames {
+			nameColumn := database.ColumnWithValue{
+				Column: database.Column{Name: dagNameName, DType: database.String{Val: name}},
+			}
+			names = append(names, nameColumn.ValRep())
+		}
+		where = fmt.Sprintf(" WHERE %s IN (%s)", dagNameName, strings.Join(names, ", "))
+	}
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s DESC", tableName, where, IDName)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	client.sqlClient.QueryIntoResults(&result, query)
+	return result.returnedRows
+}
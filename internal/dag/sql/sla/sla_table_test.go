@@ -0,0 +1,89 @@
+package sla
+
+import (
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"path"
+	"testing"
+	"time"
+)
+
+var sqlClient *database.SQLClient
+var tableClient *TableClient
+
+var databaseFile = path.Join(testutils.GetTestFolder(), "test.sqlite3")
+
+func TestMain(m *testing.M) {
+	sqlClient = database.NewSQLiteClient(databaseFile)
+	tableClient = NewTableClient(sqlClient)
+	m.Run()
+}
+
+func TestCreateSLATable(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	found := false
+	for _, table := range sqlClient.Tables() {
+		if table == tableName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Did not find table %s in tables", tableName)
+	}
+}
+
+func getTestDate(hour int) time.Time {
+	return time.Date(2019, 1, 1, hour, 0, 0, 0, time.UTC)
+}
+
+func TestInsertAndGetMisses(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	tableClient.CreateTable()
+	rows := []Row{
+		NewRow(1, "dag_a", getTestDate(0), getTestDate(1), ReasonFailed, "dag-a-run", "Failed"),
+		NewRow(1, "dag_a", getTestDate(1), getTestDate(2), ReasonPaused, "", ""),
+		NewRow(2, "dag_b", getTestDate(0), getTestDate(6), ReasonUnfinished, "dag-b-run", "Running"),
+	}
+	for _, row := range rows {
+		if _, inserted := tableClient.InsertMiss(row); !inserted {
+			t.Errorf("Expected miss %s to be inserted", row)
+		}
+	}
+	if _, inserted := tableClient.InsertMiss(rows[0]); inserted {
+		t.Error("Expected a run to have a single miss")
+	}
+	if !tableClient.IsMissRecorded(1, getTestDate(1)) || tableClient.IsMissRecorded(2, getTestDate(1)) {
+		t.Error("Expected misses to be found by DAG and execution date")
+	}
+	cases := []struct {
+		name        string
+		filter      Filter
+		expectedIDs []int
+	}{
+		{"all", Filter{}, []int{3, 2, 1}},
+		{"dag", Filter{DagNames: []string{"dag_a"}}, []int{2, 1}},
+		{"dags", Filter{DagNames: []string{"dag_a", "dag_b"}, Limit: 2}, []int{3, 2}},
+	}
+	for _, c := range cases {
+		misses := tableClient.GetMisses(c.filter)
+		ids := make([]int, 0, len(misses))
+		for _, miss := range misses {
+			ids = append(ids, miss.ID)
+		}
+		if len(ids) != len(c.expectedIDs) {
+			t.Errorf("%s: expected ids %v, found %v", c.name, c.expectedIDs, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != c.expectedIDs[i] {
+				t.Errorf("%s: expected ids %v, found %v", c.name, c.expectedIDs, ids)
+				break
+			}
+		}
+	}
+	miss := tableClient.GetMisses(Filter{DagNames: []string{"dag_b"}})[0]
+	if !miss.DueDate.Equal(getTestDate(6)) || miss.Reason != ReasonUnfinished {
+		t.Errorf("Expected the stored miss, found %s", miss)
+	}
+}
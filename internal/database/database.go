@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"goflow/internal/logs"
+	"goflow/telemetry"
 	"strings"
+	"time"
 
 	sqlite "github.com/mattn/go-sqlite3"
 )
@@ -62,7 +64,10 @@ func PutNRowValues(result QueryResult, rows *sql.Rows) {
 
 // Query runs a database query and returns the rows
 func (client *SQLClient) Query(queryString string) (*sql.Rows, error) {
-	return client.database.Query(queryString)
+	start := time.Now()
+	rows, err := client.database.Query(queryString)
+	telemetry.DBQueryDuration.Observe(telemetry.Since(start), "query")
+	return rows, err
 }
 
 // QueryIntoResults places query results into a structure of interface RowResult
@@ -74,9 +79,35 @@ func (client *SQLClient) QueryIntoResults(result QueryResult, queryString string
 	PutNRowValues(result, rows)
 }
 
+// intResult holds the result of a query returning a single integer
+type intResult struct {
+	value int
+}
+
+func (result *intResult) ScanAppend(rows *sql.Rows) error {
+	return rows.Scan(&result.value)
+}
+
+func (result *intResult) Capacity() int {
+	return 1
+}
+
+func (result *intResult) HasUnlimitedCapacity() bool {
+	return false
+}
+
+// QueryInt returns the single integer returned by the query, 0 if it returns no row
+func (client *SQLClient) QueryInt(queryString string) int {
+	result := intResult{}
+	client.QueryIntoResults(&result, queryString)
+	return result.value
+}
+
 // Exec runs a database query without returning rows
 func (client *SQLClient) Exec(queryString string) error {
+	start := time.Now()
 	_, err := client.database.Exec(queryString)
+	telemetry.DBQueryDuration.Observe(telemetry.Since(start), "exec")
 	return err
 }
 
@@ -89,12 +120,63 @@ func (client *SQLClient) CreateTable(t Table) {
 	}
 }
 
+// AddMissingColumns adds the columns of the table definition that are missing from the
+// existing table, so tables created by earlier versions gain newly added columns
+// New columns must be defined after the existing ones, since they are appended to the table,
+// and existing rows are filled with the value of the column definition
+func (client *SQLClient) AddMissingColumns(t Table) {
+	rows, err := client.database.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", t.Name))
+	if err != nil {
+		panic(err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		existing[name] = true
+	}
+	rows.Close()
+	for _, col := range t.Cols {
+		if existing[col.Name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s DEFAULT %s", t.Name, col, col.DType.getValRep())
+		err := client.Exec(query)
+		if err != nil {
+			panic(queryErrorMessage(query, err))
+		}
+	}
+}
+
 // Insert inserts rows into a given table in the database
 func (client *SQLClient) Insert(table string, columns []ColumnWithValue) {
+	client.insert(table, columns)
+}
+
+// InsertReturningID inserts a row into a given table leaving out its Serial primary key, and
+// returns the id that SQLite assigned to it, or 0 if the table is missing
+func (client *SQLClient) InsertReturningID(table string, columns []ColumnWithValue) int {
+	result, ok := client.insert(table, columns)
+	if !ok {
+		return 0
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		panic(err)
+	}
+	return int(id)
+}
+
+// insert inserts the columns that are not Serial into a given table, returning false if the table
+// is missing
+func (client *SQLClient) insert(table string, columns []ColumnWithValue) (sql.Result, bool) {
 	commaJoin := func(s []string) string { return strings.Join(s, ",") }
 	columnNames := make([]string, 0, len(columns))
 	valueStrings := make([]string, 0, len(columns))
 	for _, col := range columns {
+		if _, ok := col.DType.(Serial); ok {
+			continue
+		}
 		columnNames = append(columnNames, col.Name)
 		valueStrings = append(valueStrings, col.ValRep())
 	}
@@ -104,15 +186,118 @@ func (client *SQLClient) Insert(table string, columns []ColumnWithValue) {
 		commaJoin(columnNames),
 		commaJoin(valueStrings),
 	)
-	err := client.Exec(query)
+	start := time.Now()
+	result, err := client.database.Exec(query)
+	telemetry.DBQueryDuration.Observe(telemetry.Since(start), "exec")
 	if err != nil {
 		fmt.Println(err.Error())
 		if strings.Contains(err.Error(), "no such table") {
 			logs.ErrorLogger.Println("Insert table", table, "is missing")
-			return
+			return nil, false
 		}
 		panic(queryErrorMessage(query, err))
 	}
+	return result, true
+}
+
+// IsPrimaryKey returns true if the column is the primary key of the existing table
+func (client *SQLClient) IsPrimaryKey(table string, column string) bool {
+	rows, err := client.database.Query(
+		fmt.Sprintf("SELECT pk FROM pragma_table_info('%s') WHERE name = '%s'", table, column),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	primaryKey := 0
+	if rows.Next() {
+		if err := rows.Scan(&primaryKey); err != nil {
+			panic(err)
+		}
+	}
+	return primaryKey > 0
+}
+
+// RebuildTable recreates the existing table from the table definition, so that tables created by
+// earlier versions gain the primary key that ALTER TABLE cannot add
+// The rows are copied in the order they were inserted, leaving out the primary key so that SQLite
+// assigns it, and columns missing from the existing table get the value of their definition
+func (client *SQLClient) RebuildTable(t Table) {
+	client.AddMissingColumns(t)
+	legacyName := t.Name + "_legacy"
+	columnNames := make([]string, 0, len(t.Cols))
+	for _, col := range t.Cols {
+		if col != t.PrimaryKeyCol {
+			columnNames = append(columnNames, col.Name)
+		}
+	}
+	columns := strings.Join(columnNames, ",")
+	for _, query := range []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", t.Name, legacyName),
+		t.createQuery(),
+		fmt.Sprintf("INSERT INTO %s(%s) SELECT %s FROM %s ORDER BY rowid", t.Name, columns, columns, legacyName),
+		fmt.Sprintf("DROP TABLE %s", legacyName),
+	} {
+		if err := client.Exec(query); err != nil {
+			panic(queryErrorMessage(query, err))
+		}
+	}
+}
+
+// InsertUnlessPresent inserts a row into a given table unless a row matching the conditions is
+// present, returning true if it was inserted
+// The check and the insert are a single statement, so of concurrent clients only one inserts it
+func (client *SQLClient) InsertUnlessPresent(table string, columns, conditions ColumnWithValueSlice) bool {
+	_, inserted := client.insertUnlessPresent(table, columns, conditions)
+	return inserted
+}
+
+// InsertUnlessPresentReturningID inserts a row like InsertUnlessPresent, leaving out its Serial
+// primary key, and returns the id that SQLite assigned to it along with true if it was inserted
+func (client *SQLClient) InsertUnlessPresentReturningID(
+	table string,
+	columns, conditions ColumnWithValueSlice,
+) (int, bool) {
+	result, inserted := client.insertUnlessPresent(table, columns, conditions)
+	if !inserted {
+		return 0, false
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		panic(err)
+	}
+	return int(id), true
+}
+
+func (client *SQLClient) insertUnlessPresent(table string, columns, conditions ColumnWithValueSlice) (sql.Result, bool) {
+	columnNames := make([]string, 0, len(columns))
+	valueStrings := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if _, ok := col.DType.(Serial); ok {
+			continue
+		}
+		columnNames = append(columnNames, col.Name)
+		valueStrings = append(valueStrings, col.ValRep())
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s(%s) SELECT %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s)",
+		table,
+		strings.Join(columnNames, ","),
+		strings.Join(valueStrings, ","),
+		table,
+		conditions.Join(" AND "),
+	)
+	start := time.Now()
+	result, err := client.database.Exec(query)
+	telemetry.DBQueryDuration.Observe(telemetry.Since(start), "exec")
+	if err != nil {
+		panic(queryErrorMessage(query, err))
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return result, inserted > 0
 }
 
 // Update updates a given table with row values, for a given condition
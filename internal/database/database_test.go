@@ -278,6 +278,19 @@ func TestQueryRowsIntoResult(t *testing.T) {
 	}
 }
 
+func TestQueryInt(t *testing.T) {
+	defer PurgeDB(client)
+
+	setUpTableAndInsertOneRow()
+
+	if count := client.QueryInt(fmt.Sprintf("SELECT COUNT(*) FROM %s", testTable)); count != 1 {
+		t.Errorf("Expected a count of 1, got %d", count)
+	}
+	if id := client.QueryInt(fmt.Sprintf("SELECT %s FROM %s WHERE 0", idName, testTable)); id != 0 {
+		t.Errorf("Expected 0 without rows, got %d", id)
+	}
+}
+
 func TestUpdateTable(t *testing.T) {
 	defer PurgeDB(client)
 
@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"goflow/internal/dateutils"
+	"strings"
 	"time"
 )
 
@@ -19,7 +20,7 @@ func (s String) typeName() string {
 	return "STRING"
 }
 func (s String) getValRep() string {
-	return "'" + s.Val + "'"
+	return "'" + strings.ReplaceAll(s.Val, "'", "''") + "'"
 }
 
 // Int is an integer sql datatype
@@ -32,6 +33,17 @@ func (i Int) getValRep() string {
 	return fmt.Sprint(i.Val)
 }
 
+// Serial is an integer sql datatype that SQLite assigns to inserted rows when it is the primary
+// key of the table, inserts leave it out
+type Serial struct{ Val int }
+
+func (i Serial) typeName() string {
+	return "INTEGER"
+}
+func (i Serial) getValRep() string {
+	return fmt.Sprint(i.Val)
+}
+
 // Int64 is a long in sql datatype
 type Int64 struct{ Val int64 }
 
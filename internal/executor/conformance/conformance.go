@@ -0,0 +1,236 @@
+package conformance
+
+import (
+	"encoding/json"
+	"goflow/internal/executor"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dagconfig "goflow/internal/dag/config"
+
+	core "k8s.io/api/core/v1"
+)
+
+// runTimeout is how long a run of the suite may take to report its final phase
+const runTimeout = 10 * time.Second
+
+// Harness is an executor under test along with what its runs need to progress
+// Runs of executors that rely on informers do not progress on their own in tests, Start, Finish
+// and Removed then stand in for the informer, they are nil for executors whose runs do progress
+type Harness struct {
+	Executor executor.Executor
+	// Start reports that the given attempt of the run has started, attempts count from 1
+	Start func(spec executor.Spec, attempt int)
+	// Finish reports that the run has finished with the given phase
+	Finish func(spec executor.Spec, phase core.PodPhase)
+	// Removed reports that the cancelled run has been removed
+	Removed func(spec executor.Spec)
+}
+
+// logWriter records what a run writes and whether it was closed
+type logWriter struct {
+	lock   *sync.Mutex
+	data   []byte
+	closed bool
+}
+
+func newLogWriter() *logWriter {
+	return &logWriter{lock: &sync.Mutex{}}
+}
+
+func (writer *logWriter) Write(data []byte) (int, error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	writer.data = append(writer.data, data...)
+	return len(data), nil
+}
+
+func (writer *logWriter) Close() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	writer.closed = true
+	return nil
+}
+
+func (writer *logWriter) isClosed() bool {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return writer.closed
+}
+
+// newSpec returns the spec of a run of a DAG with the given command
+func newSpec(name string, command ...string) executor.Spec {
+	return executor.Spec{
+		Name:          "conformance-" + name,
+		DAGID:         1,
+		Attempt:       1,
+		ExecutionDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Config: &dagconfig.DAGConfig{
+			Name:        "conformance",
+			Namespace:   "default",
+			DockerImage: "busybox",
+			RetryPolicy: core.RestartPolicyNever,
+			Command:     command,
+			Env:         map[string]string{"CONFORMANCE": "true"},
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+}
+
+// receivePhases returns the phases sent on the channel until it was closed
+func receivePhases(t *testing.T, phases <-chan core.PodPhase) []core.PodPhase {
+	var received []core.PodPhase
+	deadline := time.After(runTimeout)
+	for {
+		select {
+		case phase, ok := <-phases:
+			if !ok {
+				return received
+			}
+			received = append(received, phase)
+		case <-deadline:
+			t.Fatalf("Run did not finish within %s, phases so far %v", runTimeout, received)
+		}
+	}
+}
+
+// finalPhase returns the last phase sent on the channel before it was closed
+func finalPhase(t *testing.T, phases <-chan core.PodPhase) core.PodPhase {
+	received := receivePhases(t, phases)
+	if len(received) == 0 {
+		return core.PodUnknown
+	}
+	return received[len(received)-1]
+}
+
+// checkAttempts fails the test unless the phases are Running once per attempt, then the final phase
+func checkAttempts(t *testing.T, spec executor.Spec, phases []core.PodPhase, attempts int, final core.PodPhase) {
+	expected := make([]core.PodPhase, 0, attempts+1)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		expected = append(expected, core.PodRunning)
+	}
+	expected = append(expected, final)
+	if len(phases) != len(expected) {
+		t.Errorf("Expected run %s to send phases %v, found %v", spec.Name, expected, phases)
+		return
+	}
+	for i := range expected {
+		if phases[i] != expected[i] {
+			t.Errorf("Expected run %s to send phases %v, found %v", spec.Name, expected, phases)
+			return
+		}
+	}
+}
+
+// submit submits the run and fails the test if it cannot be submitted
+func submit(t *testing.T, harness Harness, spec executor.Spec) executor.RunHandle {
+	handle, err := harness.Executor.Submit(spec)
+	if err != nil {
+		t.Fatalf("Could not submit run %s: %s", spec.Name, err)
+	}
+	return handle
+}
+
+// Run runs the conformance suite against the executor of the harness
+func Run(t *testing.T, harness Harness) {
+	t.Run("Render", func(t *testing.T) { testRender(t, harness) })
+	for _, phase := range []core.PodPhase{core.PodSucceeded, core.PodFailed} {
+		phase := phase
+		t.Run(string(phase), func(t *testing.T) { testFinish(t, harness, phase) })
+	}
+	t.Run("Retry", func(t *testing.T) { testRetry(t, harness) })
+	t.Run("Cancel", func(t *testing.T) { testCancel(t, harness) })
+}
+
+// testRender checks that the rendered object describes the run
+func testRender(t *testing.T, harness Harness) {
+	spec := newSpec("render", "echo", "render")
+	manifest := harness.Executor.Render(spec)
+	if manifest == nil {
+		t.Fatal("Expected the object a run would create")
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Could not marshal the rendered object: %s", err)
+	}
+	if !strings.Contains(string(manifestJSON), spec.Name) {
+		t.Errorf("Expected the rendered object to name run %s, found %s", spec.Name, manifestJSON)
+	}
+}
+
+// testFinish checks that a run reports Running and then the phase it finished with, closes its log
+// writer and can no longer be cancelled once it has finished
+func testFinish(t *testing.T, harness Harness, phase core.PodPhase) {
+	spec := newSpec(strings.ToLower(string(phase)), "sh", "-c", "echo $CONFORMANCE; exit 0")
+	if phase == core.PodFailed {
+		spec.Config.Command = []string{"sh", "-c", "echo $CONFORMANCE; exit 1"}
+	}
+	handle := submit(t, harness, spec)
+	defer handle.Cleanup()
+	writer := newLogWriter()
+	handle.StreamLogs(writer)
+	phases := handle.Watch()
+	go func() {
+		if harness.Start != nil {
+			harness.Start(spec, 1)
+		}
+		if harness.Finish != nil {
+			harness.Finish(spec, phase)
+		}
+	}()
+	checkAttempts(t, spec, receivePhases(t, phases), 1, phase)
+	if !writer.isClosed() {
+		t.Errorf("Expected the log writer of run %s to be closed", spec.Name)
+	}
+	if err := handle.Cancel(); err != nil {
+		t.Errorf("Expected cancelling finished run %s to do nothing, found %s", spec.Name, err)
+	}
+}
+
+// testRetry checks that a run retried by the executor reports Running as each attempt starts, then
+// the phase of its last attempt
+func testRetry(t *testing.T, harness Harness) {
+	spec := newSpec("retry", "sh", "-c", "echo $CONFORMANCE; exit 1")
+	spec.Config.RetryPolicy = core.RestartPolicyOnFailure
+	spec.Config.Retries = 1
+	handle := submit(t, harness, spec)
+	defer handle.Cleanup()
+	phases := handle.Watch()
+	go func() {
+		if harness.Start != nil {
+			harness.Start(spec, 1)
+			harness.Start(spec, 2)
+		}
+		if harness.Finish != nil {
+			harness.Finish(spec, core.PodFailed)
+		}
+	}()
+	checkAttempts(t, spec, receivePhases(t, phases), 2, core.PodFailed)
+}
+
+// testCancel checks that a cancelled run stops without succeeding
+func testCancel(t *testing.T, harness Harness) {
+	spec := newSpec("cancel", "sleep", "30")
+	handle := submit(t, harness, spec)
+	defer handle.Cleanup()
+	writer := newLogWriter()
+	handle.StreamLogs(writer)
+	phases := handle.Watch()
+	// Runs are cancelled while they run, or as soon as they start
+	time.Sleep(100 * time.Millisecond)
+	if err := handle.Cancel(); err != nil {
+		t.Fatalf("Could not cancel run %s: %s", spec.Name, err)
+	}
+	if harness.Removed != nil {
+		harness.Removed(spec)
+	}
+	if finalPhase := finalPhase(t, phases); finalPhase == core.PodSucceeded {
+		t.Errorf("Expected cancelled run %s not to succeed", spec.Name)
+	}
+	if !writer.isClosed() {
+		t.Errorf("Expected the log writer of run %s to be closed", spec.Name)
+	}
+}
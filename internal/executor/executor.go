@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"errors"
+	goflowconfig "goflow/internal/config"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/local/procstat"
+	"io"
+	"sort"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TaskName is the name of the single task run by each DAG run
+const TaskName = "task"
+
+// Spec describes a single attempt of a DAG run
+type Spec struct {
+	Name          string
+	DAGID         int
+	Attempt       int
+	ExecutionDate time.Time
+	Config        *dagconfig.DAGConfig
+}
+
+// Env returns the environment variables of the DAG sorted by name
+func (spec Spec) Env() []core.EnvVar {
+	if len(spec.Config.Env) == 0 {
+		return nil
+	}
+	env := make([]core.EnvVar, 0, len(spec.Config.Env))
+	for name, value := range spec.Config.Env {
+		env = append(env, core.EnvVar{Name: name, Value: value})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+	return env
+}
+
+// ErrAlreadySubmitted is returned by Submit when the run was already submitted by another goflow
+// instance, and the executor cannot adopt it
+var ErrAlreadySubmitted = errors.New("the run was already submitted")
+
+// Executor carries out DAG runs, such as pods on Kubernetes or processes on the goflow host
+type Executor interface {
+	// Render returns the object that submitting the run would create, without creating it
+	Render(spec Spec) runtime.Object
+	// Submit creates the run, it starts being monitored once it is watched
+	// Runs that were already submitted are adopted, or ErrAlreadySubmitted is returned
+	Submit(spec Spec) (RunHandle, error)
+}
+
+// RunHandle controls a submitted run
+// StreamLogs must be called before Watch, Cleanup once the run has finished
+type RunHandle interface {
+	// StreamLogs writes the output of the run to writer, which is closed once the run has finished
+	StreamLogs(writer io.WriteCloser)
+	// Watch starts monitoring the run and returns a channel that receives its phase whenever it
+	// changes, the channel is closed after the final phase
+	// Executors that retry runs themselves send Running as each attempt starts
+	Watch() <-chan core.PodPhase
+	// Cancel stops the run if it has not finished, its final phase is sent once it has stopped
+	Cancel() error
+	// Cleanup removes what is left of the finished run
+	Cleanup()
+}
+
+// UsageReporter is implemented by run handles that sample the resource usage of their runs
+type UsageReporter interface {
+	// Usage returns the last sampled usage of the run and the number of its attempt, false if
+	// the run is not running
+	Usage() (procstat.Usage, int, bool)
+}
+
+// Adopter is implemented by executors that can take over the runs submitted by another goflow
+// instance
+type Adopter interface {
+	// Adopt returns a handle on the run that was already submitted for the spec
+	Adopt(spec Spec) (RunHandle, error)
+}
+
+// Registry holds executors by the name that DAG configs select them with
+type Registry map[string]Executor
+
+// Get returns the executor selected by the DAG config, nil if there is none with its name
+// DAG configs without an executor use the pod executor, DAG configs with a cluster use the
+// executor registered for that cluster
+func (registry Registry) Get(dagConfig *dagconfig.DAGConfig) Executor {
+	name := dagConfig.Executor
+	if name == "" {
+		name = goflowconfig.ExecutorPod
+	}
+	if dagConfig.Cluster != "" {
+		name = ClusterKey(name, dagConfig.Cluster)
+	}
+	return registry[name]
+}
+
+// ClusterKey returns the name that the executor with the given name is registered under for the
+// cluster
+func ClusterKey(name string, cluster string) string {
+	return name + "@" + cluster
+}
@@ -8,6 +8,7 @@ import (
 	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/dagtype"
 	"goflow/internal/logs"
+	"goflow/internal/logstore"
 
 	"goflow/internal/dag/orchestrator"
 	k8sclient "goflow/internal/k8s/client"
@@ -219,22 +220,20 @@ func startServer() {
 		logs.InfoLogger.Println(run)
 		_, ok := firstRunDagNames[run.Name]
 		if ok {
-			select {
-			case logText := <-run.Logs():
-				withoutNewlines := strings.TrimSpace(logText)
-				expectedLogMessage := getLogMessage(getDagID(*run.Config))
-				if withoutNewlines != expectedLogMessage {
-					panic(
-						fmt.Sprintf(
-							"Expected log message %s, but got message %s",
-							expectedLogMessage,
-							withoutNewlines,
-						),
-					)
-				}
-			default:
-				logs.InfoLogger.Println(run.Logs())
-				panic(fmt.Sprintf("No logs available for pod %s!!!", run.Name))
+			logLines, err := run.Logs(logstore.ReadOptions{})
+			if err != nil {
+				panic(fmt.Sprintf("No logs available for pod %s!!! %s", run.Name, err))
+			}
+			withoutNewlines := strings.TrimSpace(strings.Join(logLines, "\n"))
+			expectedLogMessage := getLogMessage(getDagID(*run.Config))
+			if withoutNewlines != expectedLogMessage {
+				panic(
+					fmt.Sprintf(
+						"Expected log message %s, but got message %s",
+						expectedLogMessage,
+						withoutNewlines,
+					),
+				)
 			}
 		}
 
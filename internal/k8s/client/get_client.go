@@ -3,6 +3,7 @@ package client
 import (
 	"path/filepath"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -10,10 +11,12 @@ import (
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
+func getKubeConfigPath() string {
+	return filepath.Join(homedir.HomeDir(), ".kube", "config")
+}
+
 func getConfigFromHome() *rest.Config {
-	var kubeconfig string
-	home := homedir.HomeDir()
-	kubeconfig = filepath.Join(home, ".kube", "config")
+	kubeconfig := getKubeConfigPath()
 
 	// use the current context in kubeconfig
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -34,3 +37,25 @@ func CreateMetricsClient() *metrics.Clientset {
 	config := getConfigFromHome()
 	return metrics.NewForConfigOrDie(config)
 }
+
+// CreateDynamicClient returns a new k8s client for objects of any kind
+func CreateDynamicClient() dynamic.Interface {
+	config := getConfigFromHome()
+	return dynamic.NewForConfigOrDie(config)
+}
+
+// CreateClusterConfig returns the config of the context of a kubeconfig, ~/.kube/config if the
+// path is empty, using its current context if the context is empty
+func CreateClusterConfig(kubeconfig string, context string) *rest.Config {
+	if kubeconfig == "" {
+		kubeconfig = getKubeConfigPath()
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		panic(err.Error())
+	}
+	return config
+}
@@ -0,0 +1,287 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"goflow/internal/executor"
+	"goflow/internal/executor/conformance"
+	"goflow/internal/jsonpanic"
+	jobutils "goflow/internal/k8s/job/utils"
+	"goflow/internal/k8s/pod/event/holder"
+	podutils "goflow/internal/k8s/pod/utils"
+	"goflow/telemetry"
+	"testing"
+	"time"
+
+	dagconfig "goflow/internal/dag/config"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func getTestSpec(name string) executor.Spec {
+	return executor.Spec{
+		Name:          name,
+		DAGID:         3,
+		Attempt:       1,
+		ExecutionDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Config: &dagconfig.DAGConfig{
+			Name:        name,
+			Namespace:   "default",
+			DockerImage: "busybox",
+			RetryPolicy: core.RestartPolicyNever,
+			Command:     []string{"echo", "Hello world!!!!!!!"},
+		},
+	}
+}
+
+func TestPodExecutorConformance(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	channelHolder := holder.New()
+	conformance.Run(t, conformance.Harness{
+		Executor: NewPodExecutor(client, channelHolder, ""),
+		Start: func(spec executor.Spec, attempt int) {
+			pod, err := client.CoreV1().Pods(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+			if err != nil {
+				panic(err)
+			}
+			podCopy := pod.DeepCopy()
+			podCopy.Status.Phase = core.PodRunning
+			if attempt == 1 {
+				channelHolder.GetChannelGroup(spec.Name).Ready <- podCopy
+				return
+			}
+			// Later attempts restart the container of the pod
+			podCopy.Status.ContainerStatuses = []core.ContainerStatus{
+				{Name: spec.Name, RestartCount: int32(attempt - 1)},
+			}
+			channelHolder.GetChannelGroup(spec.Name).Update <- podCopy
+		},
+		Finish: func(spec executor.Spec, phase core.PodPhase) {
+			pod, err := client.CoreV1().Pods(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+			if err != nil {
+				panic(err)
+			}
+			podCopy := pod.DeepCopy()
+			podCopy.Status.Phase = phase
+			channelHolder.GetChannelGroup(spec.Name).Update <- podCopy
+		},
+		Removed: func(spec executor.Spec) {
+			channelHolder.GetChannelGroup(spec.Name).Remove <- &core.Pod{
+				ObjectMeta: k8sapi.ObjectMeta{Name: spec.Name, Namespace: spec.Config.Namespace},
+			}
+		},
+	})
+}
+
+func TestJobExecutorConformance(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	channelHolder := holder.New()
+	conformance.Run(t, conformance.Harness{
+		Executor: NewJobExecutor(client, channelHolder),
+		Start: func(spec executor.Spec, attempt int) {
+			job, err := client.BatchV1().Jobs(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+			if err != nil {
+				panic(err)
+			}
+			// Each attempt of a Job runs in a new pod
+			jobutils.CreateTestJobPod(client, job, fmt.Sprintf("%s-%d", spec.Name, attempt), core.PodRunning)
+		},
+		Finish: func(spec executor.Spec, phase core.PodPhase) {
+			job, err := client.BatchV1().Jobs(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+			if err != nil {
+				panic(err)
+			}
+			conditionType := batch.JobComplete
+			if phase == core.PodFailed {
+				conditionType = batch.JobFailed
+			}
+			jobutils.SetFinished(job, conditionType)
+			channelHolder.GetChannelGroup(spec.Name).JobDone <- job
+		},
+		Removed: func(spec executor.Spec) {
+			channelHolder.GetChannelGroup(spec.Name).JobRemoved <- &batch.Job{
+				ObjectMeta: k8sapi.ObjectMeta{Name: spec.Name, Namespace: spec.Config.Namespace},
+			}
+		},
+	})
+}
+
+func TestRenderPod(t *testing.T) {
+	spec := getTestSpec("test-render")
+	spec.Config.Labels = map[string]string{"team": "data"}
+	spec.Config.Env = map[string]string{"B": "2", "A": "1"}
+	spec.Config.Resources = core.ResourceRequirements{
+		Limits: core.ResourceList{core.ResourceCPU: resource.MustParse("100m")},
+	}
+	pod := *NewPodExecutor(nil, nil, "").Render(spec).(*core.Pod)
+	if jsonpanic.JSONPanic(pod) != jsonpanic.JSONPanic(getPodFrame(spec, "")) {
+		t.Errorf("Expected the rendered pod to be the pod of a run, found %s", jsonpanic.JSONPanic(pod))
+	}
+	container := pod.Spec.Containers[0]
+	if pod.Labels["team"] != "data" || pod.Labels[podutils.DAGIDLabelKey] != "3" {
+		t.Errorf("Expected the DAG labels and the goflow labels, found %v", pod.Labels)
+	}
+	if len(container.Env) != 2 || container.Env[0].Name != "A" || container.Env[1].Value != "2" {
+		t.Errorf("Expected the environment sorted by name, found %v", container.Env)
+	}
+	if container.Resources.Limits.Cpu().String() != "100m" {
+		t.Errorf("Expected the resources of the DAG, found %v", container.Resources)
+	}
+}
+
+func TestSubmitPod(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	channelHolder := holder.New()
+	spec := getTestSpec("test-create-pod")
+	_, err := NewPodExecutor(client, channelHolder, "").Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foundPod, err := client.CoreV1().Pods(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonpanic.JSONPanic(*foundPod) != jsonpanic.JSONPanic(getPodFrame(spec, "")) {
+		t.Errorf("Expected the pod of the run, found %s", jsonpanic.JSONPanic(*foundPod))
+	}
+	if !channelHolder.Contains(spec.Name) {
+		t.Error("Expected the pod events to be registered")
+	}
+}
+
+func TestSubmitExistingPodAdoptsIt(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	spec := getTestSpec("test-adopt-pod")
+	_, err := NewPodExecutor(client, holder.New(), "first").Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channelHolder := holder.New()
+	handle, err := NewPodExecutor(client, channelHolder, "second").Submit(spec)
+	if err != nil || handle == nil {
+		t.Fatalf("Expected the existing pod to be adopted, found %s", err)
+	}
+	pods, err := client.CoreV1().Pods(spec.Config.Namespace).List(context.TODO(), k8sapi.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Labels[podutils.InstanceLabelKey] != "second" {
+		t.Errorf("Expected a single pod relabelled with the adopting instance, found %v", pods.Items)
+	}
+	if !channelHolder.Contains(spec.Name) {
+		t.Error("Expected the pod events to be registered")
+	}
+	_, err = NewPodExecutor(client, holder.New(), "third").Adopt(getTestSpec("test-missing-pod"))
+	if err == nil {
+		t.Error("Expected adopting a missing pod to fail")
+	}
+}
+
+func TestSubmitPodRefused(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("pod creation refused")
+	})
+	channelHolder := holder.New()
+	spec := getTestSpec("test-pod-refused")
+	failures := telemetry.PodCreationFailures.Get(spec.Config.Name)
+	_, err := NewPodExecutor(client, channelHolder, "").Submit(spec)
+	if err == nil {
+		t.Error("Expected the refused pod creation to be returned")
+	}
+	if telemetry.PodCreationFailures.Get(spec.Config.Name) != failures+1 {
+		t.Error("Pod creation failure should have been counted")
+	}
+	if channelHolder.Contains(spec.Name) {
+		t.Error("Expected the pod events to be unregistered")
+	}
+}
+
+func TestSubmitJob(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	timeLimit := int64(60)
+	spec := getTestSpec("test-submit-job")
+	spec.Config.Retries = 3
+	spec.Config.Parallelism = 2
+	spec.Config.TimeLimit = &timeLimit
+	_, err := NewJobExecutor(client, holder.New()).Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := client.BatchV1().Jobs(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *job.Spec.BackoffLimit != 3 || *job.Spec.Parallelism != 2 || *job.Spec.Completions != 2 {
+		t.Errorf("Expected the retries and parallelism of the DAG, found %v", job.Spec)
+	}
+	if *job.Spec.ActiveDeadlineSeconds != timeLimit || job.Spec.Template.Spec.ActiveDeadlineSeconds != nil {
+		t.Errorf("Expected the time limit to be set on the job only, found %v", job.Spec)
+	}
+	if *job.Spec.TTLSecondsAfterFinished != defaultJobTTLSeconds {
+		t.Errorf("Expected the default TTL, found %d", *job.Spec.TTLSecondsAfterFinished)
+	}
+}
+
+func TestWatchRetryingJob(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	channelHolder := holder.New()
+	spec := getTestSpec("test-watch-retrying-job")
+	spec.Config.RetryPolicy = core.RestartPolicyOnFailure
+	spec.Config.Retries = 1
+	handle, err := NewJobExecutor(client, channelHolder).Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := client.BatchV1().Jobs(spec.Config.Namespace).Get(context.TODO(), spec.Name, k8sapi.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobutils.CreateTestJobPod(client, job, spec.Name+"-first", core.PodFailed)
+	jobutils.CreateTestJobPod(client, job, spec.Name+"-second", core.PodSucceeded)
+	jobutils.SetFinished(job, batch.JobComplete)
+	channelHolder.GetChannelGroup(spec.Name).JobDone <- job
+
+	var phases []core.PodPhase
+	for phase := range handle.Watch() {
+		phases = append(phases, phase)
+	}
+
+	expected := []core.PodPhase{core.PodRunning, core.PodRunning, core.PodSucceeded}
+	if fmt.Sprint(phases) != fmt.Sprint(expected) {
+		t.Errorf("Expected each attempt of the job to be reported as running, found phases %v", phases)
+	}
+}
+
+func TestSubmitExistingJob(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	defer podutils.CleanUpEnvironment(client)
+	spec := getTestSpec("test-existing-job")
+	if _, err := NewJobExecutor(client, holder.New()).Submit(spec); err != nil {
+		t.Fatal(err)
+	}
+	channelHolder := holder.New()
+	failures := telemetry.PodCreationFailures.Get(spec.Config.Name)
+	_, err := NewJobExecutor(client, channelHolder).Submit(spec)
+	if err != executor.ErrAlreadySubmitted {
+		t.Errorf("Expected the job to be reported as already submitted, found %v", err)
+	}
+	if telemetry.PodCreationFailures.Get(spec.Config.Name) != failures {
+		t.Error("An existing job should not be counted as a creation failure")
+	}
+	if channelHolder.Contains(spec.Name) {
+		t.Error("Expected the job events to be unregistered")
+	}
+}
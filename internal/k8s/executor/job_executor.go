@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"context"
+	"goflow/internal/executor"
+	jobwatch "goflow/internal/k8s/job/watch"
+	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/logs"
+	"goflow/telemetry"
+	"io"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+// defaultJobTTLSeconds is how long finished Jobs are kept when no TTL is configured
+const defaultJobTTLSeconds int32 = 600
+
+// JobExecutor runs each DAG run as a Job, Kubernetes retries its pods and deletes it once its
+// TTL has passed
+// The Job informer of the channel holder reports the events of the Jobs
+type JobExecutor struct {
+	kubeClient kubernetes.Interface
+	holder     *holder.ChannelHolder
+}
+
+// NewJobExecutor returns a new JobExecutor
+func NewJobExecutor(kubeClient kubernetes.Interface, channelHolder *holder.ChannelHolder) *JobExecutor {
+	return &JobExecutor{kubeClient, channelHolder}
+}
+
+// getJobFrame returns the Job of a run, whose pods are the pod of the run
+func getJobFrame(spec executor.Spec) batch.Job {
+	podFrame := getPodFrame(spec, "")
+	// The Job enforces the time limit across all of its retries
+	podFrame.Spec.ActiveDeadlineSeconds = nil
+	backoffLimit := spec.Config.Retries
+	ttl := spec.Config.JobTTLSeconds
+	if ttl == 0 {
+		ttl = defaultJobTTLSeconds
+	}
+	jobSpec := batch.JobSpec{
+		BackoffLimit:            &backoffLimit,
+		ActiveDeadlineSeconds:   spec.Config.TimeLimit,
+		TTLSecondsAfterFinished: &ttl,
+		Template: core.PodTemplateSpec{
+			ObjectMeta: k8sapi.ObjectMeta{
+				Labels:      podFrame.Labels,
+				Annotations: podFrame.Annotations,
+			},
+			Spec: podFrame.Spec,
+		},
+	}
+	if spec.Config.Parallelism > 0 {
+		parallelism := spec.Config.Parallelism
+		jobSpec.Parallelism = &parallelism
+		jobSpec.Completions = &parallelism
+	}
+	return batch.Job{
+		TypeMeta: k8sapi.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: k8sapi.ObjectMeta{
+			Name:        spec.Name,
+			Namespace:   spec.Config.Namespace,
+			Labels:      copyStringMap(podFrame.Labels),
+			Annotations: spec.Config.Annotations,
+		},
+		Spec: jobSpec,
+	}
+}
+
+// Render returns the Job of the run
+func (jobExecutor *JobExecutor) Render(spec executor.Spec) runtime.Object {
+	job := getJobFrame(spec)
+	return &job
+}
+
+// Submit creates the Job of the run, Jobs that already exist are not adopted
+func (jobExecutor *JobExecutor) Submit(spec executor.Spec) (executor.RunHandle, error) {
+	jobFrame := getJobFrame(spec)
+	// The channel group is registered before creation, so no job events are missed
+	jobExecutor.holder.AddChannelGroup(jobFrame.Name)
+	logs.InfoLogger.Printf("Creating job %s...\n", jobFrame.Name)
+	jobClient := jobExecutor.kubeClient.BatchV1().Jobs(jobFrame.Namespace)
+	_, err := jobClient.Create(context.TODO(), &jobFrame, k8sapi.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		jobExecutor.holder.DeleteChannelGroup(jobFrame.Name)
+		return nil, executor.ErrAlreadySubmitted
+	}
+	if err != nil {
+		telemetry.PodCreationFailures.Inc(spec.Config.Name)
+		jobExecutor.holder.DeleteChannelGroup(jobFrame.Name)
+		return nil, err
+	}
+	logs.InfoLogger.Printf("Job '%s' created in namespace '%s'\n", jobFrame.Name, jobFrame.Namespace)
+	return &jobHandle{
+		jobFrame.Name,
+		jobClient,
+		jobwatch.NewJobWatcher(jobFrame.Name, jobFrame.Namespace, jobExecutor.kubeClient, nil, jobExecutor.holder),
+	}, nil
+}
+
+// jobHandle controls the Job of a run
+type jobHandle struct {
+	jobName   string
+	jobClient v1.JobInterface
+	watcher   *jobwatch.JobWatcher
+}
+
+func (handle *jobHandle) StreamLogs(writer io.WriteCloser) {
+	handle.watcher.SetLogWriter(writer)
+}
+
+func (handle *jobHandle) Watch() <-chan core.PodPhase {
+	phases := make(chan core.PodPhase, 1)
+	handle.watcher.SetAttemptStarted(func() { phases <- core.PodRunning })
+	go handle.watcher.MonitorJob()
+	go func() {
+		handle.watcher.WaitForMonitorDone()
+		phases <- handle.watcher.Phase
+		close(phases)
+	}()
+	return phases
+}
+
+// Cancel deletes the Job along with its pods, the informer then reports its removal
+func (handle *jobHandle) Cancel() error {
+	propagation := k8sapi.DeletePropagationBackground
+	err := handle.jobClient.Delete(
+		context.TODO(),
+		handle.jobName,
+		k8sapi.DeleteOptions{PropagationPolicy: &propagation},
+	)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup leaves the finished Job to be deleted by Kubernetes once its TTL has passed
+func (handle *jobHandle) Cleanup() {}
@@ -0,0 +1,203 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"goflow/internal/executor"
+	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/k8s/pod/utils"
+	podwatch "goflow/internal/k8s/pod/watch"
+	"goflow/internal/logs"
+	"goflow/telemetry"
+	"io"
+	"strconv"
+
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const serviceAccount = "goflow"
+
+// PodExecutor runs each DAG run as a bare pod, which it deletes once the run is done
+// The informer of the channel holder reports the events of the pods
+// Pods are labelled with the goflow instance that watches them, unless instance is empty
+type PodExecutor struct {
+	kubeClient kubernetes.Interface
+	holder     *holder.ChannelHolder
+	instance   string
+}
+
+// NewPodExecutor returns a new PodExecutor
+func NewPodExecutor(
+	kubeClient kubernetes.Interface,
+	channelHolder *holder.ChannelHolder,
+	instance string,
+) *PodExecutor {
+	return &PodExecutor{kubeClient, channelHolder, instance}
+}
+
+func getContainerFrame(spec executor.Spec) core.Container {
+	return core.Container{
+		Name:            executor.TaskName,
+		Image:           spec.Config.DockerImage,
+		Command:         spec.Config.Command,
+		Args:            nil,
+		WorkingDir:      "",
+		EnvFrom:         nil,
+		Env:             spec.Env(),
+		Resources:       *spec.Config.Resources.DeepCopy(),
+		VolumeMounts:    nil,
+		VolumeDevices:   nil,
+		ImagePullPolicy: core.PullIfNotPresent,
+	}
+}
+
+func copyStringMap(mapToCopy map[string]string) map[string]string {
+	copy := make(map[string]string)
+	for key := range mapToCopy {
+		copy[key] = mapToCopy[key]
+	}
+	return copy
+}
+
+// getPodFrame returns the pod of a run watched by the goflow instance
+func getPodFrame(spec executor.Spec, instance string) core.Pod {
+	labels := copyStringMap(spec.Config.Labels)
+	labels["Name"] = spec.Name
+	labels[utils.AppSelectorKey] = utils.AppName
+	labels[utils.DAGIDLabelKey] = strconv.Itoa(spec.DAGID)
+	labels[utils.RunIDLabelKey] = spec.Name
+	labels[utils.TaskLabelKey] = executor.TaskName
+	labels[utils.AttemptLabelKey] = strconv.Itoa(spec.Attempt)
+	if instance != "" {
+		labels[utils.InstanceLabelKey] = instance
+	}
+	return core.Pod{
+		TypeMeta: k8sapi.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: k8sapi.ObjectMeta{
+			Name:        spec.Name,
+			Namespace:   spec.Config.Namespace,
+			Labels:      labels,
+			Annotations: spec.Config.Annotations,
+		},
+		Spec: core.PodSpec{
+			Volumes:               nil,
+			Containers:            []core.Container{getContainerFrame(spec)},
+			EphemeralContainers:   nil,
+			RestartPolicy:         spec.Config.RetryPolicy,
+			ActiveDeadlineSeconds: spec.Config.TimeLimit,
+			ServiceAccountName:    serviceAccount,
+		},
+	}
+}
+
+// Render returns the pod of the run
+func (podExecutor *PodExecutor) Render(spec executor.Spec) runtime.Object {
+	pod := getPodFrame(spec, podExecutor.instance)
+	return &pod
+}
+
+// Submit creates the pod of the run
+// A pod of the run that already exists is adopted rather than created twice
+func (podExecutor *PodExecutor) Submit(spec executor.Spec) (executor.RunHandle, error) {
+	podFrame := getPodFrame(spec, podExecutor.instance)
+	// The channel group is registered before creation, so no pod events are missed
+	podExecutor.holder.AddChannelGroup(podFrame.Name)
+	logs.InfoLogger.Printf("Creating pod %s...\n", podFrame.Name)
+	podClient := podExecutor.kubeClient.CoreV1().Pods(podFrame.Namespace)
+	_, err := podClient.Create(context.TODO(), &podFrame, k8sapi.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		logs.WarningLogger.Printf("Pod %s already exists, adopting it\n", podFrame.Name)
+		podExecutor.holder.DeleteChannelGroup(podFrame.Name)
+		return podExecutor.Adopt(spec)
+	}
+	if err != nil {
+		telemetry.PodCreationFailures.Inc(spec.Config.Name)
+		podExecutor.holder.DeleteChannelGroup(podFrame.Name)
+		return nil, err
+	}
+	logs.InfoLogger.Printf("Pod '%s' created in namespace '%s'\n", podFrame.Name, podFrame.Namespace)
+	return podExecutor.newHandle(podFrame.Name, podFrame.Namespace), nil
+}
+
+// Adopt takes over the existing pod of the run, which is relabelled with the instance of the
+// executor
+func (podExecutor *PodExecutor) Adopt(spec executor.Spec) (executor.RunHandle, error) {
+	podFrame := getPodFrame(spec, podExecutor.instance)
+	podExecutor.holder.AddChannelGroup(podFrame.Name)
+	podClient := podExecutor.kubeClient.CoreV1().Pods(podFrame.Namespace)
+	pod, err := podClient.Get(context.TODO(), podFrame.Name, k8sapi.GetOptions{})
+	if err == nil && pod.Labels[utils.RunIDLabelKey] != spec.Name {
+		err = fmt.Errorf("pod %s does not belong to run %s", pod.Name, spec.Name)
+	}
+	if err == nil && podExecutor.instance != "" && pod.Labels[utils.InstanceLabelKey] != podExecutor.instance {
+		pod.Labels[utils.InstanceLabelKey] = podExecutor.instance
+		_, err = podClient.Update(context.TODO(), pod, k8sapi.UpdateOptions{})
+	}
+	if err != nil {
+		podExecutor.holder.DeleteChannelGroup(podFrame.Name)
+		return nil, err
+	}
+	logs.InfoLogger.Printf("Pod '%s' adopted in namespace '%s'\n", podFrame.Name, podFrame.Namespace)
+	return podExecutor.newHandle(podFrame.Name, podFrame.Namespace), nil
+}
+
+func (podExecutor *PodExecutor) newHandle(name string, namespace string) *podHandle {
+	return &podHandle{
+		name,
+		podExecutor.kubeClient.CoreV1().Pods(namespace),
+		podwatch.NewPodWatcher(name, namespace, podExecutor.kubeClient, nil, podExecutor.holder),
+	}
+}
+
+// podHandle controls the pod of a run
+type podHandle struct {
+	podName   string
+	podClient v1.PodInterface
+	watcher   *podwatch.PodWatcher
+}
+
+func (handle *podHandle) StreamLogs(writer io.WriteCloser) {
+	handle.watcher.SetLogWriter(writer)
+}
+
+func (handle *podHandle) Watch() <-chan core.PodPhase {
+	phases := make(chan core.PodPhase, 1)
+	handle.watcher.SetAttemptStarted(func() { phases <- core.PodRunning })
+	go handle.watcher.MonitorPod()
+	go func() {
+		handle.watcher.WaitForMonitorDone()
+		phases <- handle.watcher.Phase
+		close(phases)
+	}()
+	return phases
+}
+
+// deletePod deletes the pod, which is already gone if the run was cancelled
+func (handle *podHandle) deletePod() error {
+	logs.InfoLogger.Printf("Deleting pod %s", handle.podName)
+	err := handle.podClient.Delete(context.TODO(), handle.podName, k8sapi.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Cancel deletes the pod, the informer then reports its removal
+func (handle *podHandle) Cancel() error {
+	return handle.deletePod()
+}
+
+func (handle *podHandle) Cleanup() {
+	err := handle.deletePod()
+	if err != nil {
+		panic(err)
+	}
+}
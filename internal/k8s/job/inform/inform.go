@@ -0,0 +1,87 @@
+package inform
+
+import (
+	"fmt"
+	"goflow/internal/k8s/job/utils"
+	"goflow/internal/k8s/pod/event/holder"
+	"goflow/internal/logs"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// JobInformer is a custom informer that reports the Jobs of dag runs in the channel holder once
+// they have finished or have been deleted
+type JobInformer struct {
+	jobInformer         cache.SharedInformer
+	channelHolder       *holder.ChannelHolder
+	stopInformerChannel chan struct{}
+}
+
+// New returns a new informer to be used in updating the channels in the holder
+func New(client kubernetes.Interface, channelHolder *holder.ChannelHolder) JobInformer {
+	factory := informers.NewSharedInformerFactory(client, 2*time.Second)
+	sharedInformer := factory.Batch().V1().Jobs().Informer()
+	jobInformer := JobInformer{sharedInformer, channelHolder, make(chan struct{})}
+	sharedInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			jobInformer.sendIfFinished(getJobFromInterface(obj))
+		},
+		UpdateFunc: func(old interface{}, new interface{}) {
+			jobInformer.sendIfFinished(getJobFromInterface(new))
+		},
+		DeleteFunc: func(obj interface{}) {
+			job, ok := obj.(*batch.Job)
+			if !ok {
+				// The final state of Jobs deleted while the informer was disconnected is unknown
+				tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown)
+				if !isTombstone {
+					panic(fmt.Sprintf("Expected %T, but got %T", &batch.Job{}, obj))
+				}
+				job = getJobFromInterface(tombstone.Obj)
+			}
+			logs.InfoLogger.Printf("Job %s was deleted\n", job.Name)
+			if jobInformer.channelHolder.Contains(job.Name) {
+				select {
+				case jobInformer.channelHolder.GetChannelGroup(job.Name).JobRemoved <- job:
+				default:
+				}
+			}
+		},
+	})
+	return jobInformer
+}
+
+// sendIfFinished sends a finished Job of a dag run to its channel group, once
+func (jobInformer *JobInformer) sendIfFinished(job *batch.Job) {
+	phase, finished := utils.FinishedPhase(job)
+	if !finished || !jobInformer.channelHolder.Contains(job.Name) {
+		return
+	}
+	select {
+	case jobInformer.channelHolder.GetChannelGroup(job.Name).JobDone <- job:
+		logs.InfoLogger.Printf("Job %s finished in phase %s\n", job.Name, phase)
+	default:
+	}
+}
+
+func getJobFromInterface(obj interface{}) *batch.Job {
+	job, ok := obj.(*batch.Job)
+	if !ok {
+		panic(fmt.Sprintf("Expected %T, but got %T", &batch.Job{}, obj))
+	}
+	return job
+}
+
+// Stop stops the running informer
+func (jobInformer *JobInformer) Stop() {
+	jobInformer.stopInformerChannel <- struct{}{}
+}
+
+// Start starts the informer
+func (jobInformer *JobInformer) Start() {
+	go jobInformer.jobInformer.Run(jobInformer.stopInformerChannel)
+}
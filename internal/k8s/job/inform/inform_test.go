@@ -0,0 +1,51 @@
+package inform
+
+import (
+	"context"
+	"goflow/internal/k8s/job/utils"
+	"goflow/internal/k8s/pod/event/holder"
+	"testing"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJobFinishedAndRemoved(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	channelHolder := holder.New()
+	jobInformer := New(client, channelHolder)
+	jobName := "test-job-informer"
+	namespace := "default"
+	jobInformer.Start()
+	defer jobInformer.Stop()
+
+	channelHolder.AddChannelGroup(jobName)
+	job := utils.CreateTestJob(client, jobName, namespace)
+	utils.SetFinished(job, batch.JobFailed)
+	_, err := client.BatchV1().Jobs(namespace).UpdateStatus(context.TODO(), job, k8sapi.UpdateOptions{})
+	if err != nil {
+		panic(err)
+	}
+	channelGroup := channelHolder.GetChannelGroup(jobName)
+	select {
+	case finishedJob := <-channelGroup.JobDone:
+		if phase, _ := utils.FinishedPhase(finishedJob); phase != core.PodFailed {
+			t.Errorf("Expected the Job to have failed, found phase %s", phase)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the finished Job to be reported")
+	}
+
+	err = client.BatchV1().Jobs(namespace).Delete(context.TODO(), jobName, k8sapi.DeleteOptions{})
+	if err != nil {
+		panic(err)
+	}
+	select {
+	case <-channelGroup.JobRemoved:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the deleted Job to be reported")
+	}
+}
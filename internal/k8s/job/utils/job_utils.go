@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+
+	podutils "goflow/internal/k8s/pod/utils"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// JobNameLabelKey is the label the Job controller sets on the pods of a Job to the Job name
+const JobNameLabelKey = "job-name"
+
+// FinishedPhase returns the phase of a finished Job, and false if the Job has not finished
+func FinishedPhase(job *batch.Job) (core.PodPhase, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != core.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batch.JobComplete:
+			return core.PodSucceeded, true
+		case batch.JobFailed:
+			return core.PodFailed, true
+		}
+	}
+	return "", false
+}
+
+// SetFinished marks the Job as finished with the given condition, as the Job controller does
+func SetFinished(job *batch.Job, conditionType batch.JobConditionType) {
+	now := k8sapi.Now()
+	job.Status.CompletionTime = &now
+	job.Status.Conditions = append(job.Status.Conditions, batch.JobCondition{
+		Type:               conditionType,
+		Status:             core.ConditionTrue,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	})
+}
+
+// CreateTestJob creates and returns a busybox Job with the given name using the client
+func CreateTestJob(client kubernetes.Interface, jobName string, namespace string) *batch.Job {
+	job, err := client.BatchV1().Jobs(namespace).Create(
+		context.TODO(),
+		&batch.Job{
+			TypeMeta: k8sapi.TypeMeta{
+				Kind:       "Job",
+				APIVersion: "batch/v1",
+			},
+			ObjectMeta: k8sapi.ObjectMeta{
+				Name:      jobName,
+				Namespace: namespace,
+				Labels:    map[string]string{podutils.AppSelectorKey: podutils.AppName},
+			},
+			Spec: batch.JobSpec{
+				Template: core.PodTemplateSpec{
+					Spec: core.PodSpec{
+						Containers: []core.Container{
+							{
+								Name:    "task",
+								Image:   "busybox",
+								Command: []string{"echo", "123 test"},
+							},
+						},
+						RestartPolicy: core.RestartPolicyNever,
+					},
+				},
+			},
+		},
+		k8sapi.CreateOptions{},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return job
+}
+
+// CreateTestJobPod creates a pod of the Job in the given phase, as the Job controller would
+func CreateTestJobPod(client kubernetes.Interface, job *batch.Job, podName string, phase core.PodPhase) *core.Pod {
+	podsClient := client.CoreV1().Pods(job.Namespace)
+	pod := podutils.CreateTestPod(&podsClient, podName, job.Namespace, phase)
+	pod.Labels[JobNameLabelKey] = job.Name
+	pod, err := podsClient.Update(context.TODO(), pod, k8sapi.UpdateOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return pod
+}
@@ -0,0 +1,200 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"goflow/internal/k8s/job/utils"
+	"goflow/internal/k8s/pod/event/holder"
+	podutils "goflow/internal/k8s/pod/utils"
+	"goflow/internal/logs"
+	"goflow/internal/logstore"
+	"io"
+	"sort"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podPollInterval is how often the pods of a Job are listed while its logs are streamed
+const podPollInterval = time.Second
+
+// logDrainTimeout is how long to wait for the log streams to end after the Job has finished
+const logDrainTimeout = 30 * time.Second
+
+// JobWatcher waits for a Job to finish and streams the logs of its pods
+type JobWatcher struct {
+	jobName        string
+	namespace      string
+	kubeClient     kubernetes.Interface
+	logWriter      io.WriteCloser
+	attemptStarted func()
+	Phase          core.PodPhase
+	informerChans  *holder.ChannelHolder
+	monitoringDone chan struct{}
+}
+
+// NewJobWatcher returns a new Job watcher
+// If logWriter is not nil, the logs of the pods of the Job are written to it one pod after the
+// other, and it is closed once monitoring is done
+func NewJobWatcher(
+	name string,
+	namespace string,
+	client kubernetes.Interface,
+	logWriter io.WriteCloser,
+	channelGroupHolder *holder.ChannelHolder,
+) *JobWatcher {
+	return &JobWatcher{
+		jobName:        name,
+		namespace:      namespace,
+		kubeClient:     client,
+		logWriter:      logWriter,
+		informerChans:  channelGroupHolder,
+		monitoringDone: make(chan struct{}, 1),
+	}
+}
+
+// SetLogWriter sets the writer that receives the pod logs, it must be called before MonitorJob
+func (jobWatcher *JobWatcher) SetLogWriter(logWriter io.WriteCloser) {
+	jobWatcher.logWriter = logWriter
+}
+
+// SetAttemptStarted sets the function called as each pod of the Job starts, it must be called before
+// MonitorJob
+func (jobWatcher *JobWatcher) SetAttemptStarted(attemptStarted func()) {
+	jobWatcher.attemptStarted = attemptStarted
+}
+
+// waitForJobDone returns when the Job has finished, a Job deleted before that is marked as failed
+func (jobWatcher *JobWatcher) waitForJobDone() {
+	channelGroup := jobWatcher.informerChans.GetChannelGroup(jobWatcher.jobName)
+	select {
+	case job := <-channelGroup.JobDone:
+		jobWatcher.Phase, _ = utils.FinishedPhase(job)
+	case <-channelGroup.JobRemoved:
+		logs.InfoLogger.Printf("Job %s was deleted before it finished\n", jobWatcher.jobName)
+		jobWatcher.Phase = core.PodFailed
+	}
+}
+
+// jobPods returns the pods of the Job in the order they were created
+func (jobWatcher *JobWatcher) jobPods() ([]core.Pod, error) {
+	podList, err := jobWatcher.kubeClient.CoreV1().Pods(jobWatcher.namespace).List(
+		context.TODO(),
+		k8sapi.ListOptions{
+			LabelSelector: podutils.LabelSelectorString(map[string]string{utils.JobNameLabelKey: jobWatcher.jobName}),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	pods := podList.Items
+	sort.Slice(pods, func(i, j int) bool {
+		if !pods[i].CreationTimestamp.Equal(&pods[j].CreationTimestamp) {
+			return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// streamPodLogs writes the logs of a pod of the Job until its container has stopped
+func (jobWatcher *JobWatcher) streamPodLogs(podName string) {
+	logger, err := jobWatcher.kubeClient.CoreV1().Pods(jobWatcher.namespace).GetLogs(
+		podName,
+		&core.PodLogOptions{Follow: true},
+	).Stream(context.Background())
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not retrieve logs for pod %s: %s\n", podName, err)
+		return
+	}
+	defer logger.Close()
+	err = logstore.ScanLines(logger, func(line string) {
+		if _, err := fmt.Fprintln(jobWatcher.logWriter, line); err != nil {
+			logs.ErrorLogger.Printf("Could not store log line for pod %s: %s\n", podName, err)
+		}
+	})
+	if err != nil {
+		logs.WarningLogger.Printf("Log stream for pod %s ended early: %s\n", podName, err)
+	}
+}
+
+func isClosed(channel <-chan struct{}) bool {
+	select {
+	case <-channel:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamLogs reports each started pod of the Job and writes its logs until jobDone is closed, then
+// closes done
+// Retries of the Job run in new pods, whose logs follow the logs of the pods before them
+func (jobWatcher *JobWatcher) streamLogs(jobDone <-chan struct{}, done chan struct{}) {
+	defer close(done)
+	if jobWatcher.logWriter == nil && jobWatcher.attemptStarted == nil {
+		return
+	}
+	if jobWatcher.logWriter != nil {
+		defer jobWatcher.logWriter.Close()
+	}
+	started := make(map[string]bool)
+	for {
+		// The pods are listed after checking the Job, so all pods of a finished Job are streamed
+		finished := isClosed(jobDone)
+		pods, err := jobWatcher.jobPods()
+		if err != nil {
+			logs.WarningLogger.Printf("Could not list the pods of job %s: %s\n", jobWatcher.jobName, err)
+		}
+		for _, pod := range pods {
+			if started[pod.Name] || pod.Status.Phase == core.PodPending || pod.Status.Phase == "" {
+				continue
+			}
+			started[pod.Name] = true
+			if jobWatcher.attemptStarted != nil {
+				jobWatcher.attemptStarted()
+			}
+			if jobWatcher.logWriter != nil {
+				jobWatcher.streamPodLogs(pod.Name)
+			}
+		}
+		if finished {
+			return
+		}
+		select {
+		case <-jobDone:
+		case <-time.After(podPollInterval):
+		}
+	}
+}
+
+// waitForLogs waits for the log streams to end, or gives up after logDrainTimeout
+func (jobWatcher *JobWatcher) waitForLogs(done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(logDrainTimeout):
+		logs.WarningLogger.Printf("Timed out waiting for logs of job %s\n", jobWatcher.jobName)
+	}
+}
+
+// MonitorJob streams the logs of the pods of the Job until the Job has finished
+func (jobWatcher *JobWatcher) MonitorJob() {
+	defer func() {
+		logs.InfoLogger.Printf("Monitoring for job %s done", jobWatcher.jobName)
+		jobWatcher.monitoringDone <- struct{}{}
+	}()
+	logs.InfoLogger.Printf("Beginning to monitor job %s\n", jobWatcher.jobName)
+	jobDone := make(chan struct{})
+	logsDone := make(chan struct{})
+	go jobWatcher.streamLogs(jobDone, logsDone)
+	jobWatcher.waitForJobDone()
+	close(jobDone)
+	jobWatcher.waitForLogs(logsDone)
+}
+
+// WaitForMonitorDone returns when the watcher is done monitoring
+func (jobWatcher *JobWatcher) WaitForMonitorDone() {
+	<-jobWatcher.monitoringDone
+}
@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"bytes"
+	"goflow/internal/k8s/job/utils"
+	"goflow/internal/k8s/pod/event/holder"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// bufferCloser is a log writer that records whether it was closed
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (writer *bufferCloser) Close() error {
+	writer.closed = true
+	return nil
+}
+
+func TestMonitorJob(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespace := "default"
+	jobName := "test-monitor-job"
+	channelHolder := holder.New()
+	channelHolder.AddChannelGroup(jobName)
+	job := utils.CreateTestJob(client, jobName, namespace)
+	utils.CreateTestJobPod(client, job, jobName+"-first", core.PodFailed)
+	utils.CreateTestJobPod(client, job, jobName+"-second", core.PodSucceeded)
+	utils.CreateTestJobPod(client, job, jobName+"-pending", core.PodPending)
+	logWriter := &bufferCloser{}
+	jobWatcher := NewJobWatcher(jobName, namespace, client, logWriter, channelHolder)
+
+	utils.SetFinished(job, batch.JobComplete)
+	channelHolder.GetChannelGroup(jobName).JobDone <- job
+	go jobWatcher.MonitorJob()
+	jobWatcher.WaitForMonitorDone()
+
+	if jobWatcher.Phase != core.PodSucceeded {
+		t.Errorf("Expected phase to be %s, not %s", core.PodSucceeded, jobWatcher.Phase)
+	}
+	// The fake clientset returns the same logs for every pod
+	if logWriter.String() != "fake logs\nfake logs\n" || !logWriter.closed {
+		t.Errorf("Expected the logs of both started pods to be written, found %q", logWriter.String())
+	}
+}
+
+func TestMonitorJobRemoved(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespace := "default"
+	jobName := "test-monitor-job-removed"
+	channelHolder := holder.New()
+	channelHolder.AddChannelGroup(jobName)
+	job := utils.CreateTestJob(client, jobName, namespace)
+	jobWatcher := NewJobWatcher(jobName, namespace, client, nil, channelHolder)
+
+	channelHolder.GetChannelGroup(jobName).JobRemoved <- job
+	go jobWatcher.MonitorJob()
+	jobWatcher.WaitForMonitorDone()
+
+	if jobWatcher.Phase != core.PodFailed {
+		t.Errorf("Expected a removed job to be marked %s, not %s", core.PodFailed, jobWatcher.Phase)
+	}
+}
@@ -1,14 +1,19 @@
 package channel
 
 import (
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 )
 
 // FuncChannelGroup holds the various states of a pod's events'
+// Runs executed as Jobs receive their Job on JobDone once it has finished, and on JobRemoved once
+// it has been deleted
 type FuncChannelGroup struct {
-	Ready  chan *core.Pod
-	Update chan *core.Pod
-	Remove chan *core.Pod
+	Ready      chan *core.Pod
+	Update     chan *core.Pod
+	Remove     chan *core.Pod
+	JobDone    chan *batch.Job
+	JobRemoved chan *batch.Job
 }
 
 // New returns a new FuncChannel struct
@@ -17,5 +22,7 @@ func New() *FuncChannelGroup {
 		make(chan *core.Pod, 1),
 		make(chan *core.Pod, 1),
 		make(chan *core.Pod, 1),
+		make(chan *batch.Job, 1),
+		make(chan *batch.Job, 1),
 	}
 }
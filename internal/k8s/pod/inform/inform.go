@@ -83,8 +83,22 @@ func New(
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			pod := getPodFromInterface(obj)
+			pod, ok := obj.(*core.Pod)
+			if !ok {
+				// The final state of pods deleted while the informer was disconnected is unknown
+				tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown)
+				if !isTombstone {
+					panic(fmt.Sprintf("Expected %T, but go %T", &core.Pod{}, obj))
+				}
+				pod = getPodFromInterface(tombstone.Obj)
+			}
 			logs.InfoLogger.Printf("Pod %s was successfully deleted\n", pod.Name)
+			if taskInformer.channelHolder.Contains(pod.Name) {
+				select {
+				case taskInformer.getChannelGroup(pod.Name).Remove <- pod:
+				default:
+				}
+			}
 		},
 	})
 	return taskInformer
@@ -17,7 +17,23 @@ const AppSelectorKey = "App"
 // AppName is the name of the application
 const AppName = "goflow"
 
-func getAppLabelSelectorString() string {
+// DAGIDLabelKey is the pod label key holding the id of the DAG that created the pod
+const DAGIDLabelKey = "DAGID"
+
+// RunIDLabelKey is the pod label key holding the id of the DAG run that created the pod
+const RunIDLabelKey = "RunID"
+
+// TaskLabelKey is the pod label key holding the name of the task run by the pod
+const TaskLabelKey = "Task"
+
+// AttemptLabelKey is the pod label key holding the attempt number of the task run by the pod
+const AttemptLabelKey = "Attempt"
+
+// InstanceLabelKey is the pod label key holding the goflow instance that watches the pod
+const InstanceLabelKey = "Instance"
+
+// AppLabelSelectorString returns the label selector matching all pods created by goflow
+func AppLabelSelectorString() string {
 	return LabelSelectorString(map[string]string{AppSelectorKey: AppName})
 }
 
@@ -44,7 +60,7 @@ func CleanUpPods(client kubernetes.Interface) {
 		podsClient := client.CoreV1().Pods(namespace)
 		podList, err := podsClient.List(
 			context.TODO(),
-			k8sapi.ListOptions{LabelSelector: getAppLabelSelectorString()},
+			k8sapi.ListOptions{LabelSelector: AppLabelSelectorString()},
 		)
 		if err != nil {
 			panic(err)
@@ -60,6 +76,31 @@ func CleanUpPods(client kubernetes.Interface) {
 	}
 }
 
+// CleanUpJobs deletes all Jobs created by goflow in all namespaces that are accessible, along with
+// their pods
+func CleanUpJobs(client kubernetes.Interface) {
+	namespaces := getNamespaces(client)
+	propagation := k8sapi.DeletePropagationBackground
+	for _, namespace := range namespaces {
+		jobsClient := client.BatchV1().Jobs(namespace)
+		jobList, err := jobsClient.List(
+			context.TODO(),
+			k8sapi.ListOptions{LabelSelector: AppLabelSelectorString()},
+		)
+		if err != nil {
+			panic(err)
+		}
+		for _, job := range jobList.Items {
+			logs.InfoLogger.Printf(
+				"Deleting job \"%s\" in namespace \"%s\"\n",
+				job.Name,
+				job.Namespace,
+			)
+			jobsClient.Delete(context.TODO(), job.Name, k8sapi.DeleteOptions{PropagationPolicy: &propagation})
+		}
+	}
+}
+
 // CleanUpServiceAccounts delete all associated application service accounts
 func CleanUpServiceAccounts(client kubernetes.Interface) {
 	namespaces := getNamespaces(client)
@@ -67,7 +108,7 @@ func CleanUpServiceAccounts(client kubernetes.Interface) {
 		serviceAccountClient := client.CoreV1().ServiceAccounts(namespace)
 		serviceAccountList, err := serviceAccountClient.List(
 			context.TODO(),
-			k8sapi.ListOptions{LabelSelector: getAppLabelSelectorString()},
+			k8sapi.ListOptions{LabelSelector: AppLabelSelectorString()},
 		)
 		if err != nil {
 			panic(err)
@@ -86,6 +127,8 @@ func CleanUpServiceAccounts(client kubernetes.Interface) {
 // CleanUpEnvironment deletes all associated application resources
 func CleanUpEnvironment(client kubernetes.Interface) {
 	logs.InfoLogger.Println("Cleaning up...")
+	// Jobs are deleted first, else they would replace their deleted pods
+	CleanUpJobs(client)
 	CleanUpPods(client)
 	CleanUpServiceAccounts(client)
 }
@@ -1,14 +1,16 @@
 package watch
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"goflow/internal/k8s/pod/event/holder"
 	"goflow/internal/logs"
+	"goflow/internal/logstore"
 	"io"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -20,37 +22,70 @@ import (
 
 // Add func Channels cache
 
+// logDrainTimeout is how long to wait for the log stream to end after the pod has finished
+const logDrainTimeout = 30 * time.Second
+
 // PodWatcher watches events and streams logs from pods while they are running
 type PodWatcher struct {
 	podName        string
 	namespace      string
 	kubeClient     kubernetes.Interface
-	Logs           chan string
-	withLogs       bool
+	logWriter      io.WriteCloser
+	attemptStarted func()
+	attempts       int
 	Phase          core.PodPhase
 	informerChans  *holder.ChannelHolder
 	monitoringDone chan struct{}
 }
 
 // NewPodWatcher returns a new pod watcher
+// If logWriter is not nil, the pod logs are written to it line by line and it is closed once
+// monitoring is done
 func NewPodWatcher(
 	name string,
 	namespace string,
 	client kubernetes.Interface,
-	withLogs bool,
+	logWriter io.WriteCloser,
 	channelGroupHolder *holder.ChannelHolder,
 ) *PodWatcher {
 	return &PodWatcher{
 		podName:        name,
 		namespace:      namespace,
 		kubeClient:     client,
-		Logs:           make(chan string, 1),
-		withLogs:       withLogs,
+		logWriter:      logWriter,
 		informerChans:  channelGroupHolder,
 		monitoringDone: make(chan struct{}, 1),
 	}
 }
 
+// SetLogWriter sets the writer that receives the pod logs, it must be called before MonitorPod
+func (podWatcher *PodWatcher) SetLogWriter(logWriter io.WriteCloser) {
+	podWatcher.logWriter = logWriter
+}
+
+// SetAttemptStarted sets the function called as each attempt of the pod starts, which is when the
+// pod starts running and whenever its containers restart, it must be called before MonitorPod
+func (podWatcher *PodWatcher) SetAttemptStarted(attemptStarted func()) {
+	podWatcher.attemptStarted = attemptStarted
+}
+
+// observeAttempts calls attemptStarted for the attempts of the pod that started since the last
+// update, pods that finished without being seen running have started one attempt
+func (podWatcher *PodWatcher) observeAttempts(pod *core.Pod) {
+	if podWatcher.attemptStarted == nil || pod.Status.Phase == core.PodPending || pod.Status.Phase == "" {
+		return
+	}
+	attempts := 1
+	for _, status := range pod.Status.ContainerStatuses {
+		if restarts := int(status.RestartCount) + 1; restarts > attempts {
+			attempts = restarts
+		}
+	}
+	for ; podWatcher.attempts < attempts; podWatcher.attempts++ {
+		podWatcher.attemptStarted()
+	}
+}
+
 // podClient returns the api endpoint for pods
 func (podWatcher *PodWatcher) podClient() v1.PodInterface {
 	return podWatcher.kubeClient.CoreV1().Pods(podWatcher.namespace)
@@ -70,15 +105,29 @@ func eventObjectToPod(result watch.Event) *core.Pod {
 	return podObject
 }
 
-// waitForPodAdded returns when the pod has been added
-func (podWatcher *PodWatcher) waitForPodAdded() {
+// waitForPodAdded returns when the pod has been added, or false if it was deleted before that
+func (podWatcher *PodWatcher) waitForPodAdded() bool {
 	logs.InfoLogger.Printf("Waiting for pod %s to be added...\n", podWatcher.podName)
 	if !podWatcher.informerChans.Contains(podWatcher.podName) {
 		logs.ErrorLogger.Printf("Channels not found for pod %s\n", podWatcher.podName)
 	}
-	pod := <-podWatcher.informerChans.GetChannelGroup(podWatcher.podName).Ready
-	podWatcher.Phase = pod.Status.Phase
-	logs.InfoLogger.Printf("Pod %s added\n", podWatcher.podName)
+	channelGroup := podWatcher.informerChans.GetChannelGroup(podWatcher.podName)
+	select {
+	case pod := <-channelGroup.Ready:
+		podWatcher.Phase = pod.Status.Phase
+		podWatcher.observeAttempts(pod)
+		logs.InfoLogger.Printf("Pod %s added\n", podWatcher.podName)
+		return true
+	case <-channelGroup.Remove:
+		podWatcher.setRemoved()
+		return false
+	}
+}
+
+// setRemoved marks a pod deleted before it finished as failed
+func (podWatcher *PodWatcher) setRemoved() {
+	logs.InfoLogger.Printf("Pod %s was deleted before it finished\n", podWatcher.podName)
+	podWatcher.Phase = core.PodFailed
 }
 
 func (podWatcher *PodWatcher) getLogStreamerWithOptions(
@@ -98,7 +147,7 @@ func (podWatcher *PodWatcher) getLogger() (io.ReadCloser, error) {
 	logs.InfoLogger.Printf("Retrieving logger for pod %s...\n", podWatcher.podName)
 	var logStreamer io.ReadCloser
 	for {
-		streamer, err := podWatcher.getLogStreamerWithOptions(&core.PodLogOptions{})
+		streamer, err := podWatcher.getLogStreamerWithOptions(&core.PodLogOptions{Follow: true})
 		logStreamer = streamer
 		if err == nil {
 			break
@@ -132,55 +181,73 @@ func (podWatcher *PodWatcher) callFuncUntilPodSucceedOrFail(callFunc func()) {
 		callFunc()
 		return
 	}
+	channelGroup := podWatcher.informerChans.GetChannelGroup(podWatcher.podName)
 	for {
 		callFunc()
 		logs.InfoLogger.Println("Waiting for pod update...")
-		pod, ok := <-podWatcher.informerChans.GetChannelGroup(podWatcher.podName).Update
-		if ok {
-			phase := pod.Status.Phase
-			logs.InfoLogger.Printf("Pod switched to phase %s\n", phase)
-			if phase == core.PodSucceeded || phase == core.PodFailed {
-				podWatcher.Phase = phase
-				break
+		select {
+		case pod, ok := <-channelGroup.Update:
+			if ok {
+				podWatcher.observeAttempts(pod)
+				phase := pod.Status.Phase
+				logs.InfoLogger.Printf("Pod switched to phase %s\n", phase)
+				if phase == core.PodSucceeded || phase == core.PodFailed {
+					podWatcher.Phase = phase
+					return
+				}
 			}
+		case <-channelGroup.Remove:
+			podWatcher.setRemoved()
+			return
 		}
 	}
 }
 
-func getStringFromLogger(
-	logger io.ReadCloser,
-	logChan chan string,
-	podName string,
-) (addedLogs bool) {
-	addedLogs = false
-	logBuffer := new(bytes.Buffer)
-	_, err := io.Copy(logBuffer, logger)
+// waitForPodDone returns when the pod has succeeded or failed
+func (podWatcher *PodWatcher) waitForPodDone() {
+	podWatcher.callFuncUntilPodSucceedOrFail(func() {})
+}
+
+// streamLogLines writes the logs line by line until the stream ends
+func streamLogLines(logger io.Reader, writer io.Writer, podName string) (lineCount int) {
+	err := logstore.ScanLines(logger, func(line string) {
+		_, err := fmt.Fprintln(writer, line)
+		if err != nil {
+			logs.ErrorLogger.Printf("Could not store log line for pod %s: %s\n", podName, err)
+			return
+		}
+		lineCount++
+	})
 	if err != nil {
-		panic(err)
-	}
-	logString := logBuffer.String()
-	if logString != "" {
-		addedLogs = true
-		logChan <- logString
+		logs.WarningLogger.Printf("Log stream for pod %s ended early: %s\n", podName, err)
 	}
 	return
 }
 
-func (podWatcher *PodWatcher) readLogsUntilSucceedOrFail(
-	logger io.ReadCloser,
-) {
+// streamLogs writes the pod logs into the log writer, then closes done
+func (podWatcher *PodWatcher) streamLogs(done chan struct{}) {
+	defer close(done)
+	if podWatcher.logWriter == nil {
+		return
+	}
+	defer podWatcher.logWriter.Close()
+	logger, err := podWatcher.getLogger()
+	if err != nil {
+		logs.ErrorLogger.Printf("Could not retrieve logs for pod %s: %s\n", podWatcher.podName, err)
+		return
+	}
 	defer logger.Close()
-	addedLogs := false
-	podWatcher.callFuncUntilPodSucceedOrFail(func() {
-		if getStringFromLogger(logger, podWatcher.Logs, podWatcher.podName) {
-			addedLogs = true
-		}
-	})
-	if !addedLogs {
-		addedLogs = getStringFromLogger(logger, podWatcher.Logs, podWatcher.podName)
-		if !addedLogs {
-			logs.InfoLogger.Printf("No logs retrieved for pod %s\n", podWatcher.podName)
-		}
+	if streamLogLines(logger, podWatcher.logWriter, podWatcher.podName) == 0 {
+		logs.InfoLogger.Printf("No logs retrieved for pod %s\n", podWatcher.podName)
+	}
+}
+
+// waitForLogs waits for the log stream to end, or gives up after logDrainTimeout
+func (podWatcher *PodWatcher) waitForLogs(done chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(logDrainTimeout):
+		logs.WarningLogger.Printf("Timed out waiting for logs of pod %s\n", podWatcher.podName)
 	}
 }
 
@@ -189,16 +256,21 @@ func (podWatcher *PodWatcher) setMonitorDone() {
 	podWatcher.monitoringDone <- struct{}{}
 }
 
-// MonitorPod collects pod logs until the pod terminates
+// MonitorPod streams pod logs until the pod terminates
 func (podWatcher *PodWatcher) MonitorPod() {
 	defer podWatcher.setMonitorDone()
 	logs.InfoLogger.Printf("Beginning to monitor pod %s\n", podWatcher.podName)
-	podWatcher.waitForPodAdded()
-	logger, err := podWatcher.getLogger()
-	if err != nil {
-		panic(err)
+	if !podWatcher.waitForPodAdded() {
+		if podWatcher.logWriter != nil {
+			podWatcher.logWriter.Close()
+		}
+		return
 	}
-	podWatcher.readLogsUntilSucceedOrFail(logger)
+	logsDone := make(chan struct{})
+	// Logs are streamed separately so pod phase updates are consumed while the pod runs
+	go podWatcher.streamLogs(logsDone)
+	podWatcher.waitForPodDone()
+	podWatcher.waitForLogs(logsDone)
 }
 
 // WaitForMonitorDone returns when the watcher is done monitoring
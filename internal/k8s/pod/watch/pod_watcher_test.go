@@ -34,7 +34,7 @@ func TestCallFuncUntilSucceedOrFail(t *testing.T) {
 			namespace := "default"
 			podName := "test-pod-succeed-or-fail"
 			holder := holder.New()
-			podWatcher := NewPodWatcher(podName, namespace, client, true, holder)
+			podWatcher := NewPodWatcher(podName, namespace, client, nil, holder)
 			podsClient, _ := testutils.GetPodClientWithTestWatcher(client, namespace)
 			testPod := podutils.CreateTestPod(podsClient, podName, namespace, "")
 			t.Log("Test pod created")
@@ -60,6 +60,24 @@ func TestCallFuncUntilSucceedOrFail(t *testing.T) {
 
 }
 
+func TestCallFuncUntilPodRemoved(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespace := "default"
+	podName := "test-pod-removed"
+	holder := holder.New()
+	podWatcher := NewPodWatcher(podName, namespace, client, nil, holder)
+	podsClient, _ := testutils.GetPodClientWithTestWatcher(client, namespace)
+	testPod := podutils.CreateTestPod(podsClient, podName, namespace, core.PodRunning)
+	holder.AddChannelGroup(podName)
+	holder.GetChannelGroup(podName).Remove <- testPod
+
+	podWatcher.callFuncUntilPodSucceedOrFail(func() {})
+
+	if podWatcher.Phase != core.PodFailed {
+		t.Errorf("Expected a removed pod to be marked %s, not %s", core.PodFailed, podWatcher.Phase)
+	}
+}
+
 func TestGetLogsAfterPodDone(t *testing.T) {
 	table := []struct {
 		finalPhase core.PodPhase
@@ -74,7 +92,7 @@ func TestGetLogsAfterPodDone(t *testing.T) {
 			namespace := "default"
 			podName := "test-pod-get-logs-after-pod-done"
 			podsClient, _ := testutils.GetPodClientWithTestWatcher(client, namespace)
-			watcher := NewPodWatcher(podName, namespace, client, true, holder.New())
+			watcher := NewPodWatcher(podName, namespace, client, nil, holder.New())
 			watcher.informerChans.AddChannelGroup(podName)
 
 			createdPod := podutils.CreateTestPod(podsClient, podName, namespace, "")
@@ -111,3 +129,85 @@ func TestGetLogsAfterPodDone(t *testing.T) {
 	}
 
 }
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (buffer *closingBuffer) Close() error {
+	buffer.closed = true
+	return nil
+}
+
+func TestMonitorPodStreamsLogs(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespace := "default"
+	podName := "test-pod-monitor-streams-logs"
+	podsClient, _ := testutils.GetPodClientWithTestWatcher(client, namespace)
+	logWriter := &closingBuffer{}
+	watcher := NewPodWatcher(podName, namespace, client, logWriter, holder.New())
+	watcher.informerChans.AddChannelGroup(podName)
+
+	createdPod := podutils.CreateTestPod(podsClient, podName, namespace, core.PodRunning)
+	watcher.informerChans.GetChannelGroup(podName).Ready <- createdPod
+	podCopy := createdPod.DeepCopy()
+	podCopy.Status.Phase = core.PodSucceeded
+	watcher.informerChans.GetChannelGroup(podName).Update <- podCopy
+
+	go watcher.MonitorPod()
+	watcher.WaitForMonitorDone()
+
+	if !logWriter.closed {
+		t.Error("Log writer should be closed once monitoring is done")
+	}
+	loggedText := strings.TrimSpace(logWriter.String())
+	if loggedText != "123 test" && loggedText != "fake logs" {
+		t.Errorf("Expected pod logs to be written, found %q", loggedText)
+	}
+}
+
+func TestStreamLogLines(t *testing.T) {
+	writer := new(bytes.Buffer)
+	lineCount := streamLogLines(strings.NewReader("one\ntwo\nthree"), writer, "test")
+	if lineCount != 3 {
+		t.Errorf("Expected 3 lines, found %d", lineCount)
+	}
+	if writer.String() != "one\ntwo\nthree\n" {
+		t.Errorf("Unexpected streamed logs %q", writer.String())
+	}
+}
+
+func TestCallFuncReportsAttempts(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	namespace := "default"
+	podName := "test-pod-attempts"
+	holder := holder.New()
+	podWatcher := NewPodWatcher(podName, namespace, client, nil, holder)
+	attempts := 0
+	podWatcher.SetAttemptStarted(func() { attempts++ })
+	podsClient, _ := testutils.GetPodClientWithTestWatcher(client, namespace)
+	testPod := podutils.CreateTestPod(podsClient, podName, namespace, core.PodPending)
+	holder.AddChannelGroup(podName)
+	go func() {
+		for _, restarts := range []int32{0, 0, 1, 2} {
+			updatedPod := testPod.DeepCopy()
+			updatedPod.Status.Phase = core.PodRunning
+			updatedPod.Status.ContainerStatuses = []core.ContainerStatus{{Name: podName, RestartCount: restarts}}
+			holder.GetChannelGroup(podName).Update <- updatedPod
+		}
+		failedPod := testPod.DeepCopy()
+		failedPod.Status.Phase = core.PodFailed
+		failedPod.Status.ContainerStatuses = []core.ContainerStatus{{Name: podName, RestartCount: 2}}
+		holder.GetChannelGroup(podName).Update <- failedPod
+	}()
+
+	podWatcher.callFuncUntilPodSucceedOrFail(func() {})
+
+	if podWatcher.Phase != core.PodFailed {
+		t.Errorf("Expected phase to be %s, not %s", core.PodFailed, podWatcher.Phase)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected each restart of the pod to be reported as an attempt, found %d attempts", attempts)
+	}
+}
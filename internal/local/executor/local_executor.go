@@ -0,0 +1,233 @@
+package executor
+
+import (
+	"fmt"
+	"goflow/internal/executor"
+	"goflow/internal/local/process"
+	"goflow/internal/local/procstat"
+	"goflow/internal/logs"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// LocalProcess describes the process that a local run starts
+type LocalProcess struct {
+	k8sapi.TypeMeta `json:",inline"`
+	Name            string
+	Args            []string
+	Env             []string
+	TimeLimit       *int64
+}
+
+// DeepCopyObject returns a copy of the process description
+func (localProcess *LocalProcess) DeepCopyObject() runtime.Object {
+	processCopy := *localProcess
+	processCopy.Args = append([]string(nil), localProcess.Args...)
+	processCopy.Env = append([]string(nil), localProcess.Env...)
+	if localProcess.TimeLimit != nil {
+		timeLimit := *localProcess.TimeLimit
+		processCopy.TimeLimit = &timeLimit
+	}
+	return &processCopy
+}
+
+// LocalExecutor runs each DAG run as a process on the goflow host, or in a container when the
+// DAG has a container runtime that is available
+// Failed attempts are retried when the retry policy is OnFailure, the time limit applies to each
+// attempt
+type LocalExecutor struct{}
+
+// New returns a new LocalExecutor
+func New() *LocalExecutor {
+	return &LocalExecutor{}
+}
+
+// containerRuntime returns the container runtime to run the image with, empty to run the
+// command on the host
+func containerRuntime(spec executor.Spec) string {
+	runtime := spec.Config.ContainerRuntime
+	if runtime == "" {
+		return ""
+	}
+	if _, err := exec.LookPath(runtime); err != nil {
+		logs.WarningLogger.Printf(
+			"Container runtime %s is not available, run %s runs on the host: %s",
+			runtime,
+			spec.Name,
+			err,
+		)
+		return ""
+	}
+	return runtime
+}
+
+func env(spec executor.Spec) []string {
+	env := make([]string, 0, len(spec.Config.Env))
+	for _, variable := range spec.Env() {
+		env = append(env, variable.Name+"="+variable.Value)
+	}
+	return env
+}
+
+func timeLimit(spec executor.Spec) time.Duration {
+	if spec.Config.TimeLimit == nil {
+		return 0
+	}
+	return time.Duration(*spec.Config.TimeLimit) * time.Second
+}
+
+func newProcess(spec executor.Spec, output io.Writer) *process.Process {
+	if runtime := containerRuntime(spec); runtime != "" {
+		return process.NewContainer(
+			runtime,
+			spec.Name,
+			spec.Config.DockerImage,
+			spec.Config.Command,
+			env(spec),
+			spec.Config.Resources,
+			output,
+			timeLimit(spec),
+		)
+	}
+	return process.New(spec.Name, spec.Config.Command, env(spec), output, timeLimit(spec))
+}
+
+// Render returns the description of the process of the run
+func (localExecutor *LocalExecutor) Render(spec executor.Spec) runtime.Object {
+	return &LocalProcess{
+		TypeMeta:  k8sapi.TypeMeta{Kind: "LocalProcess", APIVersion: "goflow/v1"},
+		Name:      spec.Name,
+		Args:      newProcess(spec, nil).Args(),
+		Env:       env(spec),
+		TimeLimit: spec.Config.TimeLimit,
+	}
+}
+
+// Submit checks that the command of the run can be found, the process starts once the run is
+// watched
+func (localExecutor *LocalExecutor) Submit(spec executor.Spec) (executor.RunHandle, error) {
+	args := newProcess(spec, nil).Args()
+	if len(args) == 0 {
+		return nil, fmt.Errorf("run %s has no command", spec.Name)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+	return &localHandle{spec: spec, lock: &sync.Mutex{}}, nil
+}
+
+// localHandle controls the processes of the attempts of a run
+type localHandle struct {
+	spec      executor.Spec
+	output    io.WriteCloser
+	lock      *sync.Mutex
+	process   *process.Process
+	attempt   int
+	cancelled bool
+}
+
+func (handle *localHandle) StreamLogs(writer io.WriteCloser) {
+	handle.output = writer
+}
+
+// startAttempt starts a new attempt of the run unless it has been cancelled
+func (handle *localHandle) startAttempt() error {
+	handle.lock.Lock()
+	defer handle.lock.Unlock()
+	if handle.cancelled {
+		return fmt.Errorf("run %s was cancelled", handle.spec.Name)
+	}
+	var output io.Writer
+	if handle.output != nil {
+		output = handle.output
+	}
+	attempt := newProcess(handle.spec, output)
+	logs.InfoLogger.Printf("Starting process %v for run %s...", attempt.Args(), handle.spec.Name)
+	err := attempt.Start()
+	if err != nil {
+		return err
+	}
+	handle.process = attempt
+	handle.attempt++
+	return nil
+}
+
+func (handle *localHandle) Watch() <-chan core.PodPhase {
+	phases := make(chan core.PodPhase, 1)
+	go handle.monitor(phases)
+	return phases
+}
+
+// monitor runs the attempts of the run and sends its phases
+func (handle *localHandle) monitor(phases chan core.PodPhase) {
+	defer close(phases)
+	if handle.output != nil {
+		defer handle.output.Close()
+	}
+	config := handle.spec.Config
+	for {
+		err := handle.startAttempt()
+		if err != nil {
+			logs.ErrorLogger.Printf("Could not start an attempt of run %s: %s", handle.spec.Name, err)
+			phases <- core.PodFailed
+			return
+		}
+		phases <- core.PodRunning
+		handle.lock.Lock()
+		attempt, attemptCount := handle.process, handle.attempt
+		handle.lock.Unlock()
+		result := attempt.Wait()
+		logs.InfoLogger.Printf(
+			"Attempt %d of run %s exited with code %d, timed out: %v",
+			attemptCount,
+			handle.spec.Name,
+			result.ExitCode,
+			result.TimedOut,
+		)
+		if result.Succeeded() {
+			phases <- core.PodSucceeded
+			return
+		}
+		retry := config.RetryPolicy == core.RestartPolicyOnFailure &&
+			!result.TimedOut &&
+			!result.Killed &&
+			attemptCount <= int(config.Retries)
+		if !retry {
+			phases <- core.PodFailed
+			return
+		}
+	}
+}
+
+// Cancel kills the process of the current attempt and prevents further attempts
+func (handle *localHandle) Cancel() error {
+	handle.lock.Lock()
+	handle.cancelled = true
+	attempt := handle.process
+	handle.lock.Unlock()
+	if attempt != nil {
+		attempt.Kill()
+	}
+	return nil
+}
+
+// Cleanup has nothing to remove, containers are removed by the runtime once they exit
+func (handle *localHandle) Cleanup() {}
+
+// Usage returns the last sampled usage of the current attempt and its number
+func (handle *localHandle) Usage() (procstat.Usage, int, bool) {
+	handle.lock.Lock()
+	attempt, attemptCount := handle.process, handle.attempt
+	handle.lock.Unlock()
+	if attempt == nil || attempt.Exited() {
+		return procstat.Usage{}, 0, false
+	}
+	usage, ok := attempt.Usage()
+	return usage, attemptCount, ok
+}
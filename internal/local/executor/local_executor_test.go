@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"bytes"
+	"goflow/internal/executor"
+	"goflow/internal/executor/conformance"
+	"strings"
+	"testing"
+	"time"
+
+	dagconfig "goflow/internal/dag/config"
+
+	core "k8s.io/api/core/v1"
+)
+
+// bufferCloser is a log writer that ignores being closed
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (buffer *bufferCloser) Close() error {
+	return nil
+}
+
+func getTestSpec(name string, command ...string) executor.Spec {
+	return executor.Spec{
+		Name:          name,
+		Attempt:       1,
+		ExecutionDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Config: &dagconfig.DAGConfig{
+			Name:        name,
+			RetryPolicy: core.RestartPolicyNever,
+			Retries:     2,
+			Command:     command,
+			Env:         map[string]string{"GREETING": "hello"},
+		},
+	}
+}
+
+// runToEnd runs the spec and returns its phases and output
+func runToEnd(t *testing.T, spec executor.Spec) ([]core.PodPhase, string) {
+	handle, err := New().Submit(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Cleanup()
+	output := &bufferCloser{}
+	handle.StreamLogs(output)
+	phases := make([]core.PodPhase, 0)
+	for phase := range handle.Watch() {
+		phases = append(phases, phase)
+	}
+	return phases, output.String()
+}
+
+func TestLocalExecutorConformance(t *testing.T) {
+	conformance.Run(t, conformance.Harness{Executor: New()})
+}
+
+func TestLocalRuns(t *testing.T) {
+	timeLimit := int64(1)
+	tables := []struct {
+		name           string
+		command        []string
+		retryPolicy    core.RestartPolicy
+		timeLimit      *int64
+		expectedPhase  core.PodPhase
+		expectedOutput string
+	}{
+		{"succeeded", []string{"sh", "-c", "echo $GREETING"}, core.RestartPolicyNever, nil, core.PodSucceeded, "hello\n"},
+		{"failed", []string{"sh", "-c", "echo oops >&2; exit 2"}, core.RestartPolicyNever, nil, core.PodFailed, "oops\n"},
+		{"retried", []string{"sh", "-c", "echo try; exit 1"}, core.RestartPolicyOnFailure, nil, core.PodFailed, "try\ntry\ntry\n"},
+		{"timed-out", []string{"sleep", "10"}, core.RestartPolicyOnFailure, &timeLimit, core.PodFailed, ""},
+	}
+	for _, table := range tables {
+		spec := getTestSpec("test-local-"+table.name, table.command...)
+		spec.Config.RetryPolicy = table.retryPolicy
+		spec.Config.TimeLimit = table.timeLimit
+		phases, output := runToEnd(t, spec)
+		if phases[len(phases)-1] != table.expectedPhase {
+			t.Errorf("Expected %s run to be %s, found %v", table.name, table.expectedPhase, phases)
+		}
+		if output != table.expectedOutput {
+			t.Errorf("Expected %s run to output %q, found %q", table.name, table.expectedOutput, output)
+		}
+	}
+}
+
+func TestLocalUsage(t *testing.T) {
+	handle, err := New().Submit(getTestSpec("test-local-usage", "sleep", "10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := handle.Watch()
+	reporter := handle.(executor.UsageReporter)
+	for _, _, sampled := reporter.Usage(); !sampled; _, _, sampled = reporter.Usage() {
+		time.Sleep(time.Millisecond)
+	}
+	usage, attempt, _ := reporter.Usage()
+	if usage.Memory <= 0 || attempt != 1 {
+		t.Errorf("Expected the usage of the first attempt, found %v for attempt %d", usage, attempt)
+	}
+	handle.Cancel()
+	for range phases {
+	}
+	if _, _, sampled := reporter.Usage(); sampled {
+		t.Error("Expected no usage once the run has stopped")
+	}
+}
+
+func TestLocalSubmitMissingCommand(t *testing.T) {
+	_, err := New().Submit(getTestSpec("test-local-missing", "goflow-command-that-does-not-exist"))
+	if err == nil {
+		t.Error("Expected an error for a command that does not exist")
+	}
+}
+
+func TestRenderLocal(t *testing.T) {
+	spec := getTestSpec("test-render-local", "echo", "hi")
+	spec.Config.ContainerRuntime = "goflow-runtime-that-does-not-exist"
+	localProcess := New().Render(spec).(*LocalProcess)
+	// Without the runtime the command runs on the host
+	if strings.Join(localProcess.Args, " ") != "echo hi" || localProcess.Kind != "LocalProcess" {
+		t.Errorf("Expected the host command of the DAG, found %v", localProcess)
+	}
+	if strings.Join(localProcess.Env, ",") != "GREETING=hello" {
+		t.Errorf("Expected the environment of the DAG, found %v", localProcess.Env)
+	}
+}
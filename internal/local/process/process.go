@@ -0,0 +1,245 @@
+package process
+
+import (
+	"fmt"
+	"goflow/internal/local/procstat"
+	"goflow/internal/logs"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+// sampleInterval is how often the resource usage of a running process is read
+var sampleInterval = 1 * time.Second
+
+// Result is the outcome of a finished process
+// ExitCode is -1 if the process was stopped by a signal
+type Result struct {
+	ExitCode int
+	TimedOut bool
+	Killed   bool
+	Usage    procstat.Usage
+}
+
+// Succeeded returns true if the process exited with code 0 on its own
+func (result Result) Succeeded() bool {
+	return result.ExitCode == 0 && !result.TimedOut && !result.Killed
+}
+
+// Process runs a command on the host, or in a container when it has a container runtime
+type Process struct {
+	name      string
+	runtime   string
+	args      []string
+	env       []string
+	output    io.Writer
+	timeLimit time.Duration
+	cmd       *exec.Cmd
+	lock      *sync.Mutex
+	usage     procstat.Usage
+	sampled   bool
+	timedOut  bool
+	killed    bool
+	result    Result
+	done      chan struct{}
+}
+
+// New returns a process running command on the host with env added to the environment of goflow
+// Output is written to output, which may be nil, and the process is killed after timeLimit
+// unless it is 0
+func New(name string, command []string, env []string, output io.Writer, timeLimit time.Duration) *Process {
+	return &Process{
+		name:      name,
+		args:      command,
+		env:       append(os.Environ(), env...),
+		output:    output,
+		timeLimit: timeLimit,
+		lock:      &sync.Mutex{},
+		done:      make(chan struct{}),
+	}
+}
+
+// NewContainer returns a process running command in a container of image named name, using
+// runtime, such as docker or podman
+func NewContainer(
+	runtime string,
+	name string,
+	image string,
+	command []string,
+	env []string,
+	resources core.ResourceRequirements,
+	output io.Writer,
+	timeLimit time.Duration,
+) *Process {
+	process := New(name, ContainerArgs(runtime, name, image, command, env, resources), nil, output, timeLimit)
+	process.runtime = runtime
+	return process
+}
+
+// ContainerArgs returns the command line that runs command in a container, the limits of
+// resources are passed on to the runtime
+func ContainerArgs(
+	runtime string,
+	name string,
+	image string,
+	command []string,
+	env []string,
+	resources core.ResourceRequirements,
+) []string {
+	args := []string{runtime, "run", "--rm", "--name", name}
+	for _, variable := range env {
+		args = append(args, "--env", variable)
+	}
+	if cpu, ok := resources.Limits[core.ResourceCPU]; ok {
+		args = append(args, "--cpus", strconv.FormatFloat(float64(cpu.MilliValue())/1000, 'f', -1, 64))
+	}
+	if memory, ok := resources.Limits[core.ResourceMemory]; ok {
+		args = append(args, "--memory", strconv.FormatInt(memory.Value(), 10))
+	}
+	args = append(args, image)
+	return append(args, command...)
+}
+
+// Args returns the command line of the process
+func (process *Process) Args() []string {
+	return process.args
+}
+
+// Start starts the process and monitors it until it exits
+func (process *Process) Start() error {
+	if len(process.args) == 0 {
+		return fmt.Errorf("process %s has no command", process.name)
+	}
+	cmd := exec.Command(process.args[0], process.args[1:]...)
+	cmd.Env = process.env
+	if process.output != nil {
+		// Both streams share the writer, exec writes to it from one goroutine at a time
+		cmd.Stdout = process.output
+		cmd.Stderr = process.output
+	}
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	process.lock.Lock()
+	process.cmd = cmd
+	process.lock.Unlock()
+	go process.monitor()
+	return nil
+}
+
+// monitor samples the usage of the process until it exits, killing it once its time limit
+// has passed
+func (process *Process) monitor() {
+	defer close(process.done)
+	exited := make(chan error, 1)
+	go func() { exited <- process.cmd.Wait() }()
+	var timeLimitPassed <-chan time.Time
+	if process.timeLimit > 0 {
+		timer := time.NewTimer(process.timeLimit)
+		defer timer.Stop()
+		timeLimitPassed = timer.C
+	}
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	process.sample()
+	for {
+		select {
+		case <-exited:
+			process.finish()
+			return
+		case <-timeLimitPassed:
+			logs.WarningLogger.Printf("Process %s exceeded its time limit of %s", process.name, process.timeLimit)
+			process.lock.Lock()
+			process.timedOut = true
+			process.lock.Unlock()
+			process.stop()
+		case <-ticker.C:
+			process.sample()
+		}
+	}
+}
+
+// sample reads the usage of the running process, exited processes keep their last sample
+func (process *Process) sample() {
+	usage, err := procstat.Read(process.cmd.Process.Pid)
+	if err != nil || usage.Memory == 0 {
+		return
+	}
+	process.lock.Lock()
+	process.usage = usage
+	process.sampled = true
+	process.lock.Unlock()
+}
+
+func (process *Process) finish() {
+	state := process.cmd.ProcessState
+	process.lock.Lock()
+	defer process.lock.Unlock()
+	usage := process.usage
+	// The kernel accounts for the whole lifetime of the process, unlike the last sample
+	usage.CPU = int64(state.UserTime() + state.SystemTime())
+	process.result = Result{
+		ExitCode: state.ExitCode(),
+		TimedOut: process.timedOut,
+		Killed:   process.killed,
+		Usage:    usage,
+	}
+}
+
+// stop kills the process, removing its container if it has one
+func (process *Process) stop() {
+	if process.runtime != "" {
+		// Killing the runtime client would leave the container running
+		err := exec.Command(process.runtime, "rm", "--force", process.name).Run()
+		if err != nil {
+			logs.WarningLogger.Printf("Could not remove container %s: %s", process.name, err)
+		}
+	}
+	err := process.cmd.Process.Kill()
+	if err != nil && !process.Exited() {
+		logs.WarningLogger.Printf("Could not kill process %s: %s", process.name, err)
+	}
+}
+
+// Kill stops the process if it has started and not exited yet
+func (process *Process) Kill() {
+	process.lock.Lock()
+	started := process.cmd != nil
+	process.killed = started
+	process.lock.Unlock()
+	if !started || process.Exited() {
+		return
+	}
+	process.stop()
+}
+
+// Exited returns true once the process has exited and its result is available
+func (process *Process) Exited() bool {
+	select {
+	case <-process.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait returns the result of the process once it has exited
+func (process *Process) Wait() Result {
+	<-process.done
+	process.lock.Lock()
+	defer process.lock.Unlock()
+	return process.result
+}
+
+// Usage returns the last sampled usage of the process, false if it has not been sampled yet
+func (process *Process) Usage() (procstat.Usage, bool) {
+	process.lock.Lock()
+	defer process.lock.Unlock()
+	return process.usage, process.sampled
+}
@@ -0,0 +1,86 @@
+package process
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMain(m *testing.M) {
+	sampleInterval = 10 * time.Millisecond
+	m.Run()
+}
+
+func TestProcessOutputAndExitCode(t *testing.T) {
+	output := &bytes.Buffer{}
+	process := New("test-exit", []string{"sh", "-c", "echo $GREETING; echo oops >&2; exit 3"}, []string{"GREETING=hello"}, output, 0)
+	err := process.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := process.Wait()
+	if result.ExitCode != 3 || result.Succeeded() {
+		t.Errorf("Expected exit code 3, found %v", result)
+	}
+	if output.String() != "hello\noops\n" {
+		t.Errorf("Expected both output streams, found %q", output.String())
+	}
+}
+
+func TestProcessTimeLimit(t *testing.T) {
+	process := New("test-time-limit", []string{"sleep", "10"}, nil, nil, 50*time.Millisecond)
+	err := process.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := process.Wait()
+	if !result.TimedOut || result.Succeeded() {
+		t.Errorf("Expected the process to time out, found %v", result)
+	}
+}
+
+func TestProcessKillAndUsage(t *testing.T) {
+	process := New("test-kill", []string{"sleep", "10"}, nil, nil, 0)
+	process.Kill()
+	err := process.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sampled := process.Usage(); !sampled; _, sampled = process.Usage() {
+		time.Sleep(time.Millisecond)
+	}
+	usage, _ := process.Usage()
+	if usage.Memory <= 0 {
+		t.Errorf("Expected the resident memory of the process, found %v", usage)
+	}
+	process.Kill()
+	result := process.Wait()
+	if !result.Killed || result.ExitCode != -1 {
+		t.Errorf("Expected the process to be killed, found %v", result)
+	}
+}
+
+func TestProcessStartError(t *testing.T) {
+	process := New("test-missing", []string{"goflow-command-that-does-not-exist"}, nil, nil, 0)
+	if process.Start() == nil {
+		t.Error("Expected an error for a command that does not exist")
+	}
+}
+
+func TestContainerArgs(t *testing.T) {
+	resources := core.ResourceRequirements{
+		Limits: core.ResourceList{
+			core.ResourceCPU:    resource.MustParse("500m"),
+			core.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	args := ContainerArgs("docker", "run-1", "busybox", []string{"echo", "hi"}, []string{"A=1"}, resources)
+	expected := "docker run --rm --name run-1 --env A=1 --cpus 0.5 --memory 67108864 busybox echo hi"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("Expected %q, found %q", expected, strings.Join(args, " "))
+	}
+}
@@ -0,0 +1,85 @@
+package procstat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procRoot is where the proc filesystem is mounted
+const procRoot = "/proc"
+
+// clockTicksPerSecond is the USER_HZ that the kernel reports process times in
+const clockTicksPerSecond = 100
+
+// Usage is the resource usage of a process, memory in bytes and cpu time in nanoseconds
+type Usage struct {
+	Memory int64
+	CPU    int64
+}
+
+// Read returns the current usage of the process with the given pid
+// CPU time includes the children the process has waited for
+func Read(pid int) (Usage, error) {
+	cpu, err := readCPU(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+	memory, err := readMemory(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Memory: memory, CPU: cpu}, nil
+}
+
+// readCPU sums the user and system time of the process and its waited for children
+func readCPU(pid int) (int64, error) {
+	stat, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces and parentheses, the fields start after the last one
+	end := strings.LastIndexByte(string(stat), ')')
+	if end == -1 {
+		return 0, fmt.Errorf("stat of process %d is malformed", pid)
+	}
+	// Fields are counted from the state, the third field of the file
+	fields := strings.Fields(string(stat)[end+1:])
+	if len(fields) < 15 {
+		return 0, fmt.Errorf("stat of process %d is malformed", pid)
+	}
+	ticks := int64(0)
+	// utime, stime, cutime and cstime are fields 14 to 17
+	for _, field := range fields[11:15] {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("stat of process %d is malformed: %s", pid, err)
+		}
+		ticks += value
+	}
+	return ticks * int64(time.Second) / clockTicksPerSecond, nil
+}
+
+// readMemory returns the resident set size of the process
+func readMemory(pid int) (int64, error) {
+	status, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "VmRSS:" {
+			continue
+		}
+		kilobytes, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("status of process %d is malformed: %s", pid, err)
+		}
+		return kilobytes * 1024, nil
+	}
+	// Zombie and kernel processes have no resident memory
+	return 0, nil
+}
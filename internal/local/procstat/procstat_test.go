@@ -0,0 +1,23 @@
+package procstat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	for i := 0; i < 1000000; i++ {
+		_ = make([]byte, 64)
+	}
+	usage, err := Read(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Memory <= 0 || usage.CPU < 0 {
+		t.Errorf("Expected the usage of the test process, found %v", usage)
+	}
+	_, err = Read(-1)
+	if err == nil {
+		t.Error("Expected an error for a process that does not exist")
+	}
+}
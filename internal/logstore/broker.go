@@ -0,0 +1,221 @@
+package logstore
+
+import (
+	"bytes"
+	"context"
+	"goflow/internal/logs"
+	"io"
+	"sync"
+)
+
+// subscriberBuffer is how many lines a subscriber can fall behind before it is dropped
+const subscriberBuffer = 1024
+
+// Line is a single log line along with its position in the log of an attempt
+type Line struct {
+	Number int
+	Text   string
+}
+
+// topic holds the live subscribers for the logs of a single attempt
+type topic struct {
+	subscribers map[*Subscription]struct{}
+	nextLine    int
+}
+
+// Broker is a Store that also fans out newly written log lines to live subscribers
+type Broker struct {
+	Store
+	lock   *sync.Mutex
+	topics map[Key]*topic
+}
+
+// NewBroker returns a broker storing logs in the given store
+func NewBroker(store Store) *Broker {
+	return &Broker{store, &sync.Mutex{}, make(map[Key]*topic)}
+}
+
+// storedLineCount returns the number of lines already stored for the key
+func (broker *Broker) storedLineCount(key Key) int {
+	lines, err := broker.Store.Read(key, ReadOptions{})
+	if err != nil {
+		return 0
+	}
+	return len(lines)
+}
+
+// NewWriter returns a writer that stores lines and publishes them to the subscribers of the key
+func (broker *Broker) NewWriter(key Key) (io.WriteCloser, error) {
+	writer, err := broker.Store.NewWriter(key)
+	if err != nil {
+		return nil, err
+	}
+	lineCount := broker.storedLineCount(key)
+	broker.lock.Lock()
+	broker.topics[key] = &topic{make(map[*Subscription]struct{}), lineCount}
+	broker.lock.Unlock()
+	return &broadcastWriter{writer, broker, key, make([]byte, 0)}, nil
+}
+
+// publish sends a line to all subscribers of the key, dropping subscribers that fell behind
+func (broker *Broker) publish(key Key, text string) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	currentTopic, ok := broker.topics[key]
+	if !ok {
+		return
+	}
+	line := Line{currentTopic.nextLine, text}
+	currentTopic.nextLine++
+	for subscriber := range currentTopic.subscribers {
+		select {
+		case subscriber.lines <- line:
+		default:
+			logs.WarningLogger.Printf("Dropping slow log subscriber for %s", key)
+			delete(currentTopic.subscribers, subscriber)
+			subscriber.dropped = true
+			close(subscriber.lines)
+		}
+	}
+}
+
+// closeTopic ends the live stream for the key
+func (broker *Broker) closeTopic(key Key) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	currentTopic, ok := broker.topics[key]
+	if !ok {
+		return
+	}
+	for subscriber := range currentTopic.subscribers {
+		close(subscriber.lines)
+	}
+	delete(broker.topics, key)
+}
+
+// IsLive returns true if logs are currently being written for the key
+func (broker *Broker) IsLive(key Key) bool {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	_, ok := broker.topics[key]
+	return ok
+}
+
+// Subscription holds the stored backlog of a log and, when following, its live lines
+type Subscription struct {
+	Backlog  []Line
+	lines    chan Line
+	nextLine int
+	dropped  bool
+	cancel   func()
+}
+
+// Follow returns the stored lines selected by options, and if follow is true and the logs are
+// still being written, subscribes to the lines written after them
+func (broker *Broker) Follow(key Key, options ReadOptions, follow bool) (*Subscription, error) {
+	subscription := &Subscription{cancel: func() {}}
+	broker.lock.Lock()
+	currentTopic, live := broker.topics[key]
+	if follow && live {
+		subscription.lines = make(chan Line, subscriberBuffer)
+		currentTopic.subscribers[subscription] = struct{}{}
+		subscription.cancel = func() { broker.unsubscribe(key, subscription) }
+	}
+	broker.lock.Unlock()
+
+	lines, err := broker.Store.Read(key, ReadOptions{})
+	if err != nil {
+		subscription.Cancel()
+		return nil, err
+	}
+	selected := options.apply(lines)
+	firstLine := len(lines) - len(selected)
+	if options.Tail == 0 {
+		firstLine = options.Offset
+	}
+	subscription.Backlog = make([]Line, 0, len(selected))
+	for i, text := range selected {
+		subscription.Backlog = append(subscription.Backlog, Line{firstLine + i, text})
+	}
+	subscription.nextLine = len(lines)
+	return subscription, nil
+}
+
+func (broker *Broker) unsubscribe(key Key, subscriber *Subscription) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	currentTopic, ok := broker.topics[key]
+	if !ok {
+		return
+	}
+	if _, ok := currentTopic.subscribers[subscriber]; ok {
+		delete(currentTopic.subscribers, subscriber)
+		close(subscriber.lines)
+	}
+}
+
+// Next returns the next live line after the backlog, ok is false once the logs are complete,
+// the subscriber fell behind, which Dropped then reports, or the context is done
+func (subscription *Subscription) Next(ctx context.Context) (line Line, ok bool) {
+	if subscription.lines == nil {
+		return Line{}, false
+	}
+	for {
+		select {
+		case line, ok = <-subscription.lines:
+			if !ok {
+				return Line{}, false
+			}
+			// Lines stored before the backlog was read may also be published
+			if line.Number < subscription.nextLine {
+				continue
+			}
+			subscription.nextLine = line.Number + 1
+			return line, true
+		case <-ctx.Done():
+			return Line{}, false
+		}
+	}
+}
+
+// Dropped returns true if the subscription stopped receiving live lines because it fell behind,
+// after Next returned ok false, in which case the logs may not be complete
+func (subscription *Subscription) Dropped() bool {
+	return subscription.dropped
+}
+
+// Cancel stops receiving live lines
+func (subscription *Subscription) Cancel() {
+	subscription.cancel()
+}
+
+// broadcastWriter stores written lines and publishes every complete line to the broker
+type broadcastWriter struct {
+	io.WriteCloser
+	broker  *Broker
+	key     Key
+	partial []byte
+}
+
+func (writer *broadcastWriter) Write(data []byte) (int, error) {
+	written, err := writer.WriteCloser.Write(data)
+	writer.partial = append(writer.partial, data[:written]...)
+	for {
+		newline := bytes.IndexByte(writer.partial, '\n')
+		if newline < 0 {
+			break
+		}
+		writer.broker.publish(writer.key, string(writer.partial[:newline]))
+		writer.partial = writer.partial[newline+1:]
+	}
+	return written, err
+}
+
+// Close closes the stored log and ends the live stream
+func (writer *broadcastWriter) Close() error {
+	if len(writer.partial) > 0 {
+		writer.broker.publish(writer.key, string(writer.partial))
+	}
+	writer.broker.closeTopic(writer.key)
+	return writer.WriteCloser.Close()
+}
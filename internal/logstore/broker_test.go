@@ -0,0 +1,129 @@
+package logstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFollowSkipsBacklogLines(t *testing.T) {
+	broker := NewBroker(store)
+	key := Key{"test-dag", "broker-run", 1}
+	writer, err := broker.NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(writer, "one")
+	fmt.Fprintln(writer, "two")
+	if !broker.IsLive(key) {
+		t.Errorf("Expected logs for %s to be live", key)
+	}
+
+	subscription, err := broker.Follow(key, ReadOptions{Tail: 1}, true)
+	if err != nil {
+		panic(err)
+	}
+	defer subscription.Cancel()
+	if expected := []Line{{1, "two"}}; !reflect.DeepEqual(subscription.Backlog, expected) {
+		t.Errorf("Expected backlog %v, found %v", expected, subscription.Backlog)
+	}
+	// Simulate a stored line being published after the backlog was read
+	subscription.lines <- Line{1, "two"}
+	fmt.Fprint(writer, "three\nfour")
+	writer.Close()
+
+	received := make([]Line, 0)
+	for {
+		line, ok := subscription.Next(context.Background())
+		if !ok {
+			break
+		}
+		received = append(received, line)
+	}
+	if expected := []Line{{2, "three"}, {3, "four"}}; !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected live lines %v, found %v", expected, received)
+	}
+	if broker.IsLive(key) {
+		t.Errorf("Expected logs for %s to have ended", key)
+	}
+}
+
+func TestFollowFansOut(t *testing.T) {
+	broker := NewBroker(store)
+	key := Key{"test-dag", "fan-out-run", 1}
+	writer, err := broker.NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	subscriptions := make([]*Subscription, 3)
+	for i := range subscriptions {
+		subscriptions[i], err = broker.Follow(key, ReadOptions{}, true)
+		if err != nil {
+			panic(err)
+		}
+	}
+	subscriptions[2].Cancel()
+	fmt.Fprintln(writer, "shared")
+	writer.Close()
+	for i, subscription := range subscriptions[:2] {
+		line, ok := subscription.Next(context.Background())
+		if !ok || line != (Line{0, "shared"}) {
+			t.Errorf("Expected subscriber %d to receive the line, found %v", i, line)
+		}
+	}
+	if _, ok := subscriptions[2].Next(context.Background()); ok {
+		t.Errorf("Expected cancelled subscriber to receive no lines")
+	}
+}
+
+func TestFollowFinishedLogs(t *testing.T) {
+	broker := NewBroker(store)
+	key := Key{"test-dag", "finished-run", 1}
+	writeLines(key, "done")
+	subscription, err := broker.Follow(key, ReadOptions{}, true)
+	if err != nil {
+		panic(err)
+	}
+	if expected := []Line{{0, "done"}}; !reflect.DeepEqual(subscription.Backlog, expected) {
+		t.Errorf("Expected backlog %v, found %v", expected, subscription.Backlog)
+	}
+	if _, ok := subscription.Next(context.Background()); ok {
+		t.Errorf("Expected no live lines for finished logs")
+	}
+	_, err = broker.Follow(Key{"test-dag", "missing-run", 1}, ReadOptions{}, true)
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, found %v", err)
+	}
+}
+
+func TestFollowDropsSlowSubscriber(t *testing.T) {
+	broker := NewBroker(store)
+	key := Key{"test-dag", "slow-run", 1}
+	writer, err := broker.NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	defer writer.Close()
+	subscription, err := broker.Follow(key, ReadOptions{}, true)
+	if err != nil {
+		panic(err)
+	}
+	defer subscription.Cancel()
+	for i := 0; i <= subscriberBuffer; i++ {
+		fmt.Fprintln(writer, i)
+	}
+	received := 0
+	for {
+		if _, ok := subscription.Next(context.Background()); !ok {
+			break
+		}
+		received++
+	}
+	if received != subscriberBuffer || !subscription.Dropped() {
+		t.Errorf("Expected the subscriber to be dropped after %d lines, received %d", subscriberBuffer, received)
+	}
+	if !broker.IsLive(key) {
+		t.Errorf("Expected logs for %s to still be live", key)
+	}
+}
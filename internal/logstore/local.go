@@ -0,0 +1,99 @@
+package logstore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var attemptFileRegex = regexp.MustCompile(`^attempt-(\d+)\.log$`)
+
+// LocalStore stores logs on the local filesystem as <root>/<dag>/<run>/attempt-<n>.log
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore returns a new local filesystem store rooted at the given directory
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root}
+}
+
+func (store *LocalStore) runDir(dagName, runID string) string {
+	return filepath.Join(store.root, dagName, runID)
+}
+
+func (store *LocalStore) filePath(key Key) string {
+	return filepath.Join(
+		store.runDir(key.DAGName, key.RunID),
+		fmt.Sprintf("attempt-%d.log", key.Attempt),
+	)
+}
+
+// NewWriter returns a writer that appends to the log file for the given key
+func (store *LocalStore) NewWriter(key Key) (io.WriteCloser, error) {
+	err := key.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(store.runDir(key.DAGName, key.RunID), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(store.filePath(key), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// Read returns the log lines stored for the given key
+func (store *LocalStore) Read(key Key, options ReadOptions) ([]string, error) {
+	err := key.validate()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(store.filePath(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := make([]string, 0)
+	err = ScanLines(file, func(line string) { lines = append(lines, line) })
+	if err != nil {
+		return nil, err
+	}
+	return options.apply(lines), nil
+}
+
+// Attempts returns the attempts with log files for the given run
+func (store *LocalStore) Attempts(dagName, runID string) ([]int, error) {
+	err := Key{dagName, runID, 1}.validate()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(store.runDir(dagName, runID))
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	attempts := make([]int, 0, len(files))
+	for _, file := range files {
+		matches := attemptFileRegex.FindStringSubmatch(file.Name())
+		if matches == nil {
+			continue
+		}
+		attempt, err := strconv.Atoi(matches[1])
+		if err != nil {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	sort.Ints(attempts)
+	return attempts, nil
+}
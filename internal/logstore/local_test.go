@@ -0,0 +1,123 @@
+package logstore
+
+import (
+	"fmt"
+	"goflow/internal/testutils"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var store *LocalStore
+
+func TestMain(m *testing.M) {
+	testutils.RemoveLogs()
+	store = NewLocalStore(testutils.GetLogsFolder())
+	m.Run()
+	testutils.RemoveLogs()
+}
+
+func writeLines(key Key, lines ...string) {
+	writer, err := store.NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	defer writer.Close()
+	for _, line := range lines {
+		fmt.Fprintln(writer, line)
+	}
+}
+
+func TestReadWithOptions(t *testing.T) {
+	key := Key{"test-dag", "test-run", 1}
+	writeLines(key, "one", "two")
+	writeLines(key, "three", "four")
+	cases := []struct {
+		options  ReadOptions
+		expected []string
+	}{
+		{ReadOptions{}, []string{"one", "two", "three", "four"}},
+		{ReadOptions{Tail: 2}, []string{"three", "four"}},
+		{ReadOptions{Tail: 10}, []string{"one", "two", "three", "four"}},
+		{ReadOptions{Offset: 1, Limit: 2}, []string{"two", "three"}},
+		{ReadOptions{Offset: 3}, []string{"four"}},
+		{ReadOptions{Offset: 10}, []string{}},
+		{ReadOptions{Offset: 1, Tail: 1}, []string{"four"}},
+	}
+	for _, testCase := range cases {
+		lines, err := store.Read(key, testCase.options)
+		if err != nil {
+			panic(err)
+		}
+		if !reflect.DeepEqual(lines, testCase.expected) {
+			t.Errorf("For options %+v expected %v, found %v", testCase.options, testCase.expected, lines)
+		}
+	}
+}
+
+func TestReadMissingLogs(t *testing.T) {
+	_, err := store.Read(Key{"test-dag", "missing-run", 1}, ReadOptions{})
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, found %v", err)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	for _, attempt := range []int{2, 10, 1} {
+		writeLines(Key{"test-dag", "attempts-run", attempt}, "line")
+	}
+	attempts, err := store.Attempts("test-dag", "attempts-run")
+	if err != nil {
+		panic(err)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 10}) {
+		t.Errorf("Expected attempts [1 2 10], found %v", attempts)
+	}
+	latest, err := LatestAttempt(store, "test-dag", "attempts-run")
+	if err != nil || latest != 10 {
+		t.Errorf("Expected latest attempt 10, found %d (%v)", latest, err)
+	}
+	_, err = LatestAttempt(store, "test-dag", "missing-run")
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for run without logs, found %v", err)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	for _, key := range []Key{
+		{"..", "run", 1},
+		{"dag", "../run", 1},
+		{"dag", "", 1},
+		{"dag", "run", 0},
+	} {
+		_, err := store.NewWriter(key)
+		if err == nil {
+			t.Errorf("Expected key %s to be rejected", key)
+		}
+	}
+	if _, err := os.Stat(testutils.GetTestFolder() + "/run"); err == nil {
+		t.Error("Invalid key escaped the log folder")
+	}
+}
+
+func TestScanLongLines(t *testing.T) {
+	longLine := strings.Repeat("a", MaxLineBytes+10)
+	lines := make([]string, 0)
+	err := ScanLines(strings.NewReader(longLine+"\nb"), func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		panic(err)
+	}
+	if len(lines) != 3 || strings.Join(lines, "") != longLine+"b" {
+		t.Errorf("Expected long line to be split into 2 parts followed by b, found %d lines", len(lines))
+	}
+}
+
+func TestNewUnsupportedBackend(t *testing.T) {
+	_, err := New("s3", "bucket")
+	if err == nil {
+		t.Error("Unsupported backends should return an error")
+	}
+}
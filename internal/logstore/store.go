@@ -0,0 +1,120 @@
+package logstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"goflow/internal/paths"
+	"io"
+	"strings"
+)
+
+// LocalBackend is the name of the local filesystem log storage backend
+const LocalBackend = "local"
+
+// MaxLineBytes is the longest log line that is stored, longer lines are split
+const MaxLineBytes = 1024 * 1024
+
+// ErrNotFound is returned when no logs are stored for a given key
+var ErrNotFound = errors.New("logs not found")
+
+// Key identifies the logs of a single attempt of a DAG run
+type Key struct {
+	DAGName string
+	RunID   string
+	Attempt int
+}
+
+func (key Key) String() string {
+	return fmt.Sprintf("%s/%s/%d", key.DAGName, key.RunID, key.Attempt)
+}
+
+// validate returns an error if any part of the key could escape the storage location
+func (key Key) validate() error {
+	for _, part := range []string{key.DAGName, key.RunID} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return fmt.Errorf("invalid log key %s", key)
+		}
+	}
+	if key.Attempt < 1 {
+		return fmt.Errorf("invalid attempt %d for log key %s", key.Attempt, key)
+	}
+	return nil
+}
+
+// ReadOptions selects which lines of a log are returned
+// Tail takes precedence over Offset, and a Limit of 0 returns all remaining lines
+type ReadOptions struct {
+	Offset int
+	Limit  int
+	Tail   int
+}
+
+// apply returns the lines selected by the options
+func (options ReadOptions) apply(lines []string) []string {
+	if options.Tail > 0 {
+		if options.Tail < len(lines) {
+			return lines[len(lines)-options.Tail:]
+		}
+		return lines
+	}
+	if options.Offset >= len(lines) {
+		return []string{}
+	}
+	lines = lines[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(lines) {
+		return lines[:options.Limit]
+	}
+	return lines
+}
+
+// Store persists task logs so they are available after pods are deleted
+type Store interface {
+	// NewWriter returns a writer that appends to the logs for the given key
+	NewWriter(key Key) (io.WriteCloser, error)
+	// Read returns the stored log lines for the given key
+	Read(key Key, options ReadOptions) ([]string, error)
+	// Attempts returns the attempts that have stored logs for a run, in ascending order
+	Attempts(dagName, runID string) ([]int, error)
+}
+
+// New returns the log store for the given backend, storing logs under the given location
+func New(backend string, location string) (Store, error) {
+	switch backend {
+	case "", LocalBackend:
+		if location == "" {
+			location = paths.GetGoDefaultLogPath()
+		}
+		return NewLocalStore(location), nil
+	default:
+		return nil, fmt.Errorf("unsupported log storage backend \"%s\"", backend)
+	}
+}
+
+// LatestAttempt returns the most recent attempt with stored logs for the run
+func LatestAttempt(store Store, dagName, runID string) (int, error) {
+	attempts, err := store.Attempts(dagName, runID)
+	if err != nil {
+		return 0, err
+	}
+	if len(attempts) == 0 {
+		return 0, ErrNotFound
+	}
+	return attempts[len(attempts)-1], nil
+}
+
+// ScanLines calls handleLine for every line read until the reader ends
+// Lines longer than MaxLineBytes are passed on in several parts
+func ScanLines(reader io.Reader, handleLine func(line string)) error {
+	bufferedReader := bufio.NewReaderSize(reader, MaxLineBytes)
+	for {
+		line, _, err := bufferedReader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		handleLine(string(line))
+	}
+}
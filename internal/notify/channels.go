@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SignatureHeader holds the HMAC-SHA256 signature of webhook payloads, as "sha256=<hex digest>"
+const SignatureHeader = "X-Goflow-Signature"
+
+// EventHeader holds the event of webhook payloads
+const EventHeader = "X-Goflow-Event"
+
+// Sign returns the signature of the payload that webhooks are sent with
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post posts the JSON payload to the URL, failing on statuses other than 2xx
+func (notifier *Notifier) post(url string, payload []byte, headers map[string]string) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := notifier.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", response.Status)
+	}
+	return nil
+}
+
+func (notifier *Notifier) sendWebhook(rule Rule, notification Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{EventHeader: notification.Event}
+	if notifier.config != nil && notifier.config.WebhookSecret != "" {
+		headers[SignatureHeader] = Sign(notifier.config.WebhookSecret, payload)
+	}
+	return notifier.post(rule.URL, payload, headers)
+}
+
+func (notifier *Notifier) sendSlack(rule Rule, notification Notification) error {
+	payload, err := json.Marshal(map[string]string{"text": notification.Message()})
+	if err != nil {
+		return err
+	}
+	return notifier.post(rule.URL, payload, nil)
+}
+
+func (notifier *Notifier) sendEmail(rule Rule, notification Notification) error {
+	if notifier.config == nil || notifier.config.SMTP == nil {
+		return fmt.Errorf("no SMTP server is configured")
+	}
+	server := notifier.config.SMTP
+	var auth smtp.Auth
+	if server.Username != "" {
+		auth = smtp.PlainAuth("", server.Username, server.Password, server.Host)
+	}
+	message := strings.Join([]string{
+		"From: " + server.From,
+		"To: " + strings.Join(rule.To, ", "),
+		"Subject: [goflow] " + notification.Message(),
+		"Date: " + notification.Time.Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		notification.Message(),
+		"",
+		"DAG: " + notification.DAGName,
+		"Run: " + notification.RunID,
+		"Status: " + notification.Status,
+		fmt.Sprintf("Attempt: %d", notification.Attempt),
+		"",
+	}, "\r\n")
+	return smtp.SendMail(server.Address(), auth, server.From, rule.To, []byte(message))
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"fmt"
+	goflowconfig "goflow/internal/config"
+	"goflow/internal/logs"
+	"goflow/telemetry"
+	"net/http"
+	"sync"
+	"time"
+
+	notificationtable "goflow/internal/dag/sql/notification"
+)
+
+// deliveryTimeout bounds each attempt at delivering a notification over HTTP
+const deliveryTimeout = 10 * time.Second
+
+// Notification describes an event of a DAG run
+// Attempt is the attempt of the run that the event happened on
+// SLA misses have the reason of the miss as status, and no run id if the run never started
+type Notification struct {
+	Event         string
+	DAGName       string
+	RunID         string
+	Status        string
+	ExecutionDate time.Time
+	Attempt       int
+	Time          time.Time
+}
+
+// Message returns a human readable summary of the notification
+func (notification Notification) Message() string {
+	date := notification.ExecutionDate.Format(time.RFC3339)
+	switch notification.Event {
+	case EventFailure:
+		return fmt.Sprintf("Run %s of DAG %s for %s failed", notification.RunID, notification.DAGName, date)
+	case EventSuccess:
+		return fmt.Sprintf("Run %s of DAG %s for %s succeeded", notification.RunID, notification.DAGName, date)
+	case EventRetry:
+		return fmt.Sprintf(
+			"Run %s of DAG %s for %s is retried, starting attempt %d",
+			notification.RunID,
+			notification.DAGName,
+			date,
+			notification.Attempt,
+		)
+	case EventSLAMiss:
+		return fmt.Sprintf("DAG %s missed its SLA for %s: %s", notification.DAGName, date, notification.Status)
+	}
+	return fmt.Sprintf(
+		"Run %s of DAG %s for %s: %s",
+		notification.RunID,
+		notification.DAGName,
+		date,
+		notification.Event,
+	)
+}
+
+// Notifier delivers notifications in the background, retrying failed deliveries and recording
+// every attempt in the delivery log
+type Notifier struct {
+	config     *goflowconfig.NotificationConfig
+	httpClient *http.Client
+	deliveries *notificationtable.TableClient
+	retryDelay time.Duration
+	pending    *sync.WaitGroup
+}
+
+// New returns a notifier delivering with the given config, which may be nil
+// Attempts are not recorded when the table client is nil
+func New(config *goflowconfig.NotificationConfig, deliveries *notificationtable.TableClient) *Notifier {
+	return &Notifier{
+		config:     config,
+		httpClient: &http.Client{Timeout: deliveryTimeout},
+		deliveries: deliveries,
+		retryDelay: config.RetryDelay(),
+		pending:    &sync.WaitGroup{},
+	}
+}
+
+// Notify delivers the notification through every rule that notifies of its event, without
+// waiting for the deliveries
+func (notifier *Notifier) Notify(rules []Rule, notification Notification) {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	for _, rule := range rules {
+		if !rule.Matches(notification.Event) {
+			continue
+		}
+		notifier.pending.Add(1)
+		go notifier.deliver(rule, notification)
+	}
+}
+
+// Wait blocks until the deliveries in progress have succeeded or run out of attempts
+func (notifier *Notifier) Wait() {
+	notifier.pending.Wait()
+}
+
+// deliver sends the notification through the rule until it succeeds or runs out of attempts
+func (notifier *Notifier) deliver(rule Rule, notification Notification) {
+	defer notifier.pending.Done()
+	delay := notifier.retryDelay
+	attempts := notifier.config.Attempts()
+	for attempt := 1; ; attempt++ {
+		err := notifier.send(rule, notification)
+		notifier.record(rule, notification, attempt, err)
+		if err == nil {
+			return
+		}
+		if attempt >= attempts {
+			logs.ErrorLogger.Printf(
+				"Giving up on the %s notification of run %s through %s after %d attempts: %s",
+				notification.Event,
+				notification.RunID,
+				rule.Channel,
+				attempt,
+				err,
+			)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (notifier *Notifier) send(rule Rule, notification Notification) error {
+	switch rule.Channel {
+	case ChannelWebhook:
+		return notifier.sendWebhook(rule, notification)
+	case ChannelSlack:
+		return notifier.sendSlack(rule, notification)
+	case ChannelEmail:
+		return notifier.sendEmail(rule, notification)
+	}
+	return fmt.Errorf("unknown notify channel %q", rule.Channel)
+}
+
+// record stores the outcome of a delivery attempt in the delivery log
+func (notifier *Notifier) record(rule Rule, notification Notification, attempt int, err error) {
+	status := notificationtable.StatusDelivered
+	errorMessage := ""
+	if err != nil {
+		status = notificationtable.StatusFailed
+		errorMessage = err.Error()
+	}
+	telemetry.NotificationDeliveries.Inc(rule.Channel, status)
+	if notifier.deliveries == nil {
+		return
+	}
+	notifier.deliveries.InsertDelivery(notificationtable.NewRow(
+		notification.DAGName,
+		notification.RunID,
+		notification.Event,
+		rule.Channel,
+		rule.target(),
+		attempt,
+		status,
+		errorMessage,
+	))
+}
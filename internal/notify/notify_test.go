@@ -0,0 +1,247 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	goflowconfig "goflow/internal/config"
+	"goflow/internal/database"
+	"goflow/internal/testutils"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	notificationtable "goflow/internal/dag/sql/notification"
+)
+
+var sqlClient *database.SQLClient
+var deliveryTableClient *notificationtable.TableClient
+
+func TestMain(m *testing.M) {
+	testutils.RemoveSQLiteDB()
+	sqlClient = database.NewSQLiteClient(testutils.GetSQLiteLocation())
+	deliveryTableClient = notificationtable.NewTableClient(sqlClient)
+	m.Run()
+}
+
+func getTestNotification(event string) Notification {
+	return Notification{
+		Event:         event,
+		DAGName:       "test",
+		RunID:         "test-run",
+		Status:        "Failed",
+		ExecutionDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Attempt:       1,
+	}
+}
+
+func newTestNotifier(config *goflowconfig.NotificationConfig) *Notifier {
+	notifier := New(config, deliveryTableClient)
+	notifier.retryDelay = time.Millisecond
+	return notifier
+}
+
+// request is a request received by the webhook stand-in
+type request struct {
+	headers http.Header
+	body    []byte
+}
+
+// newWebhook returns a webhook stand-in that fails the first failures requests
+func newWebhook(failures int) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	lock := &sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})), requests
+}
+
+// newSMTPServer returns the address of a mail server stand-in and the messages it receives
+func newSMTPServer(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String(), messages
+}
+
+func serveSMTP(conn net.Conn, messages chan string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			reply("354 go ahead")
+			message := strings.Builder{}
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil || dataLine == ".\r\n" {
+					break
+				}
+				message.WriteString(dataLine)
+			}
+			messages <- message.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	tables := []struct {
+		name     string
+		rule     Rule
+		problems int
+	}{
+		{"webhook", Rule{On: []string{EventFailure}, Channel: ChannelWebhook, URL: "https://hooks.example.com/x"}, 0},
+		{"email", Rule{On: []string{EventSuccess, EventSLAMiss}, Channel: ChannelEmail, To: []string{"ops@example.com"}}, 0},
+		{"no events", Rule{Channel: ChannelSlack, URL: "https://hooks.example.com/x"}, 1},
+		{"unknown event", Rule{On: []string{"finish"}, Channel: ChannelSlack, URL: "https://hooks.example.com/x"}, 1},
+		{"no URL", Rule{On: []string{EventRetry}, Channel: ChannelWebhook, URL: "hooks.example.com"}, 1},
+		{"no addresses", Rule{On: []string{EventRetry}, Channel: ChannelEmail}, 1},
+		{"unknown channel", Rule{On: []string{EventRetry}, Channel: "pager"}, 1},
+	}
+	for _, table := range tables {
+		if problems := table.rule.Validate(); len(problems) != table.problems {
+			t.Errorf("%s: expected %d problems, found %v", table.name, table.problems, problems)
+		}
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	deliveryTableClient.CreateTable()
+	server, requests := newWebhook(1)
+	defer server.Close()
+	notifier := newTestNotifier(&goflowconfig.NotificationConfig{WebhookSecret: "secret"})
+	rules := []Rule{
+		{On: []string{EventFailure}, Channel: ChannelWebhook, URL: server.URL + "/hook"},
+		{On: []string{EventSuccess}, Channel: ChannelWebhook, URL: server.URL + "/other"},
+	}
+	notifier.Notify(rules, getTestNotification(EventFailure))
+	notifier.Wait()
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected the failed delivery to be retried once, found %d requests", len(requests))
+	}
+	<-requests
+	received := <-requests
+	if received.headers.Get(SignatureHeader) != Sign("secret", received.body) {
+		t.Errorf("Expected the payload to be signed, found signature %q", received.headers.Get(SignatureHeader))
+	}
+	if received.headers.Get(EventHeader) != EventFailure {
+		t.Errorf("Expected the event header, found %q", received.headers.Get(EventHeader))
+	}
+	notification := Notification{}
+	if err := json.Unmarshal(received.body, &notification); err != nil || notification.RunID != "test-run" {
+		t.Errorf("Expected the notification as payload, found %s", received.body)
+	}
+	deliveries := deliveryTableClient.GetDeliveries("test", 0)
+	if len(deliveries) != 2 ||
+		deliveries[0].Status != notificationtable.StatusDelivered ||
+		deliveries[1].Status != notificationtable.StatusFailed ||
+		deliveries[0].Attempt != 2 {
+		t.Errorf("Expected a failed and a delivered attempt, found %v", deliveries)
+	}
+	if strings.Contains(deliveries[0].Target, "/hook") {
+		t.Errorf("Expected the path of the URL to be left out of the log, found %s", deliveries[0].Target)
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	deliveryTableClient.CreateTable()
+	server, requests := newWebhook(10)
+	defer server.Close()
+	notifier := newTestNotifier(&goflowconfig.NotificationConfig{MaxAttempts: 2})
+	notifier.Notify(
+		[]Rule{{On: []string{EventRetry}, Channel: ChannelSlack, URL: server.URL}},
+		getTestNotification(EventRetry),
+	)
+	notifier.Wait()
+	if len(requests) != 2 {
+		t.Errorf("Expected 2 attempts, found %d", len(requests))
+	}
+	received := <-requests
+	payload := map[string]string{}
+	if err := json.Unmarshal(received.body, &payload); err != nil || !strings.Contains(payload["text"], "test-run") {
+		t.Errorf("Expected a Slack message naming the run, found %s", received.body)
+	}
+	for _, delivery := range deliveryTableClient.GetDeliveries("test", 0) {
+		if delivery.Status != notificationtable.StatusFailed || delivery.Error == "" {
+			t.Errorf("Expected only failed attempts, found %s", delivery)
+		}
+	}
+}
+
+func TestNotifyEmail(t *testing.T) {
+	defer database.PurgeDB(sqlClient)
+	deliveryTableClient.CreateTable()
+	address, messages := newSMTPServer(t)
+	host, port, _ := net.SplitHostPort(address)
+	portNumber, _ := strconv.Atoi(port)
+	notifier := newTestNotifier(&goflowconfig.NotificationConfig{
+		SMTP: &goflowconfig.SMTPConfig{Host: host, Port: portNumber, From: "goflow@example.com"},
+	})
+	notifier.Notify(
+		[]Rule{{On: []string{EventSLAMiss}, Channel: ChannelEmail, To: []string{"ops@example.com"}}},
+		getTestNotification(EventSLAMiss),
+	)
+	notifier.Wait()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email, found %d", len(messages))
+	}
+	message := <-messages
+	if !strings.Contains(message, "To: ops@example.com") || !strings.Contains(message, "missed its SLA") {
+		t.Errorf("Expected an email about the SLA miss, found %s", message)
+	}
+	deliveries := deliveryTableClient.GetDeliveries("test", 0)
+	if len(deliveries) != 1 || deliveries[0].Target != "ops@example.com" {
+		t.Errorf("Expected the delivered email in the log, found %v", deliveries)
+	}
+}
+
+func TestNotifyEmailWithoutServer(t *testing.T) {
+	notifier := New(nil, nil)
+	notifier.retryDelay = time.Millisecond
+	err := notifier.send(Rule{Channel: ChannelEmail, To: []string{"ops@example.com"}}, getTestNotification(EventFailure))
+	if err == nil {
+		t.Error("Expected an error without a mail server")
+	}
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Events of DAG runs that rules can notify of
+const (
+	EventFailure = "failure"
+	EventSuccess = "success"
+	EventRetry   = "retry"
+	EventSLAMiss = "sla_miss"
+)
+
+// Events lists every event that rules can notify of
+var Events = []string{EventFailure, EventSuccess, EventRetry, EventSLAMiss}
+
+// Channels that notifications are delivered through
+const (
+	// ChannelWebhook posts the notification as JSON, signed when a webhook secret is configured
+	ChannelWebhook = "webhook"
+	// ChannelEmail sends the notification through the configured mail server
+	ChannelEmail = "email"
+	// ChannelSlack posts the message of the notification to a Slack-compatible incoming webhook
+	ChannelSlack = "slack"
+)
+
+// Rule sends the notifications of the events listed in On through a channel
+// Webhook and Slack rules post to URL, email rules send to the addresses in To
+type Rule struct {
+	On      []string
+	Channel string
+	URL     string
+	To      []string
+}
+
+// Matches returns true if the rule notifies of the event
+func (rule Rule) Matches(event string) bool {
+	for _, ruleEvent := range rule.On {
+		if ruleEvent == event {
+			return true
+		}
+	}
+	return false
+}
+
+// target returns where the rule delivers to, without the path and query of URLs, which may hold
+// credentials
+func (rule Rule) target() string {
+	if rule.Channel == ChannelEmail {
+		return strings.Join(rule.To, ",")
+	}
+	parsedURL, err := url.Parse(rule.URL)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Host
+}
+
+// Copy returns a copy of the rule
+func (rule Rule) Copy() Rule {
+	ruleCopy := rule
+	ruleCopy.On = append([]string(nil), rule.On...)
+	ruleCopy.To = append([]string(nil), rule.To...)
+	return ruleCopy
+}
+
+func isEvent(event string) bool {
+	for _, knownEvent := range Events {
+		if event == knownEvent {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns every problem that prevents the rule from delivering notifications
+func (rule Rule) Validate() []error {
+	problems := make([]error, 0)
+	if len(rule.On) == 0 {
+		problems = append(problems, fmt.Errorf("notify rule must list events among %s", strings.Join(Events, ", ")))
+	}
+	for _, event := range rule.On {
+		if !isEvent(event) {
+			problems = append(problems, fmt.Errorf(
+				"notify event %q must be one of %s",
+				event,
+				strings.Join(Events, ", "),
+			))
+		}
+	}
+	switch rule.Channel {
+	case ChannelWebhook, ChannelSlack:
+		parsedURL, err := url.Parse(rule.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			problems = append(problems, fmt.Errorf("%s notify rule needs an http or https URL", rule.Channel))
+		}
+	case ChannelEmail:
+		if len(rule.To) == 0 {
+			problems = append(problems, fmt.Errorf("email notify rule needs addresses to send to"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf(
+			"notify channel %q must be %s, %s or %s",
+			rule.Channel,
+			ChannelWebhook,
+			ChannelEmail,
+			ChannelSlack,
+		))
+	}
+	return problems
+}
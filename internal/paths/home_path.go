@@ -13,3 +13,12 @@ func GetGoDefaultHomePath() string {
 	}
 	return path.Join(homeDir, ".goflow", "config.json")
 }
+
+// GetGoDefaultLogPath returns the default location for stored task logs
+func GetGoDefaultLogPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return path.Join(homeDir, ".goflow", "logs")
+}
@@ -0,0 +1,270 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goflow/internal/jsonpanic"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiV1Prefix is the path prefix of the versioned API
+const apiV1Prefix = "/api/v1"
+
+// defaultPageLimit and maxPageLimit bound the number of items returned per page
+const defaultPageLimit = 50
+const maxPageLimit = 500
+
+// errorCodes are the machine readable codes of the error statuses returned by the API
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusInternalServerError: "internal",
+}
+
+// apiError describes why a request to the API failed
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorEnvelope is the body of every error response of the API
+type errorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// writeJSON writes the value as the JSON body of a response with the given status
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	setHeaders(w)
+	w.WriteHeader(status)
+	fmt.Fprint(w, jsonpanic.JSONPanic(value))
+}
+
+// writeAPIError writes an error envelope with the given status
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	writeJSON(w, status, errorEnvelope{apiError{code, message}})
+}
+
+// isAPIRequest returns true if the request was sent to the versioned API
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path == apiV1Prefix || strings.HasPrefix(r.URL.Path, apiV1Prefix+"/")
+}
+
+// writeRequestError writes an error in the format of the API the request was sent to
+func writeRequestError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if isAPIRequest(r) {
+		writeAPIError(w, status, message)
+		return
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, jsonpanic.JSONPanic(message))
+}
+
+// pageQuery holds the sorting and position of a requested page
+type pageQuery struct {
+	Sort       string
+	Descending bool
+	Limit      int
+	After      []string
+}
+
+// cursor marks the position after the last item of a page
+type cursor struct {
+	Sort string   `json:"s"`
+	Key  []string `json:"k"`
+}
+
+func encodeCursor(sortName string, key []string) string {
+	cursorBytes, err := json.Marshal(cursor{sortName, key})
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorBytes)
+}
+
+var errInvalidCursor = errors.New("query parameter cursor is invalid")
+
+// sortName returns the value of the sort query parameter the page was requested with
+func (query pageQuery) sortName() string {
+	if query.Descending {
+		return "-" + query.Sort
+	}
+	return query.Sort
+}
+
+// parsePageQuery parses the sort, limit and cursor query parameters of the request
+// sort is one of sortFields, prefixed with "-" for descending order
+func parsePageQuery(r *http.Request, sortFields []string, defaultSort string) (pageQuery, error) {
+	queryInts, err := getQueryInts(r, "limit")
+	if err != nil {
+		return pageQuery{}, err
+	}
+	query := pageQuery{Limit: queryInts["limit"]}
+	if query.Limit == 0 {
+		query.Limit = defaultPageLimit
+	}
+	if query.Limit > maxPageLimit {
+		query.Limit = maxPageLimit
+	}
+	sortName := r.URL.Query().Get("sort")
+	if sortName == "" {
+		sortName = defaultSort
+	}
+	query.Descending = strings.HasPrefix(sortName, "-")
+	query.Sort = strings.TrimPrefix(sortName, "-")
+	validSort := false
+	for _, field := range sortFields {
+		validSort = validSort || field == query.Sort
+	}
+	if !validSort {
+		return pageQuery{}, fmt.Errorf(
+			"query parameter sort must be one of %s, optionally prefixed with -",
+			strings.Join(sortFields, ", "),
+		)
+	}
+	cursorString := r.URL.Query().Get("cursor")
+	if cursorString == "" {
+		return query, nil
+	}
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(cursorString)
+	if err != nil {
+		return pageQuery{}, errInvalidCursor
+	}
+	pageCursor := cursor{}
+	if json.Unmarshal(cursorBytes, &pageCursor) != nil || len(pageCursor.Key) == 0 {
+		return pageQuery{}, errInvalidCursor
+	}
+	if pageCursor.Sort != query.sortName() {
+		return pageQuery{}, errors.New("query parameter cursor was issued for a different sort")
+	}
+	query.After = pageCursor.Key
+	return query, nil
+}
+
+// afterID returns the id the cursor of the query points after, for pages keyed by id
+func (query pageQuery) afterID() (int, error) {
+	if query.After == nil {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(query.After[0])
+	if err != nil || id < 1 {
+		return 0, errInvalidCursor
+	}
+	return id, nil
+}
+
+// compareKeys compares two sort keys element by element
+func compareKeys(a []string, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp := strings.Compare(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(a) - len(b)
+}
+
+// paginate returns the indexes of the n items on the page selected by the query, where items are
+// ordered by the keys returned by keyOf, and the cursor of the following page if there is one
+// Keys must be unique so that items are never skipped or repeated across pages
+func paginate(n int, keyOf func(i int) []string, query pageQuery) ([]int, string) {
+	keys := make([][]string, n)
+	indexes := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		keys[i] = keyOf(i)
+		if query.After != nil {
+			cmp := compareKeys(keys[i], query.After)
+			if (!query.Descending && cmp <= 0) || (query.Descending && cmp >= 0) {
+				continue
+			}
+		}
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		cmp := compareKeys(keys[indexes[i]], keys[indexes[j]])
+		if query.Descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if len(indexes) <= query.Limit {
+		return indexes, ""
+	}
+	indexes = indexes[:query.Limit]
+	return indexes, encodeCursor(query.sortName(), keys[indexes[len(indexes)-1]])
+}
+
+// timeKey returns a sort key for a time, ordering the same way as the time
+func timeKey(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// getQueryTimes returns the RFC 3339 time query parameters with the given names
+// Missing parameters are returned as the zero time
+func getQueryTimes(r *http.Request, names ...string) (map[string]time.Time, error) {
+	values := make(map[string]time.Time)
+	for _, name := range names {
+		valueString := r.URL.Query().Get(name)
+		if valueString == "" {
+			values[name] = time.Time{}
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, valueString)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter %s must be an RFC 3339 time", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// getQueryList returns the values of a query parameter that may be repeated or comma separated
+func getQueryList(r *http.Request, name string) []string {
+	values := make([]string, 0)
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// getQueryLabels returns the label selectors of the request, given as repeated label=key=value
+func getQueryLabels(r *http.Request) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, selector := range r.URL.Query()["label"] {
+		parts := strings.SplitN(selector, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("query parameter label must have the form key=value, got %q", selector)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// hasLabels returns true if the labels contain every selected label
+func hasLabels(labels map[string]string, selected map[string]string) bool {
+	for key, value := range selected {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,828 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"goflow/internal/auth"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/dagtype"
+	"goflow/internal/dag/orchestrator"
+	dagrun "goflow/internal/dag/run"
+	audittable "goflow/internal/dag/sql/audit"
+	dagruntable "goflow/internal/dag/sql/dagrun"
+	metricstable "goflow/internal/dag/sql/metrics"
+	"goflow/internal/logstore"
+	"goflow/internal/stringutils"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// dagV1 is the representation of a DAG in the versioned API
+// Cluster is empty for DAGs running in the cluster of goflow
+type dagV1 struct {
+	Name                string            `json:"name"`
+	Namespace           string            `json:"namespace"`
+	Cluster             string            `json:"cluster"`
+	Schedule            string            `json:"schedule"`
+	DockerImage         string            `json:"dockerImage"`
+	Labels              map[string]string `json:"labels"`
+	IsOn                bool              `json:"isOn"`
+	DryRun              bool              `json:"dryRun"`
+	ActiveRuns          int               `json:"activeRuns"`
+	MostRecentExecution time.Time         `json:"mostRecentExecution"`
+	LastUpdated         time.Time         `json:"lastUpdated"`
+}
+
+func newDAGV1(dag *dagtype.DAG) dagV1 {
+	return dagV1{
+		dag.Config.Name,
+		dag.Config.Namespace,
+		dag.Config.Cluster,
+		dag.Config.Schedule,
+		dag.Config.DockerImage,
+		dag.Config.Labels,
+		dag.IsOn,
+		dag.Config.DryRun,
+		dag.ActiveRuns.Get(),
+		dag.MostRecentExecution,
+		dag.LastUpdated,
+	}
+}
+
+// runV1 is the representation of a dag run in the versioned API
+// EndTime is omitted while the run has not finished, WaitingFor while the run is not waiting
+// and Sensors once the run is no longer cached
+// Cluster is the cluster the run was submitted to, empty for the cluster of goflow
+type runV1 struct {
+	ID            string         `json:"id"`
+	DAG           string         `json:"dag"`
+	Namespace     string         `json:"namespace"`
+	Cluster       string         `json:"cluster"`
+	Status        string         `json:"status"`
+	Trigger       string         `json:"trigger"`
+	ExecutionDate time.Time      `json:"executionDate"`
+	StartTime     time.Time      `json:"startTime"`
+	EndTime       *time.Time     `json:"endTime,omitempty"`
+	WaitingFor    []dependencyV1 `json:"waitingFor,omitempty"`
+	Sensors       []sensorV1     `json:"sensors,omitempty"`
+}
+
+// dependencyV1 is the representation of a run of another DAG that a run waits for
+// Status is empty while that run has not been recorded
+type dependencyV1 struct {
+	DAG            string    `json:"dag"`
+	ExecutionDate  time.Time `json:"executionDate"`
+	RequiredStatus string    `json:"requiredStatus"`
+	Status         string    `json:"status"`
+	Met            bool      `json:"met"`
+}
+
+func newDependenciesV1(dependencies []dagrun.Dependency) []dependencyV1 {
+	resources := make([]dependencyV1, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		resources = append(resources, dependencyV1(dependency))
+	}
+	return resources
+}
+
+// sensorV1 is the representation of the state of a sensor of a run
+type sensorV1 struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Satisfied bool      `json:"satisfied"`
+	Pokes     int       `json:"pokes"`
+	LastPoke  time.Time `json:"lastPoke"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func newSensorsV1(states []dagrun.SensorState) []sensorV1 {
+	if states == nil {
+		return nil
+	}
+	resources := make([]sensorV1, 0, len(states))
+	for _, state := range states {
+		resources = append(resources, sensorV1(state))
+	}
+	return resources
+}
+
+func newRunV1(orch *orchestrator.Orchestrator, row dagruntable.Row, dag *dagtype.DAG) runV1 {
+	resource := runV1{
+		ID:            row.RunID,
+		DAG:           dag.Config.Name,
+		Namespace:     dag.Config.Namespace,
+		Cluster:       row.Cluster,
+		Status:        row.Status,
+		Trigger:       row.Trigger,
+		ExecutionDate: row.ExecutionDate,
+		StartTime:     row.StartDate,
+	}
+	if !row.EndDate.IsZero() {
+		endTime := row.EndDate
+		resource.EndTime = &endTime
+	}
+	if row.Status == string(dagrun.PhaseWaiting) {
+		resource.WaitingFor = newDependenciesV1(orch.RunDependencies(dag, row.ExecutionDate))
+	}
+	if dagRun, ok := dag.CachedRun(row.RunID); ok {
+		resource.Sensors = newSensorsV1(dagRun.SensorStates())
+	}
+	return resource
+}
+
+// newCachedRunV1 returns the representation of a run that may not have been stored yet
+func newCachedRunV1(dagRun *dagrun.DAGRun, dag *dagtype.DAG) runV1 {
+	resource := runV1{
+		ID:            dagRun.Name,
+		DAG:           dag.Config.Name,
+		Namespace:     dag.Config.Namespace,
+		Cluster:       dagRun.Config.Cluster,
+		Status:        dagRun.Status(),
+		Trigger:       dagRun.Trigger,
+		ExecutionDate: dagRun.ExecutionDate.Time,
+		StartTime:     dagRun.StartTime.Time,
+	}
+	if dagRun.Finished() {
+		endTime := dagRun.EndTime.Time
+		resource.EndTime = &endTime
+	}
+	if resource.Status == string(dagrun.PhaseWaiting) {
+		resource.WaitingFor = newDependenciesV1(dagRun.Dependencies())
+	}
+	resource.Sensors = newSensorsV1(dagRun.SensorStates())
+	return resource
+}
+
+// metricV1 is the representation of a resource usage sample of a task in the versioned API
+type metricV1 struct {
+	ID      int       `json:"id"`
+	DAG     string    `json:"dag"`
+	RunID   string    `json:"runId"`
+	Pod     string    `json:"pod"`
+	Task    string    `json:"task"`
+	Attempt int       `json:"attempt"`
+	Memory  int64     `json:"memory"`
+	CPU     int64     `json:"cpu"`
+	Time    time.Time `json:"time"`
+}
+
+func newMetricV1(row metricstable.Row) metricV1 {
+	return metricV1{
+		row.ID,
+		row.DagName,
+		row.RunID,
+		row.PodName,
+		row.Task,
+		row.Attempt,
+		row.Memory,
+		row.CPU,
+		row.MetricTime,
+	}
+}
+
+// auditEventV1 is the representation of an audit event in the versioned API
+type auditEventV1 struct {
+	ID       int       `json:"id"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	DAG      string    `json:"dag"`
+	RunID    string    `json:"runId"`
+	Before   string    `json:"before"`
+	After    string    `json:"after"`
+	SourceIP string    `json:"sourceIp"`
+}
+
+func newAuditEventV1(row audittable.Row) auditEventV1 {
+	return auditEventV1{
+		row.ID,
+		row.EventTime,
+		row.Actor,
+		row.Action,
+		row.DagName,
+		row.RunID,
+		row.Before,
+		row.After,
+		row.SourceIP,
+	}
+}
+
+// logLineV1 is a numbered line of the logs of a dag run
+type logLineV1 struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// decisionV1 explains why a run that is due or waiting has not been started, RunID is omitted
+// for runs that the scheduler has not added yet
+type decisionV1 struct {
+	DAG           string    `json:"dag"`
+	Namespace     string    `json:"namespace"`
+	RunID         string    `json:"runId,omitempty"`
+	ExecutionDate time.Time `json:"executionDate"`
+	Priority      int       `json:"priority"`
+	Since         time.Time `json:"since"`
+	Reason        string    `json:"reason"`
+}
+
+func newDecisionV1(decision orchestrator.Decision) decisionV1 {
+	return decisionV1{
+		decision.DAG,
+		decision.Namespace,
+		decision.RunID,
+		decision.ExecutionDate,
+		decision.Priority,
+		decision.Since,
+		decision.Reason,
+	}
+}
+
+// Pages of the list endpoints, NextCursor is omitted on the last page
+type dagPageV1 struct {
+	Items      []dagV1 `json:"items"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// Counts holds the number of runs matching the filter for each status, across all pages
+type runPageV1 struct {
+	Items      []runV1        `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	Counts     map[string]int `json:"counts"`
+}
+
+type metricPageV1 struct {
+	Items      []metricV1 `json:"items"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+type auditPageV1 struct {
+	Items      []auditEventV1 `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+type schedulerQueueV1 struct {
+	Items []decisionV1 `json:"items"`
+}
+
+type logPageV1 struct {
+	Items []logLineV1 `json:"items"`
+}
+
+// dagSortKeys returns the sort keys of a DAG, ending with its unique name
+var dagSortKeys = map[string]func(dag *dagtype.DAG) []string{
+	"name": func(dag *dagtype.DAG) []string {
+		return []string{dag.Config.Name}
+	},
+	"namespace": func(dag *dagtype.DAG) []string {
+		return []string{dag.Config.Namespace, dag.Config.Name}
+	},
+	"lastUpdated": func(dag *dagtype.DAG) []string {
+		return []string{timeKey(dag.LastUpdated), dag.Config.Name}
+	},
+	"mostRecentExecution": func(dag *dagtype.DAG) []string {
+		return []string{timeKey(dag.MostRecentExecution), dag.Config.Name}
+	},
+}
+
+var dagSortFields = []string{"name", "namespace", "lastUpdated", "mostRecentExecution"}
+var runSortFields = []string{"executionDate"}
+var idSortFields = []string{"id"}
+
+// dagFilter selects DAGs, empty fields match every DAG
+type dagFilter struct {
+	names      []string
+	namespaces []string
+	labels     map[string]string
+	isOn       *bool
+}
+
+// getDAGFilter parses the DAG filter from the dag, namespace, label and isOn query parameters
+func getDAGFilter(r *http.Request) (dagFilter, error) {
+	labels, err := getQueryLabels(r)
+	if err != nil {
+		return dagFilter{}, err
+	}
+	filter := dagFilter{getQueryList(r, "dag"), getQueryList(r, "namespace"), labels, nil}
+	if isOnString := r.URL.Query().Get("isOn"); isOnString != "" {
+		isOn, err := strconv.ParseBool(isOnString)
+		if err != nil {
+			return dagFilter{}, errors.New("query parameter isOn must be a boolean")
+		}
+		filter.isOn = &isOn
+	}
+	return filter, nil
+}
+
+func containsOrEmpty(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter dagFilter) matches(dag *dagtype.DAG) bool {
+	return containsOrEmpty(filter.names, dag.Config.Name) &&
+		containsOrEmpty(filter.namespaces, dag.Config.Namespace) &&
+		hasLabels(dag.Config.Labels, filter.labels) &&
+		(filter.isOn == nil || *filter.isOn == dag.IsOn)
+}
+
+// filteredDAGs returns the DAGs visible to the principal of the request that match the filter
+func filteredDAGs(orch *orchestrator.Orchestrator, r *http.Request, filter dagFilter) dagtype.DAGList {
+	dags := make(dagtype.DAGList, 0)
+	for _, dag := range visibleDAGs(r, orch.DAGs()) {
+		if filter.matches(dag) {
+			dags = append(dags, dag)
+		}
+	}
+	return dags
+}
+
+// canonicalStatus returns a run status in the capitalization of pod phases
+func canonicalStatus(status string) string {
+	return strings.ToUpper(status[:1]) + strings.ToLower(status[1:])
+}
+
+// getRunFilter parses the filter of stored runs from the status, trigger, since and until query
+// parameters and the position of the page query
+func getRunFilter(r *http.Request, query pageQuery) (dagruntable.Filter, error) {
+	times, err := getQueryTimes(r, "since", "until")
+	if err != nil {
+		return dagruntable.Filter{}, err
+	}
+	filter := dagruntable.Filter{
+		Statuses:   make([]string, 0),
+		Triggers:   getQueryList(r, "trigger"),
+		Since:      times["since"],
+		Until:      times["until"],
+		Descending: query.Descending,
+		Limit:      query.Limit + 1,
+	}
+	for _, status := range getQueryList(r, "status") {
+		filter.Statuses = append(filter.Statuses, canonicalStatus(status))
+	}
+	if query.After == nil {
+		return filter, nil
+	}
+	if len(query.After) != 2 {
+		return dagruntable.Filter{}, errInvalidCursor
+	}
+	executionDate, dateErr := time.Parse(time.RFC3339Nano, query.After[0])
+	dagID, idErr := strconv.Atoi(query.After[1])
+	if dateErr != nil || idErr != nil {
+		return dagruntable.Filter{}, errInvalidCursor
+	}
+	filter.After = &dagruntable.Key{ExecutionDate: executionDate, DagID: dagID}
+	return filter, nil
+}
+
+// runCursorKey returns the cursor key of a stored run
+func runCursorKey(row dagruntable.Row) []string {
+	return []string{row.ExecutionDate.UTC().Format(time.RFC3339Nano), strconv.Itoa(row.DagID)}
+}
+
+// getV1DAG returns the DAG named by the request, writing a not found error if it does not exist
+func getV1DAG(orch *orchestrator.Orchestrator, w http.ResponseWriter, r *http.Request) *dagtype.DAG {
+	dag := orch.GetDag(mux.Vars(r)["name"])
+	if dag == nil {
+		writeAPIError(w, http.StatusNotFound, "there is no DAG with the given name")
+	}
+	return dag
+}
+
+func listDAGsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := getDAGFilter(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query, err := parsePageQuery(r, dagSortFields, "name")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dags := filteredDAGs(orch, r, filter)
+		sortKeys := dagSortKeys[query.Sort]
+		indexes, nextCursor := paginate(len(dags), func(i int) []string { return sortKeys(dags[i]) }, query)
+		page := dagPageV1{make([]dagV1, 0, len(indexes)), nextCursor}
+		for _, i := range indexes {
+			page.Items = append(page.Items, newDAGV1(dags[i]))
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func getDAGV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		writeJSON(w, http.StatusOK, newDAGV1(dag))
+	}
+}
+
+func writeDAGV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestBytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dagConfig := &dagconfig.DAGConfig{}
+		if err := json.Unmarshal(requestBytes, dagConfig); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "request body must be a DAG configuration: "+err.Error())
+			return
+		}
+		if !canWriteDAG(orch, r, dagConfig) {
+			writeAPIError(w, http.StatusForbidden, forbiddenMsg)
+			return
+		}
+		var previousConfig interface{}
+		if existingDAG := orch.GetDag(dagConfig.Name); existingDAG != nil {
+			previousConfig = existingDAG.Config
+		}
+		status, err := orch.WriteDAGFile(dagConfig)
+		if err != nil {
+			writeAPIError(w, status, err.Error())
+			return
+		}
+		recordAudit(orch, r, audittable.ActionDAGWrite, dagConfig.Name, "", previousConfig, dagConfig)
+		// The DAG is loaded from the written file on the next collection cycle
+		writeJSON(w, http.StatusAccepted, dagConfig)
+	}
+}
+
+func toggleDAGV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		wasOn := dag.IsOn
+		dag.ToggleOnOff()
+		recordAudit(
+			orch,
+			r,
+			audittable.ActionDAGToggle,
+			dag.Config.Name,
+			"",
+			map[string]bool{"IsOn": wasOn},
+			map[string]bool{"IsOn": dag.IsOn},
+		)
+		writeJSON(w, http.StatusOK, newDAGV1(dag))
+	}
+}
+
+func renderDAGV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		executionDate, err := getExecutionDate(r, dag)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		manifest, err := dag.Render(executionDate)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, manifest)
+	}
+}
+
+func triggerDAGV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		dagRun, err := orch.TriggerDAGRun(dag)
+		if err == dagtype.ErrMaxActiveRuns || err == dagtype.ErrRunExists {
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(orch, r, audittable.ActionRunTrigger, dag.Config.Name, dagRun.Name, nil, nil)
+		writeJSON(w, http.StatusAccepted, newCachedRunV1(dagRun, dag))
+	}
+}
+
+func cancelRunV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		runID := mux.Vars(r)["id"]
+		dagRun, err := dag.CancelRun(runID)
+		if err == dagtype.ErrRunNotActive {
+			// Runs evicted from the cache have finished long ago
+			stored := orch.RetrieveDagRuns(dagruntable.Filter{DagIDs: []int{dag.ID}, RunID: runID, Limit: 1})
+			if len(stored) == 0 {
+				writeAPIError(w, http.StatusNotFound, "there is no run with the given id")
+				return
+			}
+			err = dagrun.ErrRunFinished
+		}
+		if err == dagrun.ErrRunFinished {
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(orch, r, audittable.ActionRunCancel, dag.Config.Name, runID, nil, nil)
+		writeJSON(w, http.StatusAccepted, newCachedRunV1(dagRun, dag))
+	}
+}
+
+// writeRunPage writes the page of the stored runs of the DAGs that match the run filter
+func writeRunPage(w http.ResponseWriter, r *http.Request, orch *orchestrator.Orchestrator, dags dagtype.DAGList) {
+	query, err := parsePageQuery(r, runSortFields, "-executionDate")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := getRunFilter(r, query)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page := runPageV1{Items: make([]runV1, 0), Counts: make(map[string]int)}
+	if len(dags) == 0 {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	dagsByID := make(map[int]*dagtype.DAG)
+	for _, dag := range dags {
+		filter.DagIDs = append(filter.DagIDs, dag.ID)
+		dagsByID[dag.ID] = dag
+	}
+	rows := orch.RetrieveDagRuns(filter)
+	if len(rows) > query.Limit {
+		rows = rows[:query.Limit]
+		page.NextCursor = encodeCursor(query.sortName(), runCursorKey(rows[len(rows)-1]))
+	}
+	for _, row := range rows {
+		page.Items = append(page.Items, newRunV1(orch, row, dagsByID[row.DagID]))
+	}
+	page.Counts = orch.CountDagRunsByStatus(filter)
+	writeJSON(w, http.StatusOK, page)
+}
+
+func listRunsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := getDAGFilter(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeRunPage(w, r, orch, filteredDAGs(orch, r, filter))
+	}
+}
+
+func listDAGRunsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		writeRunPage(w, r, orch, dagtype.DAGList{dag})
+	}
+}
+
+func getRunV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dag := getV1DAG(orch, w, r)
+		if dag == nil {
+			return
+		}
+		rows := orch.RetrieveDagRuns(dagruntable.Filter{
+			DagIDs: []int{dag.ID},
+			RunID:  mux.Vars(r)["id"],
+			Limit:  1,
+		})
+		if len(rows) == 0 {
+			writeAPIError(w, http.StatusNotFound, "there is no run with the given id")
+			return
+		}
+		writeJSON(w, http.StatusOK, newRunV1(orch, rows[0], dag))
+	}
+}
+
+// followRunLogs returns the log subscription for the request, writing an error if there is none
+func followRunLogs(
+	orch *orchestrator.Orchestrator,
+	w http.ResponseWriter,
+	r *http.Request,
+	follow bool,
+) *logstore.Subscription {
+	dag := getV1DAG(orch, w, r)
+	if dag == nil {
+		return nil
+	}
+	queryInts, err := getQueryInts(r, "attempt", "offset", "limit", "tail")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	subscription, err := orch.FollowDAGRunLogs(
+		dag.Config.Name,
+		mux.Vars(r)["id"],
+		queryInts["attempt"],
+		logReadOptions(r, queryInts),
+		follow,
+	)
+	if err == logstore.ErrNotFound {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	return subscription
+}
+
+func getRunLogsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription := followRunLogs(orch, w, r, false)
+		if subscription == nil {
+			return
+		}
+		page := logPageV1{make([]logLineV1, 0, len(subscription.Backlog))}
+		for _, line := range subscription.Backlog {
+			page.Items = append(page.Items, logLineV1{line.Number, line.Text})
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func streamRunLogsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		follow := true
+		if followString := r.URL.Query().Get("follow"); followString != "" {
+			var err error
+			follow, err = strconv.ParseBool(followString)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "query parameter follow must be a boolean")
+				return
+			}
+		}
+		subscription := followRunLogs(orch, w, r, follow)
+		if subscription == nil {
+			return
+		}
+		defer subscription.Cancel()
+		setHeaders(w)
+		streamLogEvents(w, r, subscription)
+	}
+}
+
+func listSchedulerQueueV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := getDAGFilter(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		visible := make(map[string]bool)
+		for _, dag := range filteredDAGs(orch, r, filter) {
+			visible[dag.Config.Name] = true
+		}
+		reasons := stringutils.NewStringSet(r.URL.Query()["reason"])
+		queue := schedulerQueueV1{make([]decisionV1, 0)}
+		for _, decision := range orch.SchedulerDecisions() {
+			if visible[decision.DAG] && (len(reasons) == 0 || reasons.Contains(decision.Reason)) {
+				queue.Items = append(queue.Items, newDecisionV1(decision))
+			}
+		}
+		writeJSON(w, http.StatusOK, queue)
+	}
+}
+
+func listMetricsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dagFilter, err := getDAGFilter(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		times, err := getQueryTimes(r, "since", "until")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query, err := parsePageQuery(r, idSortFields, "id")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		afterID, err := query.afterID()
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		page := metricPageV1{Items: make([]metricV1, 0)}
+		// Metrics are only returned for current DAGs the principal may view
+		dags := filteredDAGs(orch, r, dagFilter)
+		if len(dags) == 0 {
+			writeJSON(w, http.StatusOK, page)
+			return
+		}
+		filter := metricstable.Filter{
+			DagNames:   make([]string, 0, len(dags)),
+			RunID:      r.URL.Query().Get("run"),
+			Since:      times["since"],
+			Until:      times["until"],
+			Descending: query.Descending,
+			Limit:      query.Limit + 1,
+		}
+		for _, dag := range dags {
+			filter.DagNames = append(filter.DagNames, dag.Config.Name)
+		}
+		if query.Descending {
+			filter.BeforeID = afterID
+		} else {
+			filter.AfterID = afterID
+		}
+		rows := orch.RetrieveMetrics(filter)
+		if len(rows) > query.Limit {
+			rows = rows[:query.Limit]
+			page.NextCursor = encodeCursor(query.sortName(), []string{strconv.Itoa(rows[len(rows)-1].ID)})
+		}
+		for _, row := range rows {
+			page.Items = append(page.Items, newMetricV1(row))
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func listAuditEventsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The audit log spans every DAG so it is restricted to global admins
+		if !auth.Allowed(r.Context(), auth.Admin, auth.Resource{}) {
+			writeAPIError(w, http.StatusForbidden, forbiddenMsg)
+			return
+		}
+		times, err := getQueryTimes(r, "since", "until")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query, err := parsePageQuery(r, idSortFields, "-id")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		afterID, err := query.afterID()
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter := audittable.Filter{
+			Actor:     r.URL.Query().Get("actor"),
+			Action:    r.URL.Query().Get("action"),
+			DagName:   r.URL.Query().Get("dag"),
+			RunID:     r.URL.Query().Get("run"),
+			Since:     times["since"],
+			Until:     times["until"],
+			Ascending: !query.Descending,
+			Limit:     query.Limit + 1,
+		}
+		if query.Descending {
+			filter.BeforeID = afterID
+		} else {
+			filter.AfterID = afterID
+		}
+		events, _ := orch.RetrieveAuditEvents(filter)
+		page := auditPageV1{Items: make([]auditEventV1, 0, len(events))}
+		if len(events) > query.Limit {
+			events = events[:query.Limit]
+			page.NextCursor = encodeCursor(query.sortName(), []string{strconv.Itoa(events[len(events)-1].ID)})
+		}
+		for _, event := range events {
+			page.Items = append(page.Items, newAuditEventV1(event))
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
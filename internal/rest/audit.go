@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"fmt"
+	"goflow/internal/auth"
+	"goflow/internal/dag/orchestrator"
+	audittable "goflow/internal/dag/sql/audit"
+	"goflow/internal/jsonpanic"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const anonymousActor = "anonymous"
+
+// defaultAuditLimit and maxAuditLimit bound the number of audit events returned per page
+const defaultAuditLimit = 100
+const maxAuditLimit = 1000
+
+// auditActor returns the name of the principal making the request
+func auditActor(r *http.Request) string {
+	principal := auth.PrincipalFromContext(r.Context())
+	if principal == nil {
+		return anonymousActor
+	}
+	return principal.Name
+}
+
+// sourceIP returns the IP address the request was sent from
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordAudit stores an audit event for an action taken through a request
+func recordAudit(
+	orch *orchestrator.Orchestrator,
+	r *http.Request,
+	action, dagName, runID string,
+	before, after interface{},
+) {
+	orch.RecordAuditEvent(auditActor(r), action, dagName, runID, before, after, sourceIP(r))
+}
+
+// auditPage is a page of audit events
+type auditPage struct {
+	Events []audittable.Row
+	Total  int
+	Limit  int
+	Offset int
+}
+
+// getAuditFilter parses the audit filter from the query parameters of the request
+func getAuditFilter(r *http.Request) (audittable.Filter, error) {
+	queryInts, err := getQueryInts(r, "limit", "offset")
+	if err != nil {
+		return audittable.Filter{}, err
+	}
+	query := r.URL.Query()
+	filter := audittable.Filter{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		DagName: query.Get("dag"),
+		RunID:   query.Get("run"),
+		Limit:   queryInts["limit"],
+		Offset:  queryInts["offset"],
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		*target, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return audittable.Filter{}, fmt.Errorf("query parameter %s must be an RFC 3339 time", name)
+		}
+	}
+	return filter, nil
+}
+
+func registerAuditHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
+	router.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		// The audit log spans every DAG so it is restricted to global admins
+		if !auth.Allowed(r.Context(), auth.Admin, auth.Resource{}) {
+			writeForbidden(w, r)
+			return
+		}
+		filter, err := getAuditFilter(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		events, total := orch.RetrieveAuditEvents(filter)
+		fmt.Fprint(w, jsonpanic.JSONPanic(auditPage{events, total, filter.Limit, filter.Offset}))
+	}).Methods(http.MethodGet)
+}
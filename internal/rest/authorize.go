@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"goflow/internal/auth"
+	"goflow/internal/dag/dagtype"
+	"goflow/internal/dag/orchestrator"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const forbiddenMsg = "permission denied"
+
+// requiredRole returns the role needed for a request based on its method
+func requiredRole(r *http.Request) auth.Role {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return auth.Viewer
+	case http.MethodPut:
+		return auth.Operator
+	default:
+		return auth.Admin
+	}
+}
+
+// dagResource returns the resource for a DAG
+func dagResource(dag *dagtype.DAG) auth.Resource {
+	return auth.Resource{DAG: dag.Config.Name, Namespace: dag.Config.Namespace}
+}
+
+// requestResource returns the resource named by the {name} route variable
+// ok is false for routes that do not act on a single DAG
+// The {name} route variable is reserved for DAG names, routes naming anything else, such as
+// datasets or pools, use another variable so that it is not authorized as a DAG
+func requestResource(orch *orchestrator.Orchestrator, r *http.Request) (resource auth.Resource, ok bool) {
+	dagName, ok := mux.Vars(r)["name"]
+	if !ok {
+		return auth.Resource{}, false
+	}
+	dag := orch.GetDag(dagName)
+	if dag == nil {
+		return auth.Resource{DAG: dagName}, true
+	}
+	return dagResource(dag), true
+}
+
+func writeForbidden(w http.ResponseWriter, r *http.Request) {
+	writeRequestError(w, r, http.StatusForbidden, forbiddenMsg)
+}
+
+// authorizationMiddleware rejects requests whose principal lacks the role required for the route
+// Routes not acting on a single DAG only require the role for some DAG, their handlers narrow
+// down access further
+func authorizationMiddleware(orch *orchestrator.Orchestrator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			role := requiredRole(r)
+			resource, ok := requestResource(orch, r)
+			allowed := auth.AllowedAnywhere(r.Context(), role)
+			if ok {
+				allowed = auth.Allowed(r.Context(), role, resource)
+			}
+			if !allowed {
+				writeForbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// visibleDAGs returns the DAGs the principal of a request may view
+func visibleDAGs(r *http.Request, dags dagtype.DAGList) dagtype.DAGList {
+	visible := make(dagtype.DAGList, 0, len(dags))
+	for _, dag := range dags {
+		if auth.Allowed(r.Context(), auth.Viewer, dagResource(dag)) {
+			visible = append(visible, dag)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"fmt"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/orchestrator"
+	audittable "goflow/internal/dag/sql/audit"
+	"goflow/internal/jsonpanic"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func registerDatasetHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
+	router.HandleFunc("/datasets/{dataset}/events", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		dataset := mux.Vars(r)["dataset"]
+		if !dagconfig.IsDatasetNameValid(dataset) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(fmt.Sprintf("dataset %q is not a valid dataset name", dataset)))
+			return
+		}
+		event := orch.SignalDatasetUpdate(dataset, auditActor(r))
+		recordAudit(orch, r, audittable.ActionDatasetUpdate, "", "", nil, event)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, jsonpanic.JSONPanic(event))
+	}).Methods(http.MethodPost)
+}
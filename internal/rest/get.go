@@ -2,16 +2,25 @@ package rest
 
 import (
 	"fmt"
+	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/dagtype"
 	"goflow/internal/dag/orchestrator"
+	"goflow/internal/jsonpanic"
+	"goflow/internal/logstore"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 const missingDagMsg = "\"There is no DAG with given name\""
 
+// logStreamRetry is how many milliseconds log streams that fell behind wait before reconnecting
+const logStreamRetry = 1000
+
 func getDAGNameFromRequest(orch *orchestrator.Orchestrator,
 	w http.ResponseWriter,
 	r *http.Request) string {
@@ -40,7 +49,7 @@ func registerGetHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
 
 	router.HandleFunc("/dags", func(w http.ResponseWriter, r *http.Request) {
 		setHeaders(w)
-		dags := orch.DAGs()
+		dags := visibleDAGs(r, orch.DAGs())
 		sort.Sort(dagtype.ByName(dags))
 		fmt.Fprint(w, dags)
 	})
@@ -58,7 +67,27 @@ func registerGetHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
 		if dag == nil {
 			return
 		}
-		fmt.Fprint(w, dag.DAGRuns)
+		fmt.Fprint(w, dag.Runs())
+	})
+
+	router.HandleFunc("/dag/{name}/render", func(w http.ResponseWriter, r *http.Request) {
+		dag := getDagFromRequest(orch, w, r)
+		if dag == nil {
+			return
+		}
+		executionDate, err := getExecutionDate(r, dag)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		manifest, err := dag.Render(executionDate)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		fmt.Fprint(w, jsonpanic.JSONPanicFormat(manifest))
 	})
 
 	router.HandleFunc("/dag/{name}/metrics", func(w http.ResponseWriter, r *http.Request) {
@@ -66,9 +95,201 @@ func registerGetHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
 		metrics, err := orch.RetrieveDAGMetrics(dagName)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, err.Error())
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		setHeaders(w)
+		fmt.Fprint(w, metrics)
+	})
+
+	router.HandleFunc("/dag/{name}/runs/{id}/metrics", func(w http.ResponseWriter, r *http.Request) {
+		dagName := getDAGNameFromRequest(orch, w, r)
+		runID := mux.Vars(r)["id"]
+		metrics, err := orch.RetrieveDAGRunMetrics(dagName, runID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, missingDagMsg)
+			return
 		}
 		setHeaders(w)
 		fmt.Fprint(w, metrics)
 	})
+
+	router.HandleFunc("/dag/{name}/runs/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		dag := getDagFromRequest(orch, w, r)
+		if dag == nil {
+			return
+		}
+		queryInts, err := getQueryInts(r, "attempt", "offset", "limit", "tail")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		logLines, err := orch.RetrieveDAGRunLogs(
+			dag.Config.Name,
+			mux.Vars(r)["id"],
+			queryInts["attempt"],
+			logstore.ReadOptions{
+				Offset: queryInts["offset"],
+				Limit:  queryInts["limit"],
+				Tail:   queryInts["tail"],
+			},
+		)
+		if err == logstore.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		fmt.Fprint(w, jsonpanic.JSONPanic(logLines))
+	})
+
+	router.HandleFunc("/dag/{name}/runs/{id}/logs/stream", func(w http.ResponseWriter, r *http.Request) {
+		dag := getDagFromRequest(orch, w, r)
+		if dag == nil {
+			return
+		}
+		queryInts, err := getQueryInts(r, "attempt", "offset", "limit", "tail")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		follow := true
+		if followString := r.URL.Query().Get("follow"); followString != "" {
+			follow, err = strconv.ParseBool(followString)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, jsonpanic.JSONPanic("query parameter follow must be a boolean"))
+				return
+			}
+		}
+		subscription, err := orch.FollowDAGRunLogs(
+			dag.Config.Name,
+			mux.Vars(r)["id"],
+			queryInts["attempt"],
+			logReadOptions(r, queryInts),
+			follow,
+		)
+		if err == logstore.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		defer subscription.Cancel()
+		streamLogEvents(w, r, subscription)
+	})
+}
+
+// logReadOptions returns the lines of a log selected by the query parameters, or the lines after
+// the Last-Event-ID of a reconnecting log stream
+func logReadOptions(r *http.Request, queryInts map[string]int) logstore.ReadOptions {
+	if lastEventID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && lastEventID >= 0 {
+		return logstore.ReadOptions{Offset: lastEventID + 1, Limit: queryInts["limit"]}
+	}
+	return logstore.ReadOptions{
+		Offset: queryInts["offset"],
+		Limit:  queryInts["limit"],
+		Tail:   queryInts["tail"],
+	}
+}
+
+// streamLogEvents writes the backlog and live lines of a log subscription as server-sent events,
+// ending with an "end" event once no more lines will follow, or with an "error" event asking the
+// client to reconnect after the last line if it fell behind the live lines
+func streamLogEvents(w http.ResponseWriter, r *http.Request, subscription *logstore.Subscription) {
+	w.Header().Set("Content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, canFlush := w.(http.Flusher)
+	flush := func() {
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+	ctx, cancel := streamContext(r)
+	defer cancel()
+	lastEventID := ""
+	for _, line := range subscription.Backlog {
+		writeLogEvent(w, line)
+		lastEventID = strconv.Itoa(line.Number)
+	}
+	flush()
+	for {
+		line, ok := subscription.Next(ctx)
+		if !ok {
+			break
+		}
+		writeLogEvent(w, line)
+		lastEventID = strconv.Itoa(line.Number)
+		flush()
+	}
+	switch {
+	case ctx.Err() != nil:
+	case subscription.Dropped():
+		fmt.Fprintf(
+			w,
+			"retry: %d\nid: %s\nevent: error\ndata: fell behind the live logs\n\n",
+			logStreamRetry,
+			lastEventID,
+		)
+		flush()
+	default:
+		fmt.Fprint(w, "event: end\ndata: \n\n")
+		flush()
+	}
+}
+
+func writeLogEvent(w http.ResponseWriter, line logstore.Line) {
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.Number, strings.ReplaceAll(line.Text, "\r", ""))
+}
+
+// getExecutionDate returns the execution date given by the date query parameter, as a date or an
+// RFC 3339 time, defaulting to the next scheduled execution of the DAG
+func getExecutionDate(r *http.Request, dag *dagtype.DAG) (time.Time, error) {
+	dateString := r.URL.Query().Get("date")
+	if dateString == "" {
+		return dag.NextExecutionDate(), nil
+	}
+	if date, err := time.Parse(dagconfig.DateFormat, dateString); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, dateString)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"query parameter date must have the format %s or be an RFC 3339 time",
+			dagconfig.DateFormat,
+		)
+	}
+	return date, nil
+}
+
+// getQueryInts returns the non-negative integer query parameters with the given names
+// Missing parameters are returned as 0
+func getQueryInts(r *http.Request, names ...string) (map[string]int, error) {
+	values := make(map[string]int)
+	query := r.URL.Query()
+	for _, name := range names {
+		valueString := query.Get(name)
+		if valueString == "" {
+			values[name] = 0
+			continue
+		}
+		value, err := strconv.Atoi(valueString)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("query parameter %s must be a non-negative integer", name)
+		}
+		values[name] = value
+	}
+	return values, nil
 }
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"fmt"
+	"goflow/internal/dag/orchestrator"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// leaderV1 tells which replica schedules DAGs, Leader is empty without leader election
+type leaderV1 struct {
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"isLeader"`
+}
+
+// shardV1 is the share of the DAGs that a live instance schedules
+type shardV1 struct {
+	Instance string   `json:"instance"`
+	DAGs     []string `json:"dags"`
+}
+
+// shardsV1 lists the live instances of a sharded deployment, it is empty without sharding
+type shardsV1 struct {
+	Instance string    `json:"instance"`
+	Items    []shardV1 `json:"items"`
+}
+
+// leaderMiddleware turns down the requests changing anything on replicas that are not the leader,
+// or changing a DAG that another instance schedules, since their DAGs are not scheduled there
+func leaderMiddleware(orch *orchestrator.Orchestrator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if !orch.IsLeader() {
+					message := "this replica is not the leader and no leader was elected yet"
+					if leader := orch.Leader(); leader != "" {
+						message = "this replica is not the leader, send changes to " + leader
+					}
+					writeRequestError(w, r, http.StatusServiceUnavailable, message)
+					return
+				}
+				if name, ok := mux.Vars(r)["name"]; ok {
+					if owner, owned := orch.DAGOwner(name); !owned {
+						message := fmt.Sprintf("DAG %s is not scheduled by any instance yet", name)
+						if owner != "" {
+							message = fmt.Sprintf("DAG %s is scheduled by another instance, send changes to %s", name, owner)
+						}
+						writeRequestError(w, r, http.StatusServiceUnavailable, message)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func getLeaderV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, leaderV1{orch.Leader(), orch.IsLeader()})
+	}
+}
+
+func listShardsV1(orch *orchestrator.Orchestrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shards := orch.Shards()
+		items := make([]shardV1, 0, len(shards))
+		for _, shard := range shards {
+			items = append(items, shardV1{shard.Instance, shard.DAGs})
+		}
+		writeJSON(w, http.StatusOK, shardsV1{orch.Config().Sharding.ID(), items})
+	}
+}
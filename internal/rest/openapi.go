@@ -0,0 +1,485 @@
+package rest
+
+import (
+	"encoding/json"
+	dagconfig "goflow/internal/dag/config"
+	"goflow/internal/dag/orchestrator"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiParameter documents a query parameter of a route of the versioned API
+type apiParameter struct {
+	Name        string
+	Type        string
+	Description string
+	Repeated    bool
+}
+
+// apiRoute is a route of the versioned API
+// The same description is used to register the route and to generate the OpenAPI document, so
+// the document always lists the routes that are actually served
+type apiRoute struct {
+	Method      string
+	Path        string
+	Summary     string
+	Parameters  []apiParameter
+	Request     interface{}
+	Status      int
+	Response    interface{}
+	ContentType string
+	Handler     http.HandlerFunc
+}
+
+func pageParameters(sortFields []string, defaultSort string) []apiParameter {
+	return []apiParameter{
+		{"limit", "integer", "Maximum number of items per page, at most " + strconv.Itoa(maxPageLimit), false},
+		{"cursor", "string", "The nextCursor of the previous page", false},
+		{
+			"sort",
+			"string",
+			"One of " + strings.Join(sortFields, ", ") + ", prefixed with - for descending order, " +
+				"defaults to " + defaultSort,
+			false,
+		},
+	}
+}
+
+var dagFilterParameters = []apiParameter{
+	{"dag", "string", "Only include the DAGs with these names", true},
+	{"namespace", "string", "Only include the DAGs in these namespaces", true},
+	{"label", "string", "Only include the DAGs with this label, given as key=value", true},
+	{"isOn", "boolean", "Only include DAGs that are turned on or off", false},
+}
+
+var timeRangeParameters = []apiParameter{
+	{"since", "date-time", "Only include items at or after this time", false},
+	{"until", "date-time", "Only include items before this time", false},
+}
+
+var runFilterParameters = []apiParameter{
+	{"status", "string", "Only include the runs with these statuses", true},
+	{"trigger", "string", "Only include the runs triggered in these ways, scheduled or manual", true},
+	{"since", "date-time", "Only include runs with an execution date at or after this time", false},
+	{"until", "date-time", "Only include runs with an execution date before this time", false},
+}
+
+var logParameters = []apiParameter{
+	{"attempt", "integer", "The attempt to read the logs of, defaults to the most recent one", false},
+	{"offset", "integer", "Number of lines to skip", false},
+	{"limit", "integer", "Maximum number of lines to read", false},
+	{"tail", "integer", "Only read this many lines from the end", false},
+}
+
+func joinParameters(parameterLists ...[]apiParameter) []apiParameter {
+	parameters := make([]apiParameter, 0)
+	for _, parameterList := range parameterLists {
+		parameters = append(parameters, parameterList...)
+	}
+	return parameters
+}
+
+// apiV1Routes returns the routes of the versioned API
+func apiV1Routes(orch *orchestrator.Orchestrator) []apiRoute {
+	return []apiRoute{
+		{
+			Method:     http.MethodGet,
+			Path:       "/dags",
+			Summary:    "List DAGs",
+			Parameters: joinParameters(dagFilterParameters, pageParameters(dagSortFields, "name")),
+			Status:     http.StatusOK,
+			Response:   dagPageV1{},
+			Handler:    listDAGsV1(orch),
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/dags",
+			Summary:  "Write a DAG file, the DAG is loaded on the next collection cycle",
+			Request:  dagconfig.DAGConfig{},
+			Status:   http.StatusAccepted,
+			Response: dagconfig.DAGConfig{},
+			Handler:  writeDAGV1(orch),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/dags/{name}",
+			Summary:  "Get a DAG",
+			Status:   http.StatusOK,
+			Response: dagV1{},
+			Handler:  getDAGV1(orch),
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/dags/{name}/toggle",
+			Summary:  "Turn a DAG on or off",
+			Status:   http.StatusOK,
+			Response: dagV1{},
+			Handler:  toggleDAGV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/dags/{name}/render",
+			Summary: "Render the pod, Job or process a run of a DAG would create, without creating anything",
+			Parameters: []apiParameter{{
+				"date",
+				"string",
+				"Execution date of the run, as " + dagconfig.DateFormat + " or an RFC 3339 time, " +
+					"defaults to the next scheduled execution",
+				false,
+			}},
+			Status: http.StatusOK,
+			// The Kubernetes Pod manifest is not described field by field
+			Response: map[string]interface{}{},
+			Handler:  renderDAGV1(orch),
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/dags/{name}/trigger",
+			Summary:  "Start a manually triggered run of a DAG, executing at the current time",
+			Status:   http.StatusAccepted,
+			Response: runV1{},
+			Handler:  triggerDAGV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/dags/{name}/runs",
+			Summary: "List the stored runs of a DAG along with their number per status",
+			Parameters: joinParameters(
+				runFilterParameters,
+				pageParameters(runSortFields, "-executionDate"),
+			),
+			Status:   http.StatusOK,
+			Response: runPageV1{},
+			Handler:  listDAGRunsV1(orch),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/dags/{name}/runs/{id}",
+			Summary:  "Get a run of a DAG",
+			Status:   http.StatusOK,
+			Response: runV1{},
+			Handler:  getRunV1(orch),
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/dags/{name}/runs/{id}/cancel",
+			Summary:  "Cancel an active run by deleting its pod, the run is then stored as Cancelled",
+			Status:   http.StatusAccepted,
+			Response: runV1{},
+			Handler:  cancelRunV1(orch),
+		},
+		{
+			Method:     http.MethodGet,
+			Path:       "/dags/{name}/runs/{id}/logs",
+			Summary:    "Get the stored logs of a run",
+			Parameters: logParameters,
+			Status:     http.StatusOK,
+			Response:   logPageV1{},
+			Handler:    getRunLogsV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/dags/{name}/runs/{id}/logs/stream",
+			Summary: "Stream the logs of a run as server-sent events",
+			Parameters: joinParameters(logParameters, []apiParameter{{
+				"follow", "boolean", "Keep streaming lines while the run is writing logs, defaults to true", false,
+			}}),
+			Status:      http.StatusOK,
+			ContentType: "text/event-stream",
+			Handler:     streamRunLogsV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/runs",
+			Summary: "List the stored runs of all DAGs along with their number per status",
+			Parameters: joinParameters(
+				dagFilterParameters,
+				runFilterParameters,
+				pageParameters(runSortFields, "-executionDate"),
+			),
+			Status:   http.StatusOK,
+			Response: runPageV1{},
+			Handler:  listRunsV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/metrics",
+			Summary: "List the resource usage metrics of DAG runs",
+			Parameters: joinParameters(
+				dagFilterParameters,
+				[]apiParameter{{"run", "string", "Only include the metrics of this run", false}},
+				timeRangeParameters,
+				pageParameters(idSortFields, "id"),
+			),
+			Status:   http.StatusOK,
+			Response: metricPageV1{},
+			Handler:  listMetricsV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/scheduler/queue",
+			Summary: "List the runs that are due or waiting but not started, with the reason why",
+			Parameters: joinParameters(
+				dagFilterParameters,
+				[]apiParameter{{
+					"reason",
+					"string",
+					"Only include the runs held for these reasons, such as paused, max_active_runs, " +
+						"pool_full or waiting_on_dependency",
+					true,
+				}},
+			),
+			Status:   http.StatusOK,
+			Response: schedulerQueueV1{},
+			Handler:  listSchedulerQueueV1(orch),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/leader",
+			Summary:  "Get the replica that schedules DAGs, the others only serve reads",
+			Status:   http.StatusOK,
+			Response: leaderV1{},
+			Handler:  getLeaderV1(orch),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/shards",
+			Summary:  "List the live instances and the DAGs each of them schedules, with sharding",
+			Status:   http.StatusOK,
+			Response: shardsV1{},
+			Handler:  listShardsV1(orch),
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/audit",
+			Summary: "List audit events",
+			Parameters: joinParameters(
+				[]apiParameter{
+					{"actor", "string", "Only include the events of this actor", false},
+					{"action", "string", "Only include the events of this action", false},
+					{"dag", "string", "Only include the events of this DAG", false},
+					{"run", "string", "Only include the events of this run", false},
+				},
+				timeRangeParameters,
+				pageParameters(idSortFields, "-id"),
+			),
+			Status:   http.StatusOK,
+			Response: auditPageV1{},
+			Handler:  listAuditEventsV1(orch),
+		},
+	}
+}
+
+// registerAPIV1Handles registers the routes of the versioned API along with its OpenAPI document
+func registerAPIV1Handles(orch *orchestrator.Orchestrator, router *mux.Router) {
+	apiRouter := router.PathPrefix(apiV1Prefix).Subrouter()
+	apiRouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "no route matches the request path")
+	})
+	apiRouter.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The catch-all OPTIONS route of the parent router marks every request as a method
+		// mismatch, so the API routes are matched again to tell unknown paths apart
+		match := mux.RouteMatch{}
+		apiRouter.Match(r, &match)
+		if match.MatchErr != mux.ErrMethodMismatch {
+			writeAPIError(w, http.StatusNotFound, "no route matches the request path")
+			return
+		}
+		writeAPIError(w, http.StatusMethodNotAllowed, "the route does not support the request method")
+	})
+	routes := apiV1Routes(orch)
+	for _, route := range routes {
+		apiRouter.HandleFunc(route.Path, route.Handler).Methods(route.Method)
+	}
+	document := openAPIDocument(routes)
+	apiRouter.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, document)
+	}).Methods(http.MethodGet)
+}
+
+var pathParameterRegex = regexp.MustCompile(`{([^}]+)}`)
+
+// openAPIDocument returns the OpenAPI 3 document describing the routes
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		path := apiV1Prefix + route.Path
+		pathItem, ok := paths[path].(map[string]interface{})
+		if !ok {
+			pathItem = make(map[string]interface{})
+			paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(route.Method)] = operationOf(route, schemas)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "goflow API",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"basic": []string{}},
+		},
+	}
+}
+
+func operationOf(route apiRoute, schemas map[string]interface{}) map[string]interface{} {
+	parameters := make([]interface{}, 0)
+	for _, match := range pathParameterRegex.FindAllStringSubmatch(route.Path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, parameter := range route.Parameters {
+		schema := parameterSchema(parameter.Type)
+		if parameter.Repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":        parameter.Name,
+			"in":          "query",
+			"description": parameter.Description,
+			"schema":      schema,
+		})
+	}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaOf(reflect.TypeOf(errorEnvelope{}), schemas),
+			},
+		},
+	}
+	response := map[string]interface{}{"description": http.StatusText(route.Status)}
+	switch {
+	case route.ContentType != "":
+		response["content"] = map[string]interface{}{
+			route.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+	case route.Response != nil:
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaOf(reflect.TypeOf(route.Response), schemas),
+			},
+		}
+	}
+	operation := map[string]interface{}{
+		"summary":    route.Summary,
+		"parameters": parameters,
+		"responses": map[string]interface{}{
+			strconv.Itoa(route.Status): response,
+			"default":                  errorResponse,
+		},
+	}
+	if route.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schemaOf(reflect.TypeOf(route.Request), schemas),
+				},
+			},
+		}
+	}
+	return operation
+}
+
+func parameterSchema(parameterType string) map[string]interface{} {
+	if parameterType == "date-time" {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	return map[string]interface{}{"type": parameterType}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// schemaName returns the name a struct type is documented under
+func schemaName(structType reflect.Type) string {
+	name := strings.TrimSuffix(structType.Name(), "V1")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// schemaOf returns the JSON schema of a type, adding named struct types to schemas
+func schemaOf(valueType reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch valueType.Kind() {
+	case reflect.Ptr:
+		schema := schemaOf(valueType.Elem(), schemas)
+		return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(valueType.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaOf(valueType.Elem(), schemas),
+		}
+	case reflect.Struct:
+		if valueType == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		// Types with their own encoding, like resource quantities, are not described by their fields
+		if valueType.Implements(marshalerType) || reflect.PtrTo(valueType).Implements(marshalerType) {
+			return map[string]interface{}{}
+		}
+		name := schemaName(valueType)
+		reference := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return reference
+		}
+		properties := make(map[string]interface{})
+		// The schema is registered before its fields so that recursive types terminate
+		schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldName := jsonFieldName(field)
+			if fieldName == "-" {
+				continue
+			}
+			properties[fieldName] = schemaOf(field.Type, schemas)
+		}
+		return reference
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// jsonFieldName returns the name a struct field is encoded under
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"goflow/internal/auth"
+	"goflow/internal/dag/orchestrator"
+	audittable "goflow/internal/dag/sql/audit"
+	"goflow/internal/jsonpanic"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// poolSize is the body of requests resizing a pool
+type poolSize struct {
+	Slots *int
+}
+
+func registerPoolHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
+	router.HandleFunc("/pools", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		fmt.Fprint(w, jsonpanic.JSONPanic(orch.Pools().List()))
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/pools/{pool}", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		occupancy, ok := orch.Pools().Get(mux.Vars(r)["pool"])
+		if !ok {
+			writeRequestError(w, r, http.StatusNotFound, "there is no pool with given name")
+			return
+		}
+		fmt.Fprint(w, jsonpanic.JSONPanic(occupancy))
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/pools/{pool}", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		// Pools are shared by every DAG, so only admins of all DAGs may resize them
+		// The pool is only resized on this instance, other instances keep their own slots
+		if !auth.Allowed(r.Context(), auth.Admin, auth.Resource{}) {
+			writeForbidden(w, r)
+			return
+		}
+		size := poolSize{}
+		requestBytes, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(requestBytes, &size)
+		}
+		if err != nil || size.Slots == nil || *size.Slots < 0 {
+			writeRequestError(w, r, http.StatusBadRequest, "request body must give a number of slots that is not negative")
+			return
+		}
+		name := mux.Vars(r)["pool"]
+		var before interface{}
+		if occupancy, ok := orch.Pools().Get(name); ok {
+			before = occupancy
+		}
+		occupancy := orch.Pools().Resize(name, *size.Slots)
+		recordAudit(orch, r, audittable.ActionPoolResize, "", "", before, occupancy)
+		fmt.Fprint(w, jsonpanic.JSONPanic(occupancy))
+	}).Methods(http.MethodPut)
+}
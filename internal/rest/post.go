@@ -3,8 +3,10 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"goflow/internal/auth"
 	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/orchestrator"
+	audittable "goflow/internal/dag/sql/audit"
 	"io/ioutil"
 	"net/http"
 
@@ -21,12 +23,36 @@ func registerPostHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
 			fmt.Fprint(w, err.Error())
 		}
 		json.Unmarshal(requestBytes, dagConfig)
+		if !canWriteDAG(orch, r, dagConfig) {
+			writeForbidden(w, r)
+			return
+		}
+		var previousConfig interface{}
+		if existingDAG := orch.GetDag(dagConfig.Name); existingDAG != nil {
+			previousConfig = existingDAG.Config
+		}
 		status, err := orch.WriteDAGFile(dagConfig)
 		if err != nil {
 			w.WriteHeader(status)
 			fmt.Fprint(w, err.Error())
 			return
 		}
+		recordAudit(orch, r, audittable.ActionDAGWrite, dagConfig.Name, "", previousConfig, dagConfig)
 		fmt.Fprint(w, "DAG write success")
 	}).Methods(http.MethodPost)
 }
+
+// canWriteDAG returns true if the principal of the request is an admin for the DAG being
+// written and for the DAG it replaces, if any
+func canWriteDAG(orch *orchestrator.Orchestrator, r *http.Request, dagConfig *dagconfig.DAGConfig) bool {
+	namespace := dagConfig.Namespace
+	if namespace == "" {
+		namespace = orch.Config().ClusterNamespace(dagConfig.Cluster)
+	}
+	resource := auth.Resource{DAG: dagConfig.Name, Namespace: namespace}
+	if !auth.Allowed(r.Context(), auth.Admin, resource) {
+		return false
+	}
+	existingDAG := orch.GetDag(dagConfig.Name)
+	return existingDAG == nil || auth.Allowed(r.Context(), auth.Admin, dagResource(existingDAG))
+}
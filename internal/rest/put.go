@@ -3,6 +3,7 @@ package rest
 import (
 	"fmt"
 	"goflow/internal/dag/orchestrator"
+	audittable "goflow/internal/dag/sql/audit"
 
 	"net/http"
 
@@ -23,7 +24,17 @@ func registerPutHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
 				fmt.Fprint(w, "DAG not found!")
 				return
 			}
+			wasOn := dag.IsOn
 			dag.ToggleOnOff()
+			recordAudit(
+				orch,
+				r,
+				audittable.ActionDAGToggle,
+				name,
+				"",
+				map[string]bool{"IsOn": wasOn},
+				map[string]bool{"IsOn": dag.IsOn},
+			)
 			fmt.Fprintf(w, "%t", dag.IsOn)
 		},
 	).Methods(
@@ -1,19 +1,40 @@
 package rest
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"goflow/internal/auth"
 	"goflow/internal/config"
 	dagconfig "goflow/internal/dag/config"
 	"goflow/internal/dag/dagtype"
 	"goflow/internal/dag/metrics"
 	"goflow/internal/dag/orchestrator"
+	"goflow/internal/dag/pool"
 	dagrun "goflow/internal/dag/run"
+	audittable "goflow/internal/dag/sql/audit"
 	dagtable "goflow/internal/dag/sql/dag"
 	dagruntable "goflow/internal/dag/sql/dagrun"
+	datasettable "goflow/internal/dag/sql/dataset"
+	metricstable "goflow/internal/dag/sql/metrics"
+	slatable "goflow/internal/dag/sql/sla"
 	"goflow/internal/database"
+	podutils "goflow/internal/k8s/pod/utils"
+	"goflow/internal/logstore"
+	"goflow/internal/sensor"
 	"goflow/internal/testutils"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"os"
 	"path"
 	"strings"
@@ -21,10 +42,12 @@ import (
 	"time"
 
 	"net/http"
+	"net/http/httptest"
 
 	httpretry "github.com/hashicorp/go-retryablehttp"
 
 	"github.com/google/go-cmp/cmp"
+	core "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -40,8 +63,10 @@ func getTestOrchestrator(configuration *config.GoFlowConfig) *orchestrator.Orche
 	kubeClient := fake.NewSimpleClientset()
 	configuration.DAGPath = testutils.GetDagsFolder()
 	configuration.DatabaseDNS = testutils.GetSQLiteLocation()
+	configuration.LogPath = testutils.GetLogsFolder()
 	return orchestrator.NewOrchestratorFromClientsAndConfig(
 		kubeClient,
+		nil,
 		configuration,
 		metrics.NewDAGMetricsClient(kubeClient, true),
 	)
@@ -57,26 +82,31 @@ func TestMain(m *testing.M) {
 	host = "localhost"
 	port = 8080
 	testutils.RemoveSQLiteDB()
+	testutils.RemoveLogs()
+	defer testutils.RemoveLogs()
 	orch = getTestOrchestrator(goflowConfig)
 	SQLCLIENT := database.NewSQLiteClient(testutils.GetSQLiteLocation())
 	dagTableClient := dagtable.NewTableClient(SQLCLIENT)
 	dagRunTableClient := dagruntable.NewTableClient(SQLCLIENT)
 	dagTableClient.CreateTable()
 	dagRunTableClient.CreateTable()
-	kubeClient := fake.NewSimpleClientset()
+	metricstable.NewTableClient(SQLCLIENT).CreateTable()
+	audittable.NewTableClient(SQLCLIENT).CreateTable()
+	slatable.NewTableClient(SQLCLIENT).CreateTable()
+	datasettable.NewTableClient(SQLCLIENT).CreateTable()
 	testDag = dagtype.CreateDAG(&dagconfig.DAGConfig{
 		Name:          "test",
 		StartDateTime: "2019-01-01",
 		MaxActiveRuns: 1,
-	}, "", kubeClient, dagtype.ScheduleCache{}, dagTableClient, "", dagRunTableClient, false)
+	}, "", orch.Executors(), dagtype.ScheduleCache{}, dagTableClient, "", dagRunTableClient, nil, nil, nil, sensor.Registry{"": sensor.NewFactory(nil)}, orch.Pools(), false)
 	testTime = time.Now()
 	orch.AddDAG(&testDag)
 	testDAG2 := copyDAG(testDag)
 	testDAG2.Config.Name = "test2"
 	orch.AddDAG(&testDAG2)
-	orch.GetDag(testDag.Config.Name).AddDagRun(testTime, false, nil)
+	orch.GetDag(testDag.Config.Name).AddDagRun(testTime, false)
 	testRun = orch.GetDag(testDag.Config.Name).DAGRuns[0]
-	go Serve(host, port, orch)
+	go Serve(context.Background(), host, port, orch)
 	m.Run()
 }
 
@@ -103,10 +133,10 @@ func get(suffix string) *http.Response {
 	return resp
 }
 
-func put(suffix string) *http.Response {
+func put(suffix string, content string) *http.Response {
 	url := getURL(suffix)
 	client := httpretry.NewClient()
-	request, err := httpretry.NewRequest("PUT", url, strings.NewReader(""))
+	request, err := httpretry.NewRequest("PUT", url, strings.NewReader(content))
 	if err != nil {
 		panic(err)
 	}
@@ -182,6 +212,23 @@ func TestGetDagRuns(t *testing.T) {
 	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestGetDagRender(t *testing.T) {
+	resp := get(fmt.Sprintf("dag/%s/render?date=2020-01-01", testDag.Config.Name))
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	pod := core.Pod{}
+	json.Unmarshal(readRespBytes(resp), &pod)
+	if !strings.HasPrefix(pod.Name, testDag.Config.Name+"-2020-01-0100-00-00") || pod.Labels[podutils.AppSelectorKey] != podutils.AppName {
+		t.Errorf("Expected the pod of the run executing on 2020-01-01, found %v", pod.ObjectMeta)
+	}
+
+	getAPIV1(t, "dags/"+testDag.Config.Name+"/render?date=2020-01-01T10:30:00Z", http.StatusOK, &pod)
+	if !strings.HasPrefix(pod.Name, testDag.Config.Name+"-2020-01-0110-30-00") {
+		t.Errorf("Expected the pod of the run executing at 10:30, found %s", pod.Name)
+	}
+	resp = get(fmt.Sprintf("dag/%s/render?date=tomorrow", testDag.Config.Name))
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+}
+
 func TestPostDag(t *testing.T) {
 	config := dagconfig.DAGConfig{
 		Name:          "test-dag-4",
@@ -244,12 +291,925 @@ func TestPostInvalidDag(t *testing.T) {
 func TestToggleDag(t *testing.T) {
 	orch.AddDAG(&testDag)
 	path := fmt.Sprintf("dag/%s/toggle", testDag.Config.Name)
-	put(path)
+	put(path, "")
 	if !testDag.IsOn {
 		t.Error("DAG should be on!")
 	}
-	put(path)
+	put(path, "")
 	if testDag.IsOn {
 		t.Error("DAG should be off!")
 	}
 }
+
+func getAuditPage(t *testing.T, query string) auditPage {
+	resp := get("audit?" + query)
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	page := auditPage{}
+	err := json.Unmarshal(readRespBytes(resp), &page)
+	if err != nil {
+		panic(err)
+	}
+	return page
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	page := getAuditPage(t, fmt.Sprintf("action=%s&dag=%s&limit=1", audittable.ActionDAGToggle, testDag.Config.Name))
+	if page.Total != 2 || len(page.Events) != 1 {
+		t.Fatalf("Expected 1 of 2 toggle events, found %d of %d", len(page.Events), page.Total)
+	}
+	event := page.Events[0]
+	if event.Actor != anonymousActor || event.SourceIP != "127.0.0.1" {
+		t.Errorf("Expected an anonymous event from localhost, found %s", event)
+	}
+	if event.Before != `{"IsOn":true}` || event.After != `{"IsOn":false}` {
+		t.Errorf("Expected the last toggle to turn the DAG off, found %s", event)
+	}
+
+	page = getAuditPage(t, fmt.Sprintf("action=%s&dag=test-dag-4", audittable.ActionDAGWrite))
+	if page.Total != 1 || !strings.Contains(page.Events[0].After, `"Name":"test-dag-4"`) {
+		t.Errorf("Expected the DAG write to be audited, found %v", page.Events)
+	}
+
+	resp := get("audit?since=yesterday")
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestGetSLAMisses(t *testing.T) {
+	slaTableClient := slatable.NewTableClient(database.NewSQLiteClient(testutils.GetSQLiteLocation()))
+	executionDate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, dagName := range []string{testDag.Config.Name, "not-loaded"} {
+		slaTableClient.InsertMiss(slatable.NewRow(
+			0, dagName, executionDate, executionDate.Add(time.Hour), slatable.ReasonPaused, "", "",
+		))
+	}
+	resp := get("sla-misses")
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	misses := make([]slatable.Row, 0)
+	if err := json.Unmarshal(readRespBytes(resp), &misses); err != nil {
+		panic(err)
+	}
+	if len(misses) != 1 || misses[0].DagName != testDag.Config.Name || misses[0].Reason != slatable.ReasonPaused {
+		t.Errorf("Expected only the SLA miss of the loaded DAG, found %v", misses)
+	}
+
+	resp = get("sla-misses?dag=not-loaded")
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+	resp = get("sla-misses?limit=all")
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPostDatasetEvent(t *testing.T) {
+	resp := post("datasets/orders/events", "")
+	errorCodeResponse(t, http.StatusCreated, resp.StatusCode)
+	event := datasettable.Row{}
+	if err := json.Unmarshal(readRespBytes(resp), &event); err != nil {
+		panic(err)
+	}
+	if event.Dataset != "orders" || event.Origin != datasettable.OriginExternal || event.Source != anonymousActor {
+		t.Errorf("Expected an external update of orders, found %s", event)
+	}
+	page := getAuditPage(t, "action="+audittable.ActionDatasetUpdate)
+	if page.Total != 1 || !strings.Contains(page.Events[0].After, `"Dataset":"orders"`) {
+		t.Errorf("Expected the dataset update to be audited, found %v", page.Events)
+	}
+
+	resp = post("datasets/-orders/events", "")
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPools(t *testing.T) {
+	resp := put("pools/database", `{"Slots": 2}`)
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	resp = put("pools/database", `{"Slots": 3}`)
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	page := getAuditPage(t, "action="+audittable.ActionPoolResize)
+	if page.Total != 2 || !strings.Contains(page.Events[0].Before, `"Slots":2`) {
+		t.Errorf("Expected the resizes to be audited, found %v", page.Events)
+	}
+
+	resp = get("pools/database")
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	occupancy := pool.Occupancy{}
+	if err := json.Unmarshal(readRespBytes(resp), &occupancy); err != nil {
+		panic(err)
+	}
+	if occupancy != (pool.Occupancy{Name: "database", Slots: 3}) {
+		t.Errorf("Expected the resized pool, found %v", occupancy)
+	}
+	resp = get("pools")
+	occupancies := make([]pool.Occupancy, 0)
+	if err := json.Unmarshal(readRespBytes(resp), &occupancies); err != nil {
+		panic(err)
+	}
+	if len(occupancies) != 1 || occupancies[0].Name != "database" {
+		t.Errorf("Expected the database pool to be listed, found %v", occupancies)
+	}
+
+	resp = get("pools/cluster")
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+	resp = put("pools/database", `{"Slots": -1}`)
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+	resp = put("pools/database", `{}`)
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestGetDagRunMetrics(t *testing.T) {
+	resp := get(fmt.Sprintf("dag/%s/runs/%s/metrics", testDag.Config.Name, testRun.Name))
+	bodyBytes := readRespBytes(resp)
+	metricRows := make([]metricstable.Row, 0)
+	err := json.Unmarshal(bodyBytes, &metricRows)
+	if err != nil {
+		t.Errorf("Could not parse metrics response %s: %s", bodyBytes, err)
+	}
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+
+	resp = get(fmt.Sprintf("dag/%s/runs/%s/metrics", "fake_dag", testRun.Name))
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	resp := get("metrics")
+	body := string(readRespBytes(resp))
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	for _, name := range []string{"goflow_dags_loaded", "goflow_db_query_duration_seconds"} {
+		if !strings.Contains(body, "# TYPE "+name) {
+			t.Errorf("Expected metric %s in response:\n%s", name, body)
+		}
+	}
+}
+
+func TestGetDagRunLogs(t *testing.T) {
+	store := logstore.NewLocalStore(testutils.GetLogsFolder())
+	writer, err := store.NewWriter(logstore.Key{
+		DAGName: testDag.Config.Name,
+		RunID:   testRun.Name,
+		Attempt: 1,
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(writer, "first line")
+	fmt.Fprintln(writer, "second line")
+	writer.Close()
+
+	resp := get(fmt.Sprintf("dag/%s/runs/%s/logs?tail=1", testDag.Config.Name, testRun.Name))
+	logLines := make([]string, 0)
+	err = json.Unmarshal(readRespBytes(resp), &logLines)
+	if err != nil {
+		panic(err)
+	}
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	if len(logLines) != 1 || logLines[0] != "second line" {
+		t.Errorf("Expected only the last log line, found %v", logLines)
+	}
+
+	resp = get(fmt.Sprintf("dag/%s/runs/%s/logs?tail=-1", testDag.Config.Name, testRun.Name))
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = get(fmt.Sprintf("dag/%s/runs/%s/logs", testDag.Config.Name, "missing-run"))
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamDagRunLogs(t *testing.T) {
+	key := logstore.Key{DAGName: testDag.Config.Name, RunID: testRun.Name, Attempt: 2}
+	writer, err := orch.LogStore().NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(writer, "stored line")
+
+	resp := get(fmt.Sprintf("dag/%s/runs/%s/logs/stream", testDag.Config.Name, testRun.Name))
+	defer resp.Body.Close()
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected an event stream, found content type %s", contentType)
+	}
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		event := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				panic(err)
+			}
+			if line == "\n" {
+				return event
+			}
+			event += line
+		}
+	}
+	expectEvent := func(expected string) {
+		if event := readEvent(); event != expected {
+			t.Errorf("Expected event %q, found %q", expected, event)
+		}
+	}
+	expectEvent("id: 0\ndata: stored line\n")
+	fmt.Fprintln(writer, "live line")
+	expectEvent("id: 1\ndata: live line\n")
+	writer.Close()
+	expectEvent("event: end\ndata: \n")
+}
+
+func TestStreamDagRunLogsResumes(t *testing.T) {
+	request, err := http.NewRequest(
+		http.MethodGet,
+		getURL(fmt.Sprintf("dag/%s/runs/%s/logs/stream?attempt=1", testDag.Config.Name, testRun.Name)),
+		nil,
+	)
+	if err != nil {
+		panic(err)
+	}
+	request.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		panic(err)
+	}
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	expected := "id: 1\ndata: second line\n\nevent: end\ndata: \n\n"
+	if body := string(readRespBytes(resp)); body != expected {
+		t.Errorf("Expected body %q, found %q", expected, body)
+	}
+}
+
+func TestStreamLogEventsOfDroppedSubscriber(t *testing.T) {
+	broker := orch.LogStore()
+	key := logstore.Key{DAGName: testDag.Config.Name, RunID: "slow-run", Attempt: 1}
+	writer, err := broker.NewWriter(key)
+	if err != nil {
+		panic(err)
+	}
+	defer writer.Close()
+	subscription, err := broker.Follow(key, logstore.ReadOptions{}, true)
+	if err != nil {
+		panic(err)
+	}
+	defer subscription.Cancel()
+	// Writing more lines than a subscriber buffers before it reads any drops it
+	for i := 0; i <= 1024; i++ {
+		fmt.Fprintln(writer, i)
+	}
+	recorder := httptest.NewRecorder()
+	streamLogEvents(recorder, httptest.NewRequest(http.MethodGet, "/", nil), subscription)
+	body := recorder.Body.String()
+	expected := "retry: 1000\nid: 1023\nevent: error\ndata: fell behind the live logs\n\n"
+	if !strings.HasSuffix(body, expected) || strings.Contains(body, "event: end") {
+		t.Errorf("Expected the stream to end with %q, found %q", expected, body[len(body)-100:])
+	}
+}
+
+func TestStreamDagRunLogsWithoutFollow(t *testing.T) {
+	resp := get(fmt.Sprintf(
+		"dag/%s/runs/%s/logs/stream?attempt=1&tail=1&follow=false",
+		testDag.Config.Name,
+		testRun.Name,
+	))
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	expected := "id: 1\ndata: second line\n\nevent: end\ndata: \n\n"
+	if body := string(readRespBytes(resp)); body != expected {
+		t.Errorf("Expected body %q, found %q", expected, body)
+	}
+
+	resp = get(fmt.Sprintf("dag/%s/runs/%s/logs/stream?follow=maybe", testDag.Config.Name, testRun.Name))
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = get(fmt.Sprintf("dag/%s/runs/%s/logs/stream", testDag.Config.Name, "missing-run"))
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAuthorization(t *testing.T) {
+	sqlClient := database.NewSQLiteClient(testutils.GetSQLiteLocation())
+	privateDAG := dagtype.CreateDAG(&dagconfig.DAGConfig{
+		Name:          "private",
+		Namespace:     "private",
+		StartDateTime: "2019-01-01",
+		MaxActiveRuns: 1,
+	}, "", orch.Executors(), dagtype.ScheduleCache{}, dagtable.NewTableClient(sqlClient), "",
+		dagruntable.NewTableClient(sqlClient), nil, nil, nil, nil, nil, false)
+	orch.AddDAG(&privateDAG)
+	guard, err := auth.New(config.AuthConfig{
+		Tokens: []config.TokenConfig{
+			{Name: "viewer", SHA256: auth.HashToken("viewer-token")},
+			{Name: "operator", SHA256: auth.HashToken("operator-token")},
+		},
+		Bindings: []config.RoleBinding{
+			{Role: "viewer", Users: []string{"viewer"}, Namespaces: []string{"private"}},
+			{Role: "operator", Users: []string{"operator"}},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	server := httptest.NewServer(newRouter(orch, guard))
+	defer server.Close()
+	request := func(method string, suffix string, token string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+"/"+suffix, strings.NewReader("{}"))
+		if err != nil {
+			panic(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	cases := []struct {
+		method   string
+		suffix   string
+		token    string
+		expected int
+	}{
+		{http.MethodGet, "dags", "", http.StatusUnauthorized},
+		{http.MethodGet, "dags", "wrong-token", http.StatusUnauthorized},
+		{http.MethodOptions, "dags", "", http.StatusOK},
+		{http.MethodGet, "dag/private", "viewer-token", http.StatusOK},
+		{http.MethodGet, "dag/test2", "viewer-token", http.StatusForbidden},
+		{http.MethodPut, "dag/private/toggle", "viewer-token", http.StatusForbidden},
+		{http.MethodPost, "dag", "viewer-token", http.StatusForbidden},
+		{http.MethodPost, "dag", "operator-token", http.StatusForbidden},
+		{http.MethodPut, "dag/test2/toggle", "operator-token", http.StatusOK},
+		{http.MethodPut, "dag/test2/toggle", "operator-token", http.StatusOK},
+		{http.MethodGet, "audit", "operator-token", http.StatusForbidden},
+	}
+	for _, testCase := range cases {
+		resp := request(testCase.method, testCase.suffix, testCase.token)
+		if resp.StatusCode != testCase.expected {
+			t.Errorf(
+				"%s /%s with token %q: expected %d, found %d",
+				testCase.method,
+				testCase.suffix,
+				testCase.token,
+				testCase.expected,
+				resp.StatusCode,
+			)
+		}
+	}
+
+	_, toggles := orch.RetrieveAuditEvents(audittable.Filter{Actor: "operator", Action: audittable.ActionDAGToggle})
+	if toggles != 2 {
+		t.Errorf("Expected 2 toggles audited for the operator, found %d", toggles)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/dags", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	dags := make([]map[string]interface{}, 0)
+	err = json.Unmarshal(readRespBytes(resp), &dags)
+	if err != nil {
+		panic(err)
+	}
+	if len(dags) != 1 {
+		t.Errorf("Expected the viewer to only see one DAG, found %d", len(dags))
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key for localhost to dir
+func writeCertificate(dir string, commonName string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	certFile = path.Join(dir, commonName+".crt")
+	keyFile = path.Join(dir, commonName+".key")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goflow-tls")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(dir, "server")
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+	first, err := reloader.currentCertificate()
+	if err != nil {
+		panic(err)
+	}
+
+	newCertFile, newKeyFile := writeCertificate(dir, "rotated")
+	os.Rename(newCertFile, certFile)
+	os.Rename(newKeyFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	second, err := reloader.currentCertificate()
+	if err != nil {
+		panic(err)
+	}
+	if first == second {
+		t.Errorf("Expected the certificate to be reloaded after the files changed")
+	}
+
+	os.Remove(keyFile)
+	third, err := reloader.currentCertificate()
+	if err != nil || third != second {
+		t.Errorf("Expected the previous certificate to be kept when reloading fails")
+	}
+}
+
+func TestServeTLSWithClientCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goflow-tls")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	serverCert, serverKey := writeCertificate(dir, "server")
+	clientCert, clientKey := writeCertificate(dir, "client")
+	tlsConfig, err := newTLSConfig(&config.ServerConfig{
+		TLSCertFile:       serverCert,
+		TLSKeyFile:        serverKey,
+		ClientCAFile:      clientCert,
+		RequireClientCert: true,
+	})
+	if err != nil {
+		panic(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+		}),
+		TLSConfig: tlsConfig,
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	serverURL := "https://" + listener.Addr().String()
+
+	serverCAs := x509.NewCertPool()
+	serverCertBytes, err := ioutil.ReadFile(serverCert)
+	if err != nil {
+		panic(err)
+	}
+	serverCAs.AppendCertsFromPEM(serverCertBytes)
+	clientPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		panic(err)
+	}
+	newClient := func(certificates []tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      serverCAs,
+			Certificates: certificates,
+		}}}
+	}
+
+	resp, err := newClient([]tls.Certificate{clientPair}).Get(serverURL)
+	if err != nil {
+		t.Fatalf("Expected request with a client certificate to succeed: %s", err.Error())
+	}
+	if body := string(readRespBytes(resp)); body != "client" {
+		t.Errorf("Expected the client certificate to be verified, found %s", body)
+	}
+	_, err = newClient(nil).Get(serverURL)
+	if err == nil {
+		t.Errorf("Expected request without a client certificate to be rejected")
+	}
+}
+
+func TestServeShutsDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErrors := make(chan error, 1)
+	go func() { serveErrors <- Serve(ctx, host, port+1, orch) }()
+	resp, err := httpretry.Get(fmt.Sprintf("http://%s:%d/dags", host, port+1))
+	if err != nil {
+		panic(err)
+	}
+	errorCodeResponse(t, http.StatusOK, resp.StatusCode)
+	cancel()
+	select {
+	case err := <-serveErrors:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, found %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Server did not shut down")
+	}
+}
+
+func TestServerDrainsRequestsAndEndsStreams(t *testing.T) {
+	started := make(chan struct{}, 2)
+	router := http.NewServeMux()
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-time.After(100 * time.Millisecond):
+			fmt.Fprint(w, "drained")
+		case <-r.Context().Done():
+		}
+	})
+	router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := streamContext(r)
+		defer cancel()
+		started <- struct{}{}
+		<-ctx.Done()
+	})
+	server, err := newServer(fmt.Sprintf("%s:%d", host, port+2), router, nil)
+	if err != nil {
+		panic(err)
+	}
+	go server.ListenAndServe()
+	bodies := make(chan string, 2)
+	for _, path := range []string{"slow", "stream"} {
+		url := fmt.Sprintf("http://%s:%d/%s", host, port+2, path)
+		go func() {
+			resp, err := httpretry.Get(url)
+			if err != nil {
+				bodies <- err.Error()
+				return
+			}
+			bodies <- string(readRespBytes(resp))
+		}()
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Expected open streams to end on shutdown, found %s", err.Error())
+	}
+	if found := (<-bodies) + (<-bodies); found != "drained" {
+		t.Errorf("Expected the slow request to be drained and the stream to end, found %q", found)
+	}
+}
+
+func TestGetMissingDagMetrics(t *testing.T) {
+	resp := get("dag/fake_dag/metrics")
+	bodyBytes := readRespBytes(resp)
+	errorCodeResponse(t, http.StatusBadRequest, resp.StatusCode)
+	message := ""
+	if err := json.Unmarshal(bodyBytes, &message); err != nil {
+		t.Errorf("Expected only the error message, found %s", bodyBytes)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	values := []int{5, 3, 9, 1, 7}
+	keyOf := func(i int) []string { return []string{fmt.Sprintf("%02d", values[i])} }
+	for _, descending := range []bool{false, true} {
+		query := pageQuery{Sort: "value", Descending: descending, Limit: 2}
+		found := make([]int, 0)
+		for page := 0; page < len(values); page++ {
+			indexes, nextCursor := paginate(len(values), keyOf, query)
+			for _, i := range indexes {
+				found = append(found, values[i])
+			}
+			if nextCursor == "" {
+				break
+			}
+			pageCursor := cursor{}
+			cursorBytes, _ := base64.RawURLEncoding.DecodeString(nextCursor)
+			json.Unmarshal(cursorBytes, &pageCursor)
+			query.After = pageCursor.Key
+		}
+		expected := []int{1, 3, 5, 7, 9}
+		if descending {
+			expected = []int{9, 7, 5, 3, 1}
+		}
+		if !cmp.Equal(found, expected) {
+			t.Errorf("Expected pages to hold %v, found %v", expected, found)
+		}
+	}
+}
+
+func getAPIV1(t *testing.T, suffix string, expectedCode int, body interface{}) {
+	resp := get("api/v1/" + suffix)
+	errorCodeResponse(t, expectedCode, resp.StatusCode)
+	bodyBytes := readRespBytes(resp)
+	if err := json.Unmarshal(bodyBytes, body); err != nil {
+		t.Errorf("Could not parse response %s: %s", bodyBytes, err)
+	}
+}
+
+func TestAPIV1Errors(t *testing.T) {
+	for _, testCase := range []struct {
+		suffix       string
+		expectedCode int
+		errorCode    string
+	}{
+		{"dags/fake_dag", http.StatusNotFound, "not_found"},
+		{"dags?sort=size", http.StatusBadRequest, "bad_request"},
+		{"dags?cursor=invalid", http.StatusBadRequest, "bad_request"},
+		{"runs?since=yesterday", http.StatusBadRequest, "bad_request"},
+		{"dags?label=team", http.StatusBadRequest, "bad_request"},
+		{"unknown", http.StatusNotFound, "not_found"},
+	} {
+		envelope := errorEnvelope{}
+		getAPIV1(t, testCase.suffix, testCase.expectedCode, &envelope)
+		if envelope.Error.Code != testCase.errorCode || envelope.Error.Message == "" {
+			t.Errorf("Expected error code %s for %s, found %v", testCase.errorCode, testCase.suffix, envelope)
+		}
+	}
+
+	resp := put("api/v1/dags", "")
+	errorCodeResponse(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestAPIV1ListDAGs(t *testing.T) {
+	names := make([]string, 0)
+	page := dagPageV1{}
+	getAPIV1(t, "dags?limit=1&sort=-namespace", http.StatusOK, &page)
+	for {
+		if len(page.Items) > 1 {
+			t.Fatalf("Expected pages with at most 1 DAG, found %v", page.Items)
+		}
+		for _, dag := range page.Items {
+			names = append(names, dag.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursorString := page.NextCursor
+		page = dagPageV1{}
+		getAPIV1(t, "dags?limit=1&sort=-namespace&cursor="+cursorString, http.StatusOK, &page)
+	}
+	// The test DAGs share their configuration, so only distinct names are paged through
+	distinctNames := make(map[string]bool)
+	for _, dag := range orch.DAGs() {
+		distinctNames[dag.Config.Name] = true
+	}
+	if len(names) != len(distinctNames) {
+		t.Errorf("Expected to page through %d DAGs, found %v", len(distinctNames), names)
+	}
+
+	page = dagPageV1{}
+	getAPIV1(t, "dags?label=team=none", http.StatusOK, &page)
+	if len(page.Items) != 0 || page.NextCursor != "" {
+		t.Errorf("Expected no DAGs to match the label, found %v", page.Items)
+	}
+
+	envelope := errorEnvelope{}
+	getAPIV1(t, "dags?limit=1&sort=name&cursor="+encodeCursor("-name", []string{"test"}), http.StatusBadRequest, &envelope)
+}
+
+func TestAPIV1ListRuns(t *testing.T) {
+	dagRunTableClient := dagruntable.NewTableClient(database.NewSQLiteClient(testutils.GetSQLiteLocation()))
+	rows := make([]dagruntable.Row, 0)
+	for i, status := range []string{"Succeeded", "Failed", "Running"} {
+		row := dagruntable.NewRow(
+			testDag.ID,
+			fmt.Sprintf("api-run-%d", i),
+			dagruntable.TriggerScheduled,
+			status,
+			time.Date(2030, 1, i+1, 0, 0, 0, 0, time.UTC),
+		)
+		row.Cluster = "east"
+		dagRunTableClient.UpsertDagRun(row)
+		rows = append(rows, row)
+	}
+	since := rows[0].ExecutionDate.Format(time.RFC3339)
+
+	page := runPageV1{}
+	getAPIV1(t, "runs?limit=2&since="+since, http.StatusOK, &page)
+	if len(page.Items) != 2 || page.Items[0].ID != rows[2].RunID || page.Items[1].ID != rows[1].RunID {
+		t.Errorf("Expected the 2 most recent runs, found %v", page.Items)
+	}
+	if page.Counts["Succeeded"] != 1 || page.Counts["Failed"] != 1 || page.Counts["Running"] != 1 {
+		t.Errorf("Expected 1 run per status, found %v", page.Counts)
+	}
+	cursorString := page.NextCursor
+	page = runPageV1{}
+	getAPIV1(t, "runs?limit=2&since="+since+"&cursor="+cursorString, http.StatusOK, &page)
+	if len(page.Items) != 1 || page.Items[0].ID != rows[0].RunID || page.NextCursor != "" {
+		t.Errorf("Expected the oldest run on the last page, found %v", page.Items)
+	}
+
+	page = runPageV1{}
+	getAPIV1(
+		t,
+		fmt.Sprintf("dags/%s/runs?status=failed,running&trigger=scheduled&since=%s", testDag.Config.Name, since),
+		http.StatusOK,
+		&page,
+	)
+	if len(page.Items) != 2 || page.Counts["Succeeded"] != 0 {
+		t.Errorf("Expected the failed and running runs, found %v", page.Items)
+	}
+
+	page = runPageV1{}
+	getAPIV1(t, "runs?trigger=manual&since="+since, http.StatusOK, &page)
+	if len(page.Items) != 0 {
+		t.Errorf("Expected no manual runs, found %v", page.Items)
+	}
+
+	run := runV1{}
+	getAPIV1(t, fmt.Sprintf("dags/%s/runs/%s", testDag.Config.Name, rows[0].RunID), http.StatusOK, &run)
+	if run.ID != rows[0].RunID || run.Status != "Succeeded" || run.Trigger != dagruntable.TriggerScheduled ||
+		run.Cluster != "east" {
+		t.Errorf("Expected run %s, found %v", rows[0].RunID, run)
+	}
+}
+
+func TestAPIV1WaitingRun(t *testing.T) {
+	dagRunTableClient := dagruntable.NewTableClient(database.NewSQLiteClient(testutils.GetSQLiteLocation()))
+	testDag.Config.WaitFor = []dagconfig.WaitFor{{DAG: "upstream", OffsetSeconds: -86400}}
+	defer func() { testDag.Config.WaitFor = nil }()
+	row := dagruntable.NewRow(
+		testDag.ID,
+		"api-waiting-run",
+		dagruntable.TriggerScheduled,
+		string(dagrun.PhaseWaiting),
+		time.Date(2031, 1, 2, 0, 0, 0, 0, time.UTC),
+	)
+	dagRunTableClient.UpsertDagRun(row)
+
+	run := runV1{}
+	getAPIV1(t, fmt.Sprintf("dags/%s/runs/%s", testDag.Config.Name, row.RunID), http.StatusOK, &run)
+	if len(run.WaitingFor) != 1 {
+		t.Fatalf("Expected the run to wait for upstream, found %v", run)
+	}
+	dependency := run.WaitingFor[0]
+	if dependency.DAG != "upstream" || dependency.Met || dependency.RequiredStatus != "Succeeded" ||
+		!dependency.ExecutionDate.Equal(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the unmet run of upstream on the previous day, found %v", dependency)
+	}
+}
+
+func TestAPIV1SensingRun(t *testing.T) {
+	testDag.Config.Sensors = []dagconfig.SensorConfig{
+		{Name: "input", Kind: dagconfig.SensorFile, Path: "/nonexistent/_SUCCESS"},
+	}
+	defer func() { testDag.Config.Sensors = nil }()
+	dagRun := testDag.AddDagRun(time.Date(2032, 1, 1, 0, 0, 0, 0, time.UTC), false)
+	testDag.ActiveRuns.Inc()
+	done := make(chan struct{})
+	go func() {
+		dagRun.Start()
+		close(done)
+	}()
+	defer func() {
+		dagRun.Cancel()
+		<-done
+	}()
+	for states := dagRun.SensorStates(); len(states) == 0 || states[0].Pokes == 0; states = dagRun.SensorStates() {
+		time.Sleep(time.Millisecond)
+	}
+
+	run := runV1{}
+	getAPIV1(t, fmt.Sprintf("dags/%s/runs/%s", testDag.Config.Name, dagRun.Name), http.StatusOK, &run)
+	if run.Status != string(dagrun.PhaseSensing) || len(run.Sensors) != 1 {
+		t.Fatalf("Expected the run to be sensing, found %v", run)
+	}
+	if state := run.Sensors[0]; state.Name != "input" || state.Satisfied || state.Pokes != 1 {
+		t.Errorf("Expected the unsatisfied input sensor poked once, found %v", state)
+	}
+}
+
+func TestAPIV1SchedulerQueue(t *testing.T) {
+	testDag.Config.Schedule = "0 0 0 * * *"
+	defer func() { testDag.Config.Schedule = "" }()
+	orch.RunDags()
+
+	queue := schedulerQueueV1{}
+	getAPIV1(t, "scheduler/queue?dag="+testDag.Config.Name, http.StatusOK, &queue)
+	if len(queue.Items) == 0 {
+		t.Fatal("Expected the due run of the paused DAG")
+	}
+	for _, decision := range queue.Items {
+		if decision.Reason != orchestrator.ReasonPaused || decision.RunID != "" ||
+			!decision.ExecutionDate.Equal(testDag.StartDateTime) {
+			t.Errorf("Expected the first run of the DAG to be held as paused, found %v", decision)
+		}
+	}
+	getAPIV1(t, "scheduler/queue?reason="+orchestrator.ReasonPoolFull, http.StatusOK, &queue)
+	if len(queue.Items) != 0 {
+		t.Errorf("Expected no runs waiting for a pool, found %v", queue.Items)
+	}
+}
+
+func TestAPIV1Leader(t *testing.T) {
+	leader := leaderV1{}
+	getAPIV1(t, "leader", http.StatusOK, &leader)
+	if !leader.IsLeader || leader.Leader != "" {
+		t.Errorf("Expected a replica without leader election to lead, found %v", leader)
+	}
+}
+
+func TestAPIV1Shards(t *testing.T) {
+	shards := shardsV1{}
+	getAPIV1(t, "shards", http.StatusOK, &shards)
+	if shards.Instance != "" || len(shards.Items) != 0 {
+		t.Errorf("Expected no shards without sharding, found %v", shards)
+	}
+}
+
+func TestAPIV1TriggerAndCancel(t *testing.T) {
+	SQLCLIENT := database.NewSQLiteClient(testutils.GetSQLiteLocation())
+	triggerDag := dagtype.CreateDAG(&dagconfig.DAGConfig{
+		Name:          "trigger-test",
+		Namespace:     "default",
+		StartDateTime: "2019-01-01",
+		MaxActiveRuns: 1,
+	}, "", orch.Executors(), dagtype.ScheduleCache{}, dagtable.NewTableClient(SQLCLIENT), "",
+		dagruntable.NewTableClient(SQLCLIENT), nil, nil, nil, nil, nil, false)
+	orch.AddDAG(&triggerDag)
+
+	resp := put("api/v1/dags/trigger-test/trigger", "")
+	errorCodeResponse(t, http.StatusAccepted, resp.StatusCode)
+	run := runV1{}
+	if err := json.Unmarshal(readRespBytes(resp), &run); err != nil {
+		t.Fatalf("Could not parse triggered run: %s", err)
+	}
+	if run.DAG != "trigger-test" || run.Trigger != dagruntable.TriggerManual || run.ID == "" {
+		t.Errorf("Expected a manual run of trigger-test, found %v", run)
+	}
+	resp = put("api/v1/dags/trigger-test/trigger", "")
+	errorCodeResponse(t, http.StatusConflict, resp.StatusCode)
+
+	resp = put(fmt.Sprintf("api/v1/dags/trigger-test/runs/%s/cancel", run.ID), "")
+	errorCodeResponse(t, http.StatusAccepted, resp.StatusCode)
+	resp = put("api/v1/dags/trigger-test/runs/unknown/cancel", "")
+	errorCodeResponse(t, http.StatusNotFound, resp.StatusCode)
+
+	events, _ := orch.RetrieveAuditEvents(audittable.Filter{DagName: "trigger-test"})
+	if len(events) != 2 || events[0].Action != audittable.ActionRunCancel || events[1].Action != audittable.ActionRunTrigger {
+		t.Errorf("Expected the trigger and cancel to be audited, found %v", events)
+	}
+}
+
+func TestAPIV1ListMetrics(t *testing.T) {
+	metricsClient := metricstable.NewTableClient(database.NewSQLiteClient(testutils.GetSQLiteLocation()))
+	for i := 0; i < 3; i++ {
+		metricsClient.InsertMetric(metricstable.NewRow(
+			0, testDag.ID, testDag.Config.Name, "api-run", "api-pod", "task", 1, 100, 200, testTime,
+		))
+	}
+	ids := make([]int, 0)
+	page := metricPageV1{}
+	getAPIV1(t, "metrics?run=api-run&limit=2", http.StatusOK, &page)
+	for _, metric := range page.Items {
+		ids = append(ids, metric.ID)
+	}
+	if page.NextCursor == "" {
+		t.Fatalf("Expected a second page of metrics")
+	}
+	cursorString := page.NextCursor
+	page = metricPageV1{}
+	getAPIV1(t, "metrics?run=api-run&limit=2&cursor="+cursorString, http.StatusOK, &page)
+	for _, metric := range page.Items {
+		ids = append(ids, metric.ID)
+	}
+	if len(ids) != 3 || ids[0] >= ids[1] || ids[1] >= ids[2] || page.NextCursor != "" {
+		t.Errorf("Expected 3 metrics in insertion order over 2 pages, found ids %v", ids)
+	}
+}
+
+func TestAPIV1OpenAPIDocument(t *testing.T) {
+	document := struct {
+		Paths      map[string]map[string]interface{}
+		Components struct{ Schemas map[string]interface{} }
+	}{}
+	getAPIV1(t, "openapi.json", http.StatusOK, &document)
+	for _, route := range apiV1Routes(orch) {
+		if _, ok := document.Paths[apiV1Prefix+route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("Expected %s %s to be documented", route.Method, route.Path)
+		}
+	}
+	for _, schema := range []string{"Dag", "DagPage", "Run", "Metric", "ErrorEnvelope", "DAGConfig"} {
+		if _, ok := document.Components.Schemas[schema]; !ok {
+			t.Errorf("Expected schema %s to be documented", schema)
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package rest
 
 import (
+	"context"
 	"fmt"
+	"goflow/internal/auth"
+	"goflow/internal/config"
 	"goflow/internal/dag/orchestrator"
+	"goflow/internal/logs"
+	"goflow/telemetry"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -13,18 +20,138 @@ func setHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 }
 
-// Serve registers handlers and starts the goflow webserver
-func Serve(host string, port int, orchestrator *orchestrator.Orchestrator) {
+// newRouter returns the router of the goflow webserver
+// Requests are authenticated and authorized when a guard is given
+func newRouter(orchestrator *orchestrator.Orchestrator, guard *auth.Guard) *mux.Router {
 	router := mux.NewRouter()
 	router.Methods(http.MethodOptions).HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			setHeaders(w)
 			w.Header().Set("Access-Control-Allow-Methods", http.MethodPut)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
 		},
 	)
+	if guard != nil {
+		guard.SetErrorWriter(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			writeRequestError(w, r, status, err.Error())
+		})
+		router.Use(guard.Middleware, authorizationMiddleware(orchestrator))
+	}
+	router.Use(leaderMiddleware(orchestrator))
 	registerGetHandles(orchestrator, router)
 	registerPostHandles(orchestrator, router)
 	registerPutHandles(orchestrator, router)
-	http.Handle("/", router)
-	http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), router)
+	registerAuditHandles(orchestrator, router)
+	registerSLAHandles(orchestrator, router)
+	registerDatasetHandles(orchestrator, router)
+	registerPoolHandles(orchestrator, router)
+	registerAPIV1Handles(orchestrator, router)
+	router.Handle("/metrics", telemetry.Handler()).Methods(http.MethodGet)
+	return router
+}
+
+// defaultReadHeaderTimeout bounds how long clients may take to send request headers
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// defaultIdleTimeout bounds how long idle keep-alive connections are kept open
+const defaultIdleTimeout = 120 * time.Second
+
+func secondsOrDefault(seconds int, defaultDuration time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultDuration
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// shutdownContextKey is the context key of the context that is done once the server shuts down
+type shutdownContextKey struct{}
+
+// streamContext returns a context for streaming a response that is done once the request is or
+// the server shuts down, since Shutdown waits for streams that would otherwise never end
+func streamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	shutdownCtx, ok := r.Context().Value(shutdownContextKey{}).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-shutdownCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// newServer returns the http server for the router, applying the configured timeouts and TLS
+// The write timeout is disabled by default since it would cut off log streams
+func newServer(
+	address string,
+	router http.Handler,
+	serverConfig *config.ServerConfig,
+) (*http.Server, error) {
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:              address,
+		Handler:           router,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), shutdownContextKey{}, shutdownCtx)
+		},
+	}
+	server.RegisterOnShutdown(shutdown)
+	if serverConfig == nil {
+		return server, nil
+	}
+	server.ReadTimeout = secondsOrDefault(serverConfig.ReadTimeoutSeconds, 0)
+	server.WriteTimeout = secondsOrDefault(serverConfig.WriteTimeoutSeconds, 0)
+	server.IdleTimeout = secondsOrDefault(serverConfig.IdleTimeoutSeconds, defaultIdleTimeout)
+	if serverConfig.TLSEnabled() {
+		tlsConfig, err := newTLSConfig(serverConfig)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsConfig
+	}
+	return server, nil
+}
+
+// Serve registers handlers and runs the goflow webserver until the context is done, then
+// drains open requests for up to the configured shutdown timeout, ending open streams
+func Serve(ctx context.Context, host string, port int, orchestrator *orchestrator.Orchestrator) error {
+	var guard *auth.Guard
+	goflowConfig := orchestrator.Config()
+	if goflowConfig.Auth.Enabled() {
+		var err error
+		guard, err = auth.New(*goflowConfig.Auth)
+		if err != nil {
+			return err
+		}
+	} else {
+		logs.WarningLogger.Println("No authentication is configured, the REST API is open to anyone")
+	}
+	router := newRouter(orchestrator, guard)
+	server, err := newServer(fmt.Sprintf("%s:%d", host, port), router, goflowConfig.Server)
+	if err != nil {
+		return err
+	}
+	serveErrors := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serveErrors <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serveErrors <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErrors:
+		return err
+	case <-ctx.Done():
+	}
+	logs.InfoLogger.Println("Shutting down REST server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), goflowConfig.ShutdownTimeout())
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
 }
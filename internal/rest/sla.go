@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"goflow/internal/dag/orchestrator"
+	slatable "goflow/internal/dag/sql/sla"
+	"goflow/internal/jsonpanic"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultSLAMissLimit and maxSLAMissLimit bound the number of SLA misses returned
+const defaultSLAMissLimit = 100
+const maxSLAMissLimit = 1000
+
+// getSLAMissFilter returns the filter of the SLA misses of the DAGs the principal of the request
+// may view, narrowed down to the DAG given by the dag query parameter
+func getSLAMissFilter(orch *orchestrator.Orchestrator, r *http.Request) (slatable.Filter, int, error) {
+	queryInts, err := getQueryInts(r, "limit")
+	if err != nil {
+		return slatable.Filter{}, http.StatusBadRequest, err
+	}
+	filter := slatable.Filter{Limit: queryInts["limit"]}
+	if filter.Limit == 0 {
+		filter.Limit = defaultSLAMissLimit
+	}
+	if filter.Limit > maxSLAMissLimit {
+		filter.Limit = maxSLAMissLimit
+	}
+	dagName := r.URL.Query().Get("dag")
+	for _, dag := range visibleDAGs(r, orch.DAGs()) {
+		if dagName == "" || dag.Config.Name == dagName {
+			filter.DagNames = append(filter.DagNames, dag.Config.Name)
+		}
+	}
+	if dagName != "" && len(filter.DagNames) == 0 {
+		dag := orch.GetDag(dagName)
+		if dag == nil {
+			return slatable.Filter{}, http.StatusNotFound, errors.New("there is no DAG with given name")
+		}
+		return slatable.Filter{}, http.StatusForbidden, errors.New(forbiddenMsg)
+	}
+	return filter, http.StatusOK, nil
+}
+
+func registerSLAHandles(orch *orchestrator.Orchestrator, router *mux.Router) {
+	router.HandleFunc("/sla-misses", func(w http.ResponseWriter, r *http.Request) {
+		setHeaders(w)
+		filter, status, err := getSLAMissFilter(orch, r)
+		if err != nil {
+			w.WriteHeader(status)
+			fmt.Fprint(w, jsonpanic.JSONPanic(err.Error()))
+			return
+		}
+		misses := make([]slatable.Row, 0)
+		// Without DAG names the filter would match the misses of every DAG
+		if len(filter.DagNames) > 0 {
+			misses = orch.RetrieveSLAMisses(filter)
+		}
+		fmt.Fprint(w, jsonpanic.JSONPanic(misses))
+	}).Methods(http.MethodGet)
+}
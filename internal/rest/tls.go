@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"goflow/internal/config"
+	"goflow/internal/logs"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateReloader serves a key pair from disk, reloading it when either file changes
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	lock        *sync.Mutex
+	modTimes    [2]time.Time
+	certificate *tls.Certificate
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, lock: &sync.Mutex{}}
+	_, err := reloader.currentCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (reloader *certificateReloader) fileModTimes() ([2]time.Time, error) {
+	modTimes := [2]time.Time{}
+	for i, file := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// currentCertificate returns the key pair, reloading it if the files were modified
+// If reloading fails the previous key pair is kept
+func (reloader *certificateReloader) currentCertificate() (*tls.Certificate, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	modTimes, err := reloader.fileModTimes()
+	if err == nil && reloader.certificate != nil && modTimes == reloader.modTimes {
+		return reloader.certificate, nil
+	}
+	if err == nil {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+		if err == nil {
+			logs.InfoLogger.Printf("Loaded TLS certificate %s\n", reloader.certFile)
+			reloader.certificate = &certificate
+			reloader.modTimes = modTimes
+			return reloader.certificate, nil
+		}
+	}
+	if reloader.certificate == nil {
+		return nil, err
+	}
+	logs.ErrorLogger.Printf("Could not reload TLS certificate, keeping the previous one: %s", err.Error())
+	return reloader.certificate, nil
+}
+
+func (reloader *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return reloader.currentCertificate()
+}
+
+// newTLSConfig returns the TLS configuration for the server, verifying client certificates
+// against the client CA when one is configured
+func newTLSConfig(serverConfig *config.ServerConfig) (*tls.Config, error) {
+	reloader, err := newCertificateReloader(serverConfig.TLSCertFile, serverConfig.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+	if serverConfig.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	caBytes, err := ioutil.ReadFile(serverConfig.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", serverConfig.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if serverConfig.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
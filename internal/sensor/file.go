@@ -0,0 +1,17 @@
+package sensor
+
+import (
+	"context"
+	"os"
+)
+
+// fileSensor waits for the file at its path to exist
+type fileSensor string
+
+func (sensor fileSensor) Poke(ctx context.Context) (bool, error) {
+	_, err := os.Stat(string(sensor))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
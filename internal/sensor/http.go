@@ -0,0 +1,29 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// httpSensor waits for a URL to answer with status 200
+type httpSensor struct {
+	client *http.Client
+	url    string
+}
+
+func (sensor *httpSensor) Poke(ctx context.Context) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sensor.url, nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := sensor.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s answered %s", sensor.url, response.Status)
+	}
+	return true, nil
+}
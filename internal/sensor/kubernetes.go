@@ -0,0 +1,66 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dagconfig "goflow/internal/dag/config"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// objectSensor waits for a Kubernetes object to exist and reach the condition of its ref
+type objectSensor struct {
+	resource dynamic.ResourceInterface
+	object   dagconfig.ObjectRef
+}
+
+func newObjectSensor(client dynamic.Interface, object dagconfig.ObjectRef, namespace string) (*objectSensor, error) {
+	resource, err := object.GroupVersionResource()
+	if err != nil {
+		return nil, err
+	}
+	if object.Namespace != "" {
+		namespace = object.Namespace
+	}
+	return &objectSensor{client.Resource(resource).Namespace(namespace), object}, nil
+}
+
+func (sensor *objectSensor) Poke(ctx context.Context) (bool, error) {
+	object, err := sensor.resource.Get(ctx, sensor.object.Name, k8sapi.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if sensor.object.Condition != "" && !hasCondition(object, sensor.object.Condition) {
+		return false, fmt.Errorf("%s does not have condition %s", sensor.object.Name, sensor.object.Condition)
+	}
+	if sensor.object.Field != "" {
+		value, found, err := unstructured.NestedFieldNoCopy(object.Object, strings.Split(sensor.object.Field, ".")...)
+		if err != nil {
+			return false, err
+		}
+		if !found || fmt.Sprint(value) != sensor.object.Value {
+			return false, fmt.Errorf("%s of %s is %v", sensor.object.Field, sensor.object.Name, value)
+		}
+	}
+	return true, nil
+}
+
+// hasCondition returns true if the status condition of the object with the type is true
+func hasCondition(object *unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, condition := range conditions {
+		fields, ok := condition.(map[string]interface{})
+		if ok && fields["type"] == conditionType && fields["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
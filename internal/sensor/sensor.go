@@ -0,0 +1,70 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	dagconfig "goflow/internal/dag/config"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// pokeTimeout bounds each poke of a sensor
+const pokeTimeout = 30 * time.Second
+
+// Sensor is a condition that dag runs wait for before they are submitted
+type Sensor interface {
+	// Poke returns true once the condition holds, errors explain why it does not hold yet
+	Poke(ctx context.Context) (bool, error)
+}
+
+// Factory builds the sensors of dag runs
+type Factory struct {
+	httpClient    *http.Client
+	dynamicClient dynamic.Interface
+}
+
+// NewFactory returns a factory whose Kubernetes sensors use the dynamic client, which may be nil
+// when Kubernetes is not available
+func NewFactory(dynamicClient dynamic.Interface) *Factory {
+	return &Factory{
+		httpClient:    &http.Client{Timeout: pokeTimeout},
+		dynamicClient: dynamicClient,
+	}
+}
+
+// Registry holds the sensor factories of the clusters DAG runs are submitted to, by cluster name,
+// the cluster of goflow having an empty name
+type Registry map[string]*Factory
+
+// Get returns the factory for the runs of the DAG, whose Kubernetes sensors look up objects in
+// the cluster of the DAG, nil if the cluster was not registered
+func (registry Registry) Get(dagConfig *dagconfig.DAGConfig) *Factory {
+	return registry[dagConfig.Cluster]
+}
+
+// New returns the sensor for the config, objects are looked up in the namespace when the config
+// does not name one
+func (factory *Factory) New(config dagconfig.SensorConfig, namespace string) (Sensor, error) {
+	switch config.Kind {
+	case dagconfig.SensorHTTP:
+		return &httpSensor{factory.httpClient, config.URL}, nil
+	case dagconfig.SensorFile:
+		return fileSensor(config.Path), nil
+	case dagconfig.SensorKubernetes:
+		if factory.dynamicClient == nil {
+			return nil, fmt.Errorf("sensor %s needs Kubernetes, which is not available", config.Name)
+		}
+		return newObjectSensor(factory.dynamicClient, *config.Object, namespace)
+	}
+	return nil, fmt.Errorf("sensor %s has unknown kind %q", config.Name, config.Kind)
+}
+
+// Poke pokes the sensor, giving up after pokeTimeout
+func Poke(sensor Sensor) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pokeTimeout)
+	defer cancel()
+	return sensor.Poke(ctx)
+}
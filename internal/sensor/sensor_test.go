@@ -0,0 +1,104 @@
+package sensor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dagconfig "goflow/internal/dag/config"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func pokeNew(t *testing.T, factory *Factory, config dagconfig.SensorConfig) bool {
+	sensor, err := factory.New(config, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	satisfied, _ := Poke(sensor)
+	return satisfied
+}
+
+func TestHTTPSensor(t *testing.T) {
+	ready := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	factory := NewFactory(nil)
+	config := dagconfig.SensorConfig{Name: "api", Kind: dagconfig.SensorHTTP, URL: server.URL}
+	if pokeNew(t, factory, config) {
+		t.Error("Expected the sensor not to be satisfied while the endpoint is unavailable")
+	}
+	ready = true
+	if !pokeNew(t, factory, config) {
+		t.Error("Expected the sensor to be satisfied once the endpoint answers 200")
+	}
+}
+
+func TestFileSensor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := dagconfig.SensorConfig{Name: "input", Kind: dagconfig.SensorFile, Path: filepath.Join(dir, "_SUCCESS")}
+	factory := NewFactory(nil)
+	if pokeNew(t, factory, config) {
+		t.Error("Expected the sensor not to be satisfied before the file exists")
+	}
+	if err := ioutil.WriteFile(config.Path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !pokeNew(t, factory, config) {
+		t.Error("Expected the sensor to be satisfied once the file exists")
+	}
+}
+
+func TestKubernetesSensor(t *testing.T) {
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "ingest", "namespace": "default"},
+		"status": map[string]interface{}{
+			"succeeded":  int64(1),
+			"conditions": []interface{}{map[string]interface{}{"type": "Complete", "status": "True"}},
+		},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "flags", "namespace": "other"},
+		"data":       map[string]interface{}{"ready": "false"},
+	}}
+	factory := NewFactory(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), job, configMap))
+	tables := []struct {
+		name     string
+		object   dagconfig.ObjectRef
+		expected bool
+	}{
+		{"exists", dagconfig.ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "ingest"}, true},
+		{"missing", dagconfig.ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "export"}, false},
+		{"condition", dagconfig.ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "ingest", Condition: "Complete"}, true},
+		{"false condition", dagconfig.ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "ingest", Condition: "Failed"}, false},
+		{"field", dagconfig.ObjectRef{APIVersion: "batch/v1", Resource: "jobs", Name: "ingest", Field: "status.succeeded", Value: "1"}, true},
+		{"other namespace", dagconfig.ObjectRef{APIVersion: "v1", Resource: "configmaps", Namespace: "other", Name: "flags", Field: "data.ready", Value: "true"}, false},
+	}
+	for _, table := range tables {
+		object := table.object
+		config := dagconfig.SensorConfig{Name: table.name, Kind: dagconfig.SensorKubernetes, Object: &object}
+		if satisfied := pokeNew(t, factory, config); satisfied != table.expected {
+			t.Errorf("%s: expected satisfied to be %t", table.name, table.expected)
+		}
+	}
+	if _, err := NewFactory(nil).New(dagconfig.SensorConfig{Kind: dagconfig.SensorKubernetes, Object: &tables[0].object}, "default"); err == nil {
+		t.Error("Expected Kubernetes sensors to need a dynamic client")
+	}
+}
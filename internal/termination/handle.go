@@ -1,18 +1,28 @@
 package termination
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
-// Handle calls a function on termination of the program
+// Handle calls a function on termination of the program by SIGINT or SIGTERM
 func Handle(termFunc func()) {
-	termChan := make(chan os.Signal)
-	signal.Notify(termChan, os.Interrupt)
+	termChan := make(chan os.Signal, 1)
+	signal.Notify(termChan, os.Interrupt, syscall.SIGTERM)
 
 	sig := <-termChan
+	signal.Stop(termChan)
 	fmt.Printf("Got %s signal. Aborting and calling term func...\n", sig)
 
 	termFunc()
 }
+
+// Context returns a context that is cancelled on termination of the program
+func Context(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	go Handle(cancel)
+	return ctx
+}
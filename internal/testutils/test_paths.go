@@ -45,3 +45,13 @@ func RemoveSQLiteDB() {
 		os.Remove(databaseFile)
 	}
 }
+
+// GetLogsFolder returns the folder where test task logs are stored
+func GetLogsFolder() string {
+	return filepath.Join(GetTestFolder(), "test_logs")
+}
+
+// RemoveLogs removes the test task logs folder if it exists
+func RemoveLogs() {
+	os.RemoveAll(GetLogsFolder())
+}
@@ -1,4 +1,4 @@
-nohup go run goflow.go -T &
+nohup go run goflow.go server -T &
 cd ui
 nohup yarn start &
 cd ..
\ No newline at end of file
@@ -0,0 +1,312 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a named metric family that can write itself in the Prometheus text format
+type Collector interface {
+	Name() string
+	Write(w io.Writer)
+}
+
+// labelKey joins label values into a single map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// labelString returns the {name="value",...} representation of the labels
+func labelString(names []string, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// sample is a single labelled value of a counter or gauge
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// valueVec holds the labelled values shared by counters and gauges
+type valueVec struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	lock       *sync.Mutex
+	samples    map[string]*sample
+}
+
+func newValueVec(name, help, metricType string, labelNames []string) valueVec {
+	return valueVec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		lock:       &sync.Mutex{},
+		samples:    make(map[string]*sample),
+	}
+}
+
+func (vec *valueVec) checkLabels(labelValues []string) {
+	if len(labelValues) != len(vec.labelNames) {
+		panic(fmt.Sprintf(
+			"metric %s expects %d label values, was given %d",
+			vec.name,
+			len(vec.labelNames),
+			len(labelValues),
+		))
+	}
+}
+
+// update applies the update function to the sample for the given label values
+func (vec *valueVec) update(labelValues []string, updateFunc func(*sample)) {
+	vec.checkLabels(labelValues)
+	key := labelKey(labelValues)
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	current, ok := vec.samples[key]
+	if !ok {
+		current = &sample{labelValues: append([]string{}, labelValues...)}
+		vec.samples[key] = current
+	}
+	updateFunc(current)
+}
+
+// Get returns the current value for the given label values
+func (vec *valueVec) Get(labelValues ...string) float64 {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	current, ok := vec.samples[labelKey(labelValues)]
+	if !ok {
+		return 0
+	}
+	return current.value
+}
+
+// Name returns the name of the metric family
+func (vec *valueVec) Name() string {
+	return vec.name
+}
+
+func (vec *valueVec) sortedKeys() []string {
+	keys := make([]string, 0, len(vec.samples))
+	for key := range vec.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Write writes the metric family in the Prometheus text format
+func (vec *valueVec) Write(w io.Writer) {
+	vec.lock.Lock()
+	defer vec.lock.Unlock()
+	writeHeader(w, vec.name, vec.help, vec.metricType)
+	for _, key := range vec.sortedKeys() {
+		current := vec.samples[key]
+		fmt.Fprintf(
+			w,
+			"%s%s %s\n",
+			vec.name,
+			labelString(vec.labelNames, current.labelValues),
+			formatFloat(current.value),
+		)
+	}
+}
+
+// CounterVec is a monotonically increasing metric partitioned by labels
+type CounterVec struct {
+	valueVec
+}
+
+// NewCounterVec returns a new counter with the given label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newValueVec(name, help, "counter", labelNames)}
+}
+
+// Inc increments the counter for the given label values by one
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by a non-negative amount
+func (counter *CounterVec) Add(amount float64, labelValues ...string) {
+	if amount < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", counter.name))
+	}
+	counter.update(labelValues, func(current *sample) { current.value += amount })
+}
+
+// GaugeVec is a metric partitioned by labels that can go up and down
+type GaugeVec struct {
+	valueVec
+}
+
+// NewGaugeVec returns a new gauge with the given label names
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newValueVec(name, help, "gauge", labelNames)}
+}
+
+// Set sets the gauge for the given label values
+func (gauge *GaugeVec) Set(value float64, labelValues ...string) {
+	gauge.update(labelValues, func(current *sample) { current.value = value })
+}
+
+// Reset removes all label values from the gauge
+func (gauge *GaugeVec) Reset() {
+	gauge.lock.Lock()
+	gauge.samples = make(map[string]*sample)
+	gauge.lock.Unlock()
+}
+
+// histogramSample holds the bucket counts for a single set of label values
+type histogramSample struct {
+	labelValues  []string
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// HistogramVec counts observations into configurable buckets, partitioned by labels
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	lock       *sync.Mutex
+	samples    map[string]*histogramSample
+}
+
+// DefaultBuckets are the default histogram buckets, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewHistogramVec returns a new histogram with the given upper bucket bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+	return &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    sortedBuckets,
+		lock:       &sync.Mutex{},
+		samples:    make(map[string]*histogramSample),
+	}
+}
+
+// Name returns the name of the metric family
+func (histogram *HistogramVec) Name() string {
+	return histogram.name
+}
+
+// Observe adds a single observation to the histogram for the given label values
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(histogram.labelNames) {
+		panic(fmt.Sprintf(
+			"metric %s expects %d label values, was given %d",
+			histogram.name,
+			len(histogram.labelNames),
+			len(labelValues),
+		))
+	}
+	key := labelKey(labelValues)
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+	current, ok := histogram.samples[key]
+	if !ok {
+		current = &histogramSample{
+			labelValues:  append([]string{}, labelValues...),
+			bucketCounts: make([]uint64, len(histogram.buckets)),
+		}
+		histogram.samples[key] = current
+	}
+	for i, upperBound := range histogram.buckets {
+		if value <= upperBound {
+			current.bucketCounts[i]++
+		}
+	}
+	current.count++
+	current.sum += value
+}
+
+// Count returns the number of observations for the given label values
+func (histogram *HistogramVec) Count(labelValues ...string) uint64 {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+	current, ok := histogram.samples[labelKey(labelValues)]
+	if !ok {
+		return 0
+	}
+	return current.count
+}
+
+// Write writes the metric family in the Prometheus text format
+func (histogram *HistogramVec) Write(w io.Writer) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+	writeHeader(w, histogram.name, histogram.help, "histogram")
+	keys := make([]string, 0, len(histogram.samples))
+	for key := range histogram.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		current := histogram.samples[key]
+		for i, upperBound := range histogram.buckets {
+			fmt.Fprintf(
+				w,
+				"%s_bucket%s %d\n",
+				histogram.name,
+				labelString(histogram.labelNames, current.labelValues, "le", formatFloat(upperBound)),
+				current.bucketCounts[i],
+			)
+		}
+		fmt.Fprintf(
+			w,
+			"%s_bucket%s %d\n",
+			histogram.name,
+			labelString(histogram.labelNames, current.labelValues, "le", "+Inf"),
+			current.count,
+		)
+		labels := labelString(histogram.labelNames, current.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", histogram.name, labels, formatFloat(current.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", histogram.name, labels, current.count)
+	}
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func writeCollector(collector Collector) string {
+	buffer := new(bytes.Buffer)
+	collector.Write(buffer)
+	return buffer.String()
+}
+
+func expectLines(t *testing.T, output string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	counter := NewCounterVec("test_total", "Test counter.", "dag", "status")
+	counter.Inc("a", "Succeeded")
+	counter.Add(2, "a", "Succeeded")
+	counter.Inc("b\"", "Failed")
+	if counter.Get("a", "Succeeded") != 3 {
+		t.Errorf("Expected counter value 3, found %v", counter.Get("a", "Succeeded"))
+	}
+	expectLines(
+		t,
+		writeCollector(counter),
+		"# HELP test_total Test counter.",
+		"# TYPE test_total counter",
+		`test_total{dag="a",status="Succeeded"} 3`,
+		`test_total{dag="b\"",status="Failed"} 1`,
+	)
+}
+
+func TestCounterCannotDecrease(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Decreasing a counter should panic")
+		}
+	}()
+	NewCounterVec("test_total", "Test counter.").Add(-1)
+}
+
+func TestGaugeVec(t *testing.T) {
+	gauge := NewGaugeVec("test_gauge", "Test gauge.")
+	gauge.Set(4)
+	gauge.Set(2)
+	expectLines(t, writeCollector(gauge), "# TYPE test_gauge gauge", "test_gauge 2")
+}
+
+func TestHistogramVec(t *testing.T) {
+	histogram := NewHistogramVec("test_seconds", "Test histogram.", []float64{1, 0.5}, "loop")
+	histogram.Observe(0.2, "run")
+	histogram.Observe(0.7, "run")
+	histogram.Observe(3, "run")
+	if histogram.Count("run") != 3 {
+		t.Errorf("Expected 3 observations, found %d", histogram.Count("run"))
+	}
+	expectLines(
+		t,
+		writeCollector(histogram),
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{loop="run",le="0.5"} 1`,
+		`test_seconds_bucket{loop="run",le="1"} 2`,
+		`test_seconds_bucket{loop="run",le="+Inf"} 3`,
+		`test_seconds_sum{loop="run"} 3.9`,
+		`test_seconds_count{loop="run"} 3`,
+	)
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(NewGaugeVec("test_gauge", "Test gauge."))
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Registering a duplicate collector should panic")
+		}
+	}()
+	registry.Register(NewGaugeVec("test_gauge", "Test gauge."))
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	Default.Export(buffer)
+	expectLines(
+		t,
+		buffer.String(),
+		"# TYPE goflow_scheduler_loop_duration_seconds histogram",
+		"# TYPE goflow_dags_loaded gauge",
+		"# TYPE goflow_dag_import_errors gauge",
+		"# TYPE goflow_dag_active_runs gauge",
+		"# TYPE goflow_dag_runs_total counter",
+		"# TYPE goflow_dag_run_duration_seconds histogram",
+		"# TYPE goflow_pod_creation_failures_total counter",
+		"# TYPE goflow_db_query_duration_seconds histogram",
+	)
+}
@@ -0,0 +1,201 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry holds the collectors exported on a metrics endpoint
+type Registry struct {
+	lock       *sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{&sync.RWMutex{}, make(map[string]Collector)}
+}
+
+// Register adds collectors to the registry, panicking on duplicate names
+func (registry *Registry) Register(collectors ...Collector) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	for _, collector := range collectors {
+		if _, ok := registry.collectors[collector.Name()]; ok {
+			panic(fmt.Sprintf("collector %s is already registered", collector.Name()))
+		}
+		registry.collectors[collector.Name()] = collector
+	}
+}
+
+// Export writes all registered collectors in the Prometheus text format, sorted by name
+func (registry *Registry) Export(w io.Writer) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	names := make([]string, 0, len(registry.collectors))
+	for name := range registry.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		registry.collectors[name].Write(w)
+	}
+}
+
+// Handler returns an http handler serving the registry in the Prometheus text format
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.Export(w)
+	})
+}
+
+// SchedulerLoopDuration tracks how long each cycle of the orchestrator loops takes
+var SchedulerLoopDuration = NewHistogramVec(
+	"goflow_scheduler_loop_duration_seconds",
+	"Duration of a single cycle of an orchestrator loop.",
+	DefaultBuckets,
+	"loop",
+)
+
+// DAGsLoaded is the number of DAGs currently held by the orchestrator
+var DAGsLoaded = NewGaugeVec(
+	"goflow_dags_loaded",
+	"Number of DAGs currently loaded by the orchestrator.",
+)
+
+// DAGImportErrors is 1 for each DAG file that failed to load in the last collection
+var DAGImportErrors = NewGaugeVec(
+	"goflow_dag_import_errors",
+	"DAG files that failed to load in the last collection.",
+	"file",
+)
+
+// ActiveRuns is the number of active runs for each DAG
+var ActiveRuns = NewGaugeVec(
+	"goflow_dag_active_runs",
+	"Number of currently active runs for each DAG.",
+	"dag",
+)
+
+// RunOutcomes counts finished DAG runs by their final status
+var RunOutcomes = NewCounterVec(
+	"goflow_dag_runs_total",
+	"Number of finished DAG runs by final status.",
+	"dag",
+	"status",
+)
+
+// RunDuration tracks how long DAG runs take from start to finish
+var RunDuration = NewHistogramVec(
+	"goflow_dag_run_duration_seconds",
+	"Duration of finished DAG runs.",
+	[]float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 21600},
+	"dag",
+	"status",
+)
+
+// PodCreationFailures counts pods that could not be created for a DAG run
+var PodCreationFailures = NewCounterVec(
+	"goflow_pod_creation_failures_total",
+	"Number of pods that failed to be created for DAG runs.",
+	"dag",
+)
+
+// SLAMisses counts runs that had not succeeded when their SLA was due, by the reason they missed it
+var SLAMisses = NewCounterVec(
+	"goflow_sla_misses_total",
+	"Number of DAG runs that missed their SLA by reason.",
+	"dag",
+	"reason",
+)
+
+// DatasetEvents counts updates of datasets by their origin, runs of DAGs or external signals
+var DatasetEvents = NewCounterVec(
+	"goflow_dataset_events_total",
+	"Number of dataset update events by origin.",
+	"dataset",
+	"origin",
+)
+
+// NotificationDeliveries counts attempts at delivering notifications by channel and status
+var NotificationDeliveries = NewCounterVec(
+	"goflow_notification_deliveries_total",
+	"Number of attempts at delivering notifications by channel and status.",
+	"channel",
+	"status",
+)
+
+// PoolSlots is the number of slots of each pool
+var PoolSlots = NewGaugeVec(
+	"goflow_pool_slots",
+	"Number of slots of each pool.",
+	"pool",
+)
+
+// PoolOccupiedSlots is the number of slots of each pool taken by running DAG runs
+var PoolOccupiedSlots = NewGaugeVec(
+	"goflow_pool_occupied_slots",
+	"Number of slots of each pool taken by DAG runs.",
+	"pool",
+)
+
+// PoolQueuedRuns is the number of DAG runs queued for the slots of each pool
+var PoolQueuedRuns = NewGaugeVec(
+	"goflow_pool_queued_runs",
+	"Number of DAG runs queued for the slots of each pool.",
+	"pool",
+)
+
+// PendingRuns is the number of DAG runs that are due or waiting but not started, by the reason
+// given by the scheduler
+var PendingRuns = NewGaugeVec(
+	"goflow_scheduler_pending_runs",
+	"Number of DAG runs that are due or waiting but not started, by reason.",
+	"reason",
+)
+
+// DBQueryDuration tracks the latency of database queries
+var DBQueryDuration = NewHistogramVec(
+	"goflow_db_query_duration_seconds",
+	"Duration of database queries.",
+	DefaultBuckets,
+	"operation",
+)
+
+// Default is the registry holding all goflow collectors
+var Default = NewRegistry()
+
+func init() {
+	Default.Register(
+		SchedulerLoopDuration,
+		DAGsLoaded,
+		DAGImportErrors,
+		ActiveRuns,
+		RunOutcomes,
+		RunDuration,
+		PodCreationFailures,
+		SLAMisses,
+		DatasetEvents,
+		NotificationDeliveries,
+		PoolSlots,
+		PoolOccupiedSlots,
+		PoolQueuedRuns,
+		PendingRuns,
+		DBQueryDuration,
+	)
+}
+
+// Handler returns an http handler serving the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Since returns the seconds elapsed since the given time, for use in Observe calls
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}